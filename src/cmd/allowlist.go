@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/allowlist"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAllowlistInterval = 10 * time.Second
+	defaultAllowlistTimeout  = 10 * time.Second
+)
+
+// [berg.prefix-allowlist] section of the config file
+type allowlistConfig struct {
+	Path     string `toml:"path"`     // file the IPAM exports the allowlist to
+	Url      string `toml:"url"`      // HTTP endpoint serving the allowlist, instead of path
+	Format   string `toml:"format"`   // json or csv, taken from the file extension or the content type by default
+	Interval string `toml:"interval"` // how often the source is checked for changes
+	Timeout  string `toml:"timeout"`  // of HTTP requests
+}
+
+// nil means the allowlist is disabled
+func parseAllowlist(data []byte) (*allowlistConfig, error) {
+	var cfg bergConfigFile
+	if err := toml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Berg.PrefixAllowlist == nil {
+		return nil, nil
+	}
+	if err := cfg.Berg.PrefixAllowlist.validate(); err != nil {
+		return nil, fmt.Errorf("prefix allowlist: %w", err)
+	}
+	return cfg.Berg.PrefixAllowlist, nil
+}
+
+func (c allowlistConfig) validate() error {
+	if (c.Path == "") == (c.Url == "") {
+		return errors.New("either path or url is mandatory")
+	}
+	switch c.Format {
+	case "", allowlist.FormatJson, allowlist.FormatCsv:
+	default:
+		return fmt.Errorf("unknown format %q", c.Format)
+	}
+	if interval, err := parseOptionalDuration(c.Interval, defaultAllowlistInterval); err != nil || interval <= 0 {
+		return fmt.Errorf("invalid interval %q", c.Interval)
+	}
+	if _, err := parseOptionalDuration(c.Timeout, defaultAllowlistTimeout); err != nil {
+		return fmt.Errorf("invalid timeout: %w", err)
+	}
+	return nil
+}
+
+// The config is validated by parseAllowlist
+func (c allowlistConfig) newWatcher(logger *logrus.Logger) *allowlist.Watcher {
+	interval, _ := parseOptionalDuration(c.Interval, defaultAllowlistInterval)
+	var source allowlist.Source
+	if c.Path != "" {
+		source = allowlist.NewFileSource(c.Path, c.Format)
+	} else {
+		timeout, _ := parseOptionalDuration(c.Timeout, defaultAllowlistTimeout)
+		source = allowlist.NewHttpSource(c.Url, c.Format, timeout)
+	}
+	return allowlist.NewWatcher(source, interval, logger)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAllowlistConfig = `
+[global.config]
+  as = 65000
+  router-id = "10.0.0.1"
+
+[berg.prefix-allowlist]
+  url = "http://ipam.example.com/berg/allowlist"
+  format = "csv"
+  interval = "30s"
+  timeout = "5s"
+`
+
+func TestParseAllowlist(t *testing.T) {
+	cfg, err := parseAllowlist([]byte(testAllowlistConfig))
+
+	assert.NoError(t, err)
+	assert.Equal(t, &allowlistConfig{
+		Url: "http://ipam.example.com/berg/allowlist", Format: "csv", Interval: "30s", Timeout: "5s",
+	}, cfg)
+	assert.Equal(t, "http://ipam.example.com/berg/allowlist", cfg.newWatcher(logrus.New()).State().Source)
+}
+
+func TestParseAllowlist_Disabled(t *testing.T) {
+	cfg, err := parseAllowlist([]byte("[global.config]\n  as = 65000\n"))
+
+	assert.NoError(t, err)
+	assert.Nil(t, cfg)
+}
+
+func TestParseAllowlist_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"no source":        `format = "json"`,
+		"both sources":     "path = \"/etc/berg/allowlist.json\"\n  url = \"http://x\"",
+		"unknown format":   "path = \"/etc/berg/allowlist.json\"\n  format = \"xml\"",
+		"invalid interval": "path = \"/etc/berg/allowlist.json\"\n  interval = \"soon\"",
+		"zero interval":    "path = \"/etc/berg/allowlist.json\"\n  interval = \"0s\"",
+		"invalid timeout":  "url = \"http://x\"\n  timeout = \"soon\"",
+	}
+	for name, section := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseAllowlist([]byte("[berg.prefix-allowlist]\n  " + section))
+
+			assert.ErrorContains(t, err, "prefix allowlist")
+		})
+	}
+}
+
+func TestStripBergSections_Allowlist(t *testing.T) {
+	stripped, found, err := stripBergSections([]byte(testAllowlistConfig))
+
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.NotContains(t, string(stripped), "prefix-allowlist")
+}
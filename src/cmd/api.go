@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/amyasnikov/berg/internal/app"
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/logging"
+)
+
+// BergService backend, the application state plus config file handling
+type apiBackend struct {
+	*app.App
+	config     *Config
+	reloads    chan<- chan error
+	vrfChanges chan<- vrfChange
+	logs       *logging.Loggers
+}
+
+// Handled by the main loop, so it never races with the config file watcher
+func (b *apiBackend) Reload() error {
+	done := make(chan error, 1)
+	b.reloads <- done
+	return <-done
+}
+
+func (b *apiBackend) AddVrf(vrf dto.Vrf, persist bool) error {
+	return b.changeVrf(vrfChange{operation: vrfAdd, vrf: vrf, persist: persist})
+}
+
+func (b *apiBackend) UpdateVrf(vrf dto.Vrf, persist bool) error {
+	return b.changeVrf(vrfChange{operation: vrfUpdate, vrf: vrf, persist: persist})
+}
+
+func (b *apiBackend) DeleteVrf(name string, persist bool) error {
+	return b.changeVrf(vrfChange{operation: vrfDelete, vrf: dto.Vrf{Name: name}, persist: persist})
+}
+
+// Handled by the main loop as well
+func (b *apiBackend) changeVrf(change vrfChange) error {
+	change.done = make(chan error, 1)
+	b.vrfChanges <- change
+	return <-change.done
+}
+
+func (b *apiBackend) Validate(config []byte) error {
+	return b.config.validateConfig(config)
+}
+
+func (b *apiBackend) LogLevels() map[string]string {
+	return b.logs.Levels()
+}
+
+func (b *apiBackend) SetLogLevel(subsystem, level string) error {
+	return b.logs.SetLevel(subsystem, level)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/amyasnikov/berg/internal/bergapi"
+	"github.com/spf13/cobra"
+)
+
+func newClearCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clear",
+		Short: "reset berg state",
+	}
+	maxPrefixCmd := &cobra.Command{
+		Use:   "max-prefix <vrf> [<neighbor>]",
+		Short: "unblock the exceeded max-prefix limits of a VRF, all of them unless the neighbor is given",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			req := &bergapi.ClearMaxPrefixRequest{Vrf: args[0]}
+			if len(args) > 1 {
+				req.Neighbor = args[1]
+			}
+			resp, err := client.ClearMaxPrefix(ctx, req)
+			if err != nil {
+				exitWithError(err)
+			}
+			if err = printCleared(os.Stdout, resp.Cleared); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+	cmd.AddCommand(maxPrefixCmd)
+	return cmd
+}
+
+func printCleared(w io.Writer, cleared []bergapi.MaxPrefixBlock) error {
+	if globalOpts.Json {
+		return printJson(w, cleared)
+	}
+	if globalOpts.Quiet {
+		return nil
+	}
+	if len(cleared) == 0 {
+		fmt.Fprintln(w, "No exceeded limits")
+		return nil
+	}
+	for _, block := range cleared {
+		if block.Neighbor == "" {
+			fmt.Fprintf(w, "Cleared the limit of VRF %s\n", block.Vrf)
+		} else {
+			fmt.Fprintf(w, "Cleared the limit of neighbor %s in VRF %s\n", block.Neighbor, block.Vrf)
+		}
+	}
+	return nil
+}
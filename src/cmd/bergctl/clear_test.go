@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/bergapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintCleared(t *testing.T) {
+	var out bytes.Buffer
+
+	assert.NoError(t, printCleared(&out, []bergapi.MaxPrefixBlock{
+		{Vrf: "vrf_10"}, {Vrf: "vrf_10", Neighbor: "192.168.0.10"},
+	}))
+	assert.Equal(t, "Cleared the limit of VRF vrf_10\n"+
+		"Cleared the limit of neighbor 192.168.0.10 in VRF vrf_10\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, printCleared(&out, nil))
+	assert.Equal(t, "No exceeded limits\n", out.String())
+}
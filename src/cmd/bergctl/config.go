@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/amyasnikov/berg/internal/bergapi"
+	"github.com/spf13/cobra"
+)
+
+func newReloadCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reload",
+		Short: "re-read the config file and apply it",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := client.Reload(ctx); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+}
+
+func newValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate [<config file>]",
+		Short: "validate a config file, the running one by default",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req := &bergapi.ValidateRequest{}
+			if len(args) > 0 {
+				data, err := os.ReadFile(args[0])
+				if err != nil {
+					exitWithError(err)
+				}
+				req.Config = string(data)
+			}
+			resp, err := client.Validate(ctx, req)
+			if err != nil {
+				exitWithError(err)
+			}
+			if globalOpts.Json {
+				if err = printJson(os.Stdout, resp); err != nil {
+					exitWithError(err)
+				}
+			} else if resp.Valid {
+				fmt.Println("configuration is valid")
+			} else {
+				for _, e := range resp.Errors {
+					fmt.Println(e)
+				}
+			}
+			if !resp.Valid {
+				os.Exit(1)
+			}
+		},
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/amyasnikov/berg/internal/bergapi"
+	"github.com/spf13/cobra"
+)
+
+func newExplainCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "explain <vrf> <prefix>|<address>",
+		Short: "explain why the routes of the VRF are (not) redistributed",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			resp, err := client.Explain(ctx, &bergapi.ExplainRequest{Vrf: args[0], Prefix: args[1]})
+			if err != nil {
+				exitWithError(err)
+			}
+			if err = printExplanation(os.Stdout, resp); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+}
+
+func printExplanation(w io.Writer, resp *bergapi.ExplainResponse) error {
+	if globalOpts.Json {
+		return printJson(w, resp)
+	}
+	if len(resp.Paths) == 0 {
+		fmt.Fprintf(w, "No paths matching %s in VRF %s\n", resp.Prefix, resp.Vrf)
+		return nil
+	}
+	for i, path := range resp.Paths {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		source := path.SourceNlri
+		if path.Neighbor != "" {
+			source += " from " + path.Neighbor
+		}
+		if path.Redistributed {
+			fmt.Fprintf(w, "%s %s: redistributed as %s\n", path.Direction, source, path.GeneratedNlri)
+		} else {
+			fmt.Fprintf(w, "%s %s: not redistributed, %s\n", path.Direction, source, path.Reason)
+		}
+		if globalOpts.Quiet {
+			continue
+		}
+		width := 0
+		for _, step := range path.Steps {
+			width = max(width, len(step.Name))
+		}
+		for _, step := range path.Steps {
+			mark := "+"
+			if !step.Passed {
+				mark = "-"
+			}
+			fmt.Fprintf(w, "  [%s] %-*s  %s\n", mark, width, step.Name, step.Detail)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/bergapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintExplanation(t *testing.T) {
+	resp := &bergapi.ExplainResponse{
+		Vrf:    "vrf_10",
+		Prefix: "10.0.0.1",
+		Paths: []bergapi.PathExplanation{
+			{
+				Direction:  "vpnv4_to_evpn",
+				SourceNlri: "100:10:10.0.0.0/24",
+				Neighbor:   "192.168.1.1",
+				Steps: []bergapi.ExplainStep{
+					{Name: "receive", Passed: true, Detail: "best path from 192.168.1.1"},
+					{Name: "generate", Detail: "no nexthop found"},
+				},
+				Reason: "no nexthop found",
+			},
+			{
+				Direction:     "evpn_to_vpnv4",
+				SourceNlri:    "5:100:10:10.0.0.0/24 Gw:0.0.0.0 Vni:10",
+				Steps:         []bergapi.ExplainStep{{Name: "inject", Passed: true, Detail: "injected"}},
+				GeneratedNlri: "100:10:10.0.0.0/24",
+				Redistributed: true,
+			},
+		},
+	}
+	var out bytes.Buffer
+
+	assert.NoError(t, printExplanation(&out, resp))
+
+	assert.Equal(t, "vpnv4_to_evpn 100:10:10.0.0.0/24 from 192.168.1.1: not redistributed, no nexthop found\n"+
+		"  [+] receive   best path from 192.168.1.1\n"+
+		"  [-] generate  no nexthop found\n"+
+		"\n"+
+		"evpn_to_vpnv4 5:100:10:10.0.0.0/24 Gw:0.0.0.0 Vni:10: redistributed as 100:10:10.0.0.0/24\n"+
+		"  [+] inject  injected\n", out.String())
+}
+
+func TestPrintExplanation_NoPaths(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, printExplanation(&out, &bergapi.ExplainResponse{Vrf: "vrf_10", Prefix: "10.0.0.1"}))
+	assert.Equal(t, "No paths matching 10.0.0.1 in VRF vrf_10\n", out.String())
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/bergapi"
+	"github.com/spf13/cobra"
+)
+
+func newLeaseCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lease",
+		Short: "add, release or show the prefixes leased by orchestrators",
+	}
+	var ttl time.Duration
+	addCmd := &cobra.Command{
+		Use:   "add <vrf> <prefix> <gateway>",
+		Short: "add or renew the lease of a prefix",
+		Args:  cobra.ExactArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := client.LeaseRoute(ctx, &bergapi.LeaseRouteRequest{
+				Vrf: args[0], Prefix: args[1], Gateway: args[2], Ttl: ttl.String(),
+			})
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+	addCmd.Flags().DurationVar(&ttl, "ttl", time.Minute, "the route is withdrawn unless the lease is renewed within ttl")
+	releaseCmd := &cobra.Command{
+		Use:   "release <vrf> <prefix>",
+		Short: "end the lease of a prefix",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := client.ReleaseRoute(ctx, &bergapi.ReleaseRouteRequest{Vrf: args[0], Prefix: args[1]}); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+	listCmd := &cobra.Command{
+		Use:   "list [<vrf>]",
+		Short: "show the leases",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req := &bergapi.ListLeasesRequest{}
+			if len(args) > 0 {
+				req.Vrf = args[0]
+			}
+			resp, err := client.ListLeases(ctx, req)
+			if err != nil {
+				exitWithError(err)
+			}
+			if err = printLeases(os.Stdout, resp.Leases); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+	cmd.AddCommand(addCmd, releaseCmd, listCmd)
+	return cmd
+}
+
+func printLeases(w io.Writer, leases []bergapi.Lease) error {
+	if globalOpts.Json {
+		return printJson(w, leases)
+	}
+	if len(leases) == 0 {
+		fmt.Fprintln(w, "No leases")
+		return nil
+	}
+	if globalOpts.Quiet {
+		for _, l := range leases {
+			fmt.Fprintln(w, l.Prefix)
+		}
+		return nil
+	}
+	lines := make([][]string, 0, len(leases))
+	for _, l := range leases {
+		state := "overridden by BGP"
+		if l.Injected {
+			state = "injected"
+		}
+		lines = append(lines, []string{l.Vrf, l.Prefix, l.Gateway, formatTimedelta(l.ExpiresAt), state})
+	}
+	printTable(w, []string{"VRF", "Network", "Gateway", "Expires in", "State"}, lines)
+	return nil
+}
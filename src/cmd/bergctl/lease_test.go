@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/bergapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintLeases(t *testing.T) {
+	var out bytes.Buffer
+	expiresAt := time.Now().Add(48 * time.Hour)
+	leases := []bergapi.Lease{
+		{Vrf: "vrf_10", Prefix: "10.0.7.0/24", Gateway: "192.168.0.7", ExpiresAt: expiresAt, Injected: true},
+		{Vrf: "vrf_10", Prefix: "10.0.8.0/24", Gateway: "192.168.0.8", ExpiresAt: expiresAt},
+	}
+
+	assert.NoError(t, printLeases(&out, leases))
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	assert.Len(t, lines, 3)
+	assert.Regexp(t, `^  vrf_10  10\.0\.7\.0/24  192\.168\.0\.7  \dd \d\d:\d\d:\d\d  injected$`, lines[1])
+	assert.Regexp(t, `^  vrf_10  10\.0\.8\.0/24  192\.168\.0\.8  \dd \d\d:\d\d:\d\d  overridden by BGP$`, lines[2])
+}
+
+func TestPrintLeases_Empty(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, printLeases(&out, nil))
+	assert.Equal(t, "No leases\n", out.String())
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/amyasnikov/berg/internal/bergapi"
+	"github.com/spf13/cobra"
+)
+
+func newLogLevelCmd() *cobra.Command {
+	var subsystem string
+	cmd := &cobra.Command{
+		Use:   "log-level [<level>]",
+		Short: "show or change the log levels, of all the subsystems unless --subsystem is given",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var resp *bergapi.LogLevelsResponse
+			var err error
+			if len(args) == 0 {
+				resp, err = client.GetLogLevels(ctx)
+			} else {
+				resp, err = client.SetLogLevel(ctx, &bergapi.SetLogLevelRequest{Subsystem: subsystem, Level: args[0]})
+			}
+			if err != nil {
+				exitWithError(err)
+			}
+			if err = printLogLevels(os.Stdout, resp); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&subsystem, "subsystem", "s", "", "app, controller, injector or gobgp")
+	return cmd
+}
+
+func printLogLevels(w io.Writer, resp *bergapi.LogLevelsResponse) error {
+	if globalOpts.Json {
+		return printJson(w, resp)
+	}
+	subsystems := make([]string, 0, len(resp.Levels))
+	for subsystem := range resp.Levels {
+		subsystems = append(subsystems, subsystem)
+	}
+	sort.Strings(subsystems)
+	for _, subsystem := range subsystems {
+		fmt.Fprintf(w, "%-12s%s\n", subsystem, resp.Levels[subsystem])
+	}
+	return nil
+}
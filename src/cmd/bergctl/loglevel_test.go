@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/bergapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintLogLevels(t *testing.T) {
+	resp := &bergapi.LogLevelsResponse{
+		Levels: map[string]string{"gobgp": "warning", "app": "info", "controller": "trace", "injector": "info"},
+	}
+	var out bytes.Buffer
+
+	assert.NoError(t, printLogLevels(&out, resp))
+
+	assert.Equal(t, "app         info\n"+
+		"controller  trace\n"+
+		"gobgp       warning\n"+
+		"injector    info\n", out.String())
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/bergapi"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+var globalOpts struct {
+	Host    string
+	Port    int
+	Json    bool
+	Quiet   bool
+	Timeout time.Duration
+}
+
+var (
+	client *bergapi.Client
+	ctx    context.Context
+)
+
+func newRootCmd() *cobra.Command {
+	cobra.EnablePrefixMatching = true
+	var cancel context.CancelFunc
+	var conn *grpc.ClientConn
+	rootCmd := &cobra.Command{
+		Use:   "bergctl",
+		Short: "Command-line client of berg",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			var err error
+			ctx, cancel = context.WithTimeout(context.Background(), globalOpts.Timeout)
+			conn, err = grpc.Dial(
+				net.JoinHostPort(globalOpts.Host, strconv.Itoa(globalOpts.Port)),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			)
+			if err != nil {
+				exitWithError(err)
+			}
+			client = bergapi.NewClient(conn)
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			cancel()
+			conn.Close()
+		},
+	}
+	rootCmd.PersistentFlags().StringVarP(&globalOpts.Host, "host", "u", "127.0.0.1", "host")
+	rootCmd.PersistentFlags().IntVarP(&globalOpts.Port, "port", "p", 50051, "port")
+	rootCmd.PersistentFlags().BoolVarP(&globalOpts.Json, "json", "j", false, "use json format to output format")
+	rootCmd.PersistentFlags().BoolVarP(&globalOpts.Quiet, "quiet", "q", false, "use quiet")
+	rootCmd.PersistentFlags().DurationVarP(&globalOpts.Timeout, "timeout", "t", 30*time.Second, "request timeout")
+	rootCmd.AddCommand(
+		newShowCmd(), newExplainCmd(), newReloadCmd(), newValidateCmd(), newLogLevelCmd(), newVrfCmd(), newLeaseCmd(),
+		newClearCmd(),
+	)
+	return rootCmd
+}
+
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/bergapi"
+	"github.com/spf13/cobra"
+)
+
+const (
+	cmdVrf       = "vrf"
+	cmdPrefix    = "prefix"
+	cmdDirection = "direction"
+)
+
+func newShowCmd() *cobra.Command {
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "show berg state",
+	}
+	redistributionCmd := &cobra.Command{
+		Use:   "redistribution [vrf <name>] [prefix <prefix>|<address>] [direction <direction>]",
+		Short: "show redistributed routes",
+		Run: func(cmd *cobra.Command, args []string) {
+			req, err := parseRedistributionArgs(args)
+			if err != nil {
+				exitWithError(err)
+			}
+			resp, err := client.ListRedistributed(ctx, req)
+			if err != nil {
+				exitWithError(err)
+			}
+			if err = printRoutes(os.Stdout, resp.Routes); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+	vrfCmd := &cobra.Command{
+		Use:   "vrf [<name>]",
+		Short: "show VRFs",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req := &bergapi.GetVrfStateRequest{}
+			if len(args) > 0 {
+				req.Vrf = args[0]
+			}
+			resp, err := client.GetVrfState(ctx, req)
+			if err != nil {
+				exitWithError(err)
+			}
+			if err = printVrfs(os.Stdout, resp.Vrfs); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "show berg status",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			resp, err := client.Status(ctx)
+			if err != nil {
+				exitWithError(err)
+			}
+			if err = printStatus(os.Stdout, resp); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+	allowlistCmd := &cobra.Command{
+		Use:   "allowlist [<vrf>]",
+		Short: "show the prefix allowlist and the routes it blocks",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req := &bergapi.GetAllowlistRequest{}
+			if len(args) > 0 {
+				req.Vrf = args[0]
+			}
+			resp, err := client.GetAllowlist(ctx, req)
+			if err != nil {
+				exitWithError(err)
+			}
+			if err = printAllowlist(os.Stdout, resp); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+	showCmd.AddCommand(redistributionCmd, vrfCmd, statusCmd, allowlistCmd)
+	return showCmd
+}
+
+func parseRedistributionArgs(args []string) (*bergapi.ListRedistributedRequest, error) {
+	req := &bergapi.ListRedistributedRequest{}
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("usage: show redistribution [vrf <name>] [prefix <prefix>] [direction <direction>]")
+	}
+	for i := 0; i < len(args); i += 2 {
+		switch args[i] {
+		case cmdVrf:
+			req.Vrf = args[i+1]
+		case cmdPrefix:
+			req.Prefix = args[i+1]
+		case cmdDirection:
+			req.Direction = args[i+1]
+		default:
+			return nil, fmt.Errorf("unknown argument %q", args[i])
+		}
+	}
+	return req, nil
+}
+
+func printJson(w io.Writer, v any) error {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(j))
+	return err
+}
+
+// Prints left-aligned columns the way the gobgp CLI does
+func printTable(w io.Writer, header []string, lines [][]string) {
+	maxLens := make([]int, len(header))
+	for i, h := range header {
+		maxLens[i] = len(h)
+	}
+	for _, l := range lines {
+		for i, v := range l {
+			maxLens[i] = max(maxLens[i], len(v))
+		}
+	}
+	var format strings.Builder
+	format.WriteString(" ")
+	for _, l := range maxLens {
+		format.WriteString(fmt.Sprintf(" %%-%ds", l+1))
+	}
+	printLine := func(values []string) {
+		args := make([]any, len(values))
+		for i, v := range values {
+			args[i] = v
+		}
+		fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf(format.String(), args...), " "))
+	}
+	printLine(header)
+	for _, l := range lines {
+		printLine(l)
+	}
+}
+
+func printRoutes(w io.Writer, routes []bergapi.Route) error {
+	if globalOpts.Json {
+		return printJson(w, routes)
+	}
+	if len(routes) == 0 {
+		fmt.Fprintln(w, "Network not in table")
+		return nil
+	}
+	if globalOpts.Quiet {
+		for _, r := range routes {
+			fmt.Fprintln(w, r.GeneratedNlri)
+		}
+		return nil
+	}
+	lines := make([][]string, 0, len(routes))
+	for _, r := range routes {
+		lines = append(lines, []string{
+			r.Vrf, r.Prefix, r.Direction, r.SourceNlri, r.GeneratedNlri, r.Uuid, formatTimedelta(r.CreatedAt),
+		})
+	}
+	printTable(w, []string{"VRF", "Network", "Direction", "Source", "Generated", "UUID", "Age"}, lines)
+	return nil
+}
+
+func printVrfs(w io.Writer, vrfs []bergapi.VrfState) error {
+	if globalOpts.Json {
+		return printJson(w, vrfs)
+	}
+	if globalOpts.Quiet {
+		for _, v := range vrfs {
+			fmt.Fprintln(w, v.Name)
+		}
+		return nil
+	}
+	lines := make([][]string, 0, len(vrfs))
+	for _, v := range vrfs {
+		lines = append(lines, []string{
+			v.Name,
+			v.Rd,
+			strings.Join(v.ImportRouteTargets, ", "),
+			strings.Join(v.ExportRouteTargets, ", "),
+			fmt.Sprintf("%d", v.Vni),
+			formatCounts(v.Redistributed),
+		})
+	}
+	printTable(w, []string{"Name", "RD", "Import RT", "Export RT", "VNI", "Redistributed"}, lines)
+	return nil
+}
+
+func printStatus(w io.Writer, status *bergapi.StatusResponse) error {
+	if globalOpts.Json {
+		return printJson(w, status)
+	}
+	fmt.Fprintf(w, "Uptime:            %s\n", formatTimedelta(status.StartedAt))
+	fmt.Fprintf(w, "Converged:         %t\n", status.Converged)
+	fmt.Fprintf(w, "Workers:           %d\n", status.Workers)
+	fmt.Fprintf(w, "Event queue depth: %d\n", status.EventQueueDepth)
+	fmt.Fprintf(w, "Redistributed:     %s\n", formatCounts(status.Redistributed))
+	switch {
+	case status.LastReload == nil:
+		fmt.Fprintf(w, "Last reload:       never\n")
+	case status.LastReload.Success:
+		fmt.Fprintf(w, "Last reload:       %s ago, succeeded\n", formatTimedelta(status.LastReload.Time))
+	default:
+		fmt.Fprintf(w, "Last reload:       %s ago, failed: %s\n",
+			formatTimedelta(status.LastReload.Time), status.LastReload.Error)
+	}
+	return nil
+}
+
+func printAllowlist(w io.Writer, allowlist *bergapi.GetAllowlistResponse) error {
+	if globalOpts.Json {
+		return printJson(w, allowlist)
+	}
+	if globalOpts.Quiet {
+		for _, b := range allowlist.Blocked {
+			fmt.Fprintln(w, b.Source)
+		}
+		return nil
+	}
+	if !allowlist.Enabled {
+		fmt.Fprintln(w, "Prefix allowlist is disabled")
+		return nil
+	}
+	fmt.Fprintf(w, "Source:       %s\n", allowlist.Source)
+	if allowlist.LoadedAt.IsZero() {
+		fmt.Fprintf(w, "Loaded:       never, every received route is blocked\n")
+	} else {
+		fmt.Fprintf(w, "Loaded:       %s ago, %d entries\n", formatTimedelta(allowlist.LoadedAt), allowlist.Entries)
+	}
+	if !allowlist.CheckedAt.IsZero() {
+		fmt.Fprintf(w, "Last checked: %s ago\n", formatTimedelta(allowlist.CheckedAt))
+	}
+	if allowlist.Error != "" {
+		fmt.Fprintf(w, "Last error:   %s\n", allowlist.Error)
+	}
+	fmt.Fprintln(w)
+	if len(allowlist.Blocked) == 0 {
+		fmt.Fprintln(w, "No blocked routes")
+		return nil
+	}
+	lines := make([][]string, 0, len(allowlist.Blocked))
+	for _, b := range allowlist.Blocked {
+		lines = append(lines, []string{b.Vrf, b.Prefix, b.Neighbor, b.Reason, formatTimedelta(b.Since)})
+	}
+	printTable(w, []string{"VRF", "Network", "Neighbor", "Reason", "Since"}, lines)
+	return nil
+}
+
+// e.g. "evpn_to_vpnv4: 1, vpnv4_to_evpn: 2"
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %d", k, counts[k]))
+	}
+	if len(parts) == 0 {
+		return "0"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatTimedelta(t time.Time) string {
+	d := time.Now().Unix() - t.Unix()
+	u := uint64(d)
+	neg := d < 0
+	if neg {
+		u = -u
+	}
+	secs := u % 60
+	u /= 60
+	mins := u % 60
+	u /= 60
+	hours := u % 24
+	days := u / 24
+
+	if days == 0 {
+		return fmt.Sprintf("%02d:%02d:%02d", hours, mins, secs)
+	}
+	return fmt.Sprintf("%dd ", days) + fmt.Sprintf("%02d:%02d:%02d", hours, mins, secs)
+}
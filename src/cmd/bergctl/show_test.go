@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/bergapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRedistributionArgs(t *testing.T) {
+	req, err := parseRedistributionArgs([]string{"vrf", "vrf_10", "prefix", "10.0.0.1", "direction", "vpnv4_to_evpn"})
+	assert.NoError(t, err)
+	assert.Equal(t, &bergapi.ListRedistributedRequest{
+		Vrf: "vrf_10", Prefix: "10.0.0.1", Direction: "vpnv4_to_evpn",
+	}, req)
+
+	_, err = parseRedistributionArgs([]string{"vrf"})
+	assert.Error(t, err)
+	_, err = parseRedistributionArgs([]string{"rd", "100:10"})
+	assert.Error(t, err)
+}
+
+func TestPrintTable(t *testing.T) {
+	var out bytes.Buffer
+	printTable(&out, []string{"Name", "RD"}, [][]string{{"vrf_10", "100:10"}, {"a", "100:200"}})
+	assert.Equal(t, "  Name    RD\n  vrf_10  100:10\n  a       100:200\n", out.String())
+}
+
+func TestPrintRoutes_Empty(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, printRoutes(&out, nil))
+	assert.Equal(t, "Network not in table\n", out.String())
+}
+
+func TestPrintAllowlist(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, printAllowlist(&out, &bergapi.GetAllowlistResponse{}))
+	assert.Equal(t, "Prefix allowlist is disabled\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, printAllowlist(&out, &bergapi.GetAllowlistResponse{
+		Enabled: true, Source: "/etc/berg/allowlist.csv", Error: "no such file",
+	}))
+	assert.Equal(t, "Source:       /etc/berg/allowlist.csv\n"+
+		"Loaded:       never, every received route is blocked\n"+
+		"Last error:   no such file\n\n"+
+		"No blocked routes\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, printAllowlist(&out, &bergapi.GetAllowlistResponse{
+		Enabled:  true,
+		LoadedAt: time.Now(),
+		Blocked: []bergapi.BlockedRoute{
+			{Vrf: "vrf_10", Prefix: "10.0.3.0/24", Neighbor: "192.168.0.10", Reason: "not allowed", Since: time.Now()},
+		},
+	}))
+	assert.Contains(t, out.String(), "  VRF     Network      Neighbor      Reason       Since\n")
+	assert.Contains(t, out.String(), "  vrf_10  10.0.3.0/24  192.168.0.10  not allowed  00:00:00\n")
+}
+
+func TestFormatCounts(t *testing.T) {
+	assert.Equal(t, "0", formatCounts(nil))
+	assert.Equal(t, "evpn_to_vpnv4: 1, vpnv4_to_evpn: 2", formatCounts(map[string]int{"vpnv4_to_evpn": 2, "evpn_to_vpnv4": 1}))
+}
+
+func TestFormatTimedelta(t *testing.T) {
+	assert.Equal(t, "01:02:03", formatTimedelta(time.Now().Add(-time.Hour-2*time.Minute-3*time.Second)))
+	assert.Equal(t, "2d 00:00:00", formatTimedelta(time.Now().Add(-48*time.Hour)))
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/amyasnikov/berg/internal/bergapi"
+	"github.com/spf13/cobra"
+)
+
+type vrfOpts struct {
+	vrf          bergapi.VrfConfig
+	routeTargets []string
+	staticRoutes []string // <prefix>=<gateway>
+	aggregates   []string // <prefix>[,summary-only][,as-set]
+	leaks        []string // <vrf>[,import|export|both][,evpn][,<prefix>...]
+	maxPrefix    bergapi.MaxPrefix
+	// gateway anti-spoofing, allowed gateways as <neighbor>=<subnet>[,<subnet>...] apply only along with the check
+	gatewayCheck    bool
+	allowedGateways []string
+	// default-originate settings, the last two apply only along with the first
+	defaultOriginate bool
+	defaultCondition string
+	suppressImported bool
+	persist          bool
+}
+
+func newVrfCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "vrf",
+		Short: "add, update or delete VRFs at runtime",
+	}
+	cmd.AddCommand(newVrfAddCmd(false), newVrfAddCmd(true), newVrfDeleteCmd())
+	return cmd
+}
+
+// The update command replaces the whole VRF, so it takes the same flags as add
+func newVrfAddCmd(update bool) *cobra.Command {
+	var opts vrfOpts
+	cmd := &cobra.Command{
+		Use:   "add <name>",
+		Short: "add a VRF",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			vrf, err := opts.vrfConfig(args[0])
+			if err != nil {
+				exitWithError(err)
+			}
+			if update {
+				err = client.UpdateVrf(ctx, &bergapi.UpdateVrfRequest{Vrf: vrf, Persist: opts.persist})
+			} else {
+				err = client.AddVrf(ctx, &bergapi.AddVrfRequest{Vrf: vrf, Persist: opts.persist})
+			}
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+	if update {
+		cmd.Use = "update <name>"
+		cmd.Short = "replace the settings of a VRF"
+	}
+	flags := cmd.Flags()
+	flags.Uint32Var(&opts.vrf.Id, "id", 0, "VRF ID, which is its VNI")
+	flags.StringVar(&opts.vrf.Rd, "rd", "", "route distinguisher")
+	flags.StringSliceVar(&opts.vrf.ImportRouteTargets, "import-rt", nil, "import route targets")
+	flags.StringSliceVar(&opts.vrf.ExportRouteTargets, "export-rt", nil, "export route targets")
+	flags.StringSliceVar(&opts.routeTargets, "rt", nil, "route targets both imported and exported")
+	flags.StringVar(&opts.vrf.WithdrawHoldTime, "withdraw-hold-time", "", "berg withdraw-hold-time, e.g. 30s")
+	flags.StringVar(&opts.vrf.Mobility, "mobility", "", "berg mobility mode")
+	flags.StringVar(&opts.vrf.MobilityResetTime, "mobility-reset-time", "", "berg mobility-reset-time, e.g. 3m")
+	flags.StringVar(&opts.vrf.OrchestratedPrecedence, "orchestrated-precedence", "",
+		"berg orchestrated-precedence, bgp or orchestrator")
+	flags.StringArrayVar(&opts.staticRoutes, "static-route", nil, "static route as <prefix>=<gateway>, repeatable")
+	flags.StringArrayVar(&opts.aggregates, "aggregate", nil,
+		"aggregate as <prefix>[,summary-only][,as-set], repeatable")
+	flags.StringArrayVar(&opts.leaks, "leak", nil,
+		"leak routes with the VRF as <vrf>[,import|export|both][,evpn][,<prefix>...], repeatable")
+	flags.BoolVar(&opts.gatewayCheck, "gateway-check", false,
+		"reject the routes whose gateway is neither the announcing neighbor nor allowed for it")
+	flags.StringArrayVar(&opts.allowedGateways, "allowed-gateways", nil,
+		"gateway subnets allowed for the neighbor address or range as <neighbor>=<subnet>[,<subnet>...], repeatable")
+	flags.BoolVar(&opts.defaultOriginate, "default-originate", false, "originate a default route into the VRF")
+	flags.StringVar(&opts.defaultCondition, "default-originate-condition", "",
+		"originate the default route only while the VRF imports the EVPN route of this prefix")
+	flags.BoolVar(&opts.suppressImported, "default-originate-suppress-imported", false,
+		"import the default routes only rather than all the EVPN routes")
+	flags.Uint32Var(&opts.maxPrefix.Vrf, "max-prefix", 0, "max routes of the VRF redistributed to EVPN")
+	flags.Uint32Var(&opts.maxPrefix.Neighbor, "max-prefix-neighbor", 0,
+		"max routes of a single neighbor redistributed to EVPN")
+	flags.Uint32Var(&opts.maxPrefix.Warning, "max-prefix-warning", 0,
+		"percentage of the max-prefix limits raising a warning")
+	flags.StringVar(&opts.maxPrefix.Action, "max-prefix-action", "",
+		"what happens once a max-prefix limit is exceeded: warn, stop or withdraw")
+	flags.BoolVar(&opts.persist, "persist", false, "write the change to the config file")
+	cmd.MarkFlagRequired("id")
+	cmd.MarkFlagRequired("rd")
+	return cmd
+}
+
+func newVrfDeleteCmd() *cobra.Command {
+	var persist bool
+	cmd := &cobra.Command{
+		Use:   "delete <name>",
+		Short: "delete a VRF",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := client.DeleteVrf(ctx, &bergapi.DeleteVrfRequest{Name: args[0], Persist: persist}); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&persist, "persist", false, "write the change to the config file")
+	return cmd
+}
+
+// --rt adds the route targets to both import and export lists
+func (o *vrfOpts) vrfConfig(name string) (bergapi.VrfConfig, error) {
+	vrf := o.vrf
+	vrf.Name = name
+	vrf.ImportRouteTargets = slices.Concat(vrf.ImportRouteTargets, o.routeTargets)
+	vrf.ExportRouteTargets = slices.Concat(vrf.ExportRouteTargets, o.routeTargets)
+	for _, route := range o.staticRoutes {
+		prefix, gateway, found := strings.Cut(route, "=")
+		if !found {
+			return bergapi.VrfConfig{}, fmt.Errorf("invalid static route %q, expected <prefix>=<gateway>", route)
+		}
+		vrf.StaticRoutes = append(vrf.StaticRoutes, bergapi.StaticRoute{Prefix: prefix, Gateway: gateway})
+	}
+	for _, aggregate := range o.aggregates {
+		prefix, options, _ := strings.Cut(aggregate, ",")
+		parsed := bergapi.Aggregate{Prefix: prefix}
+		for _, option := range strings.Split(options, ",") {
+			switch option {
+			case "":
+			case "summary-only":
+				parsed.SummaryOnly = true
+			case "as-set":
+				parsed.AsSet = true
+			default:
+				return bergapi.VrfConfig{}, fmt.Errorf("invalid aggregate option %q, expected summary-only or as-set", option)
+			}
+		}
+		vrf.Aggregates = append(vrf.Aggregates, parsed)
+	}
+	if o.maxPrefix != (bergapi.MaxPrefix{}) {
+		maxPrefix := o.maxPrefix
+		vrf.MaxPrefix = &maxPrefix
+	}
+	for _, leak := range o.leaks {
+		other, options, _ := strings.Cut(leak, ",")
+		parsed := bergapi.LeakRule{Vrf: other}
+		for _, option := range strings.Split(options, ",") {
+			switch option {
+			case "":
+			case "import", "export", "both":
+				parsed.Direction = option
+			case "evpn":
+				parsed.Evpn = true
+			default:
+				parsed.Prefixes = append(parsed.Prefixes, option) // validated by the server
+			}
+		}
+		vrf.Leaks = append(vrf.Leaks, parsed)
+	}
+	if !o.gatewayCheck && len(o.allowedGateways) > 0 {
+		return bergapi.VrfConfig{}, errors.New("--allowed-gateways require --gateway-check")
+	}
+	if o.gatewayCheck {
+		vrf.GatewayCheck = &bergapi.GatewayCheck{}
+	}
+	for _, allowed := range o.allowedGateways {
+		neighbor, subnets, found := strings.Cut(allowed, "=")
+		if !found {
+			return bergapi.VrfConfig{}, fmt.Errorf(
+				"invalid allowed gateways %q, expected <neighbor>=<subnet>[,<subnet>...]", allowed,
+			)
+		}
+		vrf.GatewayCheck.Allowed = append(vrf.GatewayCheck.Allowed, bergapi.AllowedGateways{
+			Neighbor: neighbor, Subnets: strings.Split(subnets, ","),
+		})
+	}
+	if !o.defaultOriginate && (o.defaultCondition != "" || o.suppressImported) {
+		return bergapi.VrfConfig{}, errors.New("default-originate options require --default-originate")
+	}
+	if o.defaultOriginate {
+		vrf.DefaultOriginate = &bergapi.DefaultOriginate{
+			Condition: o.defaultCondition, SuppressImported: o.suppressImported,
+		}
+	}
+	return vrf, nil
+}
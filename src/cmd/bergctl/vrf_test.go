@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/bergapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVrfOpts_VrfConfig(t *testing.T) {
+	opts := vrfOpts{
+		vrf: bergapi.VrfConfig{
+			Id: 10, Rd: "65000:10", ImportRouteTargets: []string{"65000:1"}, WithdrawHoldTime: "30s",
+		},
+		routeTargets:     []string{"65000:10"},
+		staticRoutes:     []string{"10.0.5.0/24=192.168.0.5"},
+		aggregates:       []string{"10.0.0.0/16,summary-only,as-set", "10.1.0.0/16"},
+		leaks:            []string{"vrf_20", "vrf_30,both,evpn,10.0.0.0/8,10.1.0.0/16"},
+		maxPrefix:        bergapi.MaxPrefix{Neighbor: 1000, Action: "stop"},
+		gatewayCheck:     true,
+		allowedGateways:  []string{"192.168.0.0/24=10.0.5.0/24,10.0.6.0/24"},
+		defaultOriginate: true,
+		suppressImported: true,
+	}
+
+	vrf, err := opts.vrfConfig("vrf_10")
+
+	assert.NoError(t, err)
+	assert.Equal(t, bergapi.VrfConfig{
+		Name:               "vrf_10",
+		Id:                 10,
+		Rd:                 "65000:10",
+		ImportRouteTargets: []string{"65000:1", "65000:10"},
+		ExportRouteTargets: []string{"65000:10"},
+		WithdrawHoldTime:   "30s",
+		StaticRoutes:       []bergapi.StaticRoute{{Prefix: "10.0.5.0/24", Gateway: "192.168.0.5"}},
+		Aggregates: []bergapi.Aggregate{
+			{Prefix: "10.0.0.0/16", SummaryOnly: true, AsSet: true},
+			{Prefix: "10.1.0.0/16"},
+		},
+		DefaultOriginate: &bergapi.DefaultOriginate{SuppressImported: true},
+		Leaks: []bergapi.LeakRule{
+			{Vrf: "vrf_20"},
+			{Vrf: "vrf_30", Direction: "both", Evpn: true, Prefixes: []string{"10.0.0.0/8", "10.1.0.0/16"}},
+		},
+		MaxPrefix: &bergapi.MaxPrefix{Neighbor: 1000, Action: "stop"},
+		GatewayCheck: &bergapi.GatewayCheck{Allowed: []bergapi.AllowedGateways{
+			{Neighbor: "192.168.0.0/24", Subnets: []string{"10.0.5.0/24", "10.0.6.0/24"}},
+		}},
+	}, vrf)
+}
+
+func TestVrfOpts_DefaultOriginateOptions(t *testing.T) {
+	opts := vrfOpts{defaultCondition: "0.0.0.0/0"}
+
+	_, err := opts.vrfConfig("vrf_10")
+
+	assert.ErrorContains(t, err, "require --default-originate")
+}
+
+func TestVrfOpts_AllowedGateways(t *testing.T) {
+	opts := vrfOpts{allowedGateways: []string{"192.168.0.10=10.0.5.0/24"}}
+	_, err := opts.vrfConfig("vrf_10")
+	assert.ErrorContains(t, err, "require --gateway-check")
+
+	opts = vrfOpts{gatewayCheck: true, allowedGateways: []string{"192.168.0.10"}}
+	_, err = opts.vrfConfig("vrf_10")
+	assert.ErrorContains(t, err, "invalid allowed gateways")
+}
+
+func TestVrfOpts_InvalidStaticRoute(t *testing.T) {
+	opts := vrfOpts{staticRoutes: []string{"10.0.5.0/24"}}
+
+	_, err := opts.vrfConfig("vrf_10")
+
+	assert.ErrorContains(t, err, "expected <prefix>=<gateway>")
+}
+
+func TestVrfOpts_InvalidAggregate(t *testing.T) {
+	opts := vrfOpts{aggregates: []string{"10.0.0.0/16,summary"}}
+
+	_, err := opts.vrfConfig("vrf_10")
+
+	assert.ErrorContains(t, err, `invalid aggregate option "summary"`)
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"fmt"
 	"os"
+	"runtime"
 	"time"
 
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/tracing"
+	"github.com/hashicorp/go-multierror"
 	"github.com/osrg/gobgp/v3/pkg/config"
 	"github.com/osrg/gobgp/v3/pkg/config/oc"
 	"github.com/pelletier/go-toml/v2"
@@ -14,41 +18,164 @@ import (
 )
 
 type Config struct {
-	GobgpConfig *oc.BgpConfigSet
-	ConfigFile  string
-	GrpcHosts   string
-	LogLevel    string
-	logger      *logrus.Logger
+	GobgpConfig       *oc.BgpConfigSet
+	VrfExtensions     map[string]dto.VrfExtensions
+	ConfigFile        string
+	GrpcHosts         string
+	LogLevel          string
+	LogFormat         string
+	Workers           int
+	StartupHoldTime   time.Duration
+	MetricsAddress    string
+	HealthAddress     string
+	EventSinks        []eventSinkConfig
+	Allowlist         *allowlistConfig // nil if disabled
+	Tracing           tracing.Config
+	ReconcileInterval time.Duration
+	ReconcileRate     float64
+	VrfDiscovery      time.Duration
+	logger            *logrus.Logger
 }
 
 func NewConfig(logger *logrus.Logger) (cfg Config) {
 	configFile := flag.StringP("config", "f", "", "Path to TOML config file")
 	grpcHosts := flag.StringP("api-host", "a", ":50051", "gRPC API address:port to listen to.")
-	logLevel := flag.StringP("log-level", "l", "info", "Log Level")
+	logLevel := flag.StringP(
+		"log-level", "l", "info",
+		"Log level: trace, debug, info, warn or error, optionally per subsystem, e.g. info,controller=debug,gobgp=warn",
+	)
+	logFormat := flag.String("log-format", "json", "Log format: text or json")
+	startupHoldTime := flag.Duration(
+		"startup-hold-time", 0, "Max time to wait for End-of-RIB from all neighbors before redistributing routes",
+	)
+	metricsAddress := flag.String(
+		"metrics-address", "", "address:port to serve Prometheus metrics and debug endpoints on, e.g. :9179. Disabled if empty",
+	)
+	healthAddress := flag.String(
+		"health-address", ":9180", "address:port to serve the health checks on, may be the same as --metrics-address",
+	)
+	tracingExporter := flag.String(
+		"tracing-exporter", "", "OpenTelemetry exporter of path processing traces: otlp or stdout. Disabled if empty",
+	)
+	tracingEndpoint := flag.String("tracing-endpoint", "localhost:4317", "OTLP gRPC collector address:port")
+	tracingSampleRatio := flag.Float64("tracing-sample-ratio", 1, "Fraction of the paths traced, from 0 to 1")
+	reconcileInterval := flag.Duration(
+		"reconcile-interval", 0, "How often to fix disagreements between berg and the GoBGP RIB. Disabled if 0",
+	)
+	reconcileRate := flag.Float64("reconcile-rate", 100, "Max reconciliation corrections per second")
+	vrfDiscovery := flag.Duration(
+		"vrf-discovery-interval", 10*time.Second,
+		"How often to pick up VRFs added or deleted through the GoBGP API. 0 means at startup only",
+	)
+	workers := flag.IntP("workers", "w", runtime.NumCPU(), "Number of workers handling routes in parallel")
 
 	flag.Parse()
 	if *configFile == "" {
 		panic("config file must be defined")
 	}
+	if *healthAddress == "" {
+		panic("health address must be defined")
+	}
 	cfg.ConfigFile = *configFile
 	cfg.LogLevel = *logLevel
+	cfg.LogFormat = *logFormat
 	cfg.GrpcHosts = *grpcHosts
+	cfg.Workers = *workers
+	cfg.StartupHoldTime = *startupHoldTime
+	cfg.MetricsAddress = *metricsAddress
+	cfg.HealthAddress = *healthAddress
+	cfg.ReconcileInterval = *reconcileInterval
+	cfg.ReconcileRate = *reconcileRate
+	cfg.VrfDiscovery = *vrfDiscovery
+	cfg.Tracing = tracing.Config{
+		Exporter:    *tracingExporter,
+		Endpoint:    *tracingEndpoint,
+		SampleRatio: *tracingSampleRatio,
+	}
 	cfg.logger = logger
-	cfg.GobgpConfig = cfg.mustReadConfig()
+	fileCfg := cfg.mustReadConfig()
+	cfg.GobgpConfig = fileCfg.Gobgp
+	cfg.VrfExtensions = fileCfg.VrfExtensions
+	cfg.EventSinks = fileCfg.EventSinks
+	cfg.Allowlist = fileCfg.Allowlist
 	return
 }
 
-func (c *Config) mustReadConfig() *oc.BgpConfigSet {
-	ensureVrfIdDefined(c.ConfigFile)
-	gobgpConfig, err := config.ReadConfigFile(c.ConfigFile, "toml")
+type fileConfig struct {
+	Gobgp         *oc.BgpConfigSet
+	VrfExtensions map[string]dto.VrfExtensions
+	EventSinks    []eventSinkConfig
+	Allowlist     *allowlistConfig
+}
+
+func (c *Config) mustReadConfig() fileConfig {
+	cfg, err := c.readConfig()
 	if err != nil {
 		c.logger.Fatalf("error reading config file: %v", err)
 	}
-	return gobgpConfig
+	return cfg
 }
 
-func (c *Config) watchConfigChanges() <-chan *oc.BgpConfigSet {
-	ch := make(chan *oc.BgpConfigSet)
+func (c *Config) readConfig() (fileConfig, error) {
+	ensureVrfIdDefined(c.ConfigFile)
+	data, err := os.ReadFile(c.ConfigFile)
+	if err != nil {
+		return fileConfig{}, err
+	}
+	vrfExt, err := parseVrfExtensions(data)
+	if err != nil {
+		return fileConfig{}, err
+	}
+	eventSinks, err := parseEventSinks(data)
+	if err != nil {
+		return fileConfig{}, err
+	}
+	allowlistCfg, err := parseAllowlist(data)
+	if err != nil {
+		return fileConfig{}, err
+	}
+	gobgpConfig, err := readGobgpConfig(c.ConfigFile, data)
+	if err != nil {
+		return fileConfig{}, err
+	}
+	return fileConfig{
+		Gobgp: gobgpConfig, VrfExtensions: vrfExt, EventSinks: eventSinks, Allowlist: allowlistCfg,
+	}, nil
+}
+
+// Checks the config file contents, empty data means the running config file
+func (c *Config) validateConfig(data []byte) error {
+	if len(data) == 0 {
+		var err error
+		if data, err = os.ReadFile(c.ConfigFile); err != nil {
+			return err
+		}
+	}
+	var merr error
+	if _, err := parseVrfExtensions(data); err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	if _, err := parseEventSinks(data); err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	if _, err := parseAllowlist(data); err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	if err := checkVrfIds(data); err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	stripped, _, err := stripBergSections(data)
+	if err != nil {
+		return multierror.Append(merr, err)
+	}
+	if _, err = readGobgpConfigData(stripped); err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	return merr
+}
+
+func (c *Config) watchConfigChanges() <-chan fileConfig {
+	ch := make(chan fileConfig)
 	rateLimiter := rate.Sometimes{Interval: 1 * time.Second}
 	config.WatchConfigFile(c.ConfigFile, "toml", func() {
 		rateLimiter.Do(func() {
@@ -61,13 +188,16 @@ func (c *Config) watchConfigChanges() <-chan *oc.BgpConfigSet {
 }
 
 func ensureVrfIdDefined(fileName string) error {
-	file, err := os.Open(fileName)
+	data, err := os.ReadFile(fileName)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	return checkVrfIds(data)
+}
+
+func checkVrfIds(data []byte) error {
 	config := oc.BgpConfigSet{}
-	err = toml.NewDecoder(file).Decode(&config)
+	err := toml.Unmarshal(data, &config)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/amyasnikov/berg/internal/dto"
+)
+
+type stateInspector interface {
+	DumpState() dto.StateDump
+	CheckConsistency(ctx context.Context) (dto.ConsistencyReport, error)
+}
+
+// /debug/state dumps the controller maps, /debug/consistency cross-checks them against the GoBGP RIB
+func registerDebugHandlers(mux *http.ServeMux, berg stateInspector) {
+	mux.HandleFunc("/debug/state", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, berg.DumpState())
+	})
+	mux.HandleFunc("/debug/consistency", func(w http.ResponseWriter, r *http.Request) {
+		report, err := berg.CheckConsistency(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJson(w, report)
+	})
+}
+
+func writeJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubInspector struct {
+	report dto.ConsistencyReport
+	err    error
+}
+
+func (s stubInspector) DumpState() dto.StateDump {
+	return dto.StateDump{Vpnv4: dto.ControllerState{RdVrfMap: map[string]string{"100:10": "vrf_10"}}}
+}
+
+func (s stubInspector) CheckConsistency(context.Context) (dto.ConsistencyReport, error) {
+	return s.report, s.err
+}
+
+func TestDebugHandlers(t *testing.T) {
+	mux := http.NewServeMux()
+	registerDebugHandlers(mux, stubInspector{report: dto.ConsistencyReport{
+		Dangling: []dto.InconsistentRoute{{Direction: "vpnv4_to_evpn", Source: "100:10:10.0.0.0/24"}},
+	}})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/state", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var state dto.StateDump
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &state))
+	assert.Equal(t, "vrf_10", state.Vpnv4.RdVrfMap["100:10"])
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/consistency", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var report dto.ConsistencyReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.False(t, report.Consistent)
+	assert.Len(t, report.Dangling, 1)
+}
+
+func TestDebugHandlers_ListPathError(t *testing.T) {
+	mux := http.NewServeMux()
+	registerDebugHandlers(mux, stubInspector{err: errors.New("cannot list paths")})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/consistency", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
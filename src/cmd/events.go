@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/pelletier/go-toml/v2"
+)
+
+const (
+	eventQueueSize    = 10000
+	eventFlushTimeout = 5 * time.Second
+)
+
+// [[berg.event-sinks]] section of the config file
+type eventSinkConfig struct {
+	Type string `toml:"type"` // file, webhook or syslog
+	// file
+	Path       string `toml:"path"`
+	MaxSize    int64  `toml:"max-size"` // megabytes, 0 disables rotation
+	MaxBackups int    `toml:"max-backups"`
+	// webhook
+	Url           string `toml:"url"`
+	Timeout       string `toml:"timeout"`
+	Retries       int    `toml:"retries"`
+	RetryInterval string `toml:"retry-interval"`
+	// syslog
+	Network  string `toml:"network"`
+	Address  string `toml:"address"`
+	Facility string `toml:"facility"`
+}
+
+func parseEventSinks(data []byte) ([]eventSinkConfig, error) {
+	var cfg bergConfigFile
+	if err := toml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	for i, sink := range cfg.Berg.EventSinks {
+		if err := sink.validate(); err != nil {
+			return nil, fmt.Errorf("event sink #%d: %w", i+1, err)
+		}
+	}
+	return cfg.Berg.EventSinks, nil
+}
+
+func (c eventSinkConfig) validate() error {
+	switch c.Type {
+	case "file":
+		if c.Path == "" {
+			return fmt.Errorf("path is mandatory for file sink")
+		}
+	case "webhook":
+		if c.Url == "" {
+			return fmt.Errorf("url is mandatory for webhook sink")
+		}
+		if _, err := parseOptionalDuration(c.Timeout, 0); err != nil {
+			return fmt.Errorf("invalid timeout: %w", err)
+		}
+		if _, err := parseOptionalDuration(c.RetryInterval, 0); err != nil {
+			return fmt.Errorf("invalid retry-interval: %w", err)
+		}
+	case "syslog":
+		if c.Address == "" {
+			return fmt.Errorf("address is mandatory for syslog sink")
+		}
+		if _, err := events.NewSyslogSink(c.Network, c.Address, c.facility()); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown type %q", c.Type)
+	}
+	return nil
+}
+
+func (c eventSinkConfig) facility() string {
+	if c.Facility == "" {
+		return "local0"
+	}
+	return c.Facility
+}
+
+func (c eventSinkConfig) newSink() (events.Sink, error) {
+	switch c.Type {
+	case "file":
+		return events.NewFileSink(c.Path, c.MaxSize<<20, c.MaxBackups)
+	case "webhook":
+		timeout, _ := parseOptionalDuration(c.Timeout, 5*time.Second)
+		retryInterval, _ := parseOptionalDuration(c.RetryInterval, time.Second)
+		retries := c.Retries
+		if retries == 0 {
+			retries = 3
+		}
+		return events.NewWebhookSink(c.Url, timeout, retries, retryInterval), nil
+	case "syslog":
+		network := c.Network
+		if network == "" {
+			network = "udp"
+		}
+		return events.NewSyslogSink(network, c.Address, c.facility())
+	}
+	return nil, fmt.Errorf("unknown event sink type %q", c.Type)
+}
+
+func newEventSinks(configs []eventSinkConfig) ([]events.Sink, error) {
+	sinks := make([]events.Sink, 0, len(configs))
+	for _, cfg := range configs {
+		sink, err := cfg.newSink()
+		if err != nil {
+			for _, s := range sinks {
+				s.Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func parseOptionalDuration(value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+const testEventSinksConfig = `
+[global.config]
+  as = 65000
+  router-id = "10.0.0.1"
+
+[[berg.event-sinks]]
+  type = "file"
+  path = "/var/log/berg/events.jsonl"
+  max-size = 100
+  max-backups = 5
+
+[[berg.event-sinks]]
+  type = "webhook"
+  url = "http://127.0.0.1:8080/events"
+  timeout = "2s"
+
+[[berg.event-sinks]]
+  type = "syslog"
+  address = "127.0.0.1:514"
+`
+
+func TestParseEventSinks(t *testing.T) {
+	sinks, err := parseEventSinks([]byte(testEventSinksConfig))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []eventSinkConfig{
+		{Type: "file", Path: "/var/log/berg/events.jsonl", MaxSize: 100, MaxBackups: 5},
+		{Type: "webhook", Url: "http://127.0.0.1:8080/events", Timeout: "2s"},
+		{Type: "syslog", Address: "127.0.0.1:514"},
+	}, sinks)
+}
+
+func TestParseEventSinks_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown type":     `type = "kafka"`,
+		"no path":          `type = "file"`,
+		"invalid timeout":  "type = \"webhook\"\n  url = \"http://x\"\n  timeout = \"soon\"",
+		"unknown facility": "type = \"syslog\"\n  address = \"127.0.0.1:514\"\n  facility = \"mail2\"",
+	}
+	for name, sink := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseEventSinks([]byte("[[berg.event-sinks]]\n  " + sink))
+
+			assert.ErrorContains(t, err, "event sink #1")
+		})
+	}
+}
+
+func TestStripBergSections_EventSinks(t *testing.T) {
+	stripped, found, err := stripBergSections([]byte(testEventSinksConfig))
+
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.NotContains(t, string(stripped), "event-sinks")
+	_, err = readGobgpConfigData(stripped)
+	assert.NoError(t, err)
+}
+
+func TestNewEventSinks(t *testing.T) {
+	sinks, err := newEventSinks([]eventSinkConfig{
+		{Type: "file", Path: filepath.Join(t.TempDir(), "events.jsonl")},
+		{Type: "webhook", Url: "http://127.0.0.1:8080/events"},
+	})
+
+	assert.NoError(t, err)
+	assert.IsType(t, &events.FileSink{}, sinks[0])
+	assert.IsType(t, &events.WebhookSink{}, sinks[1])
+	for _, sink := range sinks {
+		assert.NoError(t, sink.Close())
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/utils"
+	"github.com/osrg/gobgp/v3/pkg/config"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Berg-specific VRF settings, [vrfs.berg] section of the config file
+type bergVrfConfig struct {
+	WithdrawHoldTime       string                  `toml:"withdraw-hold-time,omitempty"`
+	Mobility               string                  `toml:"mobility,omitempty"`
+	MobilityResetTime      string                  `toml:"mobility-reset-time,omitempty"`
+	StaticRoutes           []staticRouteConfig     `toml:"static-routes,omitempty"`
+	OrchestratedPrecedence string                  `toml:"orchestrated-precedence,omitempty"` // "bgp" or "orchestrator"
+	Aggregates             []aggregateConfig       `toml:"aggregates,omitempty"`
+	DefaultOriginate       bool                    `toml:"default-originate,omitempty"`
+	DefaultCondition       string                  `toml:"default-originate-condition,omitempty"` // EVPN prefix
+	SuppressImported       bool                    `toml:"default-originate-suppress-imported,omitempty"`
+	Leaks                  []leakConfig            `toml:"leaks,omitempty"`
+	MaxPrefix              uint32                  `toml:"max-prefix,omitempty"`
+	MaxPrefixNeighbor      uint32                  `toml:"max-prefix-neighbor,omitempty"`
+	MaxPrefixWarning       uint32                  `toml:"max-prefix-warning,omitempty"` // percent
+	MaxPrefixAction        string                  `toml:"max-prefix-action,omitempty"`  // "warn", "stop" or "withdraw"
+	GatewayCheck           bool                    `toml:"gateway-check,omitempty"`
+	AllowedGateways        []allowedGatewaysConfig `toml:"allowed-gateways,omitempty"`
+}
+
+// [[vrfs.berg.allowed-gateways]] section of the config file
+type allowedGatewaysConfig struct {
+	Neighbor string   `toml:"neighbor"` // address or dynamic-neighbor range
+	Subnets  []string `toml:"subnets"`
+}
+
+// [[vrfs.berg.leaks]] section of the config file
+type leakConfig struct {
+	Vrf       string   `toml:"vrf"`
+	Prefixes  []string `toml:"prefixes,omitempty"`
+	Direction string   `toml:"direction,omitempty"` // "import", "export" or "both"
+	Evpn      bool     `toml:"evpn,omitempty"`
+}
+
+// [[vrfs.berg.aggregates]] section of the config file
+type aggregateConfig struct {
+	Prefix      string `toml:"prefix"`
+	Gateway     string `toml:"gateway,omitempty"`
+	SummaryOnly bool   `toml:"summary-only,omitempty"`
+	AsSet       bool   `toml:"as-set,omitempty"`
+}
+
+// [[vrfs.berg.static-routes]] section of the config file
+type staticRouteConfig struct {
+	Prefix      string   `toml:"prefix"`
+	Gateway     string   `toml:"gateway"`
+	LocalPref   uint32   `toml:"local-pref,omitempty"`
+	Med         uint32   `toml:"med,omitempty"`
+	Communities []string `toml:"communities,omitempty"`
+}
+
+type bergConfigFile struct {
+	Berg struct {
+		EventSinks      []eventSinkConfig `toml:"event-sinks"`
+		PrefixAllowlist *allowlistConfig  `toml:"prefix-allowlist"`
+	} `toml:"berg"`
+	Vrfs []struct {
+		Config struct {
+			Name string `toml:"name"`
+		} `toml:"config"`
+		Berg bergVrfConfig `toml:"berg"`
+	} `toml:"vrfs"`
+}
+
+func newBergVrfConfig(ext dto.VrfExtensions) bergVrfConfig {
+	c := bergVrfConfig{Mobility: string(ext.Mobility), OrchestratedPrecedence: string(ext.OrchestratedPrecedence)}
+	if ext.WithdrawHoldTime != 0 {
+		c.WithdrawHoldTime = ext.WithdrawHoldTime.String()
+	}
+	if ext.MobilityResetTime != 0 {
+		c.MobilityResetTime = ext.MobilityResetTime.String()
+	}
+	for _, route := range ext.StaticRoutes {
+		c.StaticRoutes = append(c.StaticRoutes, staticRouteConfig(route))
+	}
+	for _, aggregate := range ext.Aggregates {
+		c.Aggregates = append(c.Aggregates, aggregateConfig(aggregate))
+	}
+	if ext.DefaultOriginate != nil {
+		c.DefaultOriginate = true
+		c.DefaultCondition = ext.DefaultOriginate.Condition
+		c.SuppressImported = ext.DefaultOriginate.SuppressImported
+	}
+	if ext.MaxPrefix != nil {
+		c.MaxPrefix, c.MaxPrefixNeighbor = ext.MaxPrefix.Vrf, ext.MaxPrefix.Neighbor
+		c.MaxPrefixWarning, c.MaxPrefixAction = ext.MaxPrefix.Warning, string(ext.MaxPrefix.Action)
+	}
+	if ext.GatewayCheck != nil {
+		c.GatewayCheck = true
+		for _, allowed := range ext.GatewayCheck.Allowed {
+			c.AllowedGateways = append(c.AllowedGateways, allowedGatewaysConfig(allowed))
+		}
+	}
+	for _, rule := range ext.Leaks {
+		c.Leaks = append(c.Leaks, leakConfig{
+			Vrf: rule.Vrf, Prefixes: rule.Prefixes, Direction: string(rule.Direction), Evpn: rule.Evpn,
+		})
+	}
+	return c
+}
+
+func (c bergVrfConfig) toDto() (ext dto.VrfExtensions, err error) {
+	if c.WithdrawHoldTime != "" {
+		ext.WithdrawHoldTime, err = time.ParseDuration(c.WithdrawHoldTime)
+		if err != nil {
+			return dto.VrfExtensions{}, fmt.Errorf("invalid withdraw-hold-time: %w", err)
+		}
+	}
+	switch mode := dto.MobilityMode(c.Mobility); mode {
+	case dto.MobilityNone, dto.MobilityLocalPref, dto.MobilityMacMobility:
+		ext.Mobility = mode
+	default:
+		return dto.VrfExtensions{}, fmt.Errorf("invalid mobility %q", c.Mobility)
+	}
+	switch precedence := dto.Precedence(c.OrchestratedPrecedence); precedence {
+	case dto.PrecedenceBgp, dto.PrecedenceOrchestrator:
+		ext.OrchestratedPrecedence = precedence
+	case "bgp":
+		ext.OrchestratedPrecedence = dto.PrecedenceBgp
+	default:
+		return dto.VrfExtensions{}, fmt.Errorf("invalid orchestrated-precedence %q", c.OrchestratedPrecedence)
+	}
+	if c.MobilityResetTime != "" {
+		ext.MobilityResetTime, err = time.ParseDuration(c.MobilityResetTime)
+		if err != nil {
+			return dto.VrfExtensions{}, fmt.Errorf("invalid mobility-reset-time: %w", err)
+		}
+	}
+	prefixes := map[netip.Prefix]bool{}
+	for _, routeCfg := range c.StaticRoutes {
+		route := dto.StaticRoute(routeCfg)
+		if err = utils.ValidateStaticRoute(route); err != nil {
+			return dto.VrfExtensions{}, err
+		}
+		prefix, _ := utils.StaticRoutePrefix(route)
+		if prefixes[prefix] {
+			return dto.VrfExtensions{}, fmt.Errorf("duplicate static route %s", prefix)
+		}
+		prefixes[prefix] = true
+		ext.StaticRoutes = append(ext.StaticRoutes, route)
+	}
+	clear(prefixes)
+	for _, aggregateCfg := range c.Aggregates {
+		aggregate := dto.Aggregate(aggregateCfg)
+		if err = utils.ValidateAggregate(aggregate); err != nil {
+			return dto.VrfExtensions{}, err
+		}
+		prefix, _ := utils.ParsePrefix(aggregate.Prefix)
+		if prefixes[prefix] {
+			return dto.VrfExtensions{}, fmt.Errorf("duplicate aggregate %s", prefix)
+		}
+		prefixes[prefix] = true
+		ext.Aggregates = append(ext.Aggregates, aggregate)
+	}
+	if !c.DefaultOriginate && (c.DefaultCondition != "" || c.SuppressImported) {
+		return dto.VrfExtensions{}, errors.New("default-originate options require default-originate = true")
+	}
+	if c.DefaultOriginate {
+		defaultOriginate := dto.DefaultOriginate{Condition: c.DefaultCondition, SuppressImported: c.SuppressImported}
+		if err = utils.ValidateDefaultOriginate(defaultOriginate); err != nil {
+			return dto.VrfExtensions{}, err
+		}
+		ext.DefaultOriginate = &defaultOriginate
+	}
+	maxPrefix := dto.MaxPrefix{
+		Vrf:      c.MaxPrefix,
+		Neighbor: c.MaxPrefixNeighbor,
+		Warning:  c.MaxPrefixWarning,
+		Action:   dto.MaxPrefixAction(c.MaxPrefixAction),
+	}
+	if c.MaxPrefixAction == "warn" {
+		maxPrefix.Action = dto.MaxPrefixWarn
+	}
+	if maxPrefix != (dto.MaxPrefix{}) || c.MaxPrefixAction != "" {
+		if err = utils.ValidateMaxPrefix(maxPrefix); err != nil {
+			return dto.VrfExtensions{}, err
+		}
+		ext.MaxPrefix = &maxPrefix
+	}
+	if !c.GatewayCheck && len(c.AllowedGateways) > 0 {
+		return dto.VrfExtensions{}, errors.New("allowed-gateways require gateway-check = true")
+	}
+	if c.GatewayCheck {
+		gatewayCheck := dto.GatewayCheck{}
+		for _, allowedCfg := range c.AllowedGateways {
+			gatewayCheck.Allowed = append(gatewayCheck.Allowed, dto.AllowedGateways(allowedCfg))
+		}
+		if err = utils.ValidateGatewayCheck(gatewayCheck); err != nil {
+			return dto.VrfExtensions{}, err
+		}
+		ext.GatewayCheck = &gatewayCheck
+	}
+	for _, leakCfg := range c.Leaks {
+		rule := dto.LeakRule{
+			Vrf: leakCfg.Vrf, Prefixes: leakCfg.Prefixes, Direction: dto.LeakDirection(leakCfg.Direction), Evpn: leakCfg.Evpn,
+		}
+		if leakCfg.Direction == "import" {
+			rule.Direction = dto.LeakImport
+		}
+		if err = utils.ValidateLeakRule(rule); err != nil {
+			return dto.VrfExtensions{}, err
+		}
+		ext.Leaks = append(ext.Leaks, rule)
+	}
+	return ext, nil
+}
+
+func parseVrfExtensions(data []byte) (map[string]dto.VrfExtensions, error) {
+	var cfg bergConfigFile
+	if err := toml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	result := make(map[string]dto.VrfExtensions, len(cfg.Vrfs))
+	for _, vrf := range cfg.Vrfs {
+		ext, err := vrf.Berg.toDto()
+		if err != nil {
+			return nil, fmt.Errorf("VRF %s: %w", vrf.Config.Name, err)
+		}
+		result[vrf.Config.Name] = ext
+	}
+	return result, nil
+}
+
+// Removes berg sections from the config file contents, found=false means there were none
+func stripBergSections(data []byte) (stripped []byte, found bool, err error) {
+	var raw map[string]any
+	if err = toml.Unmarshal(data, &raw); err != nil {
+		return nil, false, err
+	}
+	if _, found = raw["berg"]; found {
+		delete(raw, "berg")
+	}
+	vrfs, _ := raw["vrfs"].([]any)
+	for _, vrf := range vrfs {
+		if vrfMap, ok := vrf.(map[string]any); ok {
+			if _, ok = vrfMap["berg"]; ok {
+				delete(vrfMap, "berg")
+				found = true
+			}
+		}
+	}
+	if !found {
+		return data, false, nil
+	}
+	stripped, err = toml.Marshal(raw)
+	return stripped, true, err
+}
+
+// GoBGP rejects unknown keys, so berg sections are cut out before GoBGP parses the file
+func readGobgpConfig(fileName string, data []byte) (*oc.BgpConfigSet, error) {
+	stripped, found, err := stripBergSections(data)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return config.ReadConfigFile(fileName, "toml")
+	}
+	return readGobgpConfigData(stripped)
+}
+
+// GoBGP reads config from files only
+func readGobgpConfigData(data []byte) (*oc.BgpConfigSet, error) {
+	tmp, err := os.CreateTemp("", "berg-*.toml")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return config.ReadConfigFile(tmp.Name(), "toml")
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `
+[global.config]
+  as = 65000
+  router-id = "10.0.0.1"
+
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+    id = 10
+    rd = "65000:10"
+    both-rt-list = ["65000:10"]
+  [vrfs.berg]
+    withdraw-hold-time = "30s"
+    mobility = "local-pref"
+    mobility-reset-time = "10m"
+    orchestrated-precedence = "orchestrator"
+
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_20"
+    id = 20
+    rd = "65000:20"
+    both-rt-list = ["65000:20"]
+`
+
+func TestParseVrfExtensions(t *testing.T) {
+	result, err := parseVrfExtensions([]byte(testConfig))
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]dto.VrfExtensions{
+		"vrf_10": {
+			WithdrawHoldTime:       30 * time.Second,
+			Mobility:               dto.MobilityLocalPref,
+			MobilityResetTime:      10 * time.Minute,
+			OrchestratedPrecedence: dto.PrecedenceOrchestrator,
+		},
+		"vrf_20": {},
+	}, result)
+}
+
+func TestParseVrfExtensions_InvalidDuration(t *testing.T) {
+	_, err := parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [vrfs.berg]
+    withdraw-hold-time = "soon"
+`))
+
+	assert.ErrorContains(t, err, "vrf_10")
+}
+
+func TestParseVrfExtensions_InvalidMobility(t *testing.T) {
+	_, err := parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [vrfs.berg]
+    mobility = "med"
+`))
+
+	assert.ErrorContains(t, err, "invalid mobility")
+}
+
+func TestParseVrfExtensions_InvalidPrecedence(t *testing.T) {
+	_, err := parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [vrfs.berg]
+    orchestrated-precedence = "neighbor"
+`))
+
+	assert.ErrorContains(t, err, "invalid orchestrated-precedence")
+}
+
+func TestParseVrfExtensions_StaticRoutes(t *testing.T) {
+	result, err := parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [[vrfs.berg.static-routes]]
+    prefix = "10.0.5.0/24"
+    gateway = "192.168.0.5"
+    local-pref = 200
+    communities = ["65000:1"]
+  [[vrfs.berg.static-routes]]
+    prefix = "10.0.6.0/24"
+    gateway = "192.168.0.6"
+`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []dto.StaticRoute{
+		{Prefix: "10.0.5.0/24", Gateway: "192.168.0.5", LocalPref: 200, Communities: []string{"65000:1"}},
+		{Prefix: "10.0.6.0/24", Gateway: "192.168.0.6"},
+	}, result["vrf_10"].StaticRoutes)
+}
+
+func TestParseVrfExtensions_InvalidStaticRoutes(t *testing.T) {
+	_, err := parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [[vrfs.berg.static-routes]]
+    prefix = "10.0.5.0/24"
+`))
+	assert.ErrorContains(t, err, "vrf_10: static route 10.0.5.0/24: invalid IPv4 gateway")
+
+	_, err = parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [[vrfs.berg.static-routes]]
+    prefix = "10.0.5.0/24"
+    gateway = "192.168.0.5"
+  [[vrfs.berg.static-routes]]
+    prefix = "10.0.5.1/24"
+    gateway = "192.168.0.6"
+`))
+	assert.ErrorContains(t, err, "duplicate static route 10.0.5.0/24")
+}
+
+func TestParseVrfExtensions_Aggregates(t *testing.T) {
+	result, err := parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [[vrfs.berg.aggregates]]
+    prefix = "10.0.0.0/16"
+    summary-only = true
+    as-set = true
+  [[vrfs.berg.aggregates]]
+    prefix = "10.1.0.0/16"
+    gateway = "192.168.0.1"
+`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []dto.Aggregate{
+		{Prefix: "10.0.0.0/16", SummaryOnly: true, AsSet: true},
+		{Prefix: "10.1.0.0/16", Gateway: "192.168.0.1"},
+	}, result["vrf_10"].Aggregates)
+
+	_, err = parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [[vrfs.berg.aggregates]]
+    prefix = "10.0.0.0/16"
+  [[vrfs.berg.aggregates]]
+    prefix = "10.0.1.0/16"
+`))
+	assert.ErrorContains(t, err, "duplicate aggregate 10.0.0.0/16")
+}
+
+func TestParseVrfExtensions_DefaultOriginate(t *testing.T) {
+	result, err := parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [vrfs.berg]
+    default-originate = true
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_20"
+  [vrfs.berg]
+    default-originate = true
+    default-originate-condition = "0.0.0.0/0"
+    default-originate-suppress-imported = true
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_30"
+`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, &dto.DefaultOriginate{}, result["vrf_10"].DefaultOriginate)
+	assert.Equal(t,
+		&dto.DefaultOriginate{Condition: "0.0.0.0/0", SuppressImported: true}, result["vrf_20"].DefaultOriginate)
+	assert.Nil(t, result["vrf_30"].DefaultOriginate)
+
+	for config, expected := range map[string]string{
+		`default-originate = true
+    default-originate-condition = "default"`: `default-originate condition: invalid IPv4 prefix "default"`,
+		`default-originate-suppress-imported = true`: "default-originate options require default-originate = true",
+	} {
+		_, err = parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [vrfs.berg]
+    ` + config))
+		assert.ErrorContains(t, err, expected)
+	}
+}
+
+func TestParseVrfExtensions_Leaks(t *testing.T) {
+	result, err := parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [vrfs.berg]
+    [[vrfs.berg.leaks]]
+      vrf = "vrf_20"
+      prefixes = ["10.0.0.0/8"]
+    [[vrfs.berg.leaks]]
+      vrf = "vrf_30"
+      direction = "import"
+    [[vrfs.berg.leaks]]
+      vrf = "vrf_40"
+      direction = "both"
+      evpn = true
+`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []dto.LeakRule{
+		{Vrf: "vrf_20", Prefixes: []string{"10.0.0.0/8"}},
+		{Vrf: "vrf_30"},
+		{Vrf: "vrf_40", Direction: dto.LeakBoth, Evpn: true},
+	}, result["vrf_10"].Leaks)
+
+	for config, expected := range map[string]string{
+		`prefixes = ["10.0.0.0/8"]`: "leak: VRF is required",
+		`vrf = "vrf_20"
+      direction = "in"`: `leak vrf_20: invalid direction "in"`,
+		`vrf = "vrf_20"
+      prefixes = ["10.0.0.0"]`: "leak vrf_20: ",
+	} {
+		_, err = parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [vrfs.berg]
+    [[vrfs.berg.leaks]]
+      ` + config))
+		assert.ErrorContains(t, err, expected)
+	}
+}
+
+func TestParseVrfExtensions_MaxPrefix(t *testing.T) {
+	result, err := parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [vrfs.berg]
+    max-prefix = 10000
+    max-prefix-neighbor = 1000
+    max-prefix-warning = 80
+    max-prefix-action = "withdraw"
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_20"
+  [vrfs.berg]
+    max-prefix = 100
+    max-prefix-action = "warn"
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_30"
+`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, &dto.MaxPrefix{Vrf: 10000, Neighbor: 1000, Warning: 80, Action: dto.MaxPrefixWithdraw},
+		result["vrf_10"].MaxPrefix)
+	assert.Equal(t, &dto.MaxPrefix{Vrf: 100}, result["vrf_20"].MaxPrefix)
+	assert.Nil(t, result["vrf_30"].MaxPrefix)
+
+	for config, expected := range map[string]string{
+		`max-prefix-warning = 80`: "max-prefix: no limit is set",
+		`max-prefix = 100
+    max-prefix-warning = 120`: "max-prefix: warning threshold 120% is over 100%",
+		`max-prefix = 100
+    max-prefix-action = "shutdown"`: `max-prefix: invalid action "shutdown"`,
+	} {
+		_, err = parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [vrfs.berg]
+    ` + config))
+		assert.ErrorContains(t, err, expected)
+	}
+}
+
+func TestParseVrfExtensions_GatewayCheck(t *testing.T) {
+	result, err := parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [vrfs.berg]
+    gateway-check = true
+    [[vrfs.berg.allowed-gateways]]
+      neighbor = "192.168.0.10"
+      subnets = ["10.0.5.0/24"]
+    [[vrfs.berg.allowed-gateways]]
+      neighbor = "192.168.1.0/24"
+      subnets = ["10.1.0.0/16", "10.2.0.0/16"]
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_20"
+  [vrfs.berg]
+    gateway-check = true
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_30"
+`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, &dto.GatewayCheck{Allowed: []dto.AllowedGateways{
+		{Neighbor: "192.168.0.10", Subnets: []string{"10.0.5.0/24"}},
+		{Neighbor: "192.168.1.0/24", Subnets: []string{"10.1.0.0/16", "10.2.0.0/16"}},
+	}}, result["vrf_10"].GatewayCheck)
+	assert.Equal(t, &dto.GatewayCheck{}, result["vrf_20"].GatewayCheck)
+	assert.Nil(t, result["vrf_30"].GatewayCheck)
+
+	for config, expected := range map[string]string{
+		`[[vrfs.berg.allowed-gateways]]
+      neighbor = "192.168.0.10"
+      subnets = ["10.0.5.0/24"]`: "allowed-gateways require gateway-check = true",
+		`gateway-check = true
+    [[vrfs.berg.allowed-gateways]]
+      neighbor = "vm1"
+      subnets = ["10.0.5.0/24"]`: "invalid IPv4 neighbor address or range",
+	} {
+		_, err = parseVrfExtensions([]byte(`
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+  [vrfs.berg]
+    ` + config))
+		assert.ErrorContains(t, err, expected)
+	}
+}
+
+func TestStripBergSections(t *testing.T) {
+	stripped, found, err := stripBergSections([]byte(testConfig))
+
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.NotContains(t, string(stripped), "berg")
+	assert.NotContains(t, string(stripped), "withdraw-hold-time")
+	assert.Contains(t, string(stripped), "vrf_20")
+}
+
+func TestStripBergSections_NotFound(t *testing.T) {
+	data := []byte(`[global.config]
+  as = 65000
+`)
+	stripped, found, err := stripBergSections(data)
+
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, data, stripped)
+}
+
+func TestReadGobgpConfig(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "berg.toml")
+	assert.NoError(t, os.WriteFile(fileName, []byte(testConfig), 0o600))
+
+	cfg, err := readGobgpConfig(fileName, []byte(testConfig))
+
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Vrfs, 2)
+	assert.Equal(t, "65000:10", cfg.Vrfs[0].Config.Rd)
+}
+
+func TestValidateConfig(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "berg.toml")
+	assert.NoError(t, os.WriteFile(fileName, []byte(testConfig), 0o600))
+	cfg := Config{ConfigFile: fileName}
+
+	assert.NoError(t, cfg.validateConfig(nil))
+	assert.NoError(t, cfg.validateConfig([]byte(testConfig)))
+
+	err := cfg.validateConfig([]byte(`
+[global.config]
+  as = 65000
+  unknown-key = 1
+
+[[vrfs]]
+  [vrfs.config]
+    name = "vrf_10"
+    rd = "65000:10"
+  [vrfs.berg]
+    withdraw-hold-time = "soon"
+`))
+	assert.ErrorContains(t, err, "withdraw-hold-time")
+	assert.ErrorContains(t, err, "ID is mandatory")
+	assert.ErrorContains(t, err, "unknown-key")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/app"
+	"github.com/amyasnikov/berg/internal/health"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/sirupsen/logrus"
+)
+
+// The event loop is considered stuck if it has not run for this long
+const maxEventLoopDelay = 30 * time.Second
+
+type peerLister interface {
+	ListPeer(ctx context.Context, r *api.ListPeerRequest, fn func(*api.Peer)) error
+}
+
+// EVPN uplinks of the config file, i.e. the neighbors with l2vpn-evpn family such as the route reflectors.
+// Readiness depends on their sessions only, the VM sessions and the neighbors added through the API do not count
+type evpnUplinks struct {
+	addresses atomic.Pointer[map[string]bool]
+}
+
+func newEvpnUplinks(cfg *oc.BgpConfigSet) *evpnUplinks {
+	u := &evpnUplinks{}
+	u.Update(cfg)
+	return u
+}
+
+// Picks the uplinks up from the reloaded config
+func (u *evpnUplinks) Update(cfg *oc.BgpConfigSet) {
+	peerGroups := make(map[string]oc.PeerGroup, len(cfg.PeerGroups))
+	for _, group := range cfg.PeerGroups {
+		peerGroups[group.Config.PeerGroupName] = group
+	}
+	addresses := map[string]bool{}
+	for _, neighbor := range cfg.Neighbors {
+		afiSafis := neighbor.AfiSafis
+		if len(afiSafis) == 0 { // inherited from the peer group
+			afiSafis = peerGroups[neighbor.Config.PeerGroup].AfiSafis
+		}
+		if neighbor.Config.NeighborAddress != "" && hasEvpnAfiSafi(afiSafis) {
+			addresses[neighbor.Config.NeighborAddress] = true
+		}
+	}
+	u.addresses.Store(&addresses)
+}
+
+func (u *evpnUplinks) Contains(address string) bool {
+	return (*u.addresses.Load())[address]
+}
+
+func hasEvpnAfiSafi(afiSafis []oc.AfiSafi) bool {
+	for _, afiSafi := range afiSafis {
+		if afiSafi.Config.AfiSafiName == oc.AFI_SAFI_TYPE_L2VPN_EVPN {
+			return true
+		}
+	}
+	return false
+}
+
+func registerHealthChecks(mux *http.ServeMux, berg *app.App, bgpServer peerLister, uplinks *evpnUplinks) {
+	mux.Handle("/healthz", health.Handler(
+		health.Check{Name: "event_loop", Run: func(context.Context) error {
+			return berg.CheckEventLoop(maxEventLoopDelay)
+		}},
+	))
+	mux.Handle("/readyz", health.Handler(
+		health.Check{Name: "converged", Run: func(context.Context) error { return berg.CheckConverged() }},
+		health.Check{Name: "evpn_sessions", Run: evpnSessionsCheck(bgpServer, uplinks)},
+		health.Check{Name: "last_reload", Run: func(context.Context) error { return berg.CheckLastReload() }},
+	))
+}
+
+// Serves the health checks regardless of the metrics, which share the server if they share the address
+func serveHealth(cfg Config, berg *app.App, bgpServer peerLister, uplinks *evpnUplinks, logger *logrus.Logger) {
+	mux := http.NewServeMux()
+	registerHealthChecks(mux, berg, bgpServer, uplinks)
+	switch cfg.MetricsAddress {
+	case "":
+	case cfg.HealthAddress:
+		registerMetrics(mux, berg)
+	default:
+		serveMetrics(cfg.MetricsAddress, berg, logger)
+	}
+	go func() {
+		logger.Infof("serving health checks on %s", cfg.HealthAddress)
+		if err := http.ListenAndServe(cfg.HealthAddress, mux); err != nil {
+			logger.Fatalf("cannot serve health checks: %v", err)
+		}
+	}()
+}
+
+// Fails unless every EVPN uplink is established
+func evpnSessionsCheck(bgpServer peerLister, uplinks *evpnUplinks) func(context.Context) error {
+	return func(ctx context.Context) error {
+		down := []string{}
+		err := bgpServer.ListPeer(ctx, &api.ListPeerRequest{}, func(peer *api.Peer) {
+			address := peer.GetConf().GetNeighborAddress()
+			if !uplinks.Contains(address) {
+				return
+			}
+			if state := peer.GetState().GetSessionState(); state != api.PeerState_ESTABLISHED {
+				down = append(down, fmt.Sprintf("%s is %s", address, state))
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if len(down) > 0 {
+			sort.Strings(down)
+			return fmt.Errorf("EVPN sessions are not established: %s", strings.Join(down, ", "))
+		}
+		return nil
+	}
+}
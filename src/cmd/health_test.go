@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubPeerLister []*api.Peer
+
+func (l stubPeerLister) ListPeer(ctx context.Context, r *api.ListPeerRequest, fn func(*api.Peer)) error {
+	for _, peer := range l {
+		fn(peer)
+	}
+	return nil
+}
+
+func testPeer(address string, state api.PeerState_SessionState, afi api.Family_Afi, safi api.Family_Safi) *api.Peer {
+	return &api.Peer{
+		Conf:  &api.PeerConf{NeighborAddress: address},
+		State: &api.PeerState{SessionState: state},
+		AfiSafis: []*api.AfiSafi{
+			{Config: &api.AfiSafiConfig{Family: &api.Family{Afi: afi, Safi: safi}}},
+		},
+	}
+}
+
+func TestEvpnSessionsCheck(t *testing.T) {
+	uplinks := newEvpnUplinks(&oc.BgpConfigSet{
+		Neighbors: []oc.Neighbor{
+			{
+				Config:   oc.NeighborConfig{NeighborAddress: "10.0.0.1"},
+				AfiSafis: []oc.AfiSafi{{Config: oc.AfiSafiConfig{AfiSafiName: oc.AFI_SAFI_TYPE_L2VPN_EVPN}}},
+			},
+			{Config: oc.NeighborConfig{NeighborAddress: "10.0.0.2", PeerGroup: "spines"}},
+			{
+				Config:   oc.NeighborConfig{NeighborAddress: "192.168.0.10"},
+				AfiSafis: []oc.AfiSafi{{Config: oc.AfiSafiConfig{AfiSafiName: oc.AFI_SAFI_TYPE_IPV4_UNICAST}}},
+			},
+		},
+		PeerGroups: []oc.PeerGroup{{
+			Config:   oc.PeerGroupConfig{PeerGroupName: "spines"},
+			AfiSafis: []oc.AfiSafi{{Config: oc.AfiSafiConfig{AfiSafiName: oc.AFI_SAFI_TYPE_L2VPN_EVPN}}},
+		}},
+	})
+	established := testPeer("10.0.0.1", api.PeerState_ESTABLISHED, api.Family_AFI_L2VPN, api.Family_SAFI_EVPN)
+	vmPeer := testPeer("192.168.0.10", api.PeerState_ACTIVE, api.Family_AFI_IP, api.Family_SAFI_UNICAST)
+	down := testPeer("10.0.0.2", api.PeerState_ACTIVE, api.Family_AFI_L2VPN, api.Family_SAFI_EVPN)
+	// added through the API rather than the config file
+	unknown := testPeer("10.0.0.3", api.PeerState_ACTIVE, api.Family_AFI_L2VPN, api.Family_SAFI_EVPN)
+
+	tests := []struct {
+		name    string
+		peers   stubPeerLister
+		wantErr string
+	}{
+		{name: "uplinks established", peers: stubPeerLister{established, vmPeer, unknown}},
+		{
+			name:    "uplink of the peer group down",
+			peers:   stubPeerLister{established, vmPeer, down},
+			wantErr: "EVPN sessions are not established: 10.0.0.2 is ACTIVE",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := evpnSessionsCheck(tt.peers, uplinks)(context.Background())
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	// the reloaded config drops the uplink
+	uplinks.Update(&oc.BgpConfigSet{})
+	assert.NoError(t, evpnSessionsCheck(stubPeerLister{down}, uplinks)(context.Background()))
+}
@@ -7,53 +7,97 @@ import (
 	"syscall"
 
 	"github.com/amyasnikov/berg/internal/app"
+	"github.com/amyasnikov/berg/internal/bergapi"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/logging"
+	"github.com/amyasnikov/berg/internal/tracing"
+	api "github.com/osrg/gobgp/v3/api"
 	"github.com/osrg/gobgp/v3/pkg/config"
-	"github.com/osrg/gobgp/v3/pkg/log"
 	"github.com/osrg/gobgp/v3/pkg/server"
-	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
-	var logger = logrus.New()
-	logger.SetOutput(os.Stdout)
-	logger.SetFormatter(&logrus.JSONFormatter{})
+	logs := logging.New(os.Stdout)
+	logger := logs.Logger(logging.App)
 	opts := NewConfig(logger)
-	switch opts.LogLevel {
-	case "debug":
-		logger.SetLevel(logrus.DebugLevel)
-	case "info":
-		logger.SetLevel(logrus.InfoLevel)
-	case "error":
-		logger.SetLevel(logrus.ErrorLevel)
-	default:
-		logger.SetLevel(logrus.InfoLevel)
+	if err := logs.SetFormat(opts.LogFormat); err != nil {
+		logger.Fatal(err)
+	}
+	if err := logs.SetLevels(opts.LogLevel); err != nil {
+		logger.Fatalf("invalid log level: %v", err)
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), opts.Tracing)
+	if err != nil {
+		logger.Fatalf("cannot set up tracing: %v", err)
 	}
 	maxSize := 256 << 20
-	grpcOpts := []grpc.ServerOption{grpc.MaxRecvMsgSize(maxSize), grpc.MaxSendMsgSize(maxSize)}
+	bergApi := bergapi.NewServer()
+	grpcOpts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(maxSize), grpc.MaxSendMsgSize(maxSize), bergApi.ServerOption(),
+	}
 	logger.Info("berg started")
-	bgpLogger := log.NewDefaultLogger()
+	bgpLogger := logging.NewGobgpLogger(logs.Logger(logging.Gobgp))
 	bgpServer := server.NewBgpServer(
 		server.GrpcListenAddress(opts.GrpcHosts),
 		server.GrpcOption(grpcOpts),
 		server.LoggerOption(bgpLogger))
 	bufSize := 100000
 	vrfConfig := extractVrfConfig(opts.GobgpConfig.Vrfs)
-	berg := app.NewApp(vrfConfig, bgpServer, uint64(bufSize), logger)
+	// bulk injection goes through the GoBGP gRPC API, since AddPathStream is not exposed by BgpServer
+	grpcAddress, err := localGrpcAddress(opts.GrpcHosts)
+	if err != nil {
+		logger.Fatalf("cannot stream paths to the gRPC API: %v", err)
+	}
+	grpcConn, err := grpc.Dial(
+		grpcAddress,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(maxSize)),
+	)
+	if err != nil {
+		logger.Fatalf("cannot connect to gRPC API %s: %v", grpcAddress, err)
+	}
+	defer grpcConn.Close()
+	eventSinks, err := newEventSinks(opts.EventSinks)
+	if err != nil {
+		logger.Fatalf("cannot create event sink: %v", err)
+	}
+	eventDispatcher := events.NewDispatcher(logger, eventQueueSize, eventSinks...)
+	appOpts := []app.Option{
+		app.WithWorkers(opts.Workers),
+		app.WithPathStreamer(api.NewGobgpApiClient(grpcConn)),
+		app.WithVrfExtensions(opts.VrfExtensions),
+		app.WithEventPublisher(eventDispatcher),
+		app.WithStartupHoldDown(extractNeighborFamilies(opts.GobgpConfig.Neighbors), opts.StartupHoldTime),
+		app.WithReconciliation(opts.ReconcileInterval, opts.ReconcileRate),
+		app.WithVrfDiscovery(opts.VrfDiscovery),
+		app.WithSubsystemLoggers(logs.Logger(logging.Controller), logs.Logger(logging.Injector)),
+	}
+	if opts.Allowlist != nil {
+		appOpts = append(appOpts, app.WithPrefixAllowlist(opts.Allowlist.newWatcher(logger)))
+	}
+	berg := app.NewApp(vrfConfig, bgpServer, uint64(bufSize), logger, appOpts...)
+	reloadRequests := make(chan chan error)
+	vrfChanges := make(chan vrfChange)
+	bergApi.SetBackend(&apiBackend{
+		App: berg, config: &opts, reloads: reloadRequests, vrfChanges: vrfChanges, logs: logs,
+	})
 	ctx, stopBerg := context.WithCancel(context.Background())
 	go bgpServer.Serve()
-	_, err := config.InitialConfig(context.Background(), bgpServer, opts.GobgpConfig, false)
+	_, err = config.InitialConfig(context.Background(), bgpServer, opts.GobgpConfig, false)
 	if err != nil {
-		logger.WithFields(logrus.Fields{
-			"Topic": "Config",
-			"Error": err,
-		}).Fatalf("Failed to apply initial configuration %s", opts.ConfigFile)
+		logger.WithError(err).Fatalf("Failed to apply initial configuration %s", opts.ConfigFile)
 	}
 
 	go berg.Serve(ctx)
+	uplinks := newEvpnUplinks(opts.GobgpConfig)
+	serveHealth(opts, berg, bgpServer, uplinks, logger)
 	configChanged := opts.watchConfigChanges()
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	debugCh := make(chan os.Signal, 1)
+	signal.Notify(debugCh, syscall.SIGUSR1)
 	stop := func(msg string, args ...any) {
 
 		logger.Errorf(msg, args...)
@@ -61,24 +105,57 @@ func main() {
 		bgpServer.Stop()
 		os.Exit(1)
 	}
+	applyConfig := func(newConfig fileConfig) {
+		vrfDiff := getVrfDiff(opts.GobgpConfig.Vrfs, newConfig.Gobgp.Vrfs)
+		err := applyVrfChanges(bgpServer, vrfDiff.Created, vrfDiff.Deleted)
+		if err != nil {
+			stop("cannot update config: %s", err)
+		}
+		opts.GobgpConfig, err = config.UpdateConfig(
+			context.Background(), bgpServer, opts.GobgpConfig, newConfig.Gobgp,
+		)
+		if err != nil {
+			stop("cannot update config: %s", err)
+		}
+		uplinks.Update(opts.GobgpConfig)
+		opts.VrfExtensions = newConfig.VrfExtensions
+		vrfDiff.Extensions = newConfig.VrfExtensions
+		berg.ReloadConfig(vrfDiff)
+	}
 	for {
 		select {
 		case sig := <-sigCh:
 			logger.Infof("Received %s — shutting down.", sig)
 			stopBerg()
 			bgpServer.Stop()
+			eventDispatcher.Close(eventFlushTimeout)
+			flushCtx, cancelFlush := context.WithTimeout(context.Background(), eventFlushTimeout)
+			shutdownTracing(flushCtx)
+			cancelFlush()
 			return
+		case <-debugCh:
+			if logs.ToggleDebug() {
+				logger.Warnf("SIGUSR1 received, debug logging enabled: %s", logging.FormatLevels(logs.Levels()))
+			} else {
+				logger.Warnf("SIGUSR1 received, debug logging disabled: %s", logging.FormatLevels(logs.Levels()))
+			}
 		case newConfig := <-configChanged:
-			vrfDiff := getVrfDiff(opts.GobgpConfig.Vrfs, newConfig.Vrfs)
-			err = applyVrfChanges(bgpServer, vrfDiff.Created, vrfDiff.Deleted)
-			if err != nil {
-				stop("cannot update config: %s", err)
+			applyConfig(newConfig)
+		case done := <-reloadRequests:
+			logger.Info("Reloading configuration on API request")
+			newConfig, err := opts.readConfig()
+			if err == nil {
+				applyConfig(newConfig)
 			}
-			opts.GobgpConfig, err = config.UpdateConfig(context.Background(), bgpServer, opts.GobgpConfig, newConfig)
+			done <- err
+		case change := <-vrfChanges:
+			err := opts.changeVrf(change, bgpServer, berg)
 			if err != nil {
-				stop("cannot update config: %s", err)
+				logger.WithError(err).Errorf("cannot change VRF %s on API request", change.vrf.Name)
+			} else {
+				logger.Infof("VRF %s changed on API request", change.vrf.Name)
 			}
-			berg.ReloadConfig(vrfDiff)
+			change.done <- err
 		}
 	}
 }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/amyasnikov/berg/internal/app"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// Serves Prometheus metrics along with the debug endpoints
+func serveMetrics(address string, berg *app.App, logger *logrus.Logger) {
+	mux := http.NewServeMux()
+	registerMetrics(mux, berg)
+	go func() {
+		logger.Infof("serving metrics and debug endpoints on %s", address)
+		if err := http.ListenAndServe(address, mux); err != nil {
+			logger.Fatalf("cannot serve metrics: %v", err)
+		}
+	}()
+}
+
+func registerMetrics(mux *http.ServeMux, berg *app.App) {
+	metrics.Registry.MustRegister(metrics.NewStateCollector(berg))
+	mux.Handle("/metrics", metrics.Handler())
+	registerDebugHandlers(mux, berg)
+}
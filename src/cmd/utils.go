@@ -2,6 +2,10 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
 
 	"github.com/amyasnikov/berg/internal/dto"
 	"github.com/amyasnikov/berg/internal/utils"
@@ -23,6 +27,44 @@ func extractVrfConfig(vrfs []oc.Vrf) []oc.VrfConfig {
 	return vrfConfig
 }
 
+func extractNeighborFamilies(neighbors []oc.Neighbor) map[string][]string {
+	result := make(map[string][]string, len(neighbors))
+	for _, neighbor := range neighbors {
+		if neighbor.Config.NeighborAddress == "" {
+			continue
+		}
+		families := make([]string, 0, len(neighbor.AfiSafis))
+		for _, afiSafi := range neighbor.AfiSafis {
+			families = append(families, string(afiSafi.Config.AfiSafiName))
+		}
+		result[neighbor.Config.NeighborAddress] = families
+	}
+	return result
+}
+
+// Returns the target to reach the gRPC API of this process, api-host may hold several comma-separated addresses.
+// The API is served without TLS, since grpcOpts set no credentials
+func localGrpcAddress(hosts string) (string, error) {
+	host := strings.TrimSpace(strings.Split(hosts, ",")[0])
+	if path, ok := strings.CutPrefix(host, "unix://"); ok {
+		if path == "" {
+			return "", fmt.Errorf("invalid gRPC API address %q: empty socket path", host)
+		}
+		return "unix:" + path, nil
+	}
+	addr, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid gRPC API address %q: %w", host, err)
+	}
+	switch ip, _ := netip.ParseAddr(addr); {
+	case addr == "" || ip == netip.IPv4Unspecified():
+		addr = "127.0.0.1"
+	case ip == netip.IPv6Unspecified():
+		addr = "::1"
+	}
+	return net.JoinHostPort(addr, port), nil
+}
+
 func getVrfDiff(old, new []oc.Vrf) dto.VrfDiff {
 	getCfg := func(vrfs []oc.Vrf) []oc.VrfConfig {
 		configs := make([]oc.VrfConfig, 0, len(vrfs))
@@ -78,7 +120,9 @@ func applyVrfChanges(bgpServer VrfManager, created, deleted []oc.VrfConfig) erro
 			ImportRt: importRt,
 			ExportRt: exportRt,
 		}}
-		bgpServer.AddVrf(context.Background(), req)
+		if err = bgpServer.AddVrf(context.Background(), req); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -182,6 +182,17 @@ func TestApplyVrfChanges_ErrorHandling(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "add VRF rejected by GoBGP",
+			created: []oc.VrfConfig{
+				{Id: 1, Name: "vrf1", Rd: "65000:1", BothRtList: []string{"65000:100"}},
+			},
+			mockSetup: func(m *MockVrfManager) {
+				m.On("AddVrf", mock.Anything, mock.Anything).Return(errors.New("duplicate RD"))
+			},
+			wantErr:     true,
+			expectedErr: "duplicate RD",
+		},
 	}
 
 	for _, tt := range tests {
@@ -315,3 +326,48 @@ func TestApplyVrfChanges_MixedOperations(t *testing.T) {
 	assert.NoError(t, err)
 	mockManager.AssertExpectations(t)
 }
+
+func TestLocalGrpcAddress(t *testing.T) {
+	tests := map[string]string{
+		":50051":                      "127.0.0.1:50051",
+		"0.0.0.0:50051":               "127.0.0.1:50051",
+		"[::]:50051":                  "[::1]:50051",
+		"10.0.0.1:50051,:50052":       "10.0.0.1:50051",
+		"[2001:db8::1]:50051":         "[2001:db8::1]:50051",
+		"localhost:50051":             "localhost:50051",
+		"unix:///var/run/gobgpd.sock": "unix:/var/run/gobgpd.sock",
+		" unix://gobgpd.sock, :50051": "unix:gobgpd.sock",
+	}
+	for hosts, want := range tests {
+		got, err := localGrpcAddress(hosts)
+		assert.NoError(t, err, hosts)
+		assert.Equal(t, want, got, hosts)
+	}
+	for _, hosts := range []string{"", "50051", "unix://"} {
+		_, err := localGrpcAddress(hosts)
+		assert.Error(t, err, hosts)
+	}
+}
+
+func TestExtractNeighborFamilies(t *testing.T) {
+	neighbors := []oc.Neighbor{
+		{
+			Config: oc.NeighborConfig{NeighborAddress: "10.5.0.4"},
+			AfiSafis: []oc.AfiSafi{
+				{Config: oc.AfiSafiConfig{AfiSafiName: oc.AFI_SAFI_TYPE_L2VPN_EVPN}},
+			},
+		},
+		{
+			Config: oc.NeighborConfig{NeighborAddress: "10.5.0.1", Vrf: "vrf_10"},
+			AfiSafis: []oc.AfiSafi{
+				{Config: oc.AfiSafiConfig{AfiSafiName: oc.AFI_SAFI_TYPE_IPV4_UNICAST}},
+			},
+		},
+		{Config: oc.NeighborConfig{NeighborInterface: "eth0"}},
+	}
+
+	assert.Equal(t, map[string][]string{
+		"10.5.0.4": {"l2vpn-evpn"},
+		"10.5.0.1": {"ipv4-unicast"},
+	}, extractNeighborFamilies(neighbors))
+}
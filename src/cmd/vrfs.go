@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/utils"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/pelletier/go-toml/v2"
+)
+
+type vrfOperation int
+
+const (
+	vrfAdd vrfOperation = iota
+	vrfUpdate
+	vrfDelete
+)
+
+// VRF change requested through BergService, handled by the main loop like a config file reload
+type vrfChange struct {
+	operation vrfOperation
+	vrf       dto.Vrf // just the name for deletion
+	persist   bool
+	done      chan error
+}
+
+type vrfReloader interface {
+	ReloadConfig(dto.VrfDiff)
+}
+
+// [[vrfs]] table of the config file written for a VRF changed through BergService
+type vrfFileTable struct {
+	Config struct {
+		Name         string   `toml:"name"`
+		Id           uint32   `toml:"id"`
+		Rd           string   `toml:"rd"`
+		ImportRtList []string `toml:"import-rt-list,omitempty"`
+		ExportRtList []string `toml:"export-rt-list,omitempty"`
+	} `toml:"config"`
+	Berg *bergVrfConfig `toml:"berg,omitempty"`
+}
+
+// Applies the change to GoBGP and berg, then writes it to the config file if requested.
+// A change which is not written to the file is reverted by the next config reload
+func (c *Config) changeVrf(change vrfChange, bgpServer VrfManager, berg vrfReloader) error {
+	vrfs, err := changedVrfs(c.GobgpConfig.Vrfs, change)
+	if err != nil {
+		return err
+	}
+	extensions := maps.Clone(c.VrfExtensions)
+	if extensions == nil {
+		extensions = map[string]dto.VrfExtensions{}
+	}
+	if change.operation == vrfDelete {
+		delete(extensions, change.vrf.Name)
+	} else {
+		extensions[change.vrf.Name] = change.vrf.VrfExtensions
+	}
+	diff := getVrfDiff(c.GobgpConfig.Vrfs, vrfs)
+	if err = applyVrfChanges(bgpServer, diff.Created, diff.Deleted); err != nil {
+		return err
+	}
+	gobgpConfig := *c.GobgpConfig
+	gobgpConfig.Vrfs = vrfs
+	c.GobgpConfig = &gobgpConfig
+	c.VrfExtensions = extensions
+	diff.Extensions = extensions
+	berg.ReloadConfig(diff)
+	if change.persist {
+		if err = persistVrfChange(c.ConfigFile, change); err != nil {
+			return fmt.Errorf("VRF %s is changed, but not written to the config file: %w", change.vrf.Name, err)
+		}
+	}
+	return nil
+}
+
+// Returns the VRFs as they are after the change
+func changedVrfs(vrfs []oc.Vrf, change vrfChange) ([]oc.Vrf, error) {
+	result := make([]oc.Vrf, 0, len(vrfs)+1)
+	found := false
+	for _, vrf := range vrfs {
+		if vrf.Config.Name == change.vrf.Name {
+			found = true
+		} else {
+			result = append(result, vrf)
+		}
+	}
+	switch {
+	case change.operation == vrfAdd && found:
+		return nil, fmt.Errorf("%w: %s", dto.ErrVrfExists, change.vrf.Name)
+	case change.operation != vrfAdd && !found:
+		return nil, fmt.Errorf("%w: %s", dto.ErrVrfNotFound, change.vrf.Name)
+	case change.operation == vrfDelete:
+		return result, nil
+	}
+	vrfConfig := utils.NormalizeVrf(oc.VrfConfig{
+		Name:         change.vrf.Name,
+		Id:           change.vrf.Vni,
+		Rd:           change.vrf.Rd,
+		ImportRtList: change.vrf.ImportRouteTargets,
+		ExportRtList: change.vrf.ExportRouteTargets,
+	})
+	if err := validateVrf(vrfConfig, change.vrf.VrfExtensions, result); err != nil {
+		return nil, fmt.Errorf("%w %s: %w", dto.ErrInvalidVrf, change.vrf.Name, err)
+	}
+	return append(result, oc.Vrf{Config: vrfConfig}), nil
+}
+
+// others are the rest of the VRFs, which must not share the ID or RD with the VRF
+func validateVrf(vrf oc.VrfConfig, ext dto.VrfExtensions, others []oc.Vrf) error {
+	if vrf.Id == 0 {
+		return errors.New("ID is mandatory, it is the VNI of the VRF")
+	}
+	if _, err := utils.RdToApi(vrf.Rd); err != nil {
+		return fmt.Errorf("invalid RD %q: %w", vrf.Rd, err)
+	}
+	for _, rt := range slices.Concat(vrf.ImportRtList, vrf.ExportRtList) {
+		if _, err := utils.RtToApi(rt); err != nil {
+			return err
+		}
+	}
+	for _, other := range others {
+		if other.Config.Id == vrf.Id {
+			return fmt.Errorf("ID %d is used by VRF %s", vrf.Id, other.Config.Name)
+		}
+		if other.Config.Rd == vrf.Rd {
+			return fmt.Errorf("RD %s is used by VRF %s", vrf.Rd, other.Config.Name)
+		}
+	}
+	_, err := newBergVrfConfig(ext).toDto()
+	return err
+}
+
+// Rewrites the VRF table of the config file. The rest of the file keeps its settings, but loses comments
+func persistVrfChange(fileName string, change vrfChange) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	var raw map[string]any
+	if err = toml.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	vrfs, _ := raw["vrfs"].([]any)
+	result := make([]any, 0, len(vrfs)+1)
+	found := false
+	for _, vrf := range vrfs {
+		if vrfTableName(vrf) == change.vrf.Name {
+			found = true
+			if change.operation == vrfDelete {
+				continue
+			}
+			vrf = newVrfFileTable(change.vrf)
+		}
+		result = append(result, vrf)
+	}
+	if !found && change.operation != vrfDelete {
+		result = append(result, newVrfFileTable(change.vrf))
+	}
+	if len(result) > 0 {
+		raw["vrfs"] = result
+	} else {
+		delete(raw, "vrfs")
+	}
+	if data, err = toml.Marshal(raw); err != nil {
+		return err
+	}
+	return writeFileAtomic(fileName, data)
+}
+
+func vrfTableName(vrf any) string {
+	table, _ := vrf.(map[string]any)
+	config, _ := table["config"].(map[string]any)
+	name, _ := config["name"].(string)
+	return name
+}
+
+func newVrfFileTable(vrf dto.Vrf) vrfFileTable {
+	var table vrfFileTable
+	table.Config.Name = vrf.Name
+	table.Config.Id = vrf.Vni
+	table.Config.Rd = vrf.Rd
+	table.Config.ImportRtList = vrf.ImportRouteTargets
+	table.Config.ExportRtList = vrf.ExportRouteTargets
+	if berg := newBergVrfConfig(vrf.VrfExtensions); !reflect.DeepEqual(berg, bergVrfConfig{}) {
+		table.Berg = &berg
+	}
+	return table
+}
+
+// Readers see either the old or the new file contents, never a partially written file
+func writeFileAtomic(fileName string, data []byte) error {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), "."+filepath.Base(fileName)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = tmp.Chmod(info.Mode())
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fileName)
+}
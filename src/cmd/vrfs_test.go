@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingReloader struct {
+	diffs []dto.VrfDiff
+}
+
+func (r *recordingReloader) ReloadConfig(diff dto.VrfDiff) {
+	r.diffs = append(r.diffs, diff)
+}
+
+// Config read from testConfig written to a temporary file
+func newTestConfig(t *testing.T) *Config {
+	fileName := filepath.Join(t.TempDir(), "berg.toml")
+	require.NoError(t, os.WriteFile(fileName, []byte(testConfig), 0o640))
+	cfg := &Config{ConfigFile: fileName}
+	fileCfg, err := cfg.readConfig()
+	require.NoError(t, err)
+	cfg.GobgpConfig = fileCfg.Gobgp
+	cfg.VrfExtensions = fileCfg.VrfExtensions
+	return cfg
+}
+
+func testVrf30() dto.Vrf {
+	return dto.Vrf{
+		Name:               "vrf_30",
+		Rd:                 "65000:30",
+		Vni:                30,
+		ImportRouteTargets: []string{"65000:30"},
+		ExportRouteTargets: []string{"65000:30", "65000:1"},
+		VrfExtensions: dto.VrfExtensions{
+			WithdrawHoldTime: 45 * time.Second,
+			StaticRoutes:     []dto.StaticRoute{{Prefix: "10.0.30.0/24", Gateway: "192.168.0.30", LocalPref: 200}},
+		},
+	}
+}
+
+func TestConfig_ChangeVrf_Add(t *testing.T) {
+	cfg := newTestConfig(t)
+	manager := new(MockVrfManager)
+	manager.On("AddVrf", mock.Anything, mock.Anything).Return(nil).Once()
+	reloader := &recordingReloader{}
+
+	err := cfg.changeVrf(vrfChange{operation: vrfAdd, vrf: testVrf30(), persist: true}, manager, reloader)
+
+	require.NoError(t, err)
+	manager.AssertExpectations(t)
+	require.Len(t, reloader.diffs, 1)
+	expected := oc.VrfConfig{
+		Name: "vrf_30", Id: 30, Rd: "65000:30",
+		ImportRtList: []string{"65000:30"}, ExportRtList: []string{"65000:30", "65000:1"},
+	}
+	assert.Equal(t, []oc.VrfConfig{expected}, reloader.diffs[0].Created)
+	assert.Empty(t, reloader.diffs[0].Deleted)
+	assert.Equal(t, 45*time.Second, reloader.diffs[0].Extensions["vrf_30"].WithdrawHoldTime)
+	assert.Equal(t, 30*time.Second, reloader.diffs[0].Extensions["vrf_10"].WithdrawHoldTime)
+	assert.Len(t, cfg.GobgpConfig.Vrfs, 3)
+
+	// the next reload of the written file changes nothing
+	fileCfg, err := cfg.readConfig()
+	require.NoError(t, err)
+	fileDiff := getVrfDiff(cfg.GobgpConfig.Vrfs, fileCfg.Gobgp.Vrfs)
+	assert.Empty(t, fileDiff.Created)
+	assert.Empty(t, fileDiff.Deleted)
+	assert.Equal(t, cfg.VrfExtensions, fileCfg.VrfExtensions)
+	assert.Equal(t, "65000:10", fileCfg.Gobgp.Vrfs[0].Config.Rd)
+	info, err := os.Stat(cfg.ConfigFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+}
+
+func TestConfig_ChangeVrf_UpdateAndDelete(t *testing.T) {
+	cfg := newTestConfig(t)
+	manager := new(MockVrfManager)
+	manager.On("DeleteVrf", mock.Anything, mock.Anything).Return(nil)
+	manager.On("AddVrf", mock.Anything, mock.Anything).Return(nil)
+	reloader := &recordingReloader{}
+	vrf := dto.Vrf{
+		Name: "vrf_10", Rd: "65000:100", Vni: 10, ImportRouteTargets: []string{"65000:10"},
+		ExportRouteTargets: []string{"65000:10"},
+	}
+
+	require.NoError(t, cfg.changeVrf(vrfChange{operation: vrfUpdate, vrf: vrf, persist: true}, manager, reloader))
+	require.NoError(t, cfg.changeVrf(
+		vrfChange{operation: vrfDelete, vrf: dto.Vrf{Name: "vrf_20"}, persist: true}, manager, reloader,
+	))
+
+	require.Len(t, reloader.diffs, 2)
+	assert.Equal(t, "65000:10", reloader.diffs[0].Deleted[0].Rd)
+	assert.Equal(t, "65000:100", reloader.diffs[0].Created[0].Rd)
+	assert.Equal(t, dto.VrfExtensions{}, reloader.diffs[0].Extensions["vrf_10"])
+	assert.Equal(t, "vrf_20", reloader.diffs[1].Deleted[0].Name)
+	assert.NotContains(t, reloader.diffs[1].Extensions, "vrf_20")
+	fileCfg, err := cfg.readConfig()
+	require.NoError(t, err)
+	require.Len(t, fileCfg.Gobgp.Vrfs, 1)
+	assert.Equal(t, "65000:100", fileCfg.Gobgp.Vrfs[0].Config.Rd)
+	assert.Equal(t, dto.VrfExtensions{}, fileCfg.VrfExtensions["vrf_10"])
+}
+
+func TestConfig_ChangeVrf_NotPersisted(t *testing.T) {
+	cfg := newTestConfig(t)
+	manager := new(MockVrfManager)
+	manager.On("AddVrf", mock.Anything, mock.Anything).Return(nil)
+
+	require.NoError(t, cfg.changeVrf(vrfChange{operation: vrfAdd, vrf: testVrf30()}, manager, &recordingReloader{}))
+
+	data, err := os.ReadFile(cfg.ConfigFile)
+	require.NoError(t, err)
+	assert.Equal(t, testConfig, string(data))
+}
+
+func TestConfig_ChangeVrf_Errors(t *testing.T) {
+	invalid := func(modify func(*dto.Vrf)) dto.Vrf {
+		vrf := testVrf30()
+		modify(&vrf)
+		return vrf
+	}
+	tests := []struct {
+		name   string
+		change vrfChange
+		err    error
+		msg    string
+	}{
+		{
+			name:   "Exists",
+			change: vrfChange{operation: vrfAdd, vrf: invalid(func(v *dto.Vrf) { v.Name = "vrf_10" })},
+			err:    dto.ErrVrfExists,
+		},
+		{
+			name:   "Not found",
+			change: vrfChange{operation: vrfUpdate, vrf: testVrf30()},
+			err:    dto.ErrVrfNotFound,
+		},
+		{
+			name:   "Not found on delete",
+			change: vrfChange{operation: vrfDelete, vrf: dto.Vrf{Name: "vrf_30"}},
+			err:    dto.ErrVrfNotFound,
+		},
+		{
+			name:   "No ID",
+			change: vrfChange{operation: vrfAdd, vrf: invalid(func(v *dto.Vrf) { v.Vni = 0 })},
+			err:    dto.ErrInvalidVrf,
+			msg:    "ID is mandatory",
+		},
+		{
+			name:   "Duplicate ID",
+			change: vrfChange{operation: vrfAdd, vrf: invalid(func(v *dto.Vrf) { v.Vni = 20 })},
+			err:    dto.ErrInvalidVrf,
+			msg:    "ID 20 is used by VRF vrf_20",
+		},
+		{
+			name:   "Duplicate RD",
+			change: vrfChange{operation: vrfAdd, vrf: invalid(func(v *dto.Vrf) { v.Rd = "65000:20" })},
+			err:    dto.ErrInvalidVrf,
+			msg:    "RD 65000:20 is used by VRF vrf_20",
+		},
+		{
+			name:   "Invalid RD",
+			change: vrfChange{operation: vrfAdd, vrf: invalid(func(v *dto.Vrf) { v.Rd = "30" })},
+			err:    dto.ErrInvalidVrf,
+			msg:    "invalid RD",
+		},
+		{
+			name: "Invalid RT",
+			change: vrfChange{operation: vrfAdd, vrf: invalid(func(v *dto.Vrf) {
+				v.ExportRouteTargets = []string{"rt"}
+			})},
+			err: dto.ErrInvalidVrf,
+			msg: "invalid route-target",
+		},
+		{
+			name:   "Invalid mobility",
+			change: vrfChange{operation: vrfAdd, vrf: invalid(func(v *dto.Vrf) { v.Mobility = "evpn" })},
+			err:    dto.ErrInvalidVrf,
+			msg:    "invalid mobility",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			manager := new(MockVrfManager)
+			reloader := &recordingReloader{}
+
+			err := cfg.changeVrf(tt.change, manager, reloader)
+
+			assert.ErrorIs(t, err, tt.err)
+			assert.ErrorContains(t, err, tt.msg)
+			manager.AssertExpectations(t)
+			assert.Empty(t, reloader.diffs)
+			assert.Len(t, cfg.GobgpConfig.Vrfs, 2)
+		})
+	}
+}
+
+func TestConfig_ChangeVrf_GobgpError(t *testing.T) {
+	cfg := newTestConfig(t)
+	manager := new(MockVrfManager)
+	manager.On("AddVrf", mock.Anything, mock.Anything).Return(errors.New("duplicate RD"))
+	reloader := &recordingReloader{}
+
+	err := cfg.changeVrf(vrfChange{operation: vrfAdd, vrf: testVrf30(), persist: true}, manager, reloader)
+
+	assert.ErrorContains(t, err, "duplicate RD")
+	assert.Empty(t, reloader.diffs)
+	assert.Len(t, cfg.GobgpConfig.Vrfs, 2)
+	assert.NotContains(t, cfg.VrfExtensions, "vrf_30")
+	data, err := os.ReadFile(cfg.ConfigFile)
+	require.NoError(t, err)
+	assert.Equal(t, testConfig, string(data))
+}
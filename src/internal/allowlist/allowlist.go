@@ -0,0 +1,110 @@
+package allowlist
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/utils"
+)
+
+// Formats of the allowlist exported by the IPAM
+const (
+	FormatJson = "json" // array of {"neighbor": ..., "vrf": ..., "prefixes": [...]}
+	FormatCsv  = "csv"  // neighbor,prefix[,vrf] lines, the optional header starts with "neighbor"
+)
+
+type jsonEntry struct {
+	Neighbor string   `json:"neighbor"`
+	Vrf      string   `json:"vrf,omitempty"`
+	Prefixes []string `json:"prefixes"`
+}
+
+// Parses and validates the allowlist in the format
+func Parse(data []byte, format string) ([]dto.AllowlistEntry, error) {
+	var entries []dto.AllowlistEntry
+	var err error
+	switch format {
+	case FormatJson:
+		entries, err = parseJson(data)
+	case FormatCsv:
+		entries, err = parseCsv(data)
+	default:
+		return nil, fmt.Errorf("unknown allowlist format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		if err = validate(entry); err != nil {
+			return nil, fmt.Errorf("entry #%d: %w", i+1, err)
+		}
+	}
+	return entries, nil
+}
+
+func parseJson(data []byte) ([]dto.AllowlistEntry, error) {
+	var parsed []jsonEntry
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid JSON allowlist: %w", err)
+	}
+	entries := make([]dto.AllowlistEntry, 0, len(parsed))
+	for _, entry := range parsed {
+		entries = append(entries, dto.AllowlistEntry(entry))
+	}
+	return entries, nil
+}
+
+// Lines of the same neighbor and VRF make a single entry
+func parseCsv(data []byte) ([]dto.AllowlistEntry, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	entries := []dto.AllowlistEntry{}
+	index := map[[2]string]int{} // neighbor and VRF -> entry
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV allowlist: %w", err)
+		}
+		if first && strings.EqualFold(record[0], "neighbor") {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) < 2 || len(record) > 3 {
+			return nil, fmt.Errorf("line %d: expected neighbor,prefix[,vrf]", line)
+		}
+		key := [2]string{record[0], ""}
+		if len(record) == 3 {
+			key[1] = record[2]
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(entries)
+			index[key] = i
+			entries = append(entries, dto.AllowlistEntry{Neighbor: key[0], Vrf: key[1]})
+		}
+		entries[i].Prefixes = append(entries[i].Prefixes, record[1])
+	}
+}
+
+func validate(entry dto.AllowlistEntry) error {
+	if _, err := utils.NeighborPrefix(entry.Neighbor); err != nil {
+		return err
+	}
+	for _, prefix := range entry.Prefixes {
+		if _, err := utils.ParsePrefix(prefix); err != nil {
+			return fmt.Errorf("neighbor %s: %w", entry.Neighbor, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package allowlist
+
+import (
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_Json(t *testing.T) {
+	entries, err := Parse([]byte(`[
+		{"neighbor": "192.168.0.10", "prefixes": ["10.0.1.0/24", "10.0.2.0/24"]},
+		{"neighbor": "192.168.1.0/24", "vrf": "vrf_20", "prefixes": []}
+	]`), FormatJson)
+
+	require.NoError(t, err)
+	assert.Equal(t, []dto.AllowlistEntry{
+		{Neighbor: "192.168.0.10", Prefixes: []string{"10.0.1.0/24", "10.0.2.0/24"}},
+		{Neighbor: "192.168.1.0/24", Vrf: "vrf_20", Prefixes: []string{}},
+	}, entries)
+}
+
+func TestParse_Csv(t *testing.T) {
+	entries, err := Parse([]byte("neighbor,prefix,vrf\n"+
+		"# exported by the IPAM\n"+
+		"192.168.0.10,10.0.1.0/24\n"+
+		"192.168.0.10, 10.0.2.0/24\n"+
+		"192.168.0.10,10.0.3.0/24,vrf_20\n"), FormatCsv)
+
+	require.NoError(t, err)
+	assert.Equal(t, []dto.AllowlistEntry{
+		{Neighbor: "192.168.0.10", Prefixes: []string{"10.0.1.0/24", "10.0.2.0/24"}},
+		{Neighbor: "192.168.0.10", Vrf: "vrf_20", Prefixes: []string{"10.0.3.0/24"}},
+	}, entries)
+}
+
+func TestParse_Empty(t *testing.T) {
+	entries, err := Parse(nil, FormatCsv)
+
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		data   string
+		format string
+		err    string
+	}{
+		"unknown format":   {"", "xml", `unknown allowlist format "xml"`},
+		"malformed json":   {`{"neighbor": `, FormatJson, "invalid JSON allowlist"},
+		"invalid neighbor": {`[{"neighbor": "vm1", "prefixes": []}]`, FormatJson, "entry #1"},
+		"invalid prefix":   {"192.168.0.10,10.0.1.0/24\n192.168.0.20,10.0.300.0/24\n", FormatCsv, "entry #2"},
+		"missing prefix":   {"192.168.0.10\n", FormatCsv, "line 1: expected neighbor,prefix[,vrf]"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(test.data), test.format)
+
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
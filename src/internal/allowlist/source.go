@@ -0,0 +1,87 @@
+package allowlist
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Where the allowlist comes from, e.g. a file or an HTTP endpoint the IPAM exports it to
+type Source interface {
+	// Reads the whole allowlist along with its format
+	Read(ctx context.Context) (data []byte, format string, err error)
+	String() string
+}
+
+// Allowlist file, the format is taken from the extension unless set
+type FileSource struct {
+	path   string
+	format string
+}
+
+func NewFileSource(path, format string) *FileSource {
+	if format == "" {
+		format = FormatJson
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			format = FormatCsv
+		}
+	}
+	return &FileSource{path: path, format: format}
+}
+
+func (s *FileSource) Read(context.Context) ([]byte, string, error) {
+	data, err := os.ReadFile(s.path)
+	return data, s.format, err
+}
+
+func (s *FileSource) String() string {
+	return s.path
+}
+
+// Allowlist served over HTTP, the format is taken from the content type unless set
+type HttpSource struct {
+	url    string
+	format string
+	client *http.Client
+}
+
+func NewHttpSource(url, format string, timeout time.Duration) *HttpSource {
+	return &HttpSource{url: url, format: format, client: &http.Client{Timeout: timeout}}
+}
+
+func (s *HttpSource) Read(ctx context.Context) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/json, text/csv")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, "", fmt.Errorf("allowlist %s responded with %s", s.url, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	format := s.format
+	if format == "" {
+		format = FormatJson
+		if strings.Contains(resp.Header.Get("Content-Type"), "csv") {
+			format = FormatCsv
+		}
+	}
+	return data, format, nil
+}
+
+func (s *HttpSource) String() string {
+	return s.url
+}
@@ -0,0 +1,63 @@
+package allowlist
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.CSV")
+	require.NoError(t, os.WriteFile(path, []byte("192.168.0.10,10.0.1.0/24\n"), 0o644))
+
+	data, format, err := NewFileSource(path, "").Read(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, FormatCsv, format)
+	assert.Equal(t, "192.168.0.10,10.0.1.0/24\n", string(data))
+
+	_, format, err = NewFileSource(path, FormatJson).Read(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, FormatJson, format)
+
+	_, _, err = NewFileSource(filepath.Join(t.TempDir(), "missing.json"), "").Read(context.Background())
+	assert.Error(t, err)
+}
+
+func TestHttpSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/allowlist.csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Write([]byte("192.168.0.10,10.0.1.0/24\n"))
+		case "/allowlist.json":
+			w.Write([]byte(`[]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	data, format, err := NewHttpSource(server.URL+"/allowlist.csv", "", time.Second).Read(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, FormatCsv, format)
+	assert.Equal(t, "192.168.0.10,10.0.1.0/24\n", string(data))
+
+	_, format, err = NewHttpSource(server.URL+"/allowlist.json", "", time.Second).Read(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, FormatJson, format)
+
+	_, format, err = NewHttpSource(server.URL+"/allowlist.json", FormatCsv, time.Second).Read(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, FormatCsv, format)
+
+	_, _, err = NewHttpSource(server.URL+"/missing", "", time.Second).Read(ctx)
+	assert.ErrorContains(t, err, "responded with 404 Not Found")
+}
@@ -0,0 +1,94 @@
+package allowlist
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// Reads the source periodically and passes the allowlist on whenever its contents change.
+// A source which fails to read or parse leaves the previous allowlist in effect
+type Watcher struct {
+	source   Source
+	interval time.Duration
+	logger   *logrus.Logger
+	lock     sync.Mutex
+	state    dto.AllowlistState
+	digest   [sha256.Size]byte
+}
+
+func NewWatcher(source Source, interval time.Duration, logger *logrus.Logger) *Watcher {
+	return &Watcher{
+		source:   source,
+		interval: interval,
+		logger:   logger,
+		state:    dto.AllowlistState{Enabled: true, Source: source.String()},
+	}
+}
+
+// Reads the source, changed=false means the allowlist is the same as the last loaded one
+func (w *Watcher) Check(ctx context.Context) (entries []dto.AllowlistEntry, changed bool, err error) {
+	data, format, err := w.source.Read(ctx)
+	if err == nil {
+		entries, err = Parse(data, format)
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.state.CheckedAt = time.Now()
+	if err != nil {
+		w.state.Error = err.Error()
+		metrics.AllowlistReloads.WithLabelValues("failure").Inc()
+		return nil, false, err
+	}
+	w.state.Error = ""
+	digest := sha256.Sum256(append([]byte(format), data...))
+	if !w.state.LoadedAt.IsZero() && digest == w.digest {
+		return nil, false, nil
+	}
+	w.digest = digest
+	w.state.LoadedAt, w.state.Entries = w.state.CheckedAt, len(entries)
+	metrics.AllowlistReloads.WithLabelValues("success").Inc()
+	return entries, true, nil
+}
+
+// Checks the source right away and then every interval until ctx is done,
+// sending every changed allowlist to the returned channel
+func (w *Watcher) Watch(ctx context.Context) <-chan []dto.AllowlistEntry {
+	ch := make(chan []dto.AllowlistEntry)
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			entries, changed, err := w.Check(ctx)
+			if err != nil {
+				w.logger.Errorf("cannot load prefix allowlist from %s: %v", w.source, err)
+			}
+			if changed {
+				w.logger.Infof("prefix allowlist loaded from %s: %d entries", w.source, len(entries))
+				select {
+				case ch <- entries:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// State of the source, without the blocked routes
+func (w *Watcher) State() dto.AllowlistState {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.state
+}
@@ -0,0 +1,70 @@
+package allowlist
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher_Check(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.json")
+	watcher := NewWatcher(NewFileSource(path, ""), time.Minute, logrus.New())
+	ctx := context.Background()
+
+	_, changed, err := watcher.Check(ctx)
+	assert.Error(t, err)
+	assert.False(t, changed)
+	state := watcher.State()
+	assert.True(t, state.Enabled)
+	assert.Equal(t, path, state.Source)
+	assert.True(t, state.LoadedAt.IsZero())
+	assert.NotEmpty(t, state.Error)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"neighbor": "192.168.0.10", "prefixes": ["10.0.1.0/24"]}]`), 0o644))
+	entries, changed, err := watcher.Check(ctx)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []dto.AllowlistEntry{{Neighbor: "192.168.0.10", Prefixes: []string{"10.0.1.0/24"}}}, entries)
+	state = watcher.State()
+	assert.Equal(t, 1, state.Entries)
+	assert.Empty(t, state.Error)
+	assert.False(t, state.LoadedAt.IsZero())
+
+	_, changed, err = watcher.Check(ctx)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// an invalid allowlist leaves the loaded one in effect
+	require.NoError(t, os.WriteFile(path, []byte(`[{"neighbor": "vm1"}]`), 0o644))
+	_, changed, err = watcher.Check(ctx)
+	assert.Error(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, 1, watcher.State().Entries)
+}
+
+func TestWatcher_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.csv")
+	require.NoError(t, os.WriteFile(path, []byte("192.168.0.10,10.0.1.0/24\n"), 0o644))
+	watcher := NewWatcher(NewFileSource(path, ""), 10*time.Millisecond, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates := watcher.Watch(ctx)
+	entries := <-updates
+	assert.Equal(t, []string{"10.0.1.0/24"}, entries[0].Prefixes)
+
+	require.NoError(t, os.WriteFile(path, []byte("192.168.0.10,10.0.2.0/24\n"), 0o644))
+	select {
+	case entries = <-updates:
+		assert.Equal(t, []string{"10.0.2.0/24"}, entries[0].Prefixes)
+	case <-time.After(time.Second):
+		t.Fatal("the changed allowlist is not passed on")
+	}
+}
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"github.com/amyasnikov/berg/internal/dto"
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+// State of the prefix allowlist along with the received routes it blocks
+func (a *App) Allowlist() dto.AllowlistState {
+	if a.allowlist == nil {
+		return dto.AllowlistState{Blocked: []dto.BlockedRoute{}}
+	}
+	state := a.allowlist.State()
+	state.Blocked = a.prefixAllowlist.ListBlocked()
+	return state
+}
+
+// Replaces the prefix allowlist, then redistributes the received routes it covers now. Runs on the event loop
+func (a *App) applyAllowlist(entries []dto.AllowlistEntry) {
+	a.workers.Wait()
+	unblocked, err := a.prefixAllowlist.SetAllowlist(entries)
+	if err != nil {
+		a.logger.Errorf("error while withdrawing the routes the allowlist does not cover: %v", err)
+	}
+	if len(unblocked) == 0 || a.holdDown.Active() { // the buffered paths are handled once the hold-down is over
+		return
+	}
+	sources := make(map[string]bool, len(unblocked))
+	for _, source := range unblocked {
+		sources[source] = true
+	}
+	a.redistributeUntracked("the allowlisted prefixes", func(_ *api.Path, audit dto.PathAudit) bool {
+		return sources[audit.Source]
+	})
+}
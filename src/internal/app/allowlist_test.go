@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/allowlist"
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApp_Allowlist_Disabled(t *testing.T) {
+	app := NewApp(nil, &ribServer{}, 100, logrus.New())
+
+	assert.Equal(t, dto.AllowlistState{Blocked: []dto.BlockedRoute{}}, app.Allowlist())
+}
+
+func TestApp_ApplyAllowlist(t *testing.T) {
+	path := createVPNPathWithNexthop(100, "10.0.0.1")
+	path.Best = true
+	server := &ribServer{rib: map[api.Family_Afi][]*api.Path{api.Family_AFI_IP: {path}}}
+	evpnUuid := uuid.New()
+	server.On("AddPath", mock.Anything, mock.Anything).Return(&api.AddPathResponse{Uuid: evpnUuid[:]}, nil)
+	vrfConfig := []oc.VrfConfig{{Name: "vrf_10", Rd: "65000:100", Id: 1000, BothRtList: []string{"65000:100"}}}
+	file := filepath.Join(t.TempDir(), "allowlist.csv")
+	require.NoError(t, os.WriteFile(file, []byte("192.168.1.0/24,10.0.0.0/24\n"), 0o644))
+	watcher := allowlist.NewWatcher(allowlist.NewFileSource(file, ""), time.Minute, logrus.New())
+	app := NewApp(vrfConfig, server, 100, logrus.New(), WithPrefixAllowlist(watcher))
+
+	// blocked until the allowlist is loaded
+	require.NoError(t, app.vpnController.HandleUpdate(context.Background(), path))
+	assert.Empty(t, app.ListRedistributed())
+	state := app.Allowlist()
+	assert.True(t, state.Enabled)
+	require.Len(t, state.Blocked, 1)
+	assert.Equal(t, "10.0.0.1/32", state.Blocked[0].Prefix)
+
+	entries, changed, err := watcher.Check(context.Background())
+	require.NoError(t, err)
+	require.True(t, changed)
+	app.applyAllowlist(entries)
+
+	assert.Len(t, app.ListRedistributed(), 1)
+	state = app.Allowlist()
+	assert.Equal(t, 1, state.Entries)
+	assert.Empty(t, state.Blocked)
+}
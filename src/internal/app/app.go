@@ -2,112 +2,467 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/amyasnikov/berg/internal/allowlist"
 	ctrl "github.com/amyasnikov/berg/internal/controller"
 	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
 	"github.com/amyasnikov/berg/internal/injector"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/amyasnikov/berg/internal/tracing"
+	"github.com/amyasnikov/berg/internal/utils"
+	"github.com/hashicorp/go-multierror"
 	api "github.com/osrg/gobgp/v3/api"
 	"github.com/osrg/gobgp/v3/pkg/config/oc"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 )
 
 type App struct {
-	vpnController  controller
-	evpnController controller
-	eventChan      chan *api.WatchEventResponse
-	controlChan    chan message
-	bgpServer      bgpServer
-	logger         *logrus.Logger
-}
-
-func NewApp(vrfConfig []oc.VrfConfig, bgpServer bgpServer, bufsize uint64, logger *logrus.Logger) *App {
-	vpnInjector := injector.NewVPNv4Injector(bgpServer)
-	evpnInjector := injector.NewEvpnInjector(bgpServer)
-	vpnController := ctrl.NewVPNv4Controller(evpnInjector, vrfConfig)
+	vpnController    controller
+	evpnController   controller
+	prefixLimits     prefixLimits    // of the VPNv4 controller
+	prefixAllowlist  prefixAllowlist // of the VPNv4 controller
+	prefixMobility   prefixMobility  // of the VPNv4 controller
+	allowlist        *allowlist.Watcher
+	allowlistUpdates <-chan []dto.AllowlistEntry // nil unless the allowlist is enabled
+	staticRoutes     *ctrl.StaticRoutes
+	orchestrated     *ctrl.OrchestratedRoutes
+	aggregates       *ctrl.Aggregates
+	defaultRoutes    *ctrl.DefaultRoutes
+	leaks            *ctrl.Leaks
+	eventChan        chan watchEvent
+	controlChan      chan message
+	bgpServer        bgpServer
+	logger           *logrus.Logger
+	controllerLogger *logrus.Logger
+	injectorLogger   *logrus.Logger
+	workers          *workerPool
+	workerCount      int
+	bufsize          uint64
+	streamer         pathStreamer
+	holdDown         *holdDown
+	vrfExtensions    map[string]dto.VrfExtensions
+	startedAt        time.Time
+	stateLock        sync.RWMutex
+	vrfs             map[string]dto.Vrf // by VRF name
+	lastReload       *dto.ReloadStatus
+	events           events.Publisher
+	heartbeat        atomic.Int64 // unix nanoseconds of the last event loop iteration
+	reconcileEvery   time.Duration
+	reconcileLimiter *rate.Limiter
+	discoverVrfs     bool
+	discoveryEvery   time.Duration
+	knownVrfs        map[uint32]oc.VrfConfig // normalized configs of the VRFs given to the controllers, by ID
+}
+
+// How often the idle event loop reports it is alive
+const heartbeatInterval = time.Second
+
+type Option func(*App)
+
+// Enables bulk route injection through GoBGP AddPathStream API
+func WithPathStreamer(streamer pathStreamer) Option {
+	return func(a *App) {
+		a.streamer = streamer
+	}
+}
+
+// Sets berg-specific settings of the initially configured VRFs by VRF name
+func WithVrfExtensions(vrfExt map[string]dto.VrfExtensions) Option {
+	return func(a *App) {
+		a.vrfExtensions = vrfExt
+	}
+}
+
+// Holds redistribution back at startup until all the neighbors send End-of-RIB or maxHold expires.
+// neighbors maps neighbor address to its AFI/SAFI names
+func WithStartupHoldDown(neighbors map[string][]string, maxHold time.Duration) Option {
+	return func(a *App) {
+		a.holdDown = newHoldDown(neighbors, maxHold)
+	}
+}
+
+// Sends redistribution decisions of both controllers to the publisher
+func WithEventPublisher(publisher events.Publisher) Option {
+	return func(a *App) {
+		a.events = publisher
+	}
+}
+
+// Periodically fixes the disagreements between the redistributed routes and the GoBGP RIB,
+// applying at most correctionsPerSecond corrections, non-positive means no limit. Zero interval disables it
+func WithReconciliation(interval time.Duration, correctionsPerSecond float64) Option {
+	return func(a *App) {
+		limit := rate.Limit(correctionsPerSecond)
+		if correctionsPerSecond <= 0 {
+			limit = rate.Inf
+		}
+		a.reconcileEvery = interval
+		a.reconcileLimiter = rate.NewLimiter(limit, max(1, int(correctionsPerSecond)))
+	}
+}
+
+// Picks up the VRFs created or deleted in GoBGP by any means, e.g. gobgp CLI, at startup and then
+// every interval. Zero interval means at startup only
+func WithVrfDiscovery(interval time.Duration) Option {
+	return func(a *App) {
+		a.discoverVrfs = true
+		a.discoveryEvery = interval
+	}
+}
+
+// Sets separate loggers of the controllers and the injectors, both use the app logger by default
+func WithSubsystemLoggers(controllerLogger, injectorLogger *logrus.Logger) Option {
+	return func(a *App) {
+		a.controllerLogger = controllerLogger
+		a.injectorLogger = injectorLogger
+	}
+}
+
+// Redistributes only the received routes the allowlist read by the watcher covers
+func WithPrefixAllowlist(watcher *allowlist.Watcher) Option {
+	return func(a *App) {
+		a.allowlist = watcher
+	}
+}
+
+// Sets the number of goroutines handling paths in parallel
+func WithWorkers(count int) Option {
+	return func(a *App) {
+		a.workerCount = count
+	}
+}
+
+func NewApp(
+	vrfConfig []oc.VrfConfig, bgpServer bgpServer, bufsize uint64, logger *logrus.Logger, opts ...Option,
+) *App {
+	a := &App{
+		eventChan:        make(chan watchEvent, bufsize),
+		controlChan:      make(chan message, 1),
+		bgpServer:        bgpServer,
+		logger:           logger,
+		controllerLogger: logger,
+		injectorLogger:   logger,
+		workerCount:      1,
+		bufsize:          bufsize,
+		holdDown:         newHoldDown(nil, 0),
+		startedAt:        time.Now(),
+		vrfs:             make(map[string]dto.Vrf, len(vrfConfig)),
+		knownVrfs:        make(map[uint32]oc.VrfConfig, len(vrfConfig)),
+		events:           events.Discard{},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	for _, vrf := range vrfConfig {
+		a.vrfs[vrf.Name] = dto.NewVrf(vrf, a.vrfExtensions[vrf.Name])
+		a.knownVrfs[vrf.Id] = utils.NormalizeVrf(vrf)
+	}
+	vpnInjector := injector.NewVPNv4Injector(bgpServer, a.streamer)
+	vpnInjector.SetLogger(a.injectorLogger)
+	evpnInjector := injector.NewEvpnInjector(bgpServer, a.streamer)
+	evpnInjector.SetLogger(a.injectorLogger)
+	vpnController := ctrl.NewVPNv4Controller(evpnInjector, vrfConfig, a.vrfExtensions)
+	vpnController.SetEventPublisher(a.events)
+	vpnController.SetLogger(a.controllerLogger)
+	a.vpnController = vpnController
+	a.prefixLimits = vpnController
+	a.prefixAllowlist = vpnController
+	a.prefixMobility = vpnController
+	if a.allowlist != nil {
+		vpnController.EnableAllowlist()
+	}
+	a.staticRoutes = ctrl.NewStaticRoutes(evpnInjector, vrfConfig, a.vrfExtensions)
+	a.staticRoutes.SetEventPublisher(a.events)
+	a.staticRoutes.SetLogger(a.controllerLogger)
+	a.orchestrated = ctrl.NewOrchestratedRoutes(evpnInjector, vpnController, vrfConfig, a.vrfExtensions)
+	a.orchestrated.SetEventPublisher(a.events)
+	a.orchestrated.SetLogger(a.controllerLogger)
+	vpnController.SetOrchestratedRoutes(a.orchestrated)
+	a.aggregates = ctrl.NewAggregates(evpnInjector, vpnController, vrfConfig, a.vrfExtensions)
+	a.aggregates.SetEventPublisher(a.events)
+	a.aggregates.SetLogger(a.controllerLogger)
+	vpnController.SetAggregates(a.aggregates)
+	a.leaks = ctrl.NewLeaks(vpnInjector, evpnInjector, vpnController, vrfConfig, a.vrfExtensions)
+	a.leaks.SetEventPublisher(a.events)
+	a.leaks.SetLogger(a.controllerLogger)
+	vpnController.SetLeaks(a.leaks)
 	listRoutes := func() <-chan ctrl.EvpnRouteWithPattrs {
 		ch := make(chan ctrl.EvpnRouteWithPattrs)
 		req := api.ListPathRequest{
 			Family: &api.Family{Afi: api.Family_AFI_L2VPN, Safi: api.Family_SAFI_EVPN},
 		}
-		go bgpServer.ListPath(context.Background(), &req, func(d *api.Destination) {
-			for _, path := range d.GetPaths() {
-				route, err := ctrl.NewEvpnRouteWithPattrs(path)
-				if err != nil {
-					logger.Errorf("cannot parse evpn path %v: %v", path.Nlri, err)
+		go func() {
+			defer close(ch)
+			err := bgpServer.ListPath(context.Background(), &req, func(d *api.Destination) {
+				for _, path := range d.GetPaths() {
+					route, err := ctrl.NewEvpnRouteWithPattrs(path)
+					if err != nil {
+						logger.Debugf("skipping evpn path %v: %v", path.Nlri, err)
+						continue
+					}
+					ch <- route
 				}
-				ch <- route
+			})
+			if err != nil {
+				logger.Errorf("cannot list evpn paths: %v", err)
 			}
-			close(ch)
-		})
+		}()
 		return ch
 	}
 	evpnController := ctrl.NewEvpnController(vpnInjector, vrfConfig, listRoutes)
-	return &App{
-		vpnController:  vpnController,
-		evpnController: evpnController,
-		eventChan:      make(chan *api.WatchEventResponse, bufsize),
-		controlChan:    make(chan message, 1),
-		bgpServer:      bgpServer,
-		logger:         logger,
+	evpnController.SetEventPublisher(a.events)
+	evpnController.SetLogger(a.controllerLogger)
+	a.evpnController = evpnController
+	vpnv6Injector := injector.NewVPNv6Injector(bgpServer, a.streamer)
+	vpnv6Injector.SetLogger(a.injectorLogger)
+	a.defaultRoutes = ctrl.NewDefaultRoutes(vpnInjector, vpnv6Injector, evpnController, vrfConfig, a.vrfExtensions)
+	a.defaultRoutes.SetEventPublisher(a.events)
+	a.defaultRoutes.SetLogger(a.controllerLogger)
+	evpnController.SetDefaultRoutes(a.defaultRoutes)
+	if a.workerCount < 1 {
+		a.workerCount = 1
 	}
+	a.workers = newWorkerPool(a.workerCount, int(a.bufsize)/a.workerCount, a.handlePath)
+	return a
 }
 
 func (a *App) sender(resp *api.WatchEventResponse) {
-	a.eventChan <- resp
+	a.eventChan <- watchEvent{resp: resp, receivedAt: time.Now()}
 }
 
 func (a *App) receiver() {
+	defer a.workers.Stop()
+	if a.holdDown.Active() && a.holdDown.Converged() {
+		a.releaseHoldDown("no neighbors to wait for")
+	}
+	if err := a.staticRoutes.Sync(); err != nil {
+		a.logger.Errorf("cannot inject static routes: %v", err)
+	}
+	// later on the conditional default routes follow the updates of their condition routes
+	if err := a.defaultRoutes.Sync(); err != nil {
+		a.logger.Errorf("error while originating default routes: %v", err)
+	}
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	var reconcileTick <-chan time.Time // nil unless reconciliation is enabled
+	if a.reconcileEvery > 0 {
+		reconcileTicker := time.NewTicker(a.reconcileEvery)
+		defer reconcileTicker.Stop()
+		reconcileTick = reconcileTicker.C
+	}
+	var discoveryTick <-chan time.Time // nil unless periodic VRF discovery is enabled
+	if a.discoverVrfs {
+		a.syncVrfs()
+		if a.discoveryEvery > 0 {
+			discoveryTicker := time.NewTicker(a.discoveryEvery)
+			defer discoveryTicker.Stop()
+			discoveryTick = discoveryTicker.C
+		}
+	}
 	for {
+		a.heartbeat.Store(time.Now().UnixNano())
 		select {
+		case <-ticker.C:
+			a.maintainLeases()
+			a.maintainPrefixLimits()
+			a.prefixMobility.ExpireMobility()
 		case msg := <-a.controlChan:
 			switch msg.Code {
 			case stopAppMsg:
 				return
 			case reloadConfigMsg:
-				err := a.evpnController.ReloadConfig(*msg.VrfDiff)
-				if err != nil {
-					a.logger.Errorf("error while evpn reloading: %v", err)
-				}
-				err = a.vpnController.ReloadConfig(*msg.VrfDiff)
-				if err != nil {
-					a.logger.Errorf("error while vpn reloading: %v", err)
-				}
+				a.reloadConfig(*msg.VrfDiff)
 			default:
 				a.logger.Errorf("Invalid message from controlChan: %v", msg)
 			}
-		case resp, ok := <-a.eventChan:
+		case <-reconcileTick:
+			if !a.holdDown.Active() {
+				ctx, cancel := context.WithTimeout(context.Background(), a.reconcileEvery)
+				a.reconcile(ctx)
+				cancel()
+			}
+		case <-discoveryTick:
+			a.syncVrfs()
+		case entries := <-a.allowlistUpdates:
+			a.applyAllowlist(entries)
+		case <-a.holdDown.Expired():
+			a.releaseHoldDown("max hold time expired")
+		case event, ok := <-a.eventChan:
 			if !ok {
 				return
 			}
-			for _, path := range resp.GetTable().GetPaths() {
-				if path.NeighborIp == "" || path.NeighborIp == "<nil>" { // locally originated path
+			for _, path := range event.resp.GetTable().GetPaths() {
+				if isEor(path) {
+					if a.holdDown.Active() && a.holdDown.HandleEor(path) {
+						a.releaseHoldDown("End-of-RIB received from all neighbors")
+					}
 					continue
 				}
-				family := path.GetFamily()
-				switch {
-				case family.Afi == api.Family_AFI_IP && family.Safi == api.Family_SAFI_MPLS_VPN:
-					a.handlePath(a.vpnController, path)
-				case family.Afi == api.Family_AFI_L2VPN && family.Safi == api.Family_SAFI_EVPN:
-					a.handlePath(a.evpnController, path)
+				if isLocal(path) {
+					continue
+				}
+				controller := a.pathController(path)
+				if controller == nil {
+					continue
+				}
+				metrics.ReceivedPaths.WithLabelValues(a.direction(controller)).Inc()
+				if a.holdDown.Active() {
+					a.holdDown.Buffer(controller, path)
+				} else {
+					a.workers.Submit(a.startPathSpan(controller, path, event.receivedAt), controller, path)
 				}
 			}
 		}
 	}
 }
 
-func (a *App) handlePath(controller controller, path *api.Path) {
+func (a *App) pathController(path *api.Path) controller {
+	family := path.GetFamily()
+	switch {
+	case family.Afi == api.Family_AFI_IP && family.Safi == api.Family_SAFI_MPLS_VPN:
+		return a.vpnController
+	case family.Afi == api.Family_AFI_L2VPN && family.Safi == api.Family_SAFI_EVPN:
+		return a.evpnController
+	}
+	return nil
+}
+
+// Locally originated path, e.g. injected by berg
+func isLocal(path *api.Path) bool {
+	return path.NeighborIp == "" || path.NeighborIp == "<nil>"
+}
+
+func (a *App) direction(controller controller) string {
+	if controller == a.evpnController {
+		return metrics.DirectionToVpn
+	}
+	return metrics.DirectionToEvpn
+}
+
+func (a *App) reloadConfig(diff dto.VrfDiff) {
+	diff = a.unappliedVrfChanges(diff)
+	a.updateVrfs(diff, a.reloadControllers(diff))
+}
+
+func (a *App) reloadControllers(diff dto.VrfDiff) error {
+	start := time.Now()
+	outcome := "success"
+	var merr error
+	a.workers.Wait()
+	// goes first, so that the routes of the created VRFs which import the default routes only are not redistributed
+	err := a.defaultRoutes.ReloadConfig(diff)
+	if err != nil {
+		outcome = "failure"
+		merr = multierror.Append(merr, err)
+		a.logger.Errorf("error while default routes reloading: %v", err)
+	}
+	err = a.evpnController.ReloadConfig(diff)
+	if err != nil {
+		outcome = "failure"
+		merr = multierror.Append(merr, err)
+		a.logger.Errorf("error while evpn reloading: %v", err)
+	}
+	err = a.vpnController.ReloadConfig(diff)
+	if err != nil {
+		outcome = "failure"
+		merr = multierror.Append(merr, err)
+		a.logger.Errorf("error while vpn reloading: %v", err)
+	}
+	err = a.staticRoutes.ReloadConfig(diff)
+	if err != nil {
+		outcome = "failure"
+		merr = multierror.Append(merr, err)
+		a.logger.Errorf("error while static routes reloading: %v", err)
+	}
+	err = a.orchestrated.ReloadConfig(diff)
+	if err != nil {
+		outcome = "failure"
+		merr = multierror.Append(merr, err)
+		a.logger.Errorf("error while orchestrated routes reloading: %v", err)
+	}
+	err = a.aggregates.ReloadConfig(diff)
+	if err != nil {
+		outcome = "failure"
+		merr = multierror.Append(merr, err)
+		a.logger.Errorf("error while aggregates reloading: %v", err)
+	}
+	err = a.leaks.ReloadConfig(diff)
+	if err != nil {
+		outcome = "failure"
+		merr = multierror.Append(merr, err)
+		a.logger.Errorf("error while leaks reloading: %v", err)
+	}
+	metrics.ReloadDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+	return merr
+}
+
+// Applies the diff to the VRF state and records the outcome of the config reload
+func (a *App) updateVrfs(diff dto.VrfDiff, reloadErr error) {
+	a.stateLock.Lock()
+	defer a.stateLock.Unlock()
+	a.storeVrfs(diff)
+	a.lastReload = &dto.ReloadStatus{Time: time.Now(), Success: reloadErr == nil}
+	if reloadErr != nil {
+		a.lastReload.Error = reloadErr.Error()
+	}
+}
+
+func (a *App) releaseHoldDown(reason string) {
+	a.workers.Wait()
+	count := 0
+	for controller, paths := range a.holdDown.Release() {
+		count += len(paths)
+		if err := controller.HandleUpdates(paths); err != nil {
+			a.logger.Errorf("error during initial redistribution: %v", err)
+		}
+	}
+	a.holdDown.Finish()
+	a.logger.WithFields(logrus.Fields{"reason": reason, "paths": count}).Info("startup hold-down finished")
+}
+
+// Starts the trace of the path at the moment GoBGP sent it, the time spent in eventChan is a child span
+func (a *App) startPathSpan(controller controller, path *api.Path, receivedAt time.Time) context.Context {
+	ctx, span := tracing.Tracer().Start(context.Background(), "path",
+		trace.WithTimestamp(receivedAt),
+		trace.WithAttributes(
+			tracing.AttrDirection.String(a.direction(controller)),
+			tracing.AttrNeighbor.String(path.GetNeighborIp()),
+			tracing.AttrWithdraw.Bool(path.IsWithdraw),
+		),
+	)
+	if span.IsRecording() {
+		_, queueSpan := tracing.Tracer().Start(ctx, "eventChan", trace.WithTimestamp(receivedAt))
+		queueSpan.End()
+	}
+	return ctx
+}
+
+// Ends the trace started by startPathSpan
+func (a *App) handlePath(ctx context.Context, controller controller, path *api.Path) {
 	if a.logger.IsLevelEnabled(logrus.DebugLevel) {
 		a.logger.WithFields(logrus.Fields{"path": path.String()}).Debug("received path")
 	}
-	var handler func(*api.Path) error
+	var handler func(context.Context, *api.Path) error
 	if path.IsWithdraw {
 		handler = controller.HandleWithdraw
 	} else {
 		handler = controller.HandleUpdate
 	}
-	if err := handler(path); err != nil {
+	err := handler(ctx, path)
+	if err != nil {
 		a.logger.Error(err.Error())
 	}
+	tracing.End(trace.SpanFromContext(ctx), err)
 }
 
 func (a *App) Serve(ctx context.Context) {
@@ -118,6 +473,10 @@ func (a *App) Serve(ctx context.Context) {
 					Type: api.WatchEventRequest_Table_Filter_BEST,
 					Init: true,
 				},
+				{
+					Type: api.WatchEventRequest_Table_Filter_EOR,
+					Init: true,
+				},
 			},
 		},
 	}
@@ -126,6 +485,11 @@ func (a *App) Serve(ctx context.Context) {
 		<-ctx.Done()
 		close(a.controlChan)
 	}()
+	a.workers.Start()
+	a.holdDown.Start()
+	if a.allowlist != nil {
+		a.allowlistUpdates = a.allowlist.Watch(ctx)
+	}
 	go a.receiver()
 	<-ctx.Done()
 	close(a.eventChan)
@@ -137,3 +501,123 @@ func (a *App) ReloadConfig(diff dto.VrfDiff) {
 		VrfDiff: &diff,
 	}
 }
+
+// Closed once the startup hold-down is over and the initial set of routes is redistributed
+func (a *App) Converged() <-chan struct{} {
+	return a.holdDown.done
+}
+
+// Fails if the event loop has not run for maxDelay, e.g. when it is stuck on a full worker queue
+func (a *App) CheckEventLoop(maxDelay time.Duration) error {
+	last := a.heartbeat.Load()
+	if last == 0 {
+		return errors.New("event loop is not started")
+	}
+	if delay := time.Since(time.Unix(0, last)); delay > maxDelay {
+		return fmt.Errorf("event loop has not run for %s", delay.Round(time.Second))
+	}
+	return nil
+}
+
+// Fails until the startup hold-down is over and the initial set of routes is redistributed
+func (a *App) CheckConverged() error {
+	select {
+	case <-a.Converged():
+		return nil
+	default:
+		return errors.New("initial redistribution is in progress")
+	}
+}
+
+func (a *App) CheckLastReload() error {
+	a.stateLock.RLock()
+	defer a.stateLock.RUnlock()
+	if a.lastReload != nil && !a.lastReload.Success {
+		return fmt.Errorf("config reload at %s failed: %s", a.lastReload.Time.Format(time.RFC3339), a.lastReload.Error)
+	}
+	return nil
+}
+
+// Number of redistributed routes by direction and VRF name,
+// static, orchestrated and aggregate routes count as redistributed to EVPN, default routes as redistributed to VPNv4,
+// leaked routes as redistributed in the direction of the injected route
+func (a *App) RedistributedRoutes() map[string]map[string]int {
+	toEvpn := a.vpnController.RedistributedRoutes()
+	for vrf, count := range a.staticRoutes.RedistributedRoutes() {
+		toEvpn[vrf] += count
+	}
+	for vrf, count := range a.orchestrated.RedistributedRoutes() {
+		toEvpn[vrf] += count
+	}
+	for vrf, count := range a.aggregates.RedistributedRoutes() {
+		toEvpn[vrf] += count
+	}
+	toVpn := a.evpnController.RedistributedRoutes()
+	for vrf, count := range a.defaultRoutes.RedistributedRoutes() {
+		toVpn[vrf] += count
+	}
+	result := map[string]map[string]int{
+		metrics.DirectionToEvpn: toEvpn,
+		metrics.DirectionToVpn:  toVpn,
+	}
+	for direction, vrfs := range a.leaks.RedistributedRoutes() {
+		for vrf, count := range vrfs {
+			result[direction][vrf] += count
+		}
+	}
+	return result
+}
+
+func (a *App) EventQueueDepth() int {
+	return len(a.eventChan)
+}
+
+func (a *App) ListRedistributed() []dto.RedistributedRoute {
+	return slices.Concat(
+		a.vpnController.ListRedistributed(),
+		a.evpnController.ListRedistributed(),
+		a.staticRoutes.ListRedistributed(),
+		a.orchestrated.ListRedistributed(),
+		a.aggregates.ListRedistributed(),
+		a.defaultRoutes.ListRedistributed(),
+		a.leaks.ListRedistributed(),
+	)
+}
+
+// Configured VRFs sorted by name
+func (a *App) Vrfs() []dto.Vrf {
+	a.stateLock.RLock()
+	defer a.stateLock.RUnlock()
+	result := make([]dto.Vrf, 0, len(a.vrfs))
+	for _, vrf := range a.vrfs {
+		result = append(result, vrf)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func (a *App) Status() dto.Status {
+	status := dto.Status{
+		StartedAt:       a.startedAt,
+		Workers:         a.workerCount,
+		EventQueueDepth: a.EventQueueDepth(),
+		Redistributed:   map[string]int{},
+	}
+	select {
+	case <-a.Converged():
+		status.Converged = true
+	default:
+	}
+	for direction, vrfs := range a.RedistributedRoutes() {
+		for _, count := range vrfs {
+			status.Redistributed[direction] += count
+		}
+	}
+	a.stateLock.RLock()
+	defer a.stateLock.RUnlock()
+	if a.lastReload != nil {
+		lastReload := *a.lastReload
+		status.LastReload = &lastReload
+	}
+	return status
+}
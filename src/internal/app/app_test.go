@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/metrics"
 	api "github.com/osrg/gobgp/v3/api"
 	"github.com/osrg/gobgp/v3/pkg/config/oc"
 	"github.com/sirupsen/logrus"
@@ -48,18 +49,32 @@ func (m *mockBgpServer) ListPath(ctx context.Context, r *api.ListPathRequest, fn
 	return args.Error(0)
 }
 
+// Calls fn for every VRF given as the first return value
+func (m *mockBgpServer) ListVrf(ctx context.Context, r *api.ListVrfRequest, fn func(*api.Vrf)) error {
+	args := m.Called(ctx, r, mock.AnythingOfType("func(*api.Vrf)"))
+	for _, vrf := range args.Get(0).([]*api.Vrf) {
+		fn(vrf)
+	}
+	return args.Error(1)
+}
+
 // Mock for controller interface
 type mockController struct {
 	mock.Mock
 }
 
-func (m *mockController) HandleUpdate(path *api.Path) error {
-	args := m.Called(path)
+func (m *mockController) HandleUpdate(ctx context.Context, path *api.Path) error {
+	args := m.Called(ctx, path)
 	return args.Error(0)
 }
 
-func (m *mockController) HandleWithdraw(path *api.Path) error {
-	args := m.Called(path)
+func (m *mockController) HandleUpdates(paths []*api.Path) error {
+	args := m.Called(paths)
+	return args.Error(0)
+}
+
+func (m *mockController) HandleWithdraw(ctx context.Context, path *api.Path) error {
+	args := m.Called(ctx, path)
 	return args.Error(0)
 }
 
@@ -68,6 +83,36 @@ func (m *mockController) ReloadConfig(diff dto.VrfDiff) error {
 	return args.Error(0)
 }
 
+func (m *mockController) ListRedistributed() []dto.RedistributedRoute {
+	args := m.Called()
+	return args.Get(0).([]dto.RedistributedRoute)
+}
+
+func (m *mockController) Explain(path *api.Path, vrf dto.Vrf) dto.PathExplanation {
+	args := m.Called(path, vrf)
+	return args.Get(0).(dto.PathExplanation)
+}
+
+func (m *mockController) Audit(path *api.Path) dto.PathAudit {
+	args := m.Called(path)
+	return args.Get(0).(dto.PathAudit)
+}
+
+func (m *mockController) DumpState() dto.ControllerState {
+	args := m.Called()
+	return args.Get(0).(dto.ControllerState)
+}
+
+func (m *mockController) WithdrawSource(source string) (bool, error) {
+	args := m.Called(source)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockController) RedistributedRoutes() map[string]int {
+	args := m.Called()
+	return args.Get(0).(map[string]int)
+}
+
 // Helper function to create a test VPN path
 func createTestVPNPath() *api.Path {
 	rd, _ := anypb.New(&api.RouteDistinguisherTwoOctetASN{
@@ -135,8 +180,9 @@ func TestApp_Sender(t *testing.T) {
 
 	// Read from channel with timeout
 	select {
-	case receivedResp := <-app.eventChan:
-		assert.Equal(t, resp, receivedResp)
+	case event := <-app.eventChan:
+		assert.Equal(t, resp, event.resp)
+		assert.False(t, event.receivedAt.IsZero())
 	case <-time.After(time.Millisecond * 100):
 		t.Fatal("Response not received from channel")
 	}
@@ -172,13 +218,13 @@ func TestApp_HandlePath(t *testing.T) {
 			tt.path.IsWithdraw = tt.isWithdraw
 
 			if tt.isWithdraw {
-				mockController.On("HandleWithdraw", tt.path).Return(nil)
+				mockController.On("HandleWithdraw", mock.Anything, tt.path).Return(nil)
 			} else {
-				mockController.On("HandleUpdate", tt.path).Return(nil)
+				mockController.On("HandleUpdate", mock.Anything, tt.path).Return(nil)
 			}
 
 			// Test the method
-			app.handlePath(mockController, tt.path)
+			app.handlePath(context.Background(), mockController, tt.path)
 
 			mockController.AssertExpectations(t)
 		})
@@ -196,10 +242,10 @@ func TestApp_HandlePathWithError(t *testing.T) {
 	expectedError := errors.New("handler error")
 
 	// Mock controller to return error
-	mockController.On("HandleUpdate", path).Return(expectedError)
+	mockController.On("HandleUpdate", mock.Anything, path).Return(expectedError)
 
 	// Test that error is logged but doesn't cause panic
-	app.handlePath(mockController, path)
+	app.handlePath(context.Background(), mockController, path)
 
 	mockController.AssertExpectations(t)
 }
@@ -257,3 +303,92 @@ func TestApp_Serve_BasicFunctionality(t *testing.T) {
 
 	mockServer.AssertExpectations(t)
 }
+
+func TestApp_RedistributedRoutes(t *testing.T) {
+	vpnController := &mockController{}
+	evpnController := &mockController{}
+	app := NewApp([]oc.VrfConfig{}, &mockBgpServer{}, 100, logrus.New())
+	app.vpnController = vpnController
+	app.evpnController = evpnController
+	vpnController.On("RedistributedRoutes").Return(map[string]int{"vrf_10": 2})
+	evpnController.On("RedistributedRoutes").Return(map[string]int{"vrf_10": 5})
+
+	assert.Equal(t, map[string]map[string]int{
+		metrics.DirectionToEvpn: {"vrf_10": 2},
+		metrics.DirectionToVpn:  {"vrf_10": 5},
+	}, app.RedistributedRoutes())
+	assert.Equal(t, 0, app.EventQueueDepth())
+}
+
+func TestApp_VrfsAndStatus(t *testing.T) {
+	vpnController := &mockController{}
+	evpnController := &mockController{}
+	vrfConfig := []oc.VrfConfig{
+		{Name: "vrf_20", Rd: "65000:20", Id: 20},
+		{Name: "vrf_10", Rd: "65000:10", Id: 10},
+	}
+	app := NewApp(vrfConfig, &mockBgpServer{}, 100, logrus.New(), WithWorkers(2))
+	app.vpnController = vpnController
+	app.evpnController = evpnController
+	vpnController.On("RedistributedRoutes").Return(map[string]int{"vrf_10": 2, "vrf_20": 1})
+	evpnController.On("RedistributedRoutes").Return(map[string]int{})
+	vpnController.On("ReloadConfig", mock.Anything).Return(nil)
+	evpnController.On("ReloadConfig", mock.Anything).Return(errors.New("reload failed"))
+
+	vrfs := app.Vrfs()
+	assert.Equal(t, []string{"vrf_10", "vrf_20"}, []string{vrfs[0].Name, vrfs[1].Name})
+	assert.Nil(t, app.Status().LastReload)
+
+	app.reloadConfig(dto.VrfDiff{
+		Deleted:    []oc.VrfConfig{vrfConfig[0]},
+		Created:    []oc.VrfConfig{{Name: "vrf_30", Rd: "65000:30", Id: 30}},
+		Extensions: map[string]dto.VrfExtensions{"vrf_10": {WithdrawHoldTime: time.Second}},
+	})
+
+	vrfs = app.Vrfs()
+	assert.Len(t, vrfs, 2)
+	assert.Equal(t, time.Second, vrfs[0].WithdrawHoldTime)
+	assert.Equal(t, "vrf_30", vrfs[1].Name)
+	status := app.Status()
+	assert.Equal(t, 2, status.Workers)
+	assert.Equal(t, 3, status.Redistributed[metrics.DirectionToEvpn])
+	assert.True(t, status.Converged) // no startup hold-down
+	assert.False(t, status.LastReload.Success)
+	assert.Contains(t, status.LastReload.Error, "reload failed")
+}
+
+func TestApp_CheckEventLoop(t *testing.T) {
+	app := NewApp([]oc.VrfConfig{}, &mockBgpServer{}, 100, logrus.New())
+	assert.ErrorContains(t, app.CheckEventLoop(time.Second), "not started")
+
+	app.heartbeat.Store(time.Now().Add(-time.Minute).UnixNano())
+	assert.ErrorContains(t, app.CheckEventLoop(30*time.Second), "has not run for 1m0s")
+
+	go app.receiver()
+	defer close(app.controlChan)
+	assert.Eventually(t, func() bool {
+		return app.CheckEventLoop(time.Second) == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestApp_CheckConverged(t *testing.T) {
+	app := NewApp([]oc.VrfConfig{}, &mockBgpServer{}, 100, logrus.New(),
+		WithStartupHoldDown(map[string][]string{"192.168.1.1": {"l2vpn-evpn"}}, time.Minute),
+	)
+	assert.Error(t, app.CheckConverged())
+
+	app.holdDown.Release()
+	app.holdDown.Finish()
+	assert.NoError(t, app.CheckConverged())
+}
+
+func TestApp_CheckLastReload(t *testing.T) {
+	app := NewApp([]oc.VrfConfig{}, &mockBgpServer{}, 100, logrus.New())
+	assert.NoError(t, app.CheckLastReload())
+
+	app.updateVrfs(dto.VrfDiff{}, errors.New("cannot list evpn paths"))
+	assert.ErrorContains(t, app.CheckLastReload(), "cannot list evpn paths")
+
+	app.updateVrfs(dto.VrfDiff{}, nil)
+	assert.NoError(t, app.CheckLastReload())
+}
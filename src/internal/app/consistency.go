@@ -0,0 +1,201 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	ctrl "github.com/amyasnikov/berg/internal/controller"
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/metrics"
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+// Received path along with the decision of its controller
+type auditedPath struct {
+	controller controller
+	path       *api.Path
+	audit      dto.PathAudit
+}
+
+// Locally originated path of the RIB
+type injectedPath struct {
+	nlri string
+	path *api.Path
+}
+
+// Disagreements between the controllers and the GoBGP RIB
+type ribDiff struct {
+	missing  []auditedPath            // received best paths which should be redistributed but are not
+	lost     []auditedPath            // received best paths whose redistributed route has no injected path
+	dangling []dto.RedistributedRoute // tracked routes without the injected path in the RIB
+	stale    []dto.RedistributedRoute // tracked routes without the source path in the RIB
+	orphans  []injectedPath           // locally originated paths no route is tracked for
+}
+
+type sourceKey struct {
+	direction string
+	source    string
+}
+
+func (a *App) diffRib(ctx context.Context) (ribDiff, error) {
+	var diff ribDiff
+	injected := map[string]*api.Path{} // by NLRI
+	received := map[sourceKey]bool{}
+	tracked := []auditedPath{}
+	for _, family := range ribFamilies {
+		req := &api.ListPathRequest{TableType: api.TableType_GLOBAL, Family: family}
+		err := a.bgpServer.ListPath(ctx, req, func(d *api.Destination) {
+			for _, path := range d.GetPaths() {
+				if path.Family == nil {
+					path.Family = family
+				}
+				if isLocal(path) {
+					if nlri, ok := ctrl.FormatNlri(path.GetNlri()); ok {
+						injected[nlri] = path
+					}
+					continue
+				}
+				if !path.Best {
+					continue
+				}
+				controller := a.pathController(path)
+				audit := controller.Audit(path)
+				if audit.Source == "" {
+					continue
+				}
+				received[sourceKey{a.direction(controller), audit.Source}] = true
+				switch {
+				case audit.Tracked:
+					tracked = append(tracked, auditedPath{controller, path, audit})
+				case audit.Expected:
+					diff.missing = append(diff.missing, auditedPath{controller, path, audit})
+				}
+			}
+		})
+		if err != nil {
+			return ribDiff{}, fmt.Errorf("cannot list paths: %w", err)
+		}
+	}
+	for _, audited := range tracked {
+		if _, ok := injected[audited.audit.Generated]; !ok {
+			diff.lost = append(diff.lost, audited)
+		}
+	}
+	generated := map[string]bool{}
+	for _, route := range a.ListRedistributed() {
+		generated[route.Generated] = true
+		if _, ok := injected[route.Generated]; !ok {
+			diff.dangling = append(diff.dangling, route)
+		}
+		if !isLocalSource(route.Source) && !received[sourceKey{route.Direction, route.Source}] {
+			diff.stale = append(diff.stale, route)
+		}
+	}
+	vrfRds := map[string]bool{}
+	for _, vrf := range a.Vrfs() {
+		vrfRds[vrf.Rd] = true
+	}
+	for nlri, path := range injected {
+		if generated[nlri] {
+			continue
+		}
+		// VPNv4 paths with the RD of a local VRF are originated by GoBGP VRFs rather than berg
+		if rd, _, _ := nlriPrefix(path.GetNlri()); path.Family.Afi == api.Family_AFI_IP && vrfRds[rd] {
+			continue
+		}
+		diff.orphans = append(diff.orphans, injectedPath{nlri: nlri, path: path})
+	}
+	sort.Slice(diff.orphans, func(i, j int) bool { return diff.orphans[i].nlri < diff.orphans[j].nlri })
+	return diff, nil
+}
+
+// Source of the routes berg originates itself rather than redistributes from a received path
+func isLocalSource(source string) bool {
+	switch source {
+	case ctrl.StaticSource, ctrl.OrchestratorSource, ctrl.AggregateSource, ctrl.DefaultSource, ctrl.LeakSource:
+		return true
+	}
+	return false
+}
+
+// Direction the locally originated path of the family is injected for
+func injectedDirection(family *api.Family) string {
+	if family.GetAfi() == api.Family_AFI_IP {
+		return metrics.DirectionToVpn
+	}
+	return metrics.DirectionToEvpn
+}
+
+func (a *App) DumpState() dto.StateDump {
+	return dto.StateDump{Vpnv4: a.vpnController.DumpState(), Evpn: a.evpnController.DumpState()}
+}
+
+// Cross-checks the routes tracked by the controllers against the GoBGP RIB.
+// Paths which are still queued for the workers show up as transient inconsistencies
+func (a *App) CheckConsistency(ctx context.Context) (dto.ConsistencyReport, error) {
+	diff, err := a.diffRib(ctx)
+	if err != nil {
+		return dto.ConsistencyReport{}, err
+	}
+	report := dto.ConsistencyReport{
+		Converged: a.CheckConverged() == nil,
+		Orphans:   []dto.InconsistentRoute{},
+		Dangling:  inconsistentRoutes(diff.dangling),
+		Stale:     inconsistentRoutes(diff.stale),
+		Missing:   []dto.InconsistentRoute{},
+		Internal:  []string{},
+	}
+	for _, missing := range diff.missing {
+		report.Missing = append(report.Missing, dto.InconsistentRoute{
+			Direction: a.direction(missing.controller),
+			Vrf:       missing.audit.Vrf,
+			Source:    missing.audit.Source,
+		})
+	}
+	for _, orphan := range diff.orphans {
+		report.Orphans = append(report.Orphans, dto.InconsistentRoute{
+			Direction: injectedDirection(orphan.path.Family),
+			Generated: orphan.nlri,
+		})
+	}
+	state := a.DumpState()
+	for _, problem := range state.Vpnv4.Problems {
+		report.Internal = append(report.Internal, "vpnv4: "+problem)
+	}
+	for _, problem := range state.Evpn.Problems {
+		report.Internal = append(report.Internal, "evpn: "+problem)
+	}
+	for _, routes := range [][]dto.InconsistentRoute{report.Orphans, report.Dangling, report.Stale, report.Missing} {
+		sortInconsistent(routes)
+	}
+	report.Consistent = len(report.Orphans)+len(report.Dangling)+len(report.Stale)+
+		len(report.Missing)+len(report.Internal) == 0
+	return report, nil
+}
+
+func inconsistentRoutes(routes []dto.RedistributedRoute) []dto.InconsistentRoute {
+	result := make([]dto.InconsistentRoute, 0, len(routes))
+	for _, route := range routes {
+		result = append(result, dto.InconsistentRoute{
+			Direction: route.Direction,
+			Vrf:       route.Vrf,
+			Source:    route.Source,
+			Generated: route.Generated,
+			Uuid:      route.Uuid.String(),
+		})
+	}
+	return result
+}
+
+func sortInconsistent(routes []dto.InconsistentRoute) {
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Direction != routes[j].Direction {
+			return routes[i].Direction < routes[j].Direction
+		}
+		if routes[i].Source != routes[j].Source {
+			return routes[i].Source < routes[j].Source
+		}
+		return routes[i].Generated < routes[j].Generated
+	})
+}
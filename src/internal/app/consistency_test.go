@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestApp_CheckConsistency(t *testing.T) {
+	received := createTestVPNPath()
+	received.Best = true
+	nexthop, _ := anypb.New(&api.MpReachNLRIAttribute{NextHops: []string{"192.168.1.1"}})
+	received.Pattrs = []*anypb.Any{nexthop}
+	injected := createTestEVPNPath() // the EVPN route generated from the received path
+	injected.NeighborIp = ""
+	injected.Best = true
+	server := &ribServer{rib: map[api.Family_Afi][]*api.Path{
+		api.Family_AFI_IP:    {received},
+		api.Family_AFI_L2VPN: {injected},
+	}}
+	evpnUuid := uuid.New()
+	server.On("AddPath", mock.Anything, mock.Anything).Return(&api.AddPathResponse{Uuid: evpnUuid[:]}, nil)
+	vrfConfig := []oc.VrfConfig{{Name: "vrf_10", Rd: "65000:100", Id: 1000, ImportRtList: []string{"65000:100"}}}
+	app := NewApp(vrfConfig, server, 100, logrus.New())
+
+	report, err := app.CheckConsistency(context.Background())
+
+	require.NoError(t, err)
+	assert.False(t, report.Consistent)
+	assert.True(t, report.Converged)
+	assert.Equal(t, []dto.InconsistentRoute{
+		{Direction: metrics.DirectionToEvpn, Vrf: "vrf_10", Source: "65000:100:10.0.0.0/24"},
+	}, report.Missing)
+	assert.Equal(t, []dto.InconsistentRoute{
+		{Direction: metrics.DirectionToEvpn, Generated: "5:65000:100:10.0.0.0/24 Gw:192.168.1.1 Vni:1000"},
+	}, report.Orphans)
+
+	require.NoError(t, app.vpnController.HandleUpdate(context.Background(), received))
+	report, err = app.CheckConsistency(context.Background())
+
+	require.NoError(t, err)
+	assert.True(t, report.Consistent)
+
+	server.rib[api.Family_AFI_L2VPN] = nil
+	report, err = app.CheckConsistency(context.Background())
+
+	require.NoError(t, err)
+	assert.False(t, report.Consistent)
+	assert.Equal(t, []dto.InconsistentRoute{{
+		Direction: metrics.DirectionToEvpn,
+		Vrf:       "vrf_10",
+		Source:    "65000:100:10.0.0.0/24",
+		Generated: "5:65000:100:10.0.0.0/24 Gw:192.168.1.1 Vni:1000",
+		Uuid:      evpnUuid.String(),
+	}}, report.Dangling)
+	assert.Empty(t, report.Missing)
+}
+
+func TestApp_CheckConsistency_StaticRoutes(t *testing.T) {
+	injected := createTestEVPNPath()
+	injected.NeighborIp = ""
+	server := &ribServer{rib: map[api.Family_Afi][]*api.Path{api.Family_AFI_L2VPN: {injected}}}
+	evpnUuid := uuid.New()
+	server.On("AddPath", mock.Anything, mock.Anything).Return(&api.AddPathResponse{Uuid: evpnUuid[:]}, nil)
+	vrfConfig := []oc.VrfConfig{{Name: "vrf_10", Rd: "65000:100", Id: 1000, BothRtList: []string{"65000:100"}}}
+	extensions := map[string]dto.VrfExtensions{
+		"vrf_10": {StaticRoutes: []dto.StaticRoute{{Prefix: "10.0.0.0/24", Gateway: "192.168.1.1"}}},
+	}
+	app := NewApp(vrfConfig, server, 100, logrus.New(), WithVrfExtensions(extensions))
+	require.NoError(t, app.staticRoutes.Sync())
+
+	report, err := app.CheckConsistency(context.Background())
+
+	require.NoError(t, err)
+	assert.True(t, report.Consistent)
+	assert.Equal(t, map[string]int{"vrf_10": 1}, app.RedistributedRoutes()[metrics.DirectionToEvpn])
+	require.Len(t, app.ListRedistributed(), 1)
+	assert.Equal(t, "5:65000:100:10.0.0.0/24 Gw:192.168.1.1 Vni:1000", app.ListRedistributed()[0].Generated)
+}
+
+func TestApp_DumpState(t *testing.T) {
+	vrfConfig := []oc.VrfConfig{{Name: "vrf_10", Rd: "65000:100", ImportRtList: []string{"65000:100"}}}
+	app := NewApp(vrfConfig, &mockBgpServer{}, 100, logrus.New())
+
+	state := app.DumpState()
+
+	assert.Equal(t, map[string]string{"65000:100": "vrf_10"}, state.Vpnv4.RdVrfMap)
+	assert.Equal(t, []string{"65000:100"}, state.Evpn.ExistingRT)
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/utils"
+	"github.com/hashicorp/go-multierror"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/sirupsen/logrus"
+)
+
+// How long listing the VRFs of GoBGP may take
+const vrfListTimeout = 10 * time.Second
+
+// Hands the VRFs created or deleted in GoBGP since the last check over to the controllers
+func (a *App) syncVrfs() {
+	ctx, cancel := context.WithTimeout(context.Background(), vrfListTimeout)
+	defer cancel()
+	current, err := a.listVrfs(ctx)
+	if err != nil {
+		a.logger.Errorf("cannot discover VRFs: %v", err)
+		return
+	}
+	diff := utils.GetVrfDiff(slices.Collect(maps.Values(a.knownVrfs)), slices.Collect(maps.Values(current)))
+	if len(diff.Created) == 0 && len(diff.Deleted) == 0 {
+		return
+	}
+	for _, vrf := range diff.Deleted {
+		a.logger.WithFields(logrus.Fields{"vrf": vrf.Name, "rd": vrf.Rd, "vni": vrf.Id}).Info("VRF removed from GoBGP")
+	}
+	for _, vrf := range diff.Created {
+		a.logger.WithFields(logrus.Fields{"vrf": vrf.Name, "rd": vrf.Rd, "vni": vrf.Id}).Info("VRF discovered in GoBGP")
+	}
+	diff.Extensions = a.vrfExtensions
+	if err = a.reloadControllers(diff); err != nil {
+		a.logger.Errorf("cannot apply discovered VRFs: %v", err)
+	}
+	a.stateLock.Lock()
+	defer a.stateLock.Unlock()
+	a.storeVrfs(diff)
+}
+
+// Normalized configs of the GoBGP VRFs by ID. VRFs without ID are skipped, since the ID is their VNI
+func (a *App) listVrfs(ctx context.Context) (map[uint32]oc.VrfConfig, error) {
+	vrfs := map[uint32]oc.VrfConfig{}
+	var merr error
+	err := a.bgpServer.ListVrf(ctx, &api.ListVrfRequest{}, func(apiVrf *api.Vrf) {
+		vrf, err := utils.VrfFromApi(apiVrf)
+		if err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("VRF %s: %w", apiVrf.GetName(), err))
+			return
+		}
+		if vrf.Id == 0 {
+			a.logger.Warnf("VRF %s has no ID to use as VNI, ignoring it", vrf.Name)
+			return
+		}
+		vrfs[vrf.Id] = vrf
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vrfs, merr
+}
+
+// Drops the changes of the config file which the VRF discovery has already picked up from GoBGP
+func (a *App) unappliedVrfChanges(diff dto.VrfDiff) dto.VrfDiff {
+	known := maps.Clone(a.knownVrfs)
+	result := dto.VrfDiff{Extensions: diff.Extensions}
+	for _, vrf := range diff.Deleted {
+		if existing, ok := known[vrf.Id]; ok && reflect.DeepEqual(existing, utils.NormalizeVrf(vrf)) {
+			result.Deleted = append(result.Deleted, vrf)
+			delete(known, vrf.Id)
+		}
+	}
+	for _, vrf := range diff.Created {
+		if existing, ok := known[vrf.Id]; !ok || !reflect.DeepEqual(existing, utils.NormalizeVrf(vrf)) {
+			result.Created = append(result.Created, vrf)
+		}
+	}
+	return result
+}
+
+// Must be called with stateLock held
+func (a *App) storeVrfs(diff dto.VrfDiff) {
+	for _, vrf := range diff.Deleted {
+		delete(a.vrfs, vrf.Name)
+		delete(a.knownVrfs, vrf.Id)
+	}
+	for _, vrf := range diff.Created {
+		a.vrfs[vrf.Name] = dto.NewVrf(vrf, diff.Extensions[vrf.Name])
+		a.knownVrfs[vrf.Id] = utils.NormalizeVrf(vrf)
+	}
+	if diff.Extensions != nil {
+		a.vrfExtensions = diff.Extensions
+		for name, vrf := range a.vrfs {
+			vrf.VrfExtensions = diff.Extensions[name]
+			a.vrfs[name] = vrf
+		}
+	}
+}
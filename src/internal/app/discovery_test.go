@@ -0,0 +1,111 @@
+package app
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/utils"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func testApiVrf(name string, id uint32, rd string, rts ...string) *api.Vrf {
+	apiRd, _ := utils.RdToApi(rd)
+	apiRts := make([]*anypb.Any, 0, len(rts))
+	for _, rt := range rts {
+		apiRt, _ := utils.RtToApi(rt)
+		apiRts = append(apiRts, apiRt)
+	}
+	return &api.Vrf{Name: name, Id: id, Rd: apiRd, ImportRt: apiRts, ExportRt: apiRts}
+}
+
+func TestApp_SyncVrfs(t *testing.T) {
+	server := &mockBgpServer{}
+	vpnController := &mockController{}
+	evpnController := &mockController{}
+	vrfConfig := []oc.VrfConfig{
+		{Name: "vrf_10", Rd: "65000:10", Id: 10, BothRtList: []string{"65000:10"}},
+		{Name: "vrf_20", Rd: "65000:20", Id: 20, BothRtList: []string{"65000:20"}},
+	}
+	extensions := map[string]dto.VrfExtensions{"vrf_30": {WithdrawHoldTime: time.Second}}
+	app := NewApp(vrfConfig, server, 100, logrus.New(), WithVrfExtensions(extensions), WithVrfDiscovery(0))
+	app.vpnController = vpnController
+	app.evpnController = evpnController
+	server.On("ListVrf", mock.Anything, mock.Anything, mock.Anything).Return([]*api.Vrf{
+		testApiVrf("vrf_10", 10, "65000:10", "65000:10"),
+		testApiVrf("vrf_30", 30, "65000:30", "65000:30"),
+		testApiVrf("no_id", 0, "65000:40"),
+	}, nil).Once()
+	expected := dto.VrfDiff{
+		Created: []oc.VrfConfig{{
+			Name: "vrf_30", Rd: "65000:30", Id: 30, ImportRtList: []string{"65000:30"}, ExportRtList: []string{"65000:30"},
+		}},
+		Deleted:    []oc.VrfConfig{utils.NormalizeVrf(vrfConfig[1])},
+		Extensions: extensions,
+	}
+	vpnController.On("ReloadConfig", expected).Return(nil).Once()
+	evpnController.On("ReloadConfig", expected).Return(nil).Once()
+
+	app.syncVrfs()
+
+	vpnController.AssertExpectations(t)
+	evpnController.AssertExpectations(t)
+	vrfs := app.Vrfs()
+	require.Len(t, vrfs, 2)
+	assert.Equal(t, "vrf_30", vrfs[1].Name)
+	assert.Equal(t, uint32(30), vrfs[1].Vni)
+	assert.Equal(t, time.Second, vrfs[1].WithdrawHoldTime)
+	assert.Nil(t, app.lastReload) // not a config reload
+
+	// nothing changed since
+	server.On("ListVrf", mock.Anything, mock.Anything, mock.Anything).Return([]*api.Vrf{
+		testApiVrf("vrf_10", 10, "65000:10", "65000:10"),
+		testApiVrf("vrf_30", 30, "65000:30", "65000:30"),
+	}, nil).Once()
+	app.syncVrfs()
+	vpnController.AssertNumberOfCalls(t, "ReloadConfig", 1)
+}
+
+func TestApp_SyncVrfs_ListFailed(t *testing.T) {
+	server := &mockBgpServer{}
+	vpnController := &mockController{}
+	app := NewApp(
+		[]oc.VrfConfig{{Name: "vrf_10", Rd: "65000:10", Id: 10}}, server, 100, logrus.New(), WithVrfDiscovery(0),
+	)
+	app.vpnController = vpnController
+	server.On("ListVrf", mock.Anything, mock.Anything, mock.Anything).
+		Return([]*api.Vrf{{Name: "vrf_10", Id: 10}}, nil).Once() // no RD
+	server.On("ListVrf", mock.Anything, mock.Anything, mock.Anything).
+		Return([]*api.Vrf{}, errors.New("server stopped")).Once()
+
+	app.syncVrfs()
+	app.syncVrfs()
+
+	vpnController.AssertNotCalled(t, "ReloadConfig", mock.Anything)
+	assert.Len(t, app.Vrfs(), 1)
+}
+
+func TestApp_UnappliedVrfChanges(t *testing.T) {
+	vrf10 := oc.VrfConfig{Name: "vrf_10", Rd: "65000:10", Id: 10, BothRtList: []string{"65000:10"}}
+	vrf20 := oc.VrfConfig{Name: "vrf_20", Rd: "65000:20", Id: 20}
+	vrf30 := oc.VrfConfig{Name: "vrf_30", Rd: "65000:30", Id: 30}
+	changed10 := oc.VrfConfig{Name: "vrf_10", Rd: "65000:100", Id: 10, BothRtList: []string{"65000:10"}}
+	app := NewApp([]oc.VrfConfig{vrf10, vrf20}, &mockBgpServer{}, 100, logrus.New())
+	extensions := map[string]dto.VrfExtensions{}
+
+	// not discovered yet
+	diff := dto.VrfDiff{Deleted: []oc.VrfConfig{vrf10, vrf20}, Created: []oc.VrfConfig{changed10, vrf30}}
+	assert.Equal(t, diff, app.unappliedVrfChanges(diff))
+
+	// already discovered
+	app.storeVrfs(dto.VrfDiff{Deleted: []oc.VrfConfig{vrf10, vrf20}, Created: []oc.VrfConfig{changed10, vrf30}})
+	diff.Extensions = extensions
+	assert.Equal(t, dto.VrfDiff{Extensions: extensions}, app.unappliedVrfChanges(diff))
+}
@@ -0,0 +1,113 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/utils"
+	api "github.com/osrg/gobgp/v3/api"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const stepReceive = "receive"
+
+// Families of the GoBGP global RIB berg redistributes between
+var ribFamilies = []*api.Family{
+	{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_MPLS_VPN},
+	{Afi: api.Family_AFI_L2VPN, Safi: api.Family_SAFI_EVPN},
+}
+
+// Explains why the paths of the VRF matching the prefix are (not) redistributed.
+// Prefix is either a prefix, e.g. 10.0.0.0/24, or an address covered by the routes
+func (a *App) Explain(ctx context.Context, vrfName, prefix string) (dto.Explanation, error) {
+	match, err := utils.PrefixMatcher(prefix)
+	if err != nil {
+		return dto.Explanation{}, err
+	}
+	a.stateLock.RLock()
+	vrf, ok := a.vrfs[vrfName]
+	a.stateLock.RUnlock()
+	if !ok {
+		return dto.Explanation{}, fmt.Errorf("%w: %s", dto.ErrVrfNotFound, vrfName)
+	}
+	result := dto.Explanation{Vrf: vrfName, Prefix: prefix, Paths: []dto.PathExplanation{}}
+	for _, family := range ribFamilies {
+		req := &api.ListPathRequest{TableType: api.TableType_GLOBAL, Family: family}
+		err := a.bgpServer.ListPath(ctx, req, func(d *api.Destination) {
+			for _, path := range d.GetPaths() {
+				if path.Family == nil {
+					path.Family = family
+				}
+				rd, pathPrefix, ok := nlriPrefix(path.GetNlri())
+				if !ok || !match(pathPrefix) {
+					continue
+				}
+				if family.Afi == api.Family_AFI_IP && rd != vrf.Rd {
+					continue
+				}
+				result.Paths = append(result.Paths, a.explainPath(path, pathPrefix, vrf))
+			}
+		})
+		if err != nil {
+			return dto.Explanation{}, fmt.Errorf("cannot list paths: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// Checks made by the event loop before the path reaches a controller
+func (a *App) explainPath(path *api.Path, prefix string, vrf dto.Vrf) dto.PathExplanation {
+	controller := a.pathController(path)
+	result := controller.Explain(path, vrf)
+	if result.Source == "" {
+		result.Source = prefix
+	}
+	var reason string
+	switch {
+	case isLocal(path):
+		reason = "path is locally originated, e.g. injected by berg"
+	case !path.Best:
+		reason = "path is not the best one"
+	case a.CheckConverged() != nil:
+		reason = "startup hold-down is in progress"
+	}
+	if reason != "" {
+		rejected := dto.PathExplanation{
+			Direction: result.Direction,
+			Source:    result.Source,
+			Neighbor:  result.Neighbor,
+		}
+		rejected.Reject(stepReceive, reason)
+		return rejected
+	}
+	received := dto.ExplainStep{Name: stepReceive, Passed: true, Detail: "best path from " + path.NeighborIp}
+	result.Steps = append([]dto.ExplainStep{received}, result.Steps...)
+	return result
+}
+
+// RD and prefix of VPNv4 and EVPN Type-5 routes, EVPN Type-2 routes yield their host prefix.
+// ok is false for the other NLRI types
+func nlriPrefix(nlri *anypb.Any) (rd string, prefix string, ok bool) {
+	msg, err := nlri.UnmarshalNew()
+	if err != nil {
+		return "", "", false
+	}
+	switch route := msg.(type) {
+	case *api.LabeledVPNIPAddressPrefix:
+		rd, err = utils.RdToString(route.Rd)
+		return rd, fmt.Sprintf("%s/%d", route.Prefix, route.PrefixLen), err == nil
+	case *api.EVPNIPPrefixRoute:
+		rd, err = utils.RdToString(route.Rd)
+		return rd, fmt.Sprintf("%s/%d", route.IpPrefix, route.IpPrefixLen), err == nil
+	case *api.EVPNMACIPAdvertisementRoute:
+		addr, err := netip.ParseAddr(route.IpAddress)
+		if err != nil {
+			return "", "", false
+		}
+		rd, err = utils.RdToString(route.Rd)
+		return rd, netip.PrefixFrom(addr, addr.BitLen()).String(), err == nil
+	}
+	return "", "", false
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Serves ListPath from the in-memory RIB
+type ribServer struct {
+	mockBgpServer
+	rib map[api.Family_Afi][]*api.Path
+}
+
+func (s *ribServer) ListPath(ctx context.Context, r *api.ListPathRequest, fn func(*api.Destination)) error {
+	for _, path := range s.rib[r.Family.Afi] {
+		fn(&api.Destination{Paths: []*api.Path{path}})
+	}
+	return nil
+}
+
+func TestApp_Explain(t *testing.T) {
+	received := createTestVPNPath()
+	received.Best = true
+	otherVrf := createTestVPNPath()
+	otherVrf.Best = true
+	rd, _ := anypb.New(&api.RouteDistinguisherTwoOctetASN{Admin: 65000, Assigned: 200})
+	otherVrf.Nlri, _ = anypb.New(&api.LabeledVPNIPAddressPrefix{
+		Rd: rd, Prefix: "10.0.0.0", PrefixLen: 24, Labels: []uint32{1000},
+	})
+	local := createTestEVPNPath()
+	local.Best = true
+	local.NeighborIp = "<nil>"
+	notBest := createTestEVPNPath()
+	server := &ribServer{rib: map[api.Family_Afi][]*api.Path{
+		api.Family_AFI_IP:    {received, otherVrf},
+		api.Family_AFI_L2VPN: {local, notBest},
+	}}
+	vrfConfig := []oc.VrfConfig{{Name: "vrf_10", Rd: "65000:100", Id: 1000, ImportRtList: []string{"65000:100"}}}
+	app := NewApp(vrfConfig, server, 100, logrus.New())
+
+	explanation, err := app.Explain(context.Background(), "vrf_10", "10.0.0.1")
+
+	require.NoError(t, err)
+	assert.Equal(t, "vrf_10", explanation.Vrf)
+	require.Len(t, explanation.Paths, 3)
+	assert.Equal(t, "65000:100:10.0.0.0/24", explanation.Paths[0].Source)
+	assert.Equal(t, stepReceive, explanation.Paths[0].Steps[0].Name)
+	assert.True(t, explanation.Paths[0].Steps[0].Passed)
+	assert.Contains(t, explanation.Paths[0].Reason, "nexthop")
+	assert.Equal(t, "path is locally originated, e.g. injected by berg", explanation.Paths[1].Reason)
+	assert.Len(t, explanation.Paths[1].Steps, 1)
+	assert.Equal(t, "path is not the best one", explanation.Paths[2].Reason)
+}
+
+func TestApp_Explain_Errors(t *testing.T) {
+	app := NewApp([]oc.VrfConfig{{Name: "vrf_10", Rd: "65000:100"}}, &ribServer{}, 100, logrus.New())
+
+	_, err := app.Explain(context.Background(), "vrf_20", "10.0.0.1")
+	assert.ErrorIs(t, err, dto.ErrVrfNotFound)
+
+	_, err = app.Explain(context.Background(), "vrf_10", "10.0.0/24")
+	assert.Error(t, err)
+}
+
+func TestNlriPrefix(t *testing.T) {
+	rd, prefix, ok := nlriPrefix(createTestEVPNPath().Nlri)
+	assert.True(t, ok)
+	assert.Equal(t, "65000:100", rd)
+	assert.Equal(t, "10.0.0.0/24", prefix)
+
+	rdAny, _ := anypb.New(&api.RouteDistinguisherTwoOctetASN{Admin: 65000, Assigned: 100})
+	macIp, _ := anypb.New(&api.EVPNMACIPAdvertisementRoute{Rd: rdAny, IpAddress: "10.0.0.1"})
+	_, prefix, ok = nlriPrefix(macIp)
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.1/32", prefix)
+
+	macOnly, _ := anypb.New(&api.EVPNMACIPAdvertisementRoute{Rd: rdAny})
+	_, _, ok = nlriPrefix(macOnly)
+	assert.False(t, ok)
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"net"
+	"time"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// Delays redistribution at startup until every configured neighbor has sent End-of-RIB
+// or the max hold timer expires. Paths received meanwhile are redistributed in one pass
+type holdDown struct {
+	awaiting map[string]mapset.Set[string] // neighbor address -> families without End-of-RIB
+	paths    map[string]pathTask           // the latest path per NLRI
+	maxHold  time.Duration
+	timer    *time.Timer
+	active   bool
+	done     chan struct{}
+}
+
+// neighbors maps neighbor address to its configured AFI/SAFI names, e.g. "l2vpn-evpn"
+func newHoldDown(neighbors map[string][]string, maxHold time.Duration) *holdDown {
+	awaiting := make(map[string]mapset.Set[string], len(neighbors))
+	for addr, families := range neighbors {
+		if len(families) > 0 {
+			awaiting[normalizeAddr(addr)] = mapset.NewThreadUnsafeSet(families...)
+		}
+	}
+	h := &holdDown{
+		awaiting: awaiting,
+		paths:    map[string]pathTask{},
+		maxHold:  maxHold,
+		active:   maxHold > 0,
+		done:     make(chan struct{}),
+	}
+	if !h.active {
+		close(h.done)
+	}
+	return h
+}
+
+func (h *holdDown) Start() {
+	if h.Active() {
+		h.timer = time.NewTimer(h.maxHold)
+	}
+}
+
+func (h *holdDown) Active() bool {
+	return h.active
+}
+
+// Fires when the max hold time expires, nil channel if there is nothing to wait for
+func (h *holdDown) Expired() <-chan time.Time {
+	if h.timer == nil || !h.Active() {
+		return nil
+	}
+	return h.timer.C
+}
+
+// Returns true once End-of-RIB is received from every configured neighbor
+func (h *holdDown) HandleEor(path *api.Path) bool {
+	addr := normalizeAddr(path.GetNeighborIp())
+	if families, ok := h.awaiting[addr]; ok {
+		family := bgp.AfiSafiToRouteFamily(uint16(path.GetFamily().GetAfi()), uint8(path.GetFamily().GetSafi()))
+		families.Remove(family.String())
+		if families.IsEmpty() {
+			delete(h.awaiting, addr)
+		}
+	}
+	return h.Converged()
+}
+
+func (h *holdDown) Converged() bool {
+	return len(h.awaiting) == 0
+}
+
+func (h *holdDown) Buffer(controller controller, path *api.Path) {
+	key := path.GetFamily().String() + string(path.GetNlri().GetValue())
+	if path.IsWithdraw {
+		delete(h.paths, key)
+		return
+	}
+	h.paths[key] = pathTask{controller: controller, path: path}
+}
+
+// Ends the hold-down and returns the buffered paths grouped by controller.
+// Finish must be called once they are redistributed
+func (h *holdDown) Release() map[controller][]*api.Path {
+	result := map[controller][]*api.Path{}
+	for _, task := range h.paths {
+		result[task.controller] = append(result[task.controller], task.path)
+	}
+	h.paths = map[string]pathTask{}
+	if h.timer != nil {
+		h.timer.Stop()
+	}
+	h.active = false
+	return result
+}
+
+func (h *holdDown) Finish() {
+	close(h.done)
+}
+
+func normalizeAddr(addr string) string {
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip.String()
+	}
+	return addr
+}
+
+func isEor(path *api.Path) bool {
+	return path.GetNlri() == nil
+}
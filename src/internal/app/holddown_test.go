@@ -0,0 +1,127 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func createEorPath(neighbor string, afi api.Family_Afi, safi api.Family_Safi) *api.Path {
+	return &api.Path{
+		Family:     &api.Family{Afi: afi, Safi: safi},
+		IsWithdraw: true,
+		NeighborIp: neighbor,
+	}
+}
+
+func TestHoldDown_Disabled(t *testing.T) {
+	h := newHoldDown(map[string][]string{"10.0.0.1": {"l2vpn-evpn"}}, 0)
+	h.Start()
+
+	assert.False(t, h.Active())
+	assert.Nil(t, h.Expired())
+}
+
+func TestHoldDown_HandleEor(t *testing.T) {
+	h := newHoldDown(map[string][]string{
+		"10.0.0.1": {"l2vpn-evpn"},
+		"10.0.0.2": {"ipv4-unicast", "l2vpn-evpn"},
+	}, time.Minute)
+	h.Start()
+
+	assert.False(t, h.HandleEor(createEorPath("10.0.0.1", api.Family_AFI_L2VPN, api.Family_SAFI_EVPN)))
+	assert.False(t, h.HandleEor(createEorPath("10.0.0.2", api.Family_AFI_IP, api.Family_SAFI_UNICAST)))
+	// unknown neighbor is ignored
+	assert.False(t, h.HandleEor(createEorPath("10.0.0.3", api.Family_AFI_L2VPN, api.Family_SAFI_EVPN)))
+	assert.True(t, h.HandleEor(createEorPath("10.0.0.2", api.Family_AFI_L2VPN, api.Family_SAFI_EVPN)))
+	assert.True(t, h.Active())
+}
+
+func TestHoldDown_BufferKeepsLatestPath(t *testing.T) {
+	h := newHoldDown(map[string][]string{"10.0.0.1": {"l2vpn-evpn"}}, time.Minute)
+	vpnController := &mockController{}
+	first := createVPNPathWithNexthop(100, "10.0.0.1")
+	second := createVPNPathWithNexthop(100, "10.0.0.1")
+	second.NeighborIp = "192.168.1.2"
+	withdrawn := createVPNPathWithNexthop(100, "10.0.0.2")
+	withdraw := createVPNPathWithNexthop(100, "10.0.0.2")
+	withdraw.IsWithdraw = true
+
+	h.Buffer(vpnController, first)
+	h.Buffer(vpnController, withdrawn)
+	h.Buffer(vpnController, second)
+	h.Buffer(vpnController, withdraw)
+	released := h.Release()
+
+	assert.Equal(t, map[controller][]*api.Path{vpnController: {second}}, released)
+	assert.False(t, h.Active())
+}
+
+func TestApp_StartupHoldDown_ReleasedOnEor(t *testing.T) {
+	vpnController := &mockController{}
+	evpnController := &mockController{}
+	neighbors := map[string][]string{"192.168.1.1": {"l2vpn-evpn"}}
+	app := NewApp([]oc.VrfConfig{}, &mockBgpServer{}, 100, logrus.New(), WithStartupHoldDown(neighbors, time.Minute))
+	app.vpnController = vpnController
+	app.evpnController = evpnController
+	vpnPath := createTestVPNPath()
+	evpnPath := createTestEVPNPath()
+	vpnController.On("HandleUpdates", []*api.Path{vpnPath}).Return(nil)
+	evpnController.On("HandleUpdates", []*api.Path{evpnPath}).Return(nil)
+
+	app.workers.Start()
+	app.holdDown.Start()
+	go app.receiver()
+	defer close(app.controlChan)
+	app.sender(&api.WatchEventResponse{
+		Event: &api.WatchEventResponse_Table{Table: &api.WatchEventResponse_TableEvent{
+			Paths: []*api.Path{vpnPath, evpnPath},
+		}},
+	})
+	app.sender(&api.WatchEventResponse{
+		Event: &api.WatchEventResponse_Table{Table: &api.WatchEventResponse_TableEvent{
+			Paths: []*api.Path{createEorPath("192.168.1.1", api.Family_AFI_L2VPN, api.Family_SAFI_EVPN)},
+		}},
+	})
+
+	select {
+	case <-app.Converged():
+	case <-time.After(time.Second):
+		t.Fatal("hold-down was not released")
+	}
+	vpnController.AssertExpectations(t)
+	evpnController.AssertExpectations(t)
+	vpnController.AssertNotCalled(t, "HandleUpdate", mock.Anything, mock.Anything)
+}
+
+func TestApp_StartupHoldDown_ReleasedOnTimer(t *testing.T) {
+	vpnController := &mockController{}
+	neighbors := map[string][]string{"192.168.1.1": {"l2vpn-evpn"}}
+	app := NewApp(
+		[]oc.VrfConfig{}, &mockBgpServer{}, 100, logrus.New(),
+		WithStartupHoldDown(neighbors, 20*time.Millisecond),
+	)
+	app.vpnController = vpnController
+	vpnPath := createTestVPNPath()
+	vpnController.On("HandleUpdates", []*api.Path{vpnPath}).Return(nil)
+
+	app.workers.Start()
+	app.holdDown.Start()
+	go app.receiver()
+	defer close(app.controlChan)
+	app.sender(&api.WatchEventResponse{
+		Event: &api.WatchEventResponse_Table{Table: &api.WatchEventResponse_TableEvent{Paths: []*api.Path{vpnPath}}},
+	})
+
+	select {
+	case <-app.Converged():
+	case <-time.After(time.Second):
+		t.Fatal("hold-down was not released")
+	}
+	vpnController.AssertExpectations(t)
+}
@@ -5,12 +5,37 @@ import (
 
 	"github.com/amyasnikov/berg/internal/dto"
 	api "github.com/osrg/gobgp/v3/api"
+	"google.golang.org/grpc"
 )
 
 type controller interface {
-	HandleUpdate(path *api.Path) error
-	HandleWithdraw(path *api.Path) error
+	HandleUpdate(ctx context.Context, path *api.Path) error
+	HandleUpdates(paths []*api.Path) error
+	HandleWithdraw(ctx context.Context, path *api.Path) error
 	ReloadConfig(dto.VrfDiff) error
+	RedistributedRoutes() map[string]int
+	ListRedistributed() []dto.RedistributedRoute
+	Explain(path *api.Path, vrf dto.Vrf) dto.PathExplanation
+	Audit(path *api.Path) dto.PathAudit
+	DumpState() dto.ControllerState
+	WithdrawSource(source string) (bool, error)
+}
+
+// Max-prefix limits of the redistribution to EVPN
+type prefixLimits interface {
+	ClearMaxPrefix(vrf, neighbor string) ([]dto.MaxPrefixBlock, error)
+	ClearedLimits() []dto.MaxPrefixBlock
+}
+
+// Gateway changes of the prefixes redistributed to EVPN
+type prefixMobility interface {
+	ExpireMobility()
+}
+
+// Prefix allowlist of the received routes redistributed to EVPN
+type prefixAllowlist interface {
+	SetAllowlist(entries []dto.AllowlistEntry) (unblocked []string, err error)
+	ListBlocked() []dto.BlockedRoute
 }
 
 type bgpServer interface {
@@ -18,4 +43,9 @@ type bgpServer interface {
 	DeletePath(context.Context, *api.DeletePathRequest) error
 	WatchEvent(context.Context, *api.WatchEventRequest, func(*api.WatchEventResponse)) error
 	ListPath(ctx context.Context, r *api.ListPathRequest, fn func(*api.Destination)) error
+	ListVrf(ctx context.Context, r *api.ListVrfRequest, fn func(*api.Vrf)) error
+}
+
+type pathStreamer interface {
+	AddPathStream(ctx context.Context, opts ...grpc.CallOption) (api.GobgpApi_AddPathStreamClient, error)
 }
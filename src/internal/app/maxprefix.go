@@ -0,0 +1,35 @@
+package app
+
+import (
+	"github.com/amyasnikov/berg/internal/dto"
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+// Unblocks the exceeded max-prefix limits of the VRF, only the one of the neighbor unless it is empty.
+// The received routes the limits blocked are redistributed on the next heartbeat
+func (a *App) ClearMaxPrefix(vrf, neighbor string) ([]dto.MaxPrefixBlock, error) {
+	return a.prefixLimits.ClearMaxPrefix(vrf, neighbor)
+}
+
+// Redistributes the received routes blocked by the cleared max-prefix limits. Runs on the event loop
+func (a *App) maintainPrefixLimits() {
+	if a.holdDown.Active() { // the buffered paths are handled once the hold-down is over
+		return
+	}
+	cleared := a.prefixLimits.ClearedLimits()
+	if len(cleared) == 0 {
+		return
+	}
+	vrfs := map[string]bool{}
+	neighbors := map[dto.MaxPrefixBlock]bool{}
+	for _, limit := range cleared {
+		if limit.Neighbor == "" {
+			vrfs[limit.Vrf] = true
+		} else {
+			neighbors[limit] = true
+		}
+	}
+	a.redistributeUntracked("the cleared max-prefix limits", func(path *api.Path, audit dto.PathAudit) bool {
+		return vrfs[audit.Vrf] || neighbors[dto.MaxPrefixBlock{Vrf: audit.Vrf, Neighbor: path.GetNeighborIp()}]
+	})
+}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApp_ClearMaxPrefix(t *testing.T) {
+	first := createVPNPathWithNexthop(100, "10.0.0.1")
+	second := createVPNPathWithNexthop(100, "10.0.0.2")
+	first.Best, second.Best = true, true
+	server := &ribServer{rib: map[api.Family_Afi][]*api.Path{api.Family_AFI_IP: {first, second}}}
+	evpnUuid := uuid.New()
+	server.On("AddPath", mock.Anything, mock.Anything).Return(&api.AddPathResponse{Uuid: evpnUuid[:]}, nil)
+	vrfConfig := []oc.VrfConfig{{Name: "vrf_10", Rd: "65000:100", Id: 1000, BothRtList: []string{"65000:100"}}}
+	maxPrefix := &dto.MaxPrefix{Neighbor: 1, Action: dto.MaxPrefixStop}
+	app := NewApp(vrfConfig, server, 100, logrus.New(),
+		WithVrfExtensions(map[string]dto.VrfExtensions{"vrf_10": {MaxPrefix: maxPrefix}}))
+	require.NoError(t, app.vpnController.HandleUpdate(context.Background(), first))
+	require.NoError(t, app.vpnController.HandleUpdate(context.Background(), second))
+	require.Len(t, app.ListRedistributed(), 1)
+
+	// raised limit takes effect once the exceeded one is cleared
+	app.vpnController.ReloadConfig(dto.VrfDiff{Extensions: map[string]dto.VrfExtensions{
+		"vrf_10": {MaxPrefix: &dto.MaxPrefix{Neighbor: 2, Action: dto.MaxPrefixStop}},
+	}})
+	app.maintainPrefixLimits()
+	require.Len(t, app.ListRedistributed(), 1)
+	cleared, err := app.ClearMaxPrefix("vrf_10", "")
+	require.NoError(t, err)
+	assert.Equal(t, []dto.MaxPrefixBlock{{Vrf: "vrf_10", Neighbor: "192.168.1.1"}}, cleared)
+	app.maintainPrefixLimits()
+
+	assert.Len(t, app.ListRedistributed(), 2)
+	_, err = app.ClearMaxPrefix("vrf_20", "")
+	assert.ErrorIs(t, err, dto.ErrVrfNotFound)
+}
@@ -1,6 +1,11 @@
 package app
 
-import "github.com/amyasnikov/berg/internal/dto"
+import (
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	api "github.com/osrg/gobgp/v3/api"
+)
 
 type msgCode int
 
@@ -13,3 +18,9 @@ type message struct {
 	Code    msgCode
 	VrfDiff *dto.VrfDiff
 }
+
+// GoBGP event along with the time it was received, so that queuing shows up in traces
+type watchEvent struct {
+	resp       *api.WatchEventResponse
+	receivedAt time.Time
+}
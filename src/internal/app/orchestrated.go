@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+// How long listing the VPNv4 RIB for the paths to redistribute again may take
+const ribListTimeout = 10 * time.Second
+
+// Adds or renews the lease of the prefix in the VRF, the route is withdrawn unless renewed within ttl
+func (a *App) LeaseRoute(vrf, prefix, gateway string, ttl time.Duration) error {
+	return a.orchestrated.Lease(vrf, prefix, gateway, ttl)
+}
+
+// Ends the lease of the prefix in the VRF before it expires.
+// The received routes it took precedence over are redistributed on the next heartbeat
+func (a *App) ReleaseRoute(vrf, prefix string) error {
+	return a.orchestrated.Release(vrf, prefix)
+}
+
+// Leases of the VRF sorted by VRF and prefix, empty vrf means all the VRFs
+func (a *App) OrchestratedRoutes(vrf string) []dto.OrchestratedRoute {
+	return a.orchestrated.List(vrf)
+}
+
+// Withdraws the expired leases, then redistributes the received routes the ended leases took precedence over.
+// Runs on the event loop
+func (a *App) maintainLeases() {
+	ended, err := a.orchestrated.Maintain()
+	if err != nil {
+		a.logger.Errorf("error while maintaining orchestrated routes: %v", err)
+	}
+	if len(ended) == 0 || a.holdDown.Active() { // the buffered paths are handled once the hold-down is over
+		return
+	}
+	released := make(map[dto.OrchestratedRoute]bool, len(ended))
+	for _, route := range ended {
+		released[route] = true
+	}
+	a.redistributeUntracked("the ended leases", func(path *api.Path, audit dto.PathAudit) bool {
+		_, prefix, ok := nlriPrefix(path.GetNlri())
+		return ok && released[dto.OrchestratedRoute{Vrf: audit.Vrf, Prefix: prefix}]
+	})
+}
+
+// Redistributes the best received VPNv4 paths which match and should be redistributed but are not,
+// e.g. the ones a lease took precedence over. what names them in the log. Runs on the event loop
+func (a *App) redistributeUntracked(what string, match func(path *api.Path, audit dto.PathAudit) bool) {
+	a.workers.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), ribListTimeout)
+	defer cancel()
+	family := ribFamilies[0]
+	paths := []*api.Path{}
+	req := &api.ListPathRequest{TableType: api.TableType_GLOBAL, Family: family}
+	err := a.bgpServer.ListPath(ctx, req, func(d *api.Destination) {
+		for _, path := range d.GetPaths() {
+			if isLocal(path) || !path.Best {
+				continue
+			}
+			if path.Family == nil {
+				path.Family = family
+			}
+			audit := a.vpnController.Audit(path)
+			if audit.Expected && !audit.Tracked && match(path, audit) {
+				paths = append(paths, path)
+			}
+		}
+	})
+	if err != nil {
+		a.logger.Errorf("cannot list paths of %s: %v", what, err)
+		return
+	}
+	for _, path := range paths {
+		if err := a.vpnController.HandleUpdate(ctx, path); err != nil {
+			a.logger.Error(err.Error())
+		}
+	}
+}
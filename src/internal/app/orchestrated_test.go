@@ -0,0 +1,44 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ctrl "github.com/amyasnikov/berg/internal/controller"
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApp_MaintainLeases(t *testing.T) {
+	received := createVPNPathWithNexthop(100, "10.0.0.1")
+	received.Best = true
+	server := &ribServer{rib: map[api.Family_Afi][]*api.Path{api.Family_AFI_IP: {received}}}
+	evpnUuid := uuid.New()
+	server.On("AddPath", mock.Anything, mock.Anything).Return(&api.AddPathResponse{Uuid: evpnUuid[:]}, nil)
+	server.On("DeletePath", mock.Anything, mock.Anything).Return(nil)
+	vrfConfig := []oc.VrfConfig{{Name: "vrf_10", Rd: "65000:100", Id: 1000, BothRtList: []string{"65000:100"}}}
+	extensions := map[string]dto.VrfExtensions{"vrf_10": {OrchestratedPrecedence: dto.PrecedenceOrchestrator}}
+	app := NewApp(vrfConfig, server, 100, logrus.New(), WithVrfExtensions(extensions))
+	require.NoError(t, app.vpnController.HandleUpdate(context.Background(), received))
+
+	require.NoError(t, app.LeaseRoute("vrf_10", "10.0.0.1/32", "192.168.0.7", time.Minute))
+	routes := app.ListRedistributed()
+	require.Len(t, routes, 1)
+	assert.Equal(t, ctrl.OrchestratorSource, routes[0].Source)
+
+	require.NoError(t, app.ReleaseRoute("vrf_10", "10.0.0.1/32"))
+	assert.Empty(t, app.ListRedistributed())
+	app.maintainLeases()
+
+	routes = app.ListRedistributed()
+	require.Len(t, routes, 1)
+	assert.Equal(t, "65000:100:10.0.0.1/32", routes[0].Source)
+	assert.Empty(t, app.OrchestratedRoutes(""))
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/hashicorp/go-multierror"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/sirupsen/logrus"
+)
+
+// Single fix of a disagreement with the GoBGP RIB. apply reports whether anything was changed
+type correction struct {
+	kind  string
+	event events.Event
+	apply func() (bool, error)
+}
+
+// Fixes the disagreements with the GoBGP RIB, e.g. left by a failed AddPath or DeletePath.
+// Runs on the event loop once the workers are idle, so no path is handled meanwhile
+func (a *App) reconcile(ctx context.Context) {
+	start := time.Now()
+	a.workers.Wait()
+	diff, err := a.diffRib(ctx)
+	if err != nil {
+		metrics.ReconcileRuns.WithLabelValues("failure").Inc()
+		a.logger.Errorf("cannot reconcile: %v", err)
+		return
+	}
+	corrections := a.corrections(ctx, diff)
+	var merr error
+	applied := 0
+	for i, c := range corrections {
+		if !a.reconcileLimiter.Allow() {
+			metrics.ReconcileDeferred.Add(float64(len(corrections) - i))
+			break
+		}
+		changed, err := c.apply()
+		if err != nil {
+			merr = multierror.Append(merr, err)
+		}
+		if changed {
+			applied++
+			metrics.ReconcileCorrections.WithLabelValues(c.event.Direction, c.kind).Inc()
+			c.event.Time = time.Now()
+			a.events.Publish(c.event)
+		}
+	}
+	outcome := "success"
+	if merr != nil {
+		outcome = "failure"
+		a.logger.Errorf("error while reconciling: %v", merr)
+	}
+	metrics.ReconcileRuns.WithLabelValues(outcome).Inc()
+	logger := a.logger.WithFields(logrus.Fields{
+		"found":    len(corrections),
+		"applied":  applied,
+		"duration": time.Since(start).String(),
+	})
+	if len(corrections) > 0 {
+		logger.Warn("reconciliation fixed disagreements with the RIB")
+	} else {
+		logger.Debug("reconciliation found no disagreements with the RIB")
+	}
+}
+
+// Withdrawals go first, so the re-injected routes do not replace the paths about to be deleted
+func (a *App) corrections(ctx context.Context, diff ribDiff) []correction {
+	result := []correction{}
+	for _, route := range diff.stale {
+		controller := a.vpnController
+		if route.Direction == metrics.DirectionToVpn {
+			controller = a.evpnController
+		}
+		result = append(result, correction{
+			kind: metrics.CorrectionStale,
+			event: events.Event{
+				Type:      events.Corrected,
+				Vrf:       route.Vrf,
+				Direction: route.Direction,
+				Prefix:    route.Prefix,
+				Source:    route.Source,
+				Generated: route.Generated,
+				Reason:    events.ReasonSourceLost,
+			},
+			apply: func() (bool, error) { return controller.WithdrawSource(route.Source) },
+		})
+	}
+	for _, orphan := range diff.orphans {
+		_, prefix, _ := nlriPrefix(orphan.path.GetNlri())
+		result = append(result, correction{
+			kind: metrics.CorrectionOrphan,
+			event: events.Event{
+				Type:      events.Corrected,
+				Direction: injectedDirection(orphan.path.Family),
+				Prefix:    prefix,
+				Generated: orphan.nlri,
+				Reason:    events.ReasonUntrackedPath,
+			},
+			apply: func() (bool, error) {
+				err := a.bgpServer.DeletePath(ctx, &api.DeletePathRequest{
+					TableType: api.TableType_GLOBAL,
+					Family:    orphan.path.Family,
+					Path:      &api.Path{Family: orphan.path.Family, Nlri: orphan.path.Nlri, Pattrs: orphan.path.Pattrs},
+				})
+				return err == nil, err
+			},
+		})
+	}
+	for _, missing := range diff.missing {
+		result = append(result, a.updateCorrection(ctx, missing, metrics.CorrectionMissing, events.ReasonNotRedistributed))
+	}
+	for _, lost := range diff.lost {
+		result = append(result, a.updateCorrection(ctx, lost, metrics.CorrectionLost, events.ReasonInjectedPathLost))
+	}
+	return result
+}
+
+// Handles the received path once again
+func (a *App) updateCorrection(ctx context.Context, audited auditedPath, kind string, reason string) correction {
+	_, prefix, _ := nlriPrefix(audited.path.GetNlri())
+	return correction{
+		kind: kind,
+		event: events.Event{
+			Type:      events.Corrected,
+			Vrf:       audited.audit.Vrf,
+			Direction: a.direction(audited.controller),
+			Prefix:    prefix,
+			Source:    audited.audit.Source,
+			Neighbor:  audited.path.GetNeighborIp(),
+			Generated: audited.audit.Generated,
+			Reason:    reason,
+		},
+		apply: func() (bool, error) {
+			err := audited.controller.HandleUpdate(ctx, audited.path)
+			return err == nil, err
+		},
+	}
+}
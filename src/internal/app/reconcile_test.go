@@ -0,0 +1,142 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	ctrl "github.com/amyasnikov/berg/internal/controller"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+type recordingPublisher struct {
+	lock   sync.Mutex
+	events []events.Event
+}
+
+func (p *recordingPublisher) Publish(event events.Event) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.events = append(p.events, event)
+}
+
+// Corrected events by reason
+func (p *recordingPublisher) corrections() map[string]events.Event {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	result := map[string]events.Event{}
+	for _, event := range p.events {
+		if event.Type == events.Corrected {
+			result[event.Reason] = event
+		}
+	}
+	return result
+}
+
+func testVpnPath(rd uint32, prefix string, neighbor string) *api.Path {
+	path := createTestVPNPath()
+	rdAny, _ := anypb.New(&api.RouteDistinguisherTwoOctetASN{Admin: 65000, Assigned: rd})
+	path.Nlri, _ = anypb.New(&api.LabeledVPNIPAddressPrefix{
+		Rd: rdAny, Prefix: prefix, PrefixLen: 24, Labels: []uint32{1000},
+	})
+	nexthop, _ := anypb.New(&api.MpReachNLRIAttribute{NextHops: []string{"192.168.1.1"}})
+	path.Pattrs = []*anypb.Any{nexthop}
+	path.NeighborIp = neighbor
+	path.Best = true
+	return path
+}
+
+func testEvpnPath(prefix string, neighbor string) *api.Path {
+	path := createTestEVPNPath()
+	rd, _ := anypb.New(&api.RouteDistinguisherTwoOctetASN{Admin: 65000, Assigned: 100})
+	path.Nlri, _ = anypb.New(&api.EVPNIPPrefixRoute{
+		Rd: rd, Esi: &api.EthernetSegmentIdentifier{}, IpPrefix: prefix, IpPrefixLen: 24,
+		GwAddress: "192.168.1.1", Label: 1000,
+	})
+	rt, _ := anypb.New(&api.TwoOctetAsSpecificExtended{SubType: 2, Asn: 65000, LocalAdmin: 100})
+	extComms, _ := anypb.New(&api.ExtendedCommunitiesAttribute{Communities: []*anypb.Any{rt}})
+	path.Pattrs = []*anypb.Any{extComms}
+	path.NeighborIp = neighbor
+	path.Best = true
+	return path
+}
+
+// RIB with a path of every kind of disagreement: stale, orphan, missing and lost
+func newReconcileApp(t *testing.T, correctionsPerSecond float64) (*App, *ribServer, *recordingPublisher, uuid.UUID) {
+	missing := testVpnPath(100, "10.0.0.0", "192.168.1.1")
+	lost := testVpnPath(100, "10.1.0.0", "192.168.1.1")
+	orphan := testEvpnPath("10.9.0.0", "")
+	vrfRoute := testVpnPath(100, "10.5.0.0", "") // originated by the GoBGP VRF
+	server := &ribServer{rib: map[api.Family_Afi][]*api.Path{
+		api.Family_AFI_IP:    {missing, lost, vrfRoute},
+		api.Family_AFI_L2VPN: {orphan},
+	}}
+	staleUuid := uuid.New()
+	server.On("AddPath", mock.Anything, mock.MatchedBy(func(req *api.AddPathRequest) bool {
+		return req.Path.Family.Afi == api.Family_AFI_IP
+	})).Return(&api.AddPathResponse{Uuid: staleUuid[:]}, nil)
+	evpnUuid := uuid.New()
+	server.On("AddPath", mock.Anything, mock.Anything).Return(&api.AddPathResponse{Uuid: evpnUuid[:]}, nil)
+	server.On("DeletePath", mock.Anything, mock.Anything).Return(nil)
+	publisher := &recordingPublisher{}
+	vrfConfig := []oc.VrfConfig{{Name: "vrf_10", Rd: "65000:100", Id: 1000, ImportRtList: []string{"65000:100"}}}
+	app := NewApp(vrfConfig, server, 100, logrus.New(),
+		WithReconciliation(time.Minute, correctionsPerSecond), WithEventPublisher(publisher))
+	require.NoError(t, app.vpnController.HandleUpdate(context.Background(), lost))
+	// the source of the redistributed EVPN route is gone from the RIB
+	require.NoError(t, app.evpnController.HandleUpdate(context.Background(), testEvpnPath("10.2.0.0", "10.0.0.1")))
+	return app, server, publisher, staleUuid
+}
+
+func TestApp_Reconcile(t *testing.T) {
+	app, server, publisher, staleUuid := newReconcileApp(t, 0)
+	app.workers.Start()
+	defer app.workers.Stop()
+	missingBefore := testutil.ToFloat64(
+		metrics.ReconcileCorrections.WithLabelValues(metrics.DirectionToEvpn, metrics.CorrectionMissing))
+
+	app.reconcile(context.Background())
+
+	corrections := publisher.corrections()
+	assert.Len(t, corrections, 4)
+	assert.Equal(t, "65000:100:10.0.0.0/24", corrections[events.ReasonNotRedistributed].Source)
+	assert.Equal(t, "65000:100:10.1.0.0/24", corrections[events.ReasonInjectedPathLost].Source)
+	assert.Equal(t, "5:65000:100:10.2.0.0/24 Gw:192.168.1.1 Vni:1000", corrections[events.ReasonSourceLost].Source)
+	assert.Equal(t, "5:65000:100:10.9.0.0/24 Gw:192.168.1.1 Vni:1000", corrections[events.ReasonUntrackedPath].Generated)
+	assert.Equal(t, metrics.DirectionToEvpn, corrections[events.ReasonUntrackedPath].Direction)
+	assert.Equal(t, missingBefore+1, testutil.ToFloat64(
+		metrics.ReconcileCorrections.WithLabelValues(metrics.DirectionToEvpn, metrics.CorrectionMissing)))
+	server.AssertCalled(t, "DeletePath", mock.Anything, mock.MatchedBy(func(req *api.DeletePathRequest) bool {
+		return len(req.Uuid) > 0 && uuid.UUID(req.Uuid) == staleUuid
+	}))
+	server.AssertCalled(t, "DeletePath", mock.Anything, mock.MatchedBy(func(req *api.DeletePathRequest) bool {
+		nlri, _ := ctrl.FormatNlri(req.Path.GetNlri())
+		return len(req.Uuid) == 0 && nlri == "5:65000:100:10.9.0.0/24 Gw:192.168.1.1 Vni:1000"
+	}))
+	assert.Empty(t, app.evpnController.ListRedistributed())
+	assert.Len(t, app.vpnController.ListRedistributed(), 2)
+}
+
+func TestApp_Reconcile_RateLimited(t *testing.T) {
+	app, _, publisher, _ := newReconcileApp(t, 1)
+	app.workers.Start()
+	defer app.workers.Stop()
+	deferredBefore := testutil.ToFloat64(metrics.ReconcileDeferred)
+
+	app.reconcile(context.Background())
+
+	assert.Len(t, publisher.corrections(), 1)
+	assert.Contains(t, publisher.corrections(), events.ReasonSourceLost)
+	assert.Equal(t, deferredBefore+3, testutil.ToFloat64(metrics.ReconcileDeferred))
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"sync"
+
+	"github.com/amyasnikov/berg/internal/tracing"
+	api "github.com/osrg/gobgp/v3/api"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type pathTask struct {
+	controller controller
+	path       *api.Path
+	ctx        context.Context
+	queueSpan  trace.Span
+}
+
+// Dispatches paths to a fixed set of workers.
+// Paths of the same (VRF, prefix) always land on the same worker, so their order is preserved
+type workerPool struct {
+	queues  []chan pathTask
+	pending sync.WaitGroup
+	handle  func(context.Context, controller, *api.Path)
+}
+
+func newWorkerPool(size int, queueSize int, handle func(context.Context, controller, *api.Path)) *workerPool {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	queues := make([]chan pathTask, size)
+	for i := range queues {
+		queues[i] = make(chan pathTask, queueSize)
+	}
+	return &workerPool{
+		queues: queues,
+		handle: handle,
+	}
+}
+
+func (p *workerPool) Start() {
+	for _, queue := range p.queues {
+		go p.work(queue)
+	}
+}
+
+func (p *workerPool) work(queue <-chan pathTask) {
+	for task := range queue {
+		task.queueSpan.End()
+		p.handle(task.ctx, task.controller, task.path)
+		p.pending.Done()
+	}
+}
+
+func (p *workerPool) Submit(ctx context.Context, controller controller, path *api.Path) {
+	p.pending.Add(1)
+	idx := shardKey(path) % uint32(len(p.queues))
+	_, queueSpan := tracing.Tracer().Start(ctx, "workerQueue")
+	p.queues[idx] <- pathTask{controller: controller, path: path, ctx: ctx, queueSpan: queueSpan}
+}
+
+// Blocks until every submitted path is handled
+func (p *workerPool) Wait() {
+	p.pending.Wait()
+}
+
+func (p *workerPool) Stop() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+}
+
+// Hashes (RD, prefix) of the path NLRI. Unknown NLRI types are hashed as a whole
+func shardKey(path *api.Path) uint32 {
+	h := fnv.New32a()
+	nlri := path.GetNlri()
+	var vpn api.LabeledVPNIPAddressPrefix
+	var evpn api.EVPNIPPrefixRoute
+	switch {
+	case nlri.MessageIs(&vpn) && nlri.UnmarshalTo(&vpn) == nil:
+		h.Write(vpn.GetRd().GetValue())
+		h.Write([]byte(vpn.Prefix))
+		h.Write(binary.BigEndian.AppendUint32(nil, vpn.PrefixLen))
+	case nlri.MessageIs(&evpn) && nlri.UnmarshalTo(&evpn) == nil:
+		h.Write(evpn.GetRd().GetValue())
+		h.Write([]byte(evpn.IpPrefix))
+		h.Write(binary.BigEndian.AppendUint32(nil, evpn.IpPrefixLen))
+	default:
+		h.Write(nlri.GetValue())
+	}
+	return h.Sum32()
+}
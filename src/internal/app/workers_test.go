@@ -0,0 +1,221 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/amyasnikov/berg/internal/tracing"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Helper function to create a VPN path with the given RD and prefix, carrying a nexthop
+func createVPNPathWithNexthop(rdAssigned uint32, prefix string) *api.Path {
+	rd, _ := anypb.New(&api.RouteDistinguisherTwoOctetASN{Admin: 65000, Assigned: rdAssigned})
+	nlri, _ := anypb.New(&api.LabeledVPNIPAddressPrefix{
+		Labels:    []uint32{1000},
+		Prefix:    prefix,
+		PrefixLen: 32,
+		Rd:        rd,
+	})
+	nh, _ := anypb.New(&api.MpReachNLRIAttribute{NextHops: []string{"192.168.1.1"}})
+	return &api.Path{
+		Family:     &api.Family{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_MPLS_VPN},
+		Nlri:       nlri,
+		Pattrs:     []*anypb.Any{nh},
+		NeighborIp: "192.168.1.1",
+	}
+}
+
+func TestShardKey_SameRouteSameShard(t *testing.T) {
+	first := createVPNPathWithNexthop(100, "10.0.0.1")
+	second := createVPNPathWithNexthop(100, "10.0.0.1")
+	second.IsWithdraw = true
+	second.Pattrs = nil
+
+	assert.Equal(t, shardKey(first), shardKey(second))
+}
+
+func TestShardKey_DifferentVrfOrPrefix(t *testing.T) {
+	base := shardKey(createVPNPathWithNexthop(100, "10.0.0.1"))
+
+	assert.NotEqual(t, base, shardKey(createVPNPathWithNexthop(200, "10.0.0.1")))
+	assert.NotEqual(t, base, shardKey(createVPNPathWithNexthop(100, "10.0.0.2")))
+}
+
+func TestShardKey_Evpn(t *testing.T) {
+	first := createTestEVPNPath()
+	second := createTestEVPNPath()
+	second.IsWithdraw = true
+
+	assert.Equal(t, shardKey(first), shardKey(second))
+}
+
+func TestWorkerPool_PreservesOrderPerRoute(t *testing.T) {
+	var lock sync.Mutex
+	handled := map[string][]bool{}
+	pool := newWorkerPool(4, 10, func(ctx context.Context, c controller, path *api.Path) {
+		var route api.LabeledVPNIPAddressPrefix
+		path.GetNlri().UnmarshalTo(&route)
+		lock.Lock()
+		handled[route.Prefix] = append(handled[route.Prefix], path.IsWithdraw)
+		lock.Unlock()
+	})
+	pool.Start()
+	defer pool.Stop()
+
+	for i := 0; i < 100; i++ {
+		prefix := fmt.Sprintf("10.0.0.%d", i%10)
+		path := createVPNPathWithNexthop(100, prefix)
+		path.IsWithdraw = (i/10)%2 == 1
+		pool.Submit(context.Background(), &mockController{}, path)
+	}
+	pool.Wait()
+
+	assert.Len(t, handled, 10)
+	for prefix, withdraws := range handled {
+		assert.Len(t, withdraws, 10, prefix)
+		for i, isWithdraw := range withdraws {
+			assert.Equal(t, i%2 == 1, isWithdraw, prefix)
+		}
+	}
+}
+
+func TestApp_ReloadWaitsForPendingPaths(t *testing.T) {
+	mockServer := &mockBgpServer{}
+	vpnController := &mockController{}
+	evpnController := &mockController{}
+
+	app := NewApp([]oc.VrfConfig{}, mockServer, 100, logrus.New(), WithWorkers(4))
+	app.vpnController = vpnController
+	app.evpnController = evpnController
+
+	path := createTestVPNPath()
+	started := make(chan struct{})
+	var handled atomic.Bool
+	vpnController.On("HandleUpdate", mock.Anything, path).Run(func(mock.Arguments) {
+		close(started)
+		time.Sleep(20 * time.Millisecond)
+		handled.Store(true)
+	}).Return(nil)
+	reloaded := make(chan struct{})
+	vpnController.On("ReloadConfig", mock.Anything).Run(func(mock.Arguments) {
+		assert.True(t, handled.Load(), "config reloaded before pending path was handled")
+		close(reloaded)
+	}).Return(nil)
+	evpnController.On("ReloadConfig", mock.Anything).Return(nil)
+
+	app.workers.Start()
+	go app.receiver()
+	defer close(app.controlChan)
+	app.sender(&api.WatchEventResponse{
+		Event: &api.WatchEventResponse_Table{Table: &api.WatchEventResponse_TableEvent{Paths: []*api.Path{path}}},
+	})
+	<-started
+	app.ReloadConfig(dto.VrfDiff{})
+
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("Config was not reloaded")
+	}
+	vpnController.AssertExpectations(t)
+}
+
+func BenchmarkApp_HandlePaths(b *testing.B) {
+	const vrfs = 16
+	const routesPerVrf = 64
+	vrfConfig := make([]oc.VrfConfig, 0, vrfs)
+	paths := make([]*api.Path, 0, vrfs*routesPerVrf)
+	for v := uint32(1); v <= vrfs; v++ {
+		vrfConfig = append(vrfConfig, oc.VrfConfig{
+			Name:       fmt.Sprintf("vrf_%d", v),
+			Id:         v,
+			Rd:         fmt.Sprintf("65000:%d", v),
+			BothRtList: []string{fmt.Sprintf("65000:%d", v)},
+		})
+		for r := 0; r < routesPerVrf; r++ {
+			paths = append(paths, createVPNPathWithNexthop(v, fmt.Sprintf("10.%d.%d.%d", v, r/256, r%256)))
+		}
+	}
+	for _, workers := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			mockServer := &mockBgpServer{}
+			routeUuid := uuid.New()
+			// Simulates the round trip of a single AddPath call
+			mockServer.On("AddPath", mock.Anything, mock.Anything).
+				After(50*time.Microsecond).
+				Return(&api.AddPathResponse{Uuid: routeUuid[:]}, nil)
+			mockServer.On("DeletePath", mock.Anything, mock.Anything).Return(nil)
+			logger := logrus.New()
+			logger.SetLevel(logrus.FatalLevel)
+			app := NewApp(vrfConfig, mockServer, uint64(len(paths)), logger, WithWorkers(workers))
+			app.workers.Start()
+			defer app.workers.Stop()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, path := range paths {
+					app.workers.Submit(context.Background(), app.vpnController, path)
+				}
+				app.workers.Wait()
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(b.N*len(paths))/b.Elapsed().Seconds(), "paths/s")
+		})
+	}
+}
+
+func TestApp_TracesPath(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(prevProvider)
+	app := NewApp([]oc.VrfConfig{}, &mockBgpServer{}, 100, logrus.New())
+	vpnController := &mockController{}
+	app.vpnController = vpnController
+	path := createVPNPathWithNexthop(100, "10.0.0.1")
+	handled := make(chan struct{})
+	vpnController.On("HandleUpdate", mock.Anything, path).Run(func(args mock.Arguments) {
+		assert.True(t, trace.SpanFromContext(args.Get(0).(context.Context)).SpanContext().IsValid())
+		close(handled)
+	}).Return(errors.New("no nexthop"))
+
+	app.workers.Start()
+	go app.receiver()
+	defer close(app.controlChan)
+	app.sender(&api.WatchEventResponse{
+		Event: &api.WatchEventResponse_Table{Table: &api.WatchEventResponse_TableEvent{Paths: []*api.Path{path}}},
+	})
+	<-handled
+	app.workers.Wait()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	assert.Len(t, spans, 3)
+	root := spans["path"]
+	assert.Equal(t, codes.Error, root.Status().Code)
+	assert.Contains(t, root.Attributes(), tracing.AttrDirection.String(metrics.DirectionToEvpn))
+	assert.Contains(t, root.Attributes(), tracing.AttrNeighbor.String("192.168.1.1"))
+	for _, name := range []string{"eventChan", "workerQueue"} {
+		assert.Equal(t, root.SpanContext().SpanID(), spans[name].Parent().SpanID(), name)
+	}
+}
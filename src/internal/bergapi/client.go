@@ -0,0 +1,125 @@
+package bergapi
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req any, resp any) error {
+	return c.conn.Invoke(ctx, method, req, resp, grpc.CallContentSubtype(codecName))
+}
+
+func (c *Client) ListRedistributed(
+	ctx context.Context, req *ListRedistributedRequest,
+) (*ListRedistributedResponse, error) {
+	resp := &ListRedistributedResponse{}
+	if err := c.invoke(ctx, methodListRedistributed, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetVrfState(ctx context.Context, req *GetVrfStateRequest) (*GetVrfStateResponse, error) {
+	resp := &GetVrfStateResponse{}
+	if err := c.invoke(ctx, methodGetVrfState, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) Status(ctx context.Context) (*StatusResponse, error) {
+	resp := &StatusResponse{}
+	if err := c.invoke(ctx, methodStatus, &StatusRequest{}, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) Reload(ctx context.Context) error {
+	return c.invoke(ctx, methodReload, &ReloadRequest{}, &ReloadResponse{})
+}
+
+func (c *Client) Validate(ctx context.Context, req *ValidateRequest) (*ValidateResponse, error) {
+	resp := &ValidateResponse{}
+	if err := c.invoke(ctx, methodValidate, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) Explain(ctx context.Context, req *ExplainRequest) (*ExplainResponse, error) {
+	resp := &ExplainResponse{}
+	if err := c.invoke(ctx, methodExplain, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetLogLevels(ctx context.Context) (*LogLevelsResponse, error) {
+	resp := &LogLevelsResponse{}
+	if err := c.invoke(ctx, methodGetLogLevels, &GetLogLevelsRequest{}, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) SetLogLevel(ctx context.Context, req *SetLogLevelRequest) (*LogLevelsResponse, error) {
+	resp := &LogLevelsResponse{}
+	if err := c.invoke(ctx, methodSetLogLevel, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) AddVrf(ctx context.Context, req *AddVrfRequest) error {
+	return c.invoke(ctx, methodAddVrf, req, &AddVrfResponse{})
+}
+
+func (c *Client) UpdateVrf(ctx context.Context, req *UpdateVrfRequest) error {
+	return c.invoke(ctx, methodUpdateVrf, req, &UpdateVrfResponse{})
+}
+
+func (c *Client) DeleteVrf(ctx context.Context, req *DeleteVrfRequest) error {
+	return c.invoke(ctx, methodDeleteVrf, req, &DeleteVrfResponse{})
+}
+
+func (c *Client) LeaseRoute(ctx context.Context, req *LeaseRouteRequest) error {
+	return c.invoke(ctx, methodLeaseRoute, req, &LeaseRouteResponse{})
+}
+
+func (c *Client) ReleaseRoute(ctx context.Context, req *ReleaseRouteRequest) error {
+	return c.invoke(ctx, methodReleaseRoute, req, &ReleaseRouteResponse{})
+}
+
+func (c *Client) ListLeases(ctx context.Context, req *ListLeasesRequest) (*ListLeasesResponse, error) {
+	resp := &ListLeasesResponse{}
+	if err := c.invoke(ctx, methodListLeases, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) ClearMaxPrefix(ctx context.Context, req *ClearMaxPrefixRequest) (*ClearMaxPrefixResponse, error) {
+	resp := &ClearMaxPrefixResponse{}
+	if err := c.invoke(ctx, methodClearMaxPrefix, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetAllowlist(ctx context.Context, req *GetAllowlistRequest) (*GetAllowlistResponse, error) {
+	resp := &GetAllowlistResponse{}
+	if err := c.invoke(ctx, methodGetAllowlist, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,506 @@
+package bergapi
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/utils"
+	"github.com/hashicorp/go-multierror"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Backend interface {
+	ListRedistributed() []dto.RedistributedRoute
+	Vrfs() []dto.Vrf
+	Status() dto.Status
+	Reload() error
+	Validate(config []byte) error // empty config means the running config file
+	Explain(ctx context.Context, vrf, prefix string) (dto.Explanation, error)
+	LogLevels() map[string]string
+	SetLogLevel(subsystem, level string) error // empty subsystem means all of them
+	AddVrf(vrf dto.Vrf, persist bool) error
+	UpdateVrf(vrf dto.Vrf, persist bool) error
+	DeleteVrf(name string, persist bool) error
+	LeaseRoute(vrf, prefix, gateway string, ttl time.Duration) error
+	ReleaseRoute(vrf, prefix string) error
+	OrchestratedRoutes(vrf string) []dto.OrchestratedRoute             // empty vrf means all the VRFs
+	ClearMaxPrefix(vrf, neighbor string) ([]dto.MaxPrefixBlock, error) // empty neighbor means all the limits
+	Allowlist() dto.AllowlistState
+}
+
+// Serves BergService on the GoBGP gRPC server, which has no way to register extra services.
+// Calls to unknown services land here, so the server must be created with ServerOption
+type Server struct {
+	backend atomic.Pointer[Backend]
+}
+
+func NewServer() *Server {
+	return &Server{}
+}
+
+// The backend is set once the application is built, calls made before that fail with Unavailable
+func (s *Server) SetBackend(backend Backend) {
+	s.backend.Store(&backend)
+}
+
+func (s *Server) ServerOption() grpc.ServerOption {
+	return grpc.UnknownServiceHandler(s.handle)
+}
+
+func (s *Server) handle(_ any, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	backend := s.backend.Load()
+	if backend == nil {
+		return status.Error(codes.Unavailable, "berg is starting")
+	}
+	switch method {
+	case methodListRedistributed:
+		var req ListRedistributedRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		resp, err := listRedistributed(*backend, req)
+		if err != nil {
+			return err
+		}
+		return stream.SendMsg(resp)
+	case methodGetVrfState:
+		var req GetVrfStateRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		resp, err := getVrfState(*backend, req)
+		if err != nil {
+			return err
+		}
+		return stream.SendMsg(resp)
+	case methodStatus:
+		var req StatusRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		return stream.SendMsg(getStatus(*backend))
+	case methodReload:
+		var req ReloadRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		if err := (*backend).Reload(); err != nil {
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return stream.SendMsg(&ReloadResponse{})
+	case methodValidate:
+		var req ValidateRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		return stream.SendMsg(validate(*backend, req))
+	case methodExplain:
+		var req ExplainRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		resp, err := explain(stream.Context(), *backend, req)
+		if err != nil {
+			return err
+		}
+		return stream.SendMsg(resp)
+	case methodGetLogLevels:
+		var req GetLogLevelsRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		return stream.SendMsg(&LogLevelsResponse{Levels: (*backend).LogLevels()})
+	case methodSetLogLevel:
+		var req SetLogLevelRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		if err := (*backend).SetLogLevel(req.Subsystem, req.Level); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		return stream.SendMsg(&LogLevelsResponse{Levels: (*backend).LogLevels()})
+	case methodAddVrf:
+		var req AddVrfRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		vrf, err := vrfFromConfig(req.Vrf)
+		if err == nil {
+			err = vrfStatus((*backend).AddVrf(vrf, req.Persist))
+		}
+		if err != nil {
+			return err
+		}
+		return stream.SendMsg(&AddVrfResponse{})
+	case methodUpdateVrf:
+		var req UpdateVrfRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		vrf, err := vrfFromConfig(req.Vrf)
+		if err == nil {
+			err = vrfStatus((*backend).UpdateVrf(vrf, req.Persist))
+		}
+		if err != nil {
+			return err
+		}
+		return stream.SendMsg(&UpdateVrfResponse{})
+	case methodDeleteVrf:
+		var req DeleteVrfRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		if req.Name == "" {
+			return status.Error(codes.InvalidArgument, "VRF name is required")
+		}
+		if err := vrfStatus((*backend).DeleteVrf(req.Name, req.Persist)); err != nil {
+			return err
+		}
+		return stream.SendMsg(&DeleteVrfResponse{})
+	case methodLeaseRoute:
+		var req LeaseRouteRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		ttl, err := time.ParseDuration(req.Ttl)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid TTL: %v", err)
+		}
+		if err := routeStatus((*backend).LeaseRoute(req.Vrf, req.Prefix, req.Gateway, ttl)); err != nil {
+			return err
+		}
+		return stream.SendMsg(&LeaseRouteResponse{})
+	case methodReleaseRoute:
+		var req ReleaseRouteRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		if err := routeStatus((*backend).ReleaseRoute(req.Vrf, req.Prefix)); err != nil {
+			return err
+		}
+		return stream.SendMsg(&ReleaseRouteResponse{})
+	case methodListLeases:
+		var req ListLeasesRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		return stream.SendMsg(listLeases(*backend, req))
+	case methodClearMaxPrefix:
+		var req ClearMaxPrefixRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		cleared, err := (*backend).ClearMaxPrefix(req.Vrf, req.Neighbor)
+		if err := routeStatus(err); err != nil {
+			return err
+		}
+		resp := &ClearMaxPrefixResponse{Cleared: []MaxPrefixBlock{}}
+		for _, block := range cleared {
+			resp.Cleared = append(resp.Cleared, MaxPrefixBlock(block))
+		}
+		return stream.SendMsg(resp)
+	case methodGetAllowlist:
+		var req GetAllowlistRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		return stream.SendMsg(getAllowlist(*backend, req))
+	}
+	return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+}
+
+func listRedistributed(backend Backend, req ListRedistributedRequest) (*ListRedistributedResponse, error) {
+	match, err := prefixMatcher(req.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	routes := []Route{}
+	for _, route := range backend.ListRedistributed() {
+		if req.Vrf != "" && route.Vrf != req.Vrf {
+			continue
+		}
+		if req.Direction != "" && route.Direction != req.Direction {
+			continue
+		}
+		if !match(route.Prefix) {
+			continue
+		}
+		routes = append(routes, newRoute(route))
+	}
+	sortRoutes(routes)
+	return &ListRedistributedResponse{Routes: routes}, nil
+}
+
+func getVrfState(backend Backend, req GetVrfStateRequest) (*GetVrfStateResponse, error) {
+	states := map[string]*VrfState{}
+	resp := &GetVrfStateResponse{Vrfs: []VrfState{}}
+	for _, vrf := range backend.Vrfs() {
+		if req.Vrf != "" && vrf.Name != req.Vrf {
+			continue
+		}
+		resp.Vrfs = append(resp.Vrfs, VrfState{
+			Name:               vrf.Name,
+			Rd:                 vrf.Rd,
+			Vni:                vrf.Vni,
+			ImportRouteTargets: vrf.ImportRouteTargets,
+			ExportRouteTargets: vrf.ExportRouteTargets,
+			Redistributed:      map[string]int{},
+			Routes:             []Route{},
+		})
+	}
+	if req.Vrf != "" && len(resp.Vrfs) == 0 {
+		return nil, status.Errorf(codes.NotFound, "VRF %s not found", req.Vrf)
+	}
+	for i := range resp.Vrfs {
+		states[resp.Vrfs[i].Name] = &resp.Vrfs[i]
+	}
+	for _, route := range backend.ListRedistributed() {
+		if state, ok := states[route.Vrf]; ok {
+			state.Redistributed[route.Direction]++
+			state.Routes = append(state.Routes, newRoute(route))
+		}
+	}
+	for _, state := range resp.Vrfs {
+		sortRoutes(state.Routes)
+	}
+	return resp, nil
+}
+
+func getStatus(backend Backend) *StatusResponse {
+	st := backend.Status()
+	resp := &StatusResponse{
+		StartedAt:       st.StartedAt,
+		Converged:       st.Converged,
+		Workers:         st.Workers,
+		EventQueueDepth: st.EventQueueDepth,
+		Redistributed:   st.Redistributed,
+	}
+	if st.LastReload != nil {
+		resp.LastReload = &ReloadStatus{
+			Time:    st.LastReload.Time,
+			Success: st.LastReload.Success,
+			Error:   st.LastReload.Error,
+		}
+	}
+	return resp
+}
+
+func validate(backend Backend, req ValidateRequest) *ValidateResponse {
+	err := backend.Validate([]byte(req.Config))
+	if err == nil {
+		return &ValidateResponse{Valid: true}
+	}
+	resp := &ValidateResponse{}
+	var merr *multierror.Error
+	if errors.As(err, &merr) {
+		for _, e := range merr.Errors {
+			resp.Errors = append(resp.Errors, e.Error())
+		}
+	} else {
+		resp.Errors = []string{err.Error()}
+	}
+	return resp
+}
+
+func explain(ctx context.Context, backend Backend, req ExplainRequest) (*ExplainResponse, error) {
+	if req.Vrf == "" || req.Prefix == "" {
+		return nil, status.Error(codes.InvalidArgument, "VRF and prefix are required")
+	}
+	if _, err := prefixMatcher(req.Prefix); err != nil {
+		return nil, err
+	}
+	explanation, err := backend.Explain(ctx, req.Vrf, req.Prefix)
+	if errors.Is(err, dto.ErrVrfNotFound) {
+		return nil, status.Errorf(codes.NotFound, "VRF %s not found", req.Vrf)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp := &ExplainResponse{Vrf: explanation.Vrf, Prefix: explanation.Prefix, Paths: []PathExplanation{}}
+	for _, path := range explanation.Paths {
+		steps := make([]ExplainStep, 0, len(path.Steps))
+		for _, step := range path.Steps {
+			steps = append(steps, ExplainStep{Name: step.Name, Passed: step.Passed, Detail: step.Detail})
+		}
+		resp.Paths = append(resp.Paths, PathExplanation{
+			Direction:     path.Direction,
+			SourceNlri:    path.Source,
+			Neighbor:      path.Neighbor,
+			Steps:         steps,
+			GeneratedNlri: path.Generated,
+			Redistributed: path.Redistributed,
+			Reason:        path.Reason,
+		})
+	}
+	return resp, nil
+}
+
+func vrfFromConfig(cfg VrfConfig) (dto.Vrf, error) {
+	if cfg.Name == "" {
+		return dto.Vrf{}, status.Error(codes.InvalidArgument, "VRF name is required")
+	}
+	vrf := dto.Vrf{
+		Name:               cfg.Name,
+		Rd:                 cfg.Rd,
+		Vni:                cfg.Id,
+		ImportRouteTargets: cfg.ImportRouteTargets,
+		ExportRouteTargets: cfg.ExportRouteTargets,
+		VrfExtensions: dto.VrfExtensions{
+			Mobility:               dto.MobilityMode(cfg.Mobility),
+			OrchestratedPrecedence: dto.Precedence(cfg.OrchestratedPrecedence),
+		},
+	}
+	if cfg.OrchestratedPrecedence == "bgp" {
+		vrf.OrchestratedPrecedence = dto.PrecedenceBgp
+	}
+	for _, route := range cfg.StaticRoutes {
+		vrf.StaticRoutes = append(vrf.StaticRoutes, dto.StaticRoute(route))
+	}
+	for _, aggregate := range cfg.Aggregates {
+		vrf.Aggregates = append(vrf.Aggregates, dto.Aggregate(aggregate))
+	}
+	if cfg.DefaultOriginate != nil {
+		defaultOriginate := dto.DefaultOriginate(*cfg.DefaultOriginate)
+		vrf.DefaultOriginate = &defaultOriginate
+	}
+	if cfg.MaxPrefix != nil {
+		vrf.MaxPrefix = &dto.MaxPrefix{
+			Vrf:      cfg.MaxPrefix.Vrf,
+			Neighbor: cfg.MaxPrefix.Neighbor,
+			Warning:  cfg.MaxPrefix.Warning,
+			Action:   dto.MaxPrefixAction(cfg.MaxPrefix.Action),
+		}
+		if cfg.MaxPrefix.Action == "warn" {
+			vrf.MaxPrefix.Action = dto.MaxPrefixWarn
+		}
+	}
+	if cfg.GatewayCheck != nil {
+		vrf.GatewayCheck = &dto.GatewayCheck{}
+		for _, allowed := range cfg.GatewayCheck.Allowed {
+			vrf.GatewayCheck.Allowed = append(vrf.GatewayCheck.Allowed, dto.AllowedGateways(allowed))
+		}
+	}
+	for _, leak := range cfg.Leaks {
+		rule := dto.LeakRule{
+			Vrf: leak.Vrf, Prefixes: leak.Prefixes, Direction: dto.LeakDirection(leak.Direction), Evpn: leak.Evpn,
+		}
+		if leak.Direction == "import" {
+			rule.Direction = dto.LeakImport
+		}
+		vrf.Leaks = append(vrf.Leaks, rule)
+	}
+	var err error
+	if cfg.WithdrawHoldTime != "" {
+		if vrf.WithdrawHoldTime, err = time.ParseDuration(cfg.WithdrawHoldTime); err != nil {
+			return dto.Vrf{}, status.Errorf(codes.InvalidArgument, "invalid withdraw hold time: %v", err)
+		}
+	}
+	if cfg.MobilityResetTime != "" {
+		if vrf.MobilityResetTime, err = time.ParseDuration(cfg.MobilityResetTime); err != nil {
+			return dto.Vrf{}, status.Errorf(codes.InvalidArgument, "invalid mobility reset time: %v", err)
+		}
+	}
+	return vrf, nil
+}
+
+// Maps the errors of VRF changes to gRPC codes
+func vrfStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, dto.ErrVrfNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, dto.ErrVrfExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, dto.ErrInvalidVrf):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// Maps the errors of the orchestrated route changes to gRPC codes
+func routeStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, dto.ErrVrfNotFound), errors.Is(err, dto.ErrRouteNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, dto.ErrInvalidRoute):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func listLeases(backend Backend, req ListLeasesRequest) *ListLeasesResponse {
+	resp := &ListLeasesResponse{Leases: []Lease{}}
+	for _, route := range backend.OrchestratedRoutes(req.Vrf) {
+		resp.Leases = append(resp.Leases, Lease{
+			Vrf:           route.Vrf,
+			Prefix:        route.Prefix,
+			Gateway:       route.Gateway,
+			ExpiresAt:     route.ExpiresAt,
+			Injected:      route.Injected,
+			GeneratedNlri: route.Generated,
+		})
+	}
+	return resp
+}
+
+func getAllowlist(backend Backend, req GetAllowlistRequest) *GetAllowlistResponse {
+	state := backend.Allowlist()
+	resp := &GetAllowlistResponse{
+		Enabled:   state.Enabled,
+		Source:    state.Source,
+		LoadedAt:  state.LoadedAt,
+		CheckedAt: state.CheckedAt,
+		Entries:   state.Entries,
+		Error:     state.Error,
+		Blocked:   []BlockedRoute{},
+	}
+	for _, blocked := range state.Blocked {
+		if req.Vrf == "" || blocked.Vrf == req.Vrf {
+			resp.Blocked = append(resp.Blocked, BlockedRoute(blocked))
+		}
+	}
+	return resp
+}
+
+func newRoute(route dto.RedistributedRoute) Route {
+	return Route{
+		Vrf:           route.Vrf,
+		Direction:     route.Direction,
+		Prefix:        route.Prefix,
+		SourceNlri:    route.Source,
+		GeneratedNlri: route.Generated,
+		Uuid:          route.Uuid.String(),
+		CreatedAt:     route.CreatedAt,
+		UpdatedAt:     route.UpdatedAt,
+	}
+}
+
+func sortRoutes(routes []Route) {
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Vrf != routes[j].Vrf {
+			return routes[i].Vrf < routes[j].Vrf
+		}
+		if routes[i].Prefix != routes[j].Prefix {
+			return routes[i].Prefix < routes[j].Prefix
+		}
+		return routes[i].Direction < routes[j].Direction
+	})
+}
+
+func prefixMatcher(filter string) (func(string) bool, error) {
+	match, err := utils.PrefixMatcher(filter)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return match, nil
+}
@@ -0,0 +1,501 @@
+package bergapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/logging"
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type stubBackend struct {
+	routes    []dto.RedistributedRoute
+	vrfs      []dto.Vrf
+	status    dto.Status
+	reloadErr error
+	validated []byte
+	logs      *logging.Loggers
+	added     []dto.Vrf
+	persisted bool
+	leases    []dto.OrchestratedRoute
+}
+
+func (b *stubBackend) ListRedistributed() []dto.RedistributedRoute { return b.routes }
+func (b *stubBackend) Vrfs() []dto.Vrf                             { return b.vrfs }
+func (b *stubBackend) Status() dto.Status                          { return b.status }
+func (b *stubBackend) Reload() error                               { return b.reloadErr }
+func (b *stubBackend) LogLevels() map[string]string                { return b.logs.Levels() }
+
+func (b *stubBackend) SetLogLevel(subsystem, level string) error {
+	return b.logs.SetLevel(subsystem, level)
+}
+
+func (b *stubBackend) AddVrf(vrf dto.Vrf, persist bool) error {
+	if vrf.Name == "vrf_10" {
+		return fmt.Errorf("%w: %s", dto.ErrVrfExists, vrf.Name)
+	}
+	if vrf.Vni == 0 {
+		return fmt.Errorf("%w: ID is required", dto.ErrInvalidVrf)
+	}
+	b.added = append(b.added, vrf)
+	b.persisted = persist
+	return nil
+}
+
+func (b *stubBackend) UpdateVrf(vrf dto.Vrf, persist bool) error {
+	return b.DeleteVrf(vrf.Name, persist)
+}
+
+func (b *stubBackend) DeleteVrf(name string, persist bool) error {
+	if name != "vrf_10" {
+		return fmt.Errorf("%w: %s", dto.ErrVrfNotFound, name)
+	}
+	if persist {
+		return errors.New("cannot write config file")
+	}
+	return nil
+}
+
+func (b *stubBackend) LeaseRoute(vrf, prefix, gateway string, ttl time.Duration) error {
+	if vrf != "vrf_10" {
+		return fmt.Errorf("%w: %s", dto.ErrVrfNotFound, vrf)
+	}
+	if gateway == "" {
+		return fmt.Errorf("%w: gateway is required", dto.ErrInvalidRoute)
+	}
+	expiresAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Add(ttl)
+	b.leases = append(b.leases, dto.OrchestratedRoute{Vrf: vrf, Prefix: prefix, Gateway: gateway, ExpiresAt: expiresAt})
+	return nil
+}
+
+func (b *stubBackend) ReleaseRoute(vrf, prefix string) error {
+	for i, lease := range b.leases {
+		if lease.Vrf == vrf && lease.Prefix == prefix {
+			b.leases = append(b.leases[:i], b.leases[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", dto.ErrRouteNotFound, prefix)
+}
+
+func (b *stubBackend) OrchestratedRoutes(vrf string) []dto.OrchestratedRoute {
+	result := []dto.OrchestratedRoute{}
+	for _, lease := range b.leases {
+		if vrf == "" || lease.Vrf == vrf {
+			result = append(result, lease)
+		}
+	}
+	return result
+}
+
+func (b *stubBackend) ClearMaxPrefix(vrf, neighbor string) ([]dto.MaxPrefixBlock, error) {
+	if vrf != "vrf_10" {
+		return nil, fmt.Errorf("%w: %s", dto.ErrVrfNotFound, vrf)
+	}
+	return []dto.MaxPrefixBlock{{Vrf: vrf, Neighbor: neighbor}}, nil
+}
+
+func (b *stubBackend) Allowlist() dto.AllowlistState {
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	return dto.AllowlistState{
+		Enabled:  true,
+		Source:   "/etc/berg/allowlist.json",
+		LoadedAt: since,
+		Entries:  2,
+		Blocked: []dto.BlockedRoute{
+			{Vrf: "vrf_10", Prefix: "10.0.3.0/24", Neighbor: "192.168.0.10", Reason: "not allowed", Since: since},
+			{Vrf: "vrf_20", Prefix: "10.0.4.0/24", Neighbor: "192.168.0.20", Reason: "not allowed", Since: since},
+		},
+	}
+}
+
+func (b *stubBackend) Explain(_ context.Context, vrf, prefix string) (dto.Explanation, error) {
+	if vrf != "vrf_10" {
+		return dto.Explanation{}, dto.ErrVrfNotFound
+	}
+	path := dto.PathExplanation{Direction: "vpnv4_to_evpn", Source: "100:10:10.0.0.0/24", Neighbor: "192.168.1.1"}
+	path.Pass("receive", "best path from 192.168.1.1")
+	path.Reject("generate", "no nexthop found")
+	return dto.Explanation{Vrf: vrf, Prefix: prefix, Paths: []dto.PathExplanation{path}}, nil
+}
+
+func (b *stubBackend) Validate(config []byte) error {
+	b.validated = config
+	if len(config) == 0 {
+		return nil
+	}
+	return multierror.Append(errors.New("first"), errors.New("second"))
+}
+
+var testRouteUuid = uuid.New()
+
+func newStubBackend() *stubBackend {
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	return &stubBackend{
+		logs: logging.New(io.Discard),
+		routes: []dto.RedistributedRoute{
+			{
+				Vrf:       "vrf_10",
+				Direction: "vpnv4_to_evpn",
+				Prefix:    "10.0.0.0/24",
+				Source:    "100:10:10.0.0.0/24",
+				Generated: "5:100:10:10.0.0.0/24 Gw:192.168.1.1 Vni:10",
+				Uuid:      testRouteUuid,
+				CreatedAt: created,
+				UpdatedAt: created,
+			},
+			{Vrf: "vrf_10", Direction: "evpn_to_vpnv4", Prefix: "10.1.0.0/16", Uuid: uuid.New()},
+			{Vrf: "vrf_20", Direction: "vpnv4_to_evpn", Prefix: "10.0.0.0/24", Uuid: uuid.New()},
+		},
+		vrfs: []dto.Vrf{
+			{Name: "vrf_10", Rd: "100:10", Vni: 10},
+			{Name: "vrf_20", Rd: "100:20", Vni: 20},
+		},
+		status: dto.Status{
+			Workers:       4,
+			Converged:     true,
+			Redistributed: map[string]int{"vpnv4_to_evpn": 2, "evpn_to_vpnv4": 1},
+			LastReload:    &dto.ReloadStatus{Success: false, Error: "boom"},
+		},
+	}
+}
+
+// Starts a gRPC server which knows nothing but BergService
+func startServer(t *testing.T, backend Backend) *Client {
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer()
+	if backend != nil {
+		server.SetBackend(backend)
+	}
+	grpcServer := grpc.NewServer(server.ServerOption())
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+	conn, err := grpc.Dial(
+		"bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return NewClient(conn)
+}
+
+func TestServer_ListRedistributed(t *testing.T) {
+	client := startServer(t, newStubBackend())
+
+	tests := []struct {
+		name     string
+		req      ListRedistributedRequest
+		expected int
+	}{
+		{name: "No filter", req: ListRedistributedRequest{}, expected: 3},
+		{name: "By VRF", req: ListRedistributedRequest{Vrf: "vrf_10"}, expected: 2},
+		{name: "By direction", req: ListRedistributedRequest{Direction: "vpnv4_to_evpn"}, expected: 2},
+		{name: "By prefix", req: ListRedistributedRequest{Prefix: "10.0.0.0/24"}, expected: 2},
+		{name: "By address", req: ListRedistributedRequest{Prefix: "10.1.2.3"}, expected: 1},
+		{name: "Combined", req: ListRedistributedRequest{Vrf: "vrf_20", Prefix: "10.1.2.3"}, expected: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.ListRedistributed(context.Background(), &tt.req)
+
+			require.NoError(t, err)
+			assert.Len(t, resp.Routes, tt.expected)
+		})
+	}
+}
+
+func TestServer_ListRedistributed_Route(t *testing.T) {
+	client := startServer(t, newStubBackend())
+
+	resp, err := client.ListRedistributed(context.Background(), &ListRedistributedRequest{
+		Vrf: "vrf_10", Direction: "vpnv4_to_evpn",
+	})
+
+	require.NoError(t, err)
+	require.Len(t, resp.Routes, 1)
+	route := resp.Routes[0]
+	assert.Equal(t, "100:10:10.0.0.0/24", route.SourceNlri)
+	assert.Equal(t, "5:100:10:10.0.0.0/24 Gw:192.168.1.1 Vni:10", route.GeneratedNlri)
+	assert.Equal(t, testRouteUuid.String(), route.Uuid)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), route.CreatedAt.UTC())
+}
+
+func TestServer_ListRedistributed_InvalidPrefix(t *testing.T) {
+	client := startServer(t, newStubBackend())
+
+	_, err := client.ListRedistributed(context.Background(), &ListRedistributedRequest{Prefix: "10.0.0/24"})
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_GetVrfState(t *testing.T) {
+	client := startServer(t, newStubBackend())
+
+	resp, err := client.GetVrfState(context.Background(), &GetVrfStateRequest{Vrf: "vrf_10"})
+
+	require.NoError(t, err)
+	require.Len(t, resp.Vrfs, 1)
+	assert.Equal(t, "100:10", resp.Vrfs[0].Rd)
+	assert.Equal(t, map[string]int{"vpnv4_to_evpn": 1, "evpn_to_vpnv4": 1}, resp.Vrfs[0].Redistributed)
+	assert.Len(t, resp.Vrfs[0].Routes, 2)
+
+	_, err = client.GetVrfState(context.Background(), &GetVrfStateRequest{Vrf: "vrf_30"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_Status(t *testing.T) {
+	client := startServer(t, newStubBackend())
+
+	resp, err := client.Status(context.Background())
+
+	require.NoError(t, err)
+	assert.True(t, resp.Converged)
+	assert.Equal(t, 4, resp.Workers)
+	assert.Equal(t, 2, resp.Redistributed["vpnv4_to_evpn"])
+	require.NotNil(t, resp.LastReload)
+	assert.Equal(t, "boom", resp.LastReload.Error)
+}
+
+func TestServer_NoBackend(t *testing.T) {
+	client := startServer(t, nil)
+
+	_, err := client.Status(context.Background())
+
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestServer_Reload(t *testing.T) {
+	backend := newStubBackend()
+	client := startServer(t, backend)
+
+	assert.NoError(t, client.Reload(context.Background()))
+
+	backend.reloadErr = errors.New("invalid config")
+	err := client.Reload(context.Background())
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, err.Error(), "invalid config")
+}
+
+func TestServer_Validate(t *testing.T) {
+	backend := newStubBackend()
+	client := startServer(t, backend)
+
+	resp, err := client.Validate(context.Background(), &ValidateRequest{})
+	require.NoError(t, err)
+	assert.True(t, resp.Valid)
+
+	resp, err = client.Validate(context.Background(), &ValidateRequest{Config: "[global]"})
+	require.NoError(t, err)
+	assert.False(t, resp.Valid)
+	assert.Equal(t, []string{"first", "second"}, resp.Errors)
+	assert.Equal(t, []byte("[global]"), backend.validated)
+}
+
+func TestServer_Explain(t *testing.T) {
+	client := startServer(t, newStubBackend())
+
+	resp, err := client.Explain(context.Background(), &ExplainRequest{Vrf: "vrf_10", Prefix: "10.0.0.1"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", resp.Prefix)
+	require.Len(t, resp.Paths, 1)
+	assert.Equal(t, "100:10:10.0.0.0/24", resp.Paths[0].SourceNlri)
+	assert.False(t, resp.Paths[0].Redistributed)
+	assert.Equal(t, "no nexthop found", resp.Paths[0].Reason)
+	assert.Equal(t, []ExplainStep{
+		{Name: "receive", Passed: true, Detail: "best path from 192.168.1.1"},
+		{Name: "generate", Passed: false, Detail: "no nexthop found"},
+	}, resp.Paths[0].Steps)
+}
+
+func TestServer_Explain_Errors(t *testing.T) {
+	client := startServer(t, newStubBackend())
+
+	_, err := client.Explain(context.Background(), &ExplainRequest{Vrf: "vrf_30", Prefix: "10.0.0.1"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.Explain(context.Background(), &ExplainRequest{Vrf: "vrf_10", Prefix: "10.0.0/24"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Explain(context.Background(), &ExplainRequest{Vrf: "vrf_10"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_LogLevels(t *testing.T) {
+	client := startServer(t, newStubBackend())
+
+	resp, err := client.GetLogLevels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "info", resp.Levels["controller"])
+
+	resp, err = client.SetLogLevel(context.Background(), &SetLogLevelRequest{Subsystem: "controller", Level: "trace"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"app": "info", "controller": "trace", "injector": "info", "gobgp": "info",
+	}, resp.Levels)
+
+	resp, err = client.SetLogLevel(context.Background(), &SetLogLevelRequest{Level: "warn"})
+	require.NoError(t, err)
+	assert.Equal(t, "warning", resp.Levels["controller"])
+
+	_, err = client.SetLogLevel(context.Background(), &SetLogLevelRequest{Subsystem: "bgp", Level: "debug"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.SetLogLevel(context.Background(), &SetLogLevelRequest{Level: "verbose"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_AddVrf(t *testing.T) {
+	backend := newStubBackend()
+	client := startServer(t, backend)
+
+	err := client.AddVrf(context.Background(), &AddVrfRequest{
+		Vrf: VrfConfig{
+			Name:               "vrf_30",
+			Id:                 30,
+			Rd:                 "100:30",
+			ImportRouteTargets: []string{"100:30"},
+			ExportRouteTargets: []string{"100:30"},
+			WithdrawHoldTime:   "30s",
+			Mobility:           "local-pref",
+			StaticRoutes:       []StaticRoute{{Prefix: "10.0.5.0/24", Gateway: "192.168.0.5", LocalPref: 200}},
+			Aggregates:         []Aggregate{{Prefix: "10.0.0.0/16", SummaryOnly: true}},
+			DefaultOriginate:   &DefaultOriginate{Condition: "0.0.0.0/0"},
+			Leaks:              []LeakRule{{Vrf: "vrf_10", Direction: "import"}, {Vrf: "vrf_20", Direction: "both", Evpn: true}},
+			MaxPrefix:          &MaxPrefix{Neighbor: 1000, Action: "warn"},
+			GatewayCheck: &GatewayCheck{Allowed: []AllowedGateways{
+				{Neighbor: "192.168.0.0/24", Subnets: []string{"10.0.5.0/24"}},
+			}},
+		},
+		Persist: true,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []dto.Vrf{{
+		Name:               "vrf_30",
+		Rd:                 "100:30",
+		Vni:                30,
+		ImportRouteTargets: []string{"100:30"},
+		ExportRouteTargets: []string{"100:30"},
+		VrfExtensions: dto.VrfExtensions{
+			WithdrawHoldTime: 30 * time.Second,
+			Mobility:         dto.MobilityLocalPref,
+			StaticRoutes:     []dto.StaticRoute{{Prefix: "10.0.5.0/24", Gateway: "192.168.0.5", LocalPref: 200}},
+			Aggregates:       []dto.Aggregate{{Prefix: "10.0.0.0/16", SummaryOnly: true}},
+			DefaultOriginate: &dto.DefaultOriginate{Condition: "0.0.0.0/0"},
+			Leaks:            []dto.LeakRule{{Vrf: "vrf_10"}, {Vrf: "vrf_20", Direction: dto.LeakBoth, Evpn: true}},
+			MaxPrefix:        &dto.MaxPrefix{Neighbor: 1000},
+			GatewayCheck: &dto.GatewayCheck{Allowed: []dto.AllowedGateways{
+				{Neighbor: "192.168.0.0/24", Subnets: []string{"10.0.5.0/24"}},
+			}},
+		},
+	}}, backend.added)
+	assert.True(t, backend.persisted)
+}
+
+func TestServer_VrfErrors(t *testing.T) {
+	client := startServer(t, newStubBackend())
+	ctx := context.Background()
+
+	err := client.AddVrf(ctx, &AddVrfRequest{Vrf: VrfConfig{Name: "vrf_10", Id: 10}})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	err = client.AddVrf(ctx, &AddVrfRequest{Vrf: VrfConfig{Name: "vrf_30"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	err = client.AddVrf(ctx, &AddVrfRequest{Vrf: VrfConfig{Id: 30}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	err = client.AddVrf(ctx, &AddVrfRequest{Vrf: VrfConfig{Name: "vrf_30", Id: 30, MobilityResetTime: "10"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	err = client.UpdateVrf(ctx, &UpdateVrfRequest{Vrf: VrfConfig{Name: "vrf_30", Id: 30}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.NoError(t, client.UpdateVrf(ctx, &UpdateVrfRequest{Vrf: VrfConfig{Name: "vrf_10", Id: 10}}))
+
+	assert.NoError(t, client.DeleteVrf(ctx, &DeleteVrfRequest{Name: "vrf_10"}))
+	err = client.DeleteVrf(ctx, &DeleteVrfRequest{Name: "vrf_10", Persist: true})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	err = client.DeleteVrf(ctx, &DeleteVrfRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_Leases(t *testing.T) {
+	client := startServer(t, newStubBackend())
+	ctx := context.Background()
+
+	err := client.LeaseRoute(ctx, &LeaseRouteRequest{
+		Vrf: "vrf_10", Prefix: "10.0.7.0/24", Gateway: "192.168.0.7", Ttl: "1m",
+	})
+	require.NoError(t, err)
+	resp, err := client.ListLeases(ctx, &ListLeasesRequest{Vrf: "vrf_10"})
+	require.NoError(t, err)
+	assert.Equal(t, []Lease{{
+		Vrf:       "vrf_10",
+		Prefix:    "10.0.7.0/24",
+		Gateway:   "192.168.0.7",
+		ExpiresAt: time.Date(2025, 1, 1, 0, 1, 0, 0, time.UTC),
+	}}, resp.Leases)
+
+	require.NoError(t, client.ReleaseRoute(ctx, &ReleaseRouteRequest{Vrf: "vrf_10", Prefix: "10.0.7.0/24"}))
+	resp, err = client.ListLeases(ctx, &ListLeasesRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, resp.Leases)
+}
+
+func TestServer_LeaseErrors(t *testing.T) {
+	client := startServer(t, newStubBackend())
+	ctx := context.Background()
+
+	err := client.LeaseRoute(ctx, &LeaseRouteRequest{Vrf: "vrf_10", Prefix: "10.0.7.0/24", Gateway: "192.168.0.7"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	err = client.LeaseRoute(ctx, &LeaseRouteRequest{Vrf: "vrf_10", Prefix: "10.0.7.0/24", Ttl: "1m"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	err = client.LeaseRoute(ctx, &LeaseRouteRequest{
+		Vrf: "vrf_30", Prefix: "10.0.7.0/24", Gateway: "192.168.0.7", Ttl: "1m",
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	err = client.ReleaseRoute(ctx, &ReleaseRouteRequest{Vrf: "vrf_10", Prefix: "10.0.7.0/24"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_ClearMaxPrefix(t *testing.T) {
+	client := startServer(t, newStubBackend())
+	ctx := context.Background()
+
+	resp, err := client.ClearMaxPrefix(ctx, &ClearMaxPrefixRequest{Vrf: "vrf_10", Neighbor: "192.168.0.10"})
+	require.NoError(t, err)
+	assert.Equal(t, []MaxPrefixBlock{{Vrf: "vrf_10", Neighbor: "192.168.0.10"}}, resp.Cleared)
+
+	_, err = client.ClearMaxPrefix(ctx, &ClearMaxPrefixRequest{Vrf: "vrf_30"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_GetAllowlist(t *testing.T) {
+	client := startServer(t, newStubBackend())
+	ctx := context.Background()
+
+	resp, err := client.GetAllowlist(ctx, &GetAllowlistRequest{})
+	require.NoError(t, err)
+	assert.True(t, resp.Enabled)
+	assert.Equal(t, "/etc/berg/allowlist.json", resp.Source)
+	assert.Equal(t, 2, resp.Entries)
+	assert.Len(t, resp.Blocked, 2)
+
+	resp, err = client.GetAllowlist(ctx, &GetAllowlistRequest{Vrf: "vrf_20"})
+	require.NoError(t, err)
+	require.Len(t, resp.Blocked, 1)
+	assert.Equal(t, "10.0.4.0/24", resp.Blocked[0].Prefix)
+	assert.Equal(t, "192.168.0.20", resp.Blocked[0].Neighbor)
+}
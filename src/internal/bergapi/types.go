@@ -0,0 +1,307 @@
+package bergapi
+
+import "time"
+
+const ServiceName = "berg.BergService"
+
+const (
+	methodListRedistributed = "/" + ServiceName + "/ListRedistributed"
+	methodGetVrfState       = "/" + ServiceName + "/GetVrfState"
+	methodStatus            = "/" + ServiceName + "/Status"
+	methodReload            = "/" + ServiceName + "/Reload"
+	methodValidate          = "/" + ServiceName + "/Validate"
+	methodExplain           = "/" + ServiceName + "/Explain"
+	methodGetLogLevels      = "/" + ServiceName + "/GetLogLevels"
+	methodSetLogLevel       = "/" + ServiceName + "/SetLogLevel"
+	methodAddVrf            = "/" + ServiceName + "/AddVrf"
+	methodUpdateVrf         = "/" + ServiceName + "/UpdateVrf"
+	methodDeleteVrf         = "/" + ServiceName + "/DeleteVrf"
+	methodLeaseRoute        = "/" + ServiceName + "/LeaseRoute"
+	methodReleaseRoute      = "/" + ServiceName + "/ReleaseRoute"
+	methodListLeases        = "/" + ServiceName + "/ListLeases"
+	methodClearMaxPrefix    = "/" + ServiceName + "/ClearMaxPrefix"
+	methodGetAllowlist      = "/" + ServiceName + "/GetAllowlist"
+)
+
+// Empty fields match everything. Prefix is either a prefix, e.g. 10.0.0.0/24, or an address covered by the route
+type ListRedistributedRequest struct {
+	Vrf       string `json:"vrf,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`
+	Direction string `json:"direction,omitempty"`
+}
+
+type ListRedistributedResponse struct {
+	Routes []Route `json:"routes"`
+}
+
+type Route struct {
+	Vrf           string    `json:"vrf"`
+	Direction     string    `json:"direction"`
+	Prefix        string    `json:"prefix"`
+	SourceNlri    string    `json:"source_nlri"`
+	GeneratedNlri string    `json:"generated_nlri"`
+	Uuid          string    `json:"uuid"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Empty Vrf means all the VRFs
+type GetVrfStateRequest struct {
+	Vrf string `json:"vrf,omitempty"`
+}
+
+type GetVrfStateResponse struct {
+	Vrfs []VrfState `json:"vrfs"`
+}
+
+type VrfState struct {
+	Name               string         `json:"name"`
+	Rd                 string         `json:"rd"`
+	Vni                uint32         `json:"vni"`
+	ImportRouteTargets []string       `json:"import_route_targets"`
+	ExportRouteTargets []string       `json:"export_route_targets"`
+	Redistributed      map[string]int `json:"redistributed"` // routes count by direction
+	Routes             []Route        `json:"routes"`
+}
+
+type StatusRequest struct{}
+
+type StatusResponse struct {
+	StartedAt       time.Time      `json:"started_at"`
+	Converged       bool           `json:"converged"`
+	Workers         int            `json:"workers"`
+	EventQueueDepth int            `json:"event_queue_depth"`
+	Redistributed   map[string]int `json:"redistributed"` // routes count by direction
+	LastReload      *ReloadStatus  `json:"last_reload,omitempty"`
+}
+
+type ReloadStatus struct {
+	Time    time.Time `json:"time"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Re-reads the config file and applies it
+type ReloadRequest struct{}
+
+type ReloadResponse struct{}
+
+type ValidateRequest struct {
+	Config string `json:"config,omitempty"` // TOML config file contents, empty means the running config file
+}
+
+type ValidateResponse struct {
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Prefix is either a prefix, e.g. 10.0.0.0/24, or an address covered by the routes
+type ExplainRequest struct {
+	Vrf    string `json:"vrf"`
+	Prefix string `json:"prefix"`
+}
+
+type ExplainResponse struct {
+	Vrf    string            `json:"vrf"`
+	Prefix string            `json:"prefix"`
+	Paths  []PathExplanation `json:"paths"` // every path of the RIB matching the prefix
+}
+
+type PathExplanation struct {
+	Direction     string        `json:"direction"`
+	SourceNlri    string        `json:"source_nlri"`
+	Neighbor      string        `json:"neighbor,omitempty"`
+	Steps         []ExplainStep `json:"steps"`
+	GeneratedNlri string        `json:"generated_nlri,omitempty"`
+	Redistributed bool          `json:"redistributed"`
+	Reason        string        `json:"reason,omitempty"` // why the path is not redistributed
+}
+
+type ExplainStep struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+type GetLogLevelsRequest struct{}
+
+// Empty Subsystem means all the subsystems
+type SetLogLevelRequest struct {
+	Subsystem string `json:"subsystem,omitempty"`
+	Level     string `json:"level"`
+}
+
+type LogLevelsResponse struct {
+	Levels map[string]string `json:"levels"` // by subsystem
+}
+
+// VRF settings along with its berg section. Id is the VNI, durations are Go durations, e.g. 30s
+type VrfConfig struct {
+	Name                   string            `json:"name"`
+	Id                     uint32            `json:"id"`
+	Rd                     string            `json:"rd"`
+	ImportRouteTargets     []string          `json:"import_route_targets"`
+	ExportRouteTargets     []string          `json:"export_route_targets"`
+	WithdrawHoldTime       string            `json:"withdraw_hold_time,omitempty"`
+	Mobility               string            `json:"mobility,omitempty"`
+	MobilityResetTime      string            `json:"mobility_reset_time,omitempty"`
+	StaticRoutes           []StaticRoute     `json:"static_routes,omitempty"`
+	OrchestratedPrecedence string            `json:"orchestrated_precedence,omitempty"` // "bgp" or "orchestrator"
+	Aggregates             []Aggregate       `json:"aggregates,omitempty"`
+	DefaultOriginate       *DefaultOriginate `json:"default_originate,omitempty"` // null means disabled
+	Leaks                  []LeakRule        `json:"leaks,omitempty"`
+	MaxPrefix              *MaxPrefix        `json:"max_prefix,omitempty"`    // null means no limits
+	GatewayCheck           *GatewayCheck     `json:"gateway_check,omitempty"` // null means disabled
+}
+
+// Gateways of the received routes must be the announcing neighbors or belong to the subnets allowed for them
+type GatewayCheck struct {
+	Allowed []AllowedGateways `json:"allowed,omitempty"`
+}
+
+// Neighbor is either an address or a dynamic-neighbor range
+type AllowedGateways struct {
+	Neighbor string   `json:"neighbor"`
+	Subnets  []string `json:"subnets"`
+}
+
+// Limits of the routes redistributed to EVPN, zero means no limit. Warning is a percentage of the limits,
+// Action is "warn" (the default), "stop" or "withdraw"
+type MaxPrefix struct {
+	Vrf      uint32 `json:"vrf,omitempty"`
+	Neighbor uint32 `json:"neighbor,omitempty"`
+	Warning  uint32 `json:"warning,omitempty"`
+	Action   string `json:"action,omitempty"`
+}
+
+// Routes leaked between the VRF and the other VRF Vrf, Direction is "import" (the default), "export" or "both"
+type LeakRule struct {
+	Vrf       string   `json:"vrf"`
+	Prefixes  []string `json:"prefixes,omitempty"` // empty means all the routes
+	Direction string   `json:"direction,omitempty"`
+	Evpn      bool     `json:"evpn,omitempty"`
+}
+
+// Default route imported into the VRF, Condition is the prefix of the EVPN route the VRF must import for it
+type DefaultOriginate struct {
+	Condition        string `json:"condition,omitempty"`
+	SuppressImported bool   `json:"suppress_imported,omitempty"`
+}
+
+// Prefix exported as a single Type-5 route while any more specific route of the VRF is redistributed
+type Aggregate struct {
+	Prefix      string `json:"prefix"`
+	Gateway     string `json:"gateway,omitempty"`
+	SummaryOnly bool   `json:"summary_only,omitempty"`
+	AsSet       bool   `json:"as_set,omitempty"`
+}
+
+// Route injected as Type-5 with the gateway of an appliance which cannot speak BGP
+type StaticRoute struct {
+	Prefix      string   `json:"prefix"`
+	Gateway     string   `json:"gateway"`
+	LocalPref   uint32   `json:"local_pref,omitempty"`
+	Med         uint32   `json:"med,omitempty"`
+	Communities []string `json:"communities,omitempty"`
+}
+
+// Persist writes the change to the config file, otherwise the next config reload reverts it
+type AddVrfRequest struct {
+	Vrf     VrfConfig `json:"vrf"`
+	Persist bool      `json:"persist,omitempty"`
+}
+
+type AddVrfResponse struct{}
+
+// Replaces the settings of the VRF with the same name
+type UpdateVrfRequest struct {
+	Vrf     VrfConfig `json:"vrf"`
+	Persist bool      `json:"persist,omitempty"`
+}
+
+type UpdateVrfResponse struct{}
+
+type DeleteVrfRequest struct {
+	Name    string `json:"name"`
+	Persist bool   `json:"persist,omitempty"`
+}
+
+type DeleteVrfResponse struct{}
+
+// Adds or renews the lease of the prefix, the route is withdrawn unless renewed within Ttl, a Go duration
+type LeaseRouteRequest struct {
+	Vrf     string `json:"vrf"`
+	Prefix  string `json:"prefix"`
+	Gateway string `json:"gateway"`
+	Ttl     string `json:"ttl"`
+}
+
+type LeaseRouteResponse struct{}
+
+// Ends the lease of the prefix before it expires
+type ReleaseRouteRequest struct {
+	Vrf    string `json:"vrf"`
+	Prefix string `json:"prefix"`
+}
+
+type ReleaseRouteResponse struct{}
+
+// Empty Vrf means all the VRFs
+type ListLeasesRequest struct {
+	Vrf string `json:"vrf,omitempty"`
+}
+
+type ListLeasesResponse struct {
+	Leases []Lease `json:"leases"`
+}
+
+// Unblocks the exceeded max-prefix limits of the VRF, empty Neighbor means all of them
+type ClearMaxPrefixRequest struct {
+	Vrf      string `json:"vrf"`
+	Neighbor string `json:"neighbor,omitempty"`
+}
+
+type ClearMaxPrefixResponse struct {
+	Cleared []MaxPrefixBlock `json:"cleared"`
+}
+
+// Empty Neighbor stands for the limit of the VRF
+type MaxPrefixBlock struct {
+	Vrf      string `json:"vrf"`
+	Neighbor string `json:"neighbor,omitempty"`
+}
+
+// Empty Vrf means the blocked routes of all the VRFs
+type GetAllowlistRequest struct {
+	Vrf string `json:"vrf,omitempty"`
+}
+
+// LoadedAt is zero until the allowlist is loaded, Error is the one of the last check
+type GetAllowlistResponse struct {
+	Enabled   bool           `json:"enabled"`
+	Source    string         `json:"source,omitempty"`
+	LoadedAt  time.Time      `json:"loaded_at"`
+	CheckedAt time.Time      `json:"checked_at"`
+	Entries   int            `json:"entries"`
+	Error     string         `json:"error,omitempty"`
+	Blocked   []BlockedRoute `json:"blocked"`
+}
+
+type BlockedRoute struct {
+	Vrf      string    `json:"vrf"`
+	Prefix   string    `json:"prefix"`
+	Source   string    `json:"source_nlri"`
+	Neighbor string    `json:"neighbor"`
+	Reason   string    `json:"reason"`
+	Since    time.Time `json:"since"`
+}
+
+// Injected is false while the prefix learned over BGP takes precedence
+type Lease struct {
+	Vrf           string    `json:"vrf"`
+	Prefix        string    `json:"prefix"`
+	Gateway       string    `json:"gateway"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	Injected      bool      `json:"injected"`
+	GeneratedNlri string    `json:"generated_nlri,omitempty"`
+}
@@ -0,0 +1,506 @@
+package controller
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/amyasnikov/berg/internal/utils"
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Source of the routes injected for aggregates
+const AggregateSource = "aggregate"
+
+// AS_PATH segment type of unordered ASNs
+const asSet = 1
+
+// Route redistributed to EVPN or suppressed by a summary-only aggregate, more specific than the aggregate
+type contributor struct {
+	prefix  netip.Prefix
+	gateway string
+	asns    []uint32
+}
+
+// Contributing routes of an aggregate
+type contribution struct {
+	routes map[vpnRoute]contributor
+	asns   map[uint32]int // number of the contributing routes by ASN
+	first  vpnRoute       // the lowest contributing prefix, whose gateway the aggregate takes by default
+}
+
+func newContribution() *contribution {
+	return &contribution{routes: map[vpnRoute]contributor{}, asns: map[uint32]int{}}
+}
+
+func (c *contribution) add(route vpnRoute, added contributor) {
+	c.remove(route)
+	c.routes[route] = added
+	for _, asn := range added.asns {
+		c.asns[asn]++
+	}
+	if first, ok := c.routes[c.first]; !ok || lessPrefix(added.prefix, first.prefix) {
+		c.first = route
+	}
+}
+
+// Returns whether the route contributed
+func (c *contribution) remove(route vpnRoute) bool {
+	removed, ok := c.routes[route]
+	if !ok {
+		return false
+	}
+	delete(c.routes, route)
+	for _, asn := range removed.asns {
+		c.asns[asn]--
+		if c.asns[asn] == 0 {
+			delete(c.asns, asn)
+		}
+	}
+	if route == c.first {
+		c.first = vpnRoute{}
+		for other, r := range c.routes {
+			if first, ok := c.routes[c.first]; !ok || lessPrefix(r.prefix, first.prefix) {
+				c.first = other
+			}
+		}
+	}
+	return true
+}
+
+// Injects a Type-5 route for every aggregate of the VRFs which has contributing routes
+type Aggregates struct {
+	lock     sync.Mutex
+	local    localInjector
+	vpn      *VPNv4Controller
+	vrfs     map[string]dto.Vrf                     // by VRF name
+	tries    map[string]*prefixTrie[aggregateEntry] // by VRF name, nil if the VRF has no aggregates
+	injected map[localKey]localRoute
+	// contributing routes by aggregate, kept up to date by the updates and withdrawals of the routes
+	contributions map[localKey]*contribution
+}
+
+type aggregateEntry struct {
+	key       localKey
+	aggregate dto.Aggregate
+}
+
+// vpn supplies the contributing routes and suppresses them for the summary-only aggregates
+func NewAggregates(
+	injector evpnInjector, vpn *VPNv4Controller, vrfCfg []oc.VrfConfig, vrfExt map[string]dto.VrfExtensions,
+) *Aggregates {
+	a := &Aggregates{
+		local:         newLocalInjector(injector, AggregateSource),
+		vpn:           vpn,
+		vrfs:          newVrfMap(vrfCfg, vrfExt),
+		injected:      map[localKey]localRoute{},
+		contributions: map[localKey]*contribution{},
+	}
+	a.buildTries()
+	return a
+}
+
+// Sets the receiver of the injection decisions
+func (a *Aggregates) SetEventPublisher(publisher events.Publisher) {
+	a.local.events = publisher
+}
+
+func (a *Aggregates) SetLogger(logger *logrus.Logger) {
+	a.local.logger = logger
+}
+
+// Must be called with lock held
+func (a *Aggregates) buildTries() {
+	a.tries = make(map[string]*prefixTrie[aggregateEntry], len(a.vrfs))
+	for name, vrf := range a.vrfs {
+		if len(vrf.Aggregates) == 0 {
+			continue
+		}
+		trie := &prefixTrie[aggregateEntry]{}
+		for _, aggregate := range vrf.Aggregates {
+			prefix, err := utils.ParsePrefix(aggregate.Prefix)
+			if err != nil {
+				continue // validated with the config
+			}
+			trie.Insert(prefix, aggregateEntry{key: localKey{vrf: name, prefix: prefix.String()}, aggregate: aggregate})
+		}
+		a.tries[name] = trie
+	}
+}
+
+// Applies the VRF changes, suppresses or restores the routes covered by the summary-only aggregates,
+// then recounts the contributing routes and injects or withdraws the aggregates
+func (a *Aggregates) ReloadConfig(diff dto.VrfDiff) error {
+	a.lock.Lock()
+	reloadVrfs(a.vrfs, diff)
+	a.buildTries()
+	a.lock.Unlock()
+	var merr error
+	// without the lock, the routes changing their suppression contribute one by one
+	if a.vpn != nil {
+		if err := a.vpn.resummarize(a.summarized); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if err := a.sync(); err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	return merr
+}
+
+// Recounts the contributing routes, then injects the aggregates with contributing routes
+// and withdraws the rest. Must be called with lock held
+func (a *Aggregates) sync() error {
+	a.contributions = map[localKey]*contribution{}
+	if a.vpn != nil && len(a.tries) > 0 {
+		a.vpn.contributors(func(vrfName string, route vpnRoute, generated dto.Evpn5Route) {
+			a.add(vrfName, route, generated)
+		})
+	}
+	var merr error
+	for key, injected := range a.injected {
+		if _, ok := a.contributions[key]; ok {
+			continue
+		}
+		delete(a.injected, key)
+		if err := a.local.withdraw(key, injected, a.withdrawReason(key)); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	for _, trie := range a.tries {
+		for _, entry := range trie.Values() {
+			if err := a.refresh(entry); err != nil {
+				merr = multierror.Append(merr, err)
+			}
+		}
+	}
+	return merr
+}
+
+// Counts the redistributed or suppressed route in the aggregates covering it,
+// then injects or replaces the aggregates whose contribution has changed
+func (a *Aggregates) contribute(vrfName string, route vpnRoute, generated dto.Evpn5Route) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.refreshAll(a.add(vrfName, route, generated))
+}
+
+// Uncounts the route which is neither redistributed nor suppressed anymore,
+// then replaces or withdraws the aggregates whose contribution has changed
+func (a *Aggregates) uncontribute(vrfName string, route vpnRoute) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	trie := a.tries[vrfName]
+	if trie == nil {
+		return nil
+	}
+	prefix, err := route.netipPrefix()
+	if err != nil {
+		return nil
+	}
+	changed := []aggregateEntry{}
+	for _, entry := range trie.Supernets(prefix) {
+		if c := a.contributions[entry.key]; c != nil && c.remove(route) {
+			if len(c.routes) == 0 {
+				delete(a.contributions, entry.key)
+			}
+			changed = append(changed, entry)
+		}
+	}
+	return a.refreshAll(changed)
+}
+
+// Counts the route in the aggregates covering it, returning them. Must be called with lock held
+func (a *Aggregates) add(vrfName string, route vpnRoute, generated dto.Evpn5Route) []aggregateEntry {
+	trie := a.tries[vrfName]
+	if trie == nil {
+		return nil
+	}
+	prefix, err := route.netipPrefix()
+	if err != nil {
+		return nil
+	}
+	entries := trie.Supernets(prefix)
+	for _, entry := range entries {
+		c, ok := a.contributions[entry.key]
+		if !ok {
+			c = newContribution()
+			a.contributions[entry.key] = c
+		}
+		c.add(route, contributor{prefix: prefix, gateway: generated.Gateway, asns: asNumbers(generated.PathAttrs)})
+	}
+	return entries
+}
+
+// Must be called with lock held
+func (a *Aggregates) refreshAll(entries []aggregateEntry) error {
+	var merr error
+	for _, entry := range entries {
+		if err := a.refresh(entry); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	return merr
+}
+
+// Injects the aggregate while it has contributing routes, withdraws it otherwise.
+// Unchanged aggregates are left alone. Must be called with lock held
+func (a *Aggregates) refresh(entry aggregateEntry) error {
+	key := entry.key
+	prev, loaded := a.injected[key]
+	c, ok := a.contributions[key]
+	if !ok {
+		if !loaded {
+			return nil
+		}
+		delete(a.injected, key)
+		return a.local.withdraw(key, prev, a.withdrawReason(key))
+	}
+	spec := aggregateSpec(a.vrfs[key.vrf], key, entry.aggregate, c)
+	if loaded && reflect.DeepEqual(prev.spec, spec) {
+		return nil
+	}
+	injected, err := a.local.inject(key, spec, prev, loaded, events.ReasonContributing)
+	if err != nil {
+		return fmt.Errorf("VRF %s: %w", key.vrf, err)
+	}
+	a.injected[key] = injected
+	return nil
+}
+
+func aggregateSpec(vrf dto.Vrf, key localKey, aggregate dto.Aggregate, c *contribution) localSpec {
+	gateway := aggregate.Gateway
+	if gateway == "" {
+		gateway = c.routes[c.first].gateway
+	}
+	spec := newLocalSpec(vrf, dto.StaticRoute{Prefix: key.prefix, Gateway: gateway})
+	spec.Aggregate = true
+	if aggregate.AsSet {
+		spec.Asns = []uint32{}
+		for asn := range c.asns {
+			spec.Asns = append(spec.Asns, asn)
+		}
+		slices.Sort(spec.Asns)
+	}
+	return spec
+}
+
+// Must be called with lock held
+func (a *Aggregates) withdrawReason(key localKey) string {
+	vrf, ok := a.vrfs[key.vrf]
+	if !ok {
+		return events.ReasonVrfDeleted
+	}
+	for _, aggregate := range vrf.Aggregates {
+		if prefix, err := utils.ParsePrefix(aggregate.Prefix); err == nil &&
+			prefix.String() == key.prefix {
+			return events.ReasonNoContributors
+		}
+	}
+	return events.ReasonAggregateRemoved
+}
+
+// Whether a summary-only aggregate of the VRF covers the prefix
+func (a *Aggregates) summarized(vrfName string, prefix netip.Prefix) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.summarizes(vrfName, prefix)
+}
+
+// Must be called with lock held
+func (a *Aggregates) summarizes(vrfName string, prefix netip.Prefix) bool {
+	trie := a.tries[vrfName]
+	if trie == nil {
+		return false
+	}
+	for _, entry := range trie.Supernets(prefix) {
+		if entry.aggregate.SummaryOnly {
+			return true
+		}
+	}
+	return false
+}
+
+// Injected aggregates sorted by VRF and prefix, Source is AggregateSource
+func (a *Aggregates) ListRedistributed() []dto.RedistributedRoute {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	result := make([]dto.RedistributedRoute, 0, len(a.injected))
+	for key, injected := range a.injected {
+		result = append(result, a.local.redistributedRoute(key, injected))
+	}
+	sortRedistributed(result)
+	return result
+}
+
+// Number of injected aggregates by VRF name
+func (a *Aggregates) RedistributedRoutes() map[string]int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	result := map[string]int{}
+	for key := range a.injected {
+		result[key.vrf]++
+	}
+	return result
+}
+
+func lessPrefix(a, b netip.Prefix) bool {
+	if cmp := a.Addr().Compare(b.Addr()); cmp != 0 {
+		return cmp < 0
+	}
+	return a.Bits() < b.Bits()
+}
+
+// ASNs of the AS_PATH attribute
+func asNumbers(pattrs []*anypb.Any) []uint32 {
+	var result []uint32
+	for _, pattr := range pattrs {
+		var asPath api.AsPathAttribute
+		if pattr.UnmarshalTo(&asPath) != nil {
+			continue
+		}
+		for _, segment := range asPath.Segments {
+			result = append(result, segment.Numbers...)
+		}
+	}
+	return result
+}
+
+// Sets the aggregates which may suppress the received routes
+func (c *VPNv4Controller) SetAggregates(aggregates *Aggregates) {
+	c.aggregates = aggregates
+}
+
+func (c *VPNv4Controller) summarized(vrf dto.Vrf, route vpnRoute) bool {
+	if c.aggregates == nil {
+		return false
+	}
+	prefix, err := route.netipPrefix()
+	return err == nil && c.aggregates.summarized(vrf.Name, prefix)
+}
+
+// Keeps the route aside rather than redistributing it, withdrawing it if it is redistributed
+func (c *VPNv4Controller) suppress(
+	vrfName string, route vpnRoute, suppressed suppressedRoute,
+) (withdrawn bool, err error) {
+	c.suppressed.Store(route, suppressed)
+	evpnUuid, loaded := c.redistributedEvpn.LoadAndDelete(route)
+	if !loaded {
+		c.routeChanged(route)
+		return false, nil
+	}
+	c.withdrawHold.Cancel(route.prefixKey())
+	info := c.forgetRoute(route)
+	c.emit(vpnEvent(events.Withdrawn, vrfName, route, info.generated, events.ReasonSummarized))
+	err = c.evpnInjector.DelRoute(evpnUuid)
+	observeRoute(vrfName, metrics.DirectionToEvpn, metrics.OperationWithdraw, err)
+	return true, err
+}
+
+// Suppresses the redistributed routes newly covered by the summary-only aggregates
+// and redistributes the suppressed ones which are not covered anymore
+func (c *VPNv4Controller) resummarize(summarized func(vrfName string, prefix netip.Prefix) bool) (merr error) {
+	c.redistributedEvpn.Range(func(route vpnRoute, _ uuid.UUID) bool {
+		vrfName := c.vrfName(route.Rd)
+		prefix, err := route.netipPrefix()
+		if err != nil || !summarized(vrfName, prefix) {
+			return true
+		}
+		info, _ := c.routeInfo.Load(route)
+		suppressed := suppressedRoute{info.route, info.neighbor}
+		withdrawn, err := c.suppress(vrfName, route, suppressed)
+		if err != nil {
+			merr = multierror.Append(merr, err)
+		}
+		if !withdrawn { // withdrawn by its source meanwhile
+			c.dropSuppressed(route, suppressed)
+		}
+		return true
+	})
+	c.suppressed.Range(func(route vpnRoute, suppressed suppressedRoute) bool {
+		vrf, ok := c.rdVrfMap.Load(route.Rd)
+		if !ok {
+			c.dropSuppressed(route, suppressed)
+			return true
+		}
+		prefix, err := route.netipPrefix()
+		if err == nil && summarized(vrf.Name, prefix) {
+			return true
+		}
+		// the route stays suppressed until it is injected, so that its withdrawal meanwhile is not missed
+		if !c.admit(vrf, route, suppressed.neighbor) {
+			c.dropSuppressed(route, suppressed)
+			return true
+		}
+		evpnRoute := suppressed.route
+		evpnUuid, err := c.evpnInjector.AddType5Route(evpnRoute)
+		observeRoute(vrf.Name, metrics.DirectionToEvpn, metrics.OperationInject, err)
+		if err != nil {
+			c.emit(vpnEvent(events.Rejected, vrf.Name, route, generatedEvpn(evpnRoute), err.Error()))
+			c.dropSuppressed(route, suppressed)
+			c.uncount(route)
+			merr = multierror.Append(merr, err)
+			return true
+		}
+		stored := false
+		c.suppressed.Compute(route, func(cur suppressedRoute, loaded bool) (suppressedRoute, xsync.ComputeOp) {
+			if !loaded || !reflect.DeepEqual(cur, suppressed) {
+				return cur, xsync.CancelOp
+			}
+			// stored before the route leaves the suppressed ones, so a withdrawal finds it either way
+			c.redistributedEvpn.Store(route, evpnUuid)
+			stored = true
+			return cur, xsync.DeleteOp
+		})
+		if !stored { // withdrawn or updated by its source meanwhile
+			c.uncount(route)
+			err := c.evpnInjector.DelRoute(evpnUuid)
+			observeRoute(vrf.Name, metrics.DirectionToEvpn, metrics.OperationWithdraw, err)
+			if err != nil {
+				merr = multierror.Append(merr, err)
+			}
+			return true
+		}
+		c.recordRoute(route, evpnRoute, suppressed.neighbor)
+		c.emit(vpnEvent(events.Added, vrf.Name, route, generatedEvpn(evpnRoute), events.ReasonUnsummarized))
+		return true
+	})
+	return merr
+}
+
+// Drops the suppressed route unless its source has updated it meanwhile
+func (c *VPNv4Controller) dropSuppressed(route vpnRoute, suppressed suppressedRoute) {
+	c.suppressed.Compute(route, func(cur suppressedRoute, loaded bool) (suppressedRoute, xsync.ComputeOp) {
+		if loaded && reflect.DeepEqual(cur, suppressed) {
+			return cur, xsync.DeleteOp
+		}
+		return cur, xsync.CancelOp
+	})
+	c.routeChanged(route)
+}
+
+// Calls fn for every redistributed or suppressed route
+func (c *VPNv4Controller) contributors(fn func(vrfName string, route vpnRoute, generated dto.Evpn5Route)) {
+	c.redistributedEvpn.Range(func(route vpnRoute, _ uuid.UUID) bool {
+		info, _ := c.routeInfo.Load(route)
+		fn(c.vrfName(route.Rd), route, info.route)
+		return true
+	})
+	c.suppressed.Range(func(route vpnRoute, suppressed suppressedRoute) bool {
+		fn(c.vrfName(route.Rd), route, suppressed.route)
+		return true
+	})
+}
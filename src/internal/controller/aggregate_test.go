@@ -0,0 +1,261 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// VPNv4 path of the VRF of createTestVPNPath learned from the AS
+func createAggregatedPath(prefix string, asn uint32) *api.Path {
+	path := createTestVPNPath()
+	rd, _ := anypb.New(&api.RouteDistinguisherTwoOctetASN{Admin: 65000, Assigned: 100})
+	path.Nlri, _ = anypb.New(&api.LabeledVPNIPAddressPrefix{
+		Rd: rd, Prefix: prefix, PrefixLen: 24, Labels: []uint32{1000},
+	})
+	asPath, _ := anypb.New(&api.AsPathAttribute{Segments: []*api.AsSegment{{Type: 2, Numbers: []uint32{asn}}}})
+	path.Pattrs = append(path.Pattrs, asPath)
+	return path
+}
+
+func withPrefix(prefix string) any {
+	return mock.MatchedBy(func(route dto.Evpn5Route) bool { return route.Prefix == prefix })
+}
+
+func aggregateExtensions(aggregates ...dto.Aggregate) map[string]dto.VrfExtensions {
+	return map[string]dto.VrfExtensions{"vrf_10": {Aggregates: aggregates}}
+}
+
+func TestAggregates_HandleUpdate(t *testing.T) {
+	tests := []struct {
+		name            string
+		aggregates      []dto.Aggregate
+		path            *api.Path
+		expectedEvents  []events.Type
+		expectedReasons []string
+		redistributed   int  // received routes
+		aggregated      bool // whether the aggregate is injected
+		gateway         string
+		asSet           []uint32
+	}{
+		{
+			name:            "No aggregates",
+			path:            createAggregatedPath("10.0.1.0", 65001),
+			expectedEvents:  []events.Type{events.Added},
+			expectedReasons: []string{events.ReasonSourceAdvertised},
+			redistributed:   1,
+		},
+		{
+			name:            "Route outside the aggregate",
+			aggregates:      []dto.Aggregate{{Prefix: "10.0.0.0/16"}},
+			path:            createAggregatedPath("10.1.0.0", 65001),
+			expectedEvents:  []events.Type{events.Added},
+			expectedReasons: []string{events.ReasonSourceAdvertised},
+			redistributed:   1,
+		},
+		{
+			name:            "Contributing route with AS_SET",
+			aggregates:      []dto.Aggregate{{Prefix: "10.0.0.0/16", AsSet: true}},
+			path:            createAggregatedPath("10.0.1.0", 65001),
+			expectedEvents:  []events.Type{events.Added, events.Added},
+			expectedReasons: []string{events.ReasonContributing, events.ReasonSourceAdvertised},
+			redistributed:   1,
+			aggregated:      true,
+			gateway:         "192.168.1.1",
+			asSet:           []uint32{65001},
+		},
+		{
+			name:            "Summary-only with gateway",
+			aggregates:      []dto.Aggregate{{Prefix: "10.0.0.0/16", Gateway: "192.168.0.1", SummaryOnly: true}},
+			path:            createAggregatedPath("10.0.1.0", 65001),
+			expectedEvents:  []events.Type{events.Added, events.Rejected},
+			expectedReasons: []string{events.ReasonContributing, events.ReasonSummarized},
+			aggregated:      true,
+			gateway:         "192.168.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			injector := &mockEvpnInjector{}
+			var aggregate *dto.Evpn5Route
+			injector.On("AddType5Route", withPrefix("10.0.0.0")).Return(uuid.New(), nil).Run(func(args mock.Arguments) {
+				route := args.Get(0).(dto.Evpn5Route)
+				aggregate = &route
+			})
+			injector.On("AddType5Route", mock.Anything).Return(uuid.New(), nil)
+			c := newTestControllers(
+				injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf}, aggregateExtensions(tt.aggregates...),
+			)
+
+			require.NoError(t, c.vpn.HandleUpdate(context.Background(), tt.path))
+
+			assert.Equal(t, tt.expectedEvents, c.publisher.types())
+			assert.Equal(t, tt.expectedReasons, c.publisher.reasons())
+			assert.Len(t, c.vpn.ListRedistributed(), tt.redistributed)
+			assert.Equal(t, tt.redistributed == 1, c.vpn.Audit(tt.path).Expected)
+			if !tt.aggregated {
+				assert.Nil(t, aggregate)
+				assert.Empty(t, c.aggregates.ListRedistributed())
+				return
+			}
+			require.NotNil(t, aggregate)
+			assert.Equal(t, uint32(16), aggregate.Prefixlen)
+			assert.Equal(t, tt.gateway, aggregate.Gateway)
+			assert.Equal(t, tt.asSet, asSetOf(t, *aggregate))
+			listed := c.aggregates.ListRedistributed()
+			require.Len(t, listed, 1)
+			assert.Equal(t, AggregateSource, listed[0].Source)
+			assert.Equal(t, map[string]int{"vrf_10": 1}, c.aggregates.RedistributedRoutes())
+		})
+	}
+}
+
+func TestAggregates_Contributing(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+	injector.On("AddType5Route", withPrefix("10.0.1.0")).Return(uuid.New(), nil)
+	injector.On("AddType5Route", withPrefix("10.0.2.0")).Return(uuid.New(), nil)
+	injector.On("AddType5Route", withPrefix("10.0.0.0")).Return(first, nil).Once()
+	c := newTestControllers(
+		injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf},
+		aggregateExtensions(dto.Aggregate{Prefix: "10.0.0.0/16", AsSet: true}),
+	)
+	require.NoError(t, c.vpn.HandleUpdate(context.Background(), createAggregatedPath("10.0.1.0", 65001)))
+
+	// another contributing AS, the aggregate is replaced in place
+	injector.On("AddType5Route", withPrefix("10.0.0.0")).Return(second, nil).Once()
+	require.NoError(t, c.vpn.HandleUpdate(context.Background(), createAggregatedPath("10.0.2.0", 65002)))
+	assert.Equal(t, []uint32{65001, 65002}, asSetOf(t, injector.Calls[3].Arguments.Get(0).(dto.Evpn5Route)))
+	injector.AssertNotCalled(t, "DelRoute", first)
+
+	injector.On("DelRoute", mock.Anything).Return(nil)
+	injector.On("AddType5Route", withPrefix("10.0.0.0")).Return(third, nil).Once()
+	require.NoError(t, c.vpn.HandleWithdraw(context.Background(), createAggregatedPath("10.0.1.0", 65001)))
+	assert.Equal(t, []uint32{65002}, asSetOf(t, injector.Calls[4].Arguments.Get(0).(dto.Evpn5Route)))
+	assert.Equal(t, third, c.aggregates.ListRedistributed()[0].Uuid)
+	require.NoError(t, c.vpn.HandleWithdraw(context.Background(), createAggregatedPath("10.0.2.0", 65002)))
+
+	injector.AssertCalled(t, "DelRoute", third)
+	assert.Empty(t, c.aggregates.ListRedistributed())
+	last := c.publisher.events[len(c.publisher.events)-2] // followed by the withdrawal of the contributing route
+	assert.Equal(t, events.Withdrawn, last.Type)
+	assert.Equal(t, AggregateSource, last.Source)
+	assert.Equal(t, events.ReasonNoContributors, last.Reason)
+}
+
+func TestAggregates_ReloadConfig(t *testing.T) {
+	tests := []struct {
+		name            string
+		before          []dto.Aggregate
+		after           []dto.Aggregate
+		expectedEvents  []events.Type // of the reload and of the route received after it
+		expectedReasons []string
+		redistributed   int // received routes
+		aggregated      bool
+	}{
+		{
+			name:            "Aggregate removed",
+			before:          []dto.Aggregate{{Prefix: "10.0.0.0/16"}},
+			expectedEvents:  []events.Type{events.Withdrawn, events.Added},
+			expectedReasons: []string{events.ReasonAggregateRemoved, events.ReasonSourceAdvertised},
+			redistributed:   2,
+		},
+		{
+			name:           "Summary-only aggregate removed",
+			before:         []dto.Aggregate{{Prefix: "10.0.0.0/16", SummaryOnly: true}},
+			expectedEvents: []events.Type{events.Added, events.Withdrawn, events.Added},
+			expectedReasons: []string{
+				events.ReasonUnsummarized, events.ReasonAggregateRemoved, events.ReasonSourceAdvertised,
+			},
+			redistributed: 2,
+		},
+		{
+			name:            "Summary-only aggregate added",
+			after:           []dto.Aggregate{{Prefix: "10.0.0.0/16", SummaryOnly: true}},
+			expectedEvents:  []events.Type{events.Added, events.Withdrawn, events.Rejected},
+			expectedReasons: []string{events.ReasonContributing, events.ReasonSummarized, events.ReasonSummarized},
+			aggregated:      true,
+		},
+		{
+			name:            "Aggregate no longer summary-only",
+			before:          []dto.Aggregate{{Prefix: "10.0.0.0/16", SummaryOnly: true}},
+			after:           []dto.Aggregate{{Prefix: "10.0.0.0/16"}},
+			expectedEvents:  []events.Type{events.Added, events.Added},
+			expectedReasons: []string{events.ReasonUnsummarized, events.ReasonSourceAdvertised},
+			redistributed:   2,
+			aggregated:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			injector := &mockEvpnInjector{}
+			injector.On("AddType5Route", mock.Anything).Return(uuid.New(), nil)
+			injector.On("DelRoute", mock.Anything).Return(nil)
+			c := newTestControllers(
+				injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf}, aggregateExtensions(tt.before...),
+			)
+			require.NoError(t, c.vpn.HandleUpdate(context.Background(), createAggregatedPath("10.0.1.0", 65001)))
+			c.publisher.events = nil
+
+			require.NoError(t, c.aggregates.ReloadConfig(dto.VrfDiff{Extensions: aggregateExtensions(tt.after...)}))
+			require.NoError(t, c.vpn.HandleUpdate(context.Background(), createAggregatedPath("10.0.2.0", 65002)))
+
+			assert.Equal(t, tt.expectedEvents, c.publisher.types())
+			assert.Equal(t, tt.expectedReasons, c.publisher.reasons())
+			assert.Len(t, c.vpn.ListRedistributed(), tt.redistributed)
+			assert.Equal(t, tt.aggregated, len(c.aggregates.ListRedistributed()) == 1)
+			if !tt.aggregated {
+				assert.Empty(t, c.aggregates.contributions) // the routes of VRFs without aggregates are not counted
+			}
+		})
+	}
+}
+
+func TestAggregates_UnsummarizedWithdrawn(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	aggregateUuid, routeUuid := uuid.New(), uuid.New()
+	injector.On("AddType5Route", withPrefix("10.0.0.0")).Return(aggregateUuid, nil).Once()
+	c := newTestControllers(
+		injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf},
+		aggregateExtensions(dto.Aggregate{Prefix: "10.0.0.0/16", SummaryOnly: true}),
+	)
+	path := createAggregatedPath("10.0.1.0", 65001)
+	require.NoError(t, c.vpn.HandleUpdate(context.Background(), path))
+
+	// the source withdraws the route while it is re-injected on its own
+	injector.On("AddType5Route", withPrefix("10.0.1.0")).Return(routeUuid, nil).Once().Run(func(mock.Arguments) {
+		require.NoError(t, c.vpn.HandleWithdraw(context.Background(), path))
+	})
+	injector.On("DelRoute", aggregateUuid).Return(nil).Once()
+	injector.On("DelRoute", routeUuid).Return(nil).Once()
+	require.NoError(t, c.aggregates.ReloadConfig(dto.VrfDiff{Extensions: map[string]dto.VrfExtensions{}}))
+
+	assert.Empty(t, c.vpn.ListRedistributed())
+	assert.Empty(t, c.aggregates.ListRedistributed())
+	assert.Equal(t, 0, c.vpn.suppressed.Size())
+	injector.AssertExpectations(t)
+}
+
+// ASNs of the AS_SET of the aggregate, nil if it has none
+func asSetOf(t *testing.T, route dto.Evpn5Route) []uint32 {
+	for _, attr := range route.PathAttrs {
+		var asPath api.AsPathAttribute
+		if attr.UnmarshalTo(&asPath) == nil {
+			require.Len(t, asPath.Segments, 1)
+			assert.EqualValues(t, asSet, asPath.Segments[0].Type)
+			return asPath.Segments[0].Numbers
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/utils"
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+// Prefixes the neighbors may announce, the entries are validated by the allowlist source
+type prefixAllowlist struct {
+	loaded  bool // false blocks every received route until the first allowlist arrives
+	entries []allowlistEntry
+}
+
+type allowlistEntry struct {
+	neighbor netip.Prefix
+	vrf      string // empty means any VRF
+	prefixes []netip.Prefix
+}
+
+func newPrefixAllowlist(entries []dto.AllowlistEntry) *prefixAllowlist {
+	result := &prefixAllowlist{loaded: true, entries: make([]allowlistEntry, 0, len(entries))}
+	for _, entry := range entries {
+		neighbor, err := utils.NeighborPrefix(entry.Neighbor)
+		if err != nil {
+			continue
+		}
+		compiled := allowlistEntry{neighbor: neighbor, vrf: entry.Vrf}
+		for _, prefix := range entry.Prefixes {
+			if parsed, err := utils.ParsePrefix(prefix); err == nil {
+				compiled.prefixes = append(compiled.prefixes, parsed)
+			}
+		}
+		result.entries = append(result.entries, compiled)
+	}
+	return result
+}
+
+// Reason to block the route of the neighbor in the VRF, empty if an entry of the neighbor covers the route
+func (l *prefixAllowlist) check(vrfName, neighbor string, route vpnRoute) string {
+	if !l.loaded {
+		return events.ReasonNotAllowlisted + ": allowlist is not loaded yet"
+	}
+	neighborAddr, err := netip.ParseAddr(neighbor)
+	if err != nil {
+		return fmt.Sprintf("%s: invalid neighbor address %s", events.ReasonNotAllowlisted, neighbor)
+	}
+	prefix, err := route.netipPrefix()
+	if err != nil {
+		return fmt.Sprintf("%s: invalid prefix %s/%d", events.ReasonNotAllowlisted, route.Prefix, route.Prefixlen)
+	}
+	found := false
+	for _, entry := range l.entries {
+		if entry.vrf != "" && entry.vrf != vrfName || !entry.neighbor.Contains(neighborAddr) {
+			continue
+		}
+		found = true
+		for _, allowed := range entry.prefixes {
+			if allowed.Bits() <= prefix.Bits() && allowed.Contains(prefix.Addr()) {
+				return ""
+			}
+		}
+	}
+	if !found {
+		return fmt.Sprintf("%s: no entry for neighbor %s", events.ReasonNotAllowlisted, neighbor)
+	}
+	return fmt.Sprintf("%s: %s is not allowed for neighbor %s", events.ReasonNotAllowlisted, prefix, neighbor)
+}
+
+// Requires every received route to be covered by the prefix allowlist, all of them are blocked until it is set
+func (c *VPNv4Controller) EnableAllowlist() {
+	c.allowlist.CompareAndSwap(nil, &prefixAllowlist{})
+}
+
+// Reason to block the route of the neighbor, empty if the allowlist is disabled or allows the route.
+// Locally originated routes have no neighbor and are never blocked
+func (c *VPNv4Controller) unauthorized(vrf dto.Vrf, route vpnRoute, neighbor string) string {
+	allowlist := c.allowlist.Load()
+	if allowlist == nil || neighbor == "" {
+		return ""
+	}
+	return allowlist.check(vrf.Name, neighbor, route)
+}
+
+// Rejects the path the allowlist does not cover and keeps it among the blocked routes
+func (c *VPNv4Controller) rejectUnauthorized(vrf dto.Vrf, route vpnRoute, path *api.Path, reason string) error {
+	c.storeBlocked(vrf.Name, route, path.GetNeighborIp(), reason)
+	return c.rejectPath(vrf, route, path, reason)
+}
+
+func (c *VPNv4Controller) storeBlocked(vrfName string, route vpnRoute, neighbor, reason string) {
+	blocked := dto.BlockedRoute{
+		Vrf:      vrfName,
+		Prefix:   fmt.Sprintf("%s/%d", route.Prefix, route.Prefixlen),
+		Source:   route.String(),
+		Neighbor: neighbor,
+		Reason:   reason,
+		Since:    time.Now(),
+	}
+	if prev, ok := c.blocked.Load(route); ok && prev.Neighbor == neighbor && prev.Reason == reason {
+		blocked.Since = prev.Since
+	}
+	c.blocked.Store(route, blocked)
+}
+
+// Replaces the prefix allowlist. The redistributed routes it does not cover anymore are withdrawn,
+// while the sources of the blocked routes it covers now are returned to be redistributed again
+func (c *VPNv4Controller) SetAllowlist(entries []dto.AllowlistEntry) (unblocked []string, err error) {
+	c.allowlist.Store(newPrefixAllowlist(entries))
+	err = c.withdrawRejected(func(vrf dto.Vrf, route vpnRoute, info redistributionInfo) string {
+		reason := c.unauthorized(vrf, route, info.neighbor)
+		if reason != "" {
+			c.storeBlocked(vrf.Name, route, info.neighbor, reason)
+		}
+		return reason
+	})
+	unblocked = []string{}
+	c.blocked.Range(func(route vpnRoute, blocked dto.BlockedRoute) bool {
+		vrf, ok := c.rdVrfMap.Load(route.Rd)
+		if !ok {
+			c.blocked.Delete(route)
+			return true
+		}
+		reason := c.unauthorized(vrf, route, blocked.Neighbor)
+		if reason == "" {
+			c.blocked.Delete(route)
+			unblocked = append(unblocked, blocked.Source)
+		} else if reason != blocked.Reason {
+			c.storeBlocked(vrf.Name, route, blocked.Neighbor, reason)
+		}
+		return true
+	})
+	sort.Strings(unblocked)
+	return unblocked, err
+}
+
+// Received routes the allowlist blocks sorted by VRF, prefix and neighbor
+func (c *VPNv4Controller) ListBlocked() []dto.BlockedRoute {
+	result := []dto.BlockedRoute{}
+	c.blocked.Range(func(_ vpnRoute, blocked dto.BlockedRoute) bool {
+		result = append(result, blocked)
+		return true
+	})
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Vrf != result[j].Vrf {
+			return result[i].Vrf < result[j].Vrf
+		}
+		if result[i].Prefix != result[j].Prefix {
+			return result[i].Prefix < result[j].Prefix
+		}
+		return result[i].Neighbor < result[j].Neighbor
+	})
+	return result
+}
@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var testAllowlist = []dto.AllowlistEntry{
+	{Neighbor: "192.168.0.10", Prefixes: []string{"10.0.0.0/16"}},
+	{Neighbor: "192.168.1.0/24", Vrf: "vrf_20", Prefixes: []string{"10.0.1.0/24"}},
+}
+
+func TestPrefixAllowlist_Check(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist []dto.AllowlistEntry
+		vrf       string
+		neighbor  string
+		prefix    string
+		prefixlen uint32
+		expected  string
+	}{
+		{
+			name:      "Prefix allowed for the neighbor",
+			allowlist: testAllowlist,
+			vrf:       "vrf_10",
+			neighbor:  "192.168.0.10",
+			prefix:    "10.0.1.0",
+			prefixlen: 24,
+		},
+		{
+			name:      "Prefix allowed for the neighbor subnet in the VRF",
+			allowlist: testAllowlist,
+			vrf:       "vrf_20",
+			neighbor:  "192.168.1.5",
+			prefix:    "10.0.1.128",
+			prefixlen: 25,
+		},
+		{
+			name:      "Prefix outside the allowed ones",
+			allowlist: testAllowlist,
+			vrf:       "vrf_10",
+			neighbor:  "192.168.0.10",
+			prefix:    "10.1.0.0",
+			prefixlen: 24,
+			expected:  "prefix not allowed by the allowlist: 10.1.0.0/24 is not allowed for neighbor 192.168.0.10",
+		},
+		{
+			name:      "Prefix covering the allowed ones",
+			allowlist: testAllowlist,
+			vrf:       "vrf_10",
+			neighbor:  "192.168.0.10",
+			prefix:    "10.0.0.0",
+			prefixlen: 8,
+			expected:  "prefix not allowed by the allowlist: 10.0.0.0/8 is not allowed for neighbor 192.168.0.10",
+		},
+		{
+			name:      "Entry of another VRF",
+			allowlist: testAllowlist,
+			vrf:       "vrf_10",
+			neighbor:  "192.168.1.5",
+			prefix:    "10.0.1.0",
+			prefixlen: 24,
+			expected:  "prefix not allowed by the allowlist: no entry for neighbor 192.168.1.5",
+		},
+		{
+			name:      "Allowlist not loaded",
+			vrf:       "vrf_10",
+			neighbor:  "192.168.0.10",
+			prefix:    "10.0.1.0",
+			prefixlen: 24,
+			expected:  "prefix not allowed by the allowlist: allowlist is not loaded yet",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowlist := &prefixAllowlist{}
+			if tt.allowlist != nil {
+				allowlist = newPrefixAllowlist(tt.allowlist)
+			}
+			route := vpnRoute{Rd: "65000:100", Prefix: tt.prefix, Prefixlen: tt.prefixlen}
+
+			assert.Equal(t, tt.expected, allowlist.check(tt.vrf, tt.neighbor, route))
+		})
+	}
+}
+
+func TestAllowlist_HandleUpdate(t *testing.T) {
+	tests := []struct {
+		name          string
+		enabled       bool
+		allowlist     []dto.AllowlistEntry // nil if not loaded
+		path          *api.Path
+		expectedEvent events.Type
+		redistributed int
+	}{
+		{
+			name:          "Allowed",
+			enabled:       true,
+			allowlist:     testAllowlist,
+			path:          createNeighborPath("10.0.1.0", "192.168.0.10"),
+			expectedEvent: events.Added,
+			redistributed: 1,
+		},
+		{
+			name:          "Not allowed",
+			enabled:       true,
+			allowlist:     testAllowlist,
+			path:          createNeighborPath("10.1.0.0", "192.168.0.10"),
+			expectedEvent: events.Rejected,
+		},
+		{
+			name:          "Allowlist not loaded",
+			enabled:       true,
+			path:          createNeighborPath("10.0.1.0", "192.168.0.10"),
+			expectedEvent: events.Rejected,
+		},
+		{
+			name:          "Allowlist disabled",
+			path:          createNeighborPath("10.1.0.0", "192.168.0.10"),
+			expectedEvent: events.Added,
+			redistributed: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			injector := &mockEvpnInjector{}
+			injector.On("AddType5Route", mock.Anything).Return(uuid.New(), nil)
+			c := newTestControllers(injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf}, nil)
+			if tt.enabled {
+				c.vpn.EnableAllowlist()
+			}
+			if tt.allowlist != nil {
+				_, err := c.vpn.SetAllowlist(tt.allowlist)
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, c.vpn.HandleUpdate(context.Background(), tt.path))
+
+			assert.Equal(t, []events.Type{tt.expectedEvent}, c.publisher.types())
+			assert.Len(t, c.vpn.ListRedistributed(), tt.redistributed)
+			assert.Equal(t, tt.redistributed == 1, c.vpn.Audit(tt.path).Expected)
+			if tt.redistributed == 1 {
+				assert.Empty(t, c.vpn.ListBlocked())
+				return
+			}
+			listed := c.vpn.ListBlocked()
+			require.Len(t, listed, 1)
+			assert.Equal(t, "vrf_10", listed[0].Vrf)
+			assert.Equal(t, "192.168.0.10", listed[0].Neighbor)
+			assert.Equal(t, c.publisher.events[0].Reason, listed[0].Reason)
+			explanation := c.vpn.Explain(tt.path, dto.NewVrf(orchestratedVrf, dto.VrfExtensions{}))
+			assert.Equal(t, stepAllowlist, explanation.Steps[len(explanation.Steps)-1].Name)
+			assert.False(t, explanation.Redistributed)
+
+			// withdrawn routes are not blocked anymore
+			require.NoError(t, c.vpn.HandleWithdraw(context.Background(), tt.path))
+			assert.Empty(t, c.vpn.ListBlocked())
+		})
+	}
+}
+
+func TestAllowlist_SetAllowlist(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	injector.On("AddType5Route", withPrefix("10.0.1.0")).Return(uuid.New(), nil).Once()
+	c := newTestControllers(injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf}, nil)
+	c.vpn.EnableAllowlist()
+	require.NoError(t, c.vpn.HandleUpdate(context.Background(), createNeighborPath("10.0.1.0", "192.168.0.10")))
+	require.NoError(t, c.vpn.HandleUpdate(context.Background(), createNeighborPath("10.1.0.0", "192.168.0.10")))
+	require.Len(t, c.vpn.ListBlocked(), 2)
+
+	// the allowed routes blocked until the allowlist is loaded are let through once received again
+	unblocked, err := c.vpn.SetAllowlist(testAllowlist)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"65000:100:10.0.1.0/24"}, unblocked)
+	require.NoError(t, c.vpn.HandleUpdate(context.Background(), createNeighborPath("10.0.1.0", "192.168.0.10")))
+
+	assert.Len(t, c.vpn.ListRedistributed(), 1)
+	blocked := c.vpn.ListBlocked()
+	require.Len(t, blocked, 1)
+	assert.Equal(t, "10.1.0.0/24", blocked[0].Prefix)
+	injector.AssertExpectations(t)
+}
+
+func TestAllowlist_SetAllowlistWithdraws(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	evpnUuid := uuid.New()
+	injector.On("AddType5Route", withPrefix("10.0.1.0")).Return(evpnUuid, nil).Once()
+	injector.On("AddType5Route", withPrefix("10.0.2.0")).Return(uuid.New(), nil).Once()
+	injector.On("DelRoute", evpnUuid).Return(nil).Once()
+	c := newTestControllers(injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf}, nil)
+	c.vpn.EnableAllowlist()
+	ctx := context.Background()
+	_, err := c.vpn.SetAllowlist(testAllowlist)
+	require.NoError(t, err)
+
+	require.NoError(t, c.vpn.HandleUpdate(ctx, createNeighborPath("10.0.1.0", "192.168.0.10")))
+	require.NoError(t, c.vpn.HandleUpdate(ctx, createNeighborPath("10.0.2.0", "192.168.0.10")))
+	unblocked, err := c.vpn.SetAllowlist([]dto.AllowlistEntry{
+		{Neighbor: "192.168.0.10", Prefixes: []string{"10.0.2.0/24"}},
+	})
+	require.NoError(t, err)
+
+	assert.Empty(t, unblocked)
+	listed := c.vpn.ListRedistributed()
+	require.Len(t, listed, 1)
+	assert.Equal(t, "65000:100:10.0.2.0/24", listed[0].Source)
+	blocked := c.vpn.ListBlocked()
+	require.Len(t, blocked, 1)
+	assert.Equal(t, "10.0.1.0/24", blocked[0].Prefix)
+	last := c.publisher.events[len(c.publisher.events)-1]
+	assert.Equal(t, events.Withdrawn, last.Type)
+	assert.Equal(t, "192.168.0.10", last.Neighbor)
+	injector.AssertExpectations(t)
+}
@@ -1,16 +1,26 @@
 package controller
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/logging"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/amyasnikov/berg/internal/tracing"
 	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/google/uuid"
 	multierror "github.com/hashicorp/go-multierror"
 	api "github.com/osrg/gobgp/v3/api"
 	"github.com/osrg/gobgp/v3/pkg/config/oc"
 	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
 // Handles updates and withdrawals of IPv4 routes
@@ -18,88 +28,501 @@ type VPNv4Controller struct {
 	evpnInjector      evpnInjector
 	rdVrfMap          *xsync.Map[string, dto.Vrf]
 	redistributedEvpn *xsync.Map[vpnRoute, uuid.UUID]
+	routeInfo         *xsync.Map[vpnRoute, redistributionInfo]
 	routeGen          *evpnRouteGen
+	withdrawHold      *withdrawHold
+	mobility          *mobilityTracker
+	orchestrated      *OrchestratedRoutes // nil if there are no leases to compete with
+	aggregates        *Aggregates         // nil if there are no aggregates to suppress routes
+	leaks             *Leaks              // nil if the received routes are not leaked
+	suppressed        *xsync.Map[vpnRoute, suppressedRoute]
+	limits            *prefixLimits
+	allowlist         atomic.Pointer[prefixAllowlist] // nil if received routes need no authorization
+	blocked           *xsync.Map[vpnRoute, dto.BlockedRoute]
+	events            events.Publisher
+	logger            *logrus.Logger
 }
 
-func NewVPNv4Controller(injector evpnInjector, vrfCfg []oc.VrfConfig) *VPNv4Controller {
+func NewVPNv4Controller(
+	injector evpnInjector, vrfCfg []oc.VrfConfig, vrfExt map[string]dto.VrfExtensions,
+) *VPNv4Controller {
 	return &VPNv4Controller{
 		evpnInjector:      injector,
-		rdVrfMap:          makeRdVrfMap(vrfCfg),
+		rdVrfMap:          makeRdVrfMap(vrfCfg, vrfExt),
 		redistributedEvpn: xsync.NewMap[vpnRoute, uuid.UUID](),
+		routeInfo:         xsync.NewMap[vpnRoute, redistributionInfo](),
+		suppressed:        xsync.NewMap[vpnRoute, suppressedRoute](),
+		limits:            newPrefixLimits(),
+		blocked:           xsync.NewMap[vpnRoute, dto.BlockedRoute](),
 		routeGen:          newEvpnRouteGen(),
+		withdrawHold:      newWithdrawHold(),
+		mobility:          newMobilityTracker(),
+		events:            events.Discard{},
+		logger:            logging.Discard(),
 	}
 }
 
-func (c *VPNv4Controller) HandleUpdate(path *api.Path) error {
+// Sets the receiver of the redistribution decisions
+func (c *VPNv4Controller) SetEventPublisher(publisher events.Publisher) {
+	c.events = publisher
+}
+
+func (c *VPNv4Controller) SetLogger(logger *logrus.Logger) {
+	c.logger = logger
+}
+
+func (c *VPNv4Controller) HandleUpdate(ctx context.Context, path *api.Path) (err error) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "VPNv4Controller.HandleUpdate")
+	defer func() { tracing.End(span, err) }()
 	route, err := vpnFromApi(path.GetNlri())
 	if err != nil {
 		return err
 	}
+	span.SetAttributes(tracing.AttrPrefix.String(route.String()))
 	vrf, ok := c.rdVrfMap.Load(route.Rd)
 	if !ok {
 		return nil
 	}
-	evpnRoute, err := c.routeGen.GenRoute(route, vrf, path.GetPattrs())
-	if err != nil {
+	span.SetAttributes(tracing.AttrVrf.String(vrf.Name))
+	evpnRoute, redistribute, err := c.decide(ctx, vrf, route, path)
+	if !redistribute {
 		return err
 	}
+	defer observeHandling(vrf.Name, metrics.DirectionToEvpn, metrics.OperationInject, start, &err)
+	_, injectSpan := tracing.Tracer().Start(ctx, "EvpnInjector.AddType5Route")
 	evpnUuid, err := c.evpnInjector.AddType5Route(evpnRoute)
+	tracing.End(injectSpan, err)
 	if err != nil {
+		c.rejectInjection(vrf.Name, route, evpnRoute, path, err)
 		return err
 	}
-	if prevUuid, _ := c.redistributedEvpn.Load(route); prevUuid != uuid.Nil {
+	c.injected(vrf.Name, route, evpnRoute, evpnUuid, path)
+	return nil
+}
+
+// Decides whether the received route is redistributed and generates its EVPN route if it is.
+// The rejections are published here, err is set if the route cannot be handled
+func (c *VPNv4Controller) decide(
+	ctx context.Context, vrf dto.Vrf, route vpnRoute, path *api.Path,
+) (evpnRoute dto.Evpn5Route, redistribute bool, err error) {
+	if c.overridden(vrf, route) {
+		c.publish(vpnEvent(events.Rejected, vrf.Name, route, "", events.ReasonOrchestrated), path)
+		return evpnRoute, false, nil
+	}
+	if reason := c.unauthorized(vrf, route, path.GetNeighborIp()); reason != "" {
+		return evpnRoute, false, c.rejectUnauthorized(vrf, route, path, reason)
+	}
+	c.blocked.Delete(route)
+	if reason := pathSpoofed(vrf, route, path); reason != "" {
+		return evpnRoute, false, c.rejectSpoofed(vrf, route, path, reason)
+	}
+	_, genSpan := tracing.Tracer().Start(ctx, "evpnRouteGen.GenRoute")
+	evpnRoute, err = c.genRoute(route, vrf, path.GetPattrs())
+	tracing.End(genSpan, err)
+	if err != nil {
+		observeRoute(vrf.Name, metrics.DirectionToEvpn, metrics.OperationInject, err)
+		c.publish(vpnEvent(events.Rejected, vrf.Name, route, "", err.Error()), path)
+		return evpnRoute, false, err
+	}
+	if c.summarized(vrf, route) {
+		withdrawn, err := c.suppress(vrf.Name, route, suppressedRoute{evpnRoute, path.GetNeighborIp()})
+		if !withdrawn {
+			c.publish(vpnEvent(events.Rejected, vrf.Name, route, "", events.ReasonSummarized), path)
+		}
+		return evpnRoute, false, err
+	}
+	if _, loaded := c.suppressed.LoadAndDelete(route); loaded {
+		c.routeChanged(route)
+	}
+	return evpnRoute, c.admit(vrf, route, path.GetNeighborIp()), nil
+}
+
+// Records the EVPN route injected for the received one, withdrawing the routes it replaces
+func (c *VPNv4Controller) injected(
+	vrfName string, route vpnRoute, evpnRoute dto.Evpn5Route, evpnUuid uuid.UUID, path *api.Path,
+) {
+	heldRoute, held := c.withdrawHold.Cancel(route.prefixKey())
+	if held {
+		metrics.WithdrawHold.WithLabelValues(vrfName, "saved").Inc()
+	}
+	replaced := held
+	if held && heldRoute != route {
+		if heldUuid, loaded := c.redistributedEvpn.LoadAndDelete(heldRoute); loaded {
+			c.forgetRoute(heldRoute)
+			c.evpnInjector.DelRoute(heldUuid) // implicit withdraw
+		}
+	}
+	if prevUuid, loaded := c.redistributedEvpn.LoadAndStore(route, evpnUuid); loaded {
+		replaced = true
 		c.evpnInjector.DelRoute(prevUuid) // implicit withdraw
 	}
-	c.redistributedEvpn.Store(route, evpnUuid)
-	return nil
+	c.recordRoute(route, evpnRoute, path.GetNeighborIp())
+	eventType, reason := injectedEvent(replaced)
+	c.publish(vpnEvent(eventType, vrfName, route, generatedEvpn(evpnRoute), reason), path)
+}
+
+// Publishes that the EVPN route of the received one could not be injected
+func (c *VPNv4Controller) rejectInjection(
+	vrfName string, route vpnRoute, evpnRoute dto.Evpn5Route, path *api.Path, err error,
+) {
+	c.publish(vpnEvent(events.Rejected, vrfName, route, generatedEvpn(evpnRoute), err.Error()), path)
+	c.uncount(route)
+}
+
+func (c *VPNv4Controller) publish(event events.Event, path *api.Path) {
+	event.Neighbor = path.GetNeighborIp()
+	c.emit(event)
+}
+
+func (c *VPNv4Controller) emit(event events.Event) {
+	logEvent(c.logger, event)
+	c.events.Publish(event)
+}
+
+func (c *VPNv4Controller) genRoute(route vpnRoute, vrf dto.Vrf, pattrs []*anypb.Any) (dto.Evpn5Route, error) {
+	evpnRoute, err := c.routeGen.GenRoute(route, vrf, pattrs)
+	if err != nil || vrf.Mobility == dto.MobilityNone {
+		return evpnRoute, err
+	}
+	seq := c.mobility.Observe(route.prefixKey(), evpnRoute.Gateway, vrf.MobilityResetTime)
+	applyMobility(&evpnRoute, vrf.Mobility, seq)
+	return evpnRoute, nil
 }
 
-func (c *VPNv4Controller) HandleWithdraw(path *api.Path) error {
+// Redistributes paths in bulk, e.g. the routes collected during startup hold-down
+func (c *VPNv4Controller) HandleUpdates(paths []*api.Path) (merr error) {
+	ctx, span := tracing.Tracer().Start(context.Background(), "VPNv4Controller.HandleUpdates")
+	defer func() { tracing.End(span, merr) }()
+	routes := make([]vpnRoute, 0, len(paths))
+	sources := make([]*api.Path, 0, len(paths))
+	evpnRoutes := make([]dto.Evpn5Route, 0, len(paths))
+	vrfNames := make([]string, 0, len(paths))
+	for _, path := range paths {
+		route, err := vpnFromApi(path.GetNlri())
+		if err != nil {
+			merr = multierror.Append(merr, err)
+			continue
+		}
+		vrf, ok := c.rdVrfMap.Load(route.Rd)
+		if !ok {
+			continue
+		}
+		evpnRoute, redistribute, err := c.decide(ctx, vrf, route, path)
+		if err != nil {
+			merr = multierror.Append(merr, err)
+		}
+		if !redistribute {
+			continue
+		}
+		routes = append(routes, route)
+		sources = append(sources, path)
+		evpnRoutes = append(evpnRoutes, evpnRoute)
+		vrfNames = append(vrfNames, vrf.Name)
+	}
+	if len(evpnRoutes) == 0 {
+		return merr
+	}
+	evpnUuids, err := c.evpnInjector.AddType5Routes(evpnRoutes)
+	if err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	for i, evpnUuid := range evpnUuids {
+		if evpnUuid == uuid.Nil {
+			observeRoute(vrfNames[i], metrics.DirectionToEvpn, metrics.OperationInject, errNotInjected)
+			c.rejectInjection(vrfNames[i], routes[i], evpnRoutes[i], sources[i], errNotInjected)
+			continue
+		}
+		observeRoute(vrfNames[i], metrics.DirectionToEvpn, metrics.OperationInject, nil)
+		c.injected(vrfNames[i], routes[i], evpnRoutes[i], evpnUuid, sources[i])
+	}
+	return merr
+}
+
+func (c *VPNv4Controller) HandleWithdraw(ctx context.Context, path *api.Path) (err error) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "VPNv4Controller.HandleWithdraw")
+	defer func() { tracing.End(span, err) }()
 	route, err := vpnFromApi(path.GetNlri())
 	if err != nil {
 		return err
 	}
+	span.SetAttributes(tracing.AttrPrefix.String(route.String()))
+	if _, loaded := c.suppressed.LoadAndDelete(route); loaded {
+		c.routeChanged(route)
+	}
+	c.blocked.Delete(route)
 	evpnUuid, _ := c.redistributedEvpn.Load(route)
-	if evpnUuid != uuid.Nil {
-		c.redistributedEvpn.Delete(route)
-		if err = c.evpnInjector.DelRoute(evpnUuid); err != nil {
-			return err
+	if evpnUuid == uuid.Nil {
+		return nil
+	}
+	vrf, ok := c.rdVrfMap.Load(route.Rd)
+	span.SetAttributes(tracing.AttrVrf.String(vrf.Name))
+	if ok && vrf.WithdrawHoldTime > 0 {
+		span.SetAttributes(tracing.AttrHeld.Bool(true))
+		c.withdrawHold.Schedule(route, evpnUuid, vrf.WithdrawHoldTime, c.withdrawHeld)
+		metrics.WithdrawHold.WithLabelValues(vrf.Name, "delayed").Inc()
+		metrics.ObservePath(vrf.Name, metrics.DirectionToEvpn, start)
+		return nil
+	}
+	defer observeHandling(vrf.Name, metrics.DirectionToEvpn, metrics.OperationWithdraw, start, &err)
+	c.redistributedEvpn.Delete(route)
+	info := c.forgetRoute(route)
+	c.publish(vpnEvent(events.Withdrawn, vrf.Name, route, info.generated, events.ReasonSourceWithdrawn), path)
+	_, injectSpan := tracing.Tracer().Start(ctx, "EvpnInjector.DelRoute")
+	err = c.evpnInjector.DelRoute(evpnUuid)
+	tracing.End(injectSpan, err)
+	return err
+}
+
+// Withdraws the route once its hold time is over, unless it was replaced meanwhile
+func (c *VPNv4Controller) withdrawHeld(route vpnRoute, evpnUuid uuid.UUID) {
+	var deleted bool
+	c.redistributedEvpn.Compute(route, func(cur uuid.UUID, loaded bool) (uuid.UUID, xsync.ComputeOp) {
+		if loaded && cur == evpnUuid {
+			deleted = true
+			return cur, xsync.DeleteOp
 		}
+		return cur, xsync.CancelOp
+	})
+	if deleted {
+		vrfName := c.vrfName(route.Rd)
+		metrics.WithdrawHold.WithLabelValues(vrfName, "withdrawn").Inc()
+		info := c.forgetRoute(route)
+		c.emit(vpnEvent(events.Withdrawn, vrfName, route, info.generated, events.ReasonHoldExpired))
+		err := c.evpnInjector.DelRoute(evpnUuid)
+		observeRoute(vrfName, metrics.DirectionToEvpn, metrics.OperationWithdraw, err)
 	}
-	return nil
+}
+
+// Withdraws the routes redistributed from the source which is gone from the RIB without a withdrawal.
+// Routes on withdraw hold are left to expire
+func (c *VPNv4Controller) WithdrawSource(source string) (withdrawn bool, merr error) {
+	c.redistributedEvpn.Range(func(route vpnRoute, evpnUuid uuid.UUID) bool {
+		if route.String() != source || c.withdrawHold.Pending(route.prefixKey()) {
+			return true
+		}
+		if _, loaded := c.redistributedEvpn.LoadAndDelete(route); !loaded {
+			return true
+		}
+		withdrawn = true
+		vrfName := c.vrfName(route.Rd)
+		info := c.forgetRoute(route)
+		c.emit(vpnEvent(events.Withdrawn, vrfName, route, info.generated, events.ReasonSourceLost))
+		err := c.evpnInjector.DelRoute(evpnUuid)
+		observeRoute(vrfName, metrics.DirectionToEvpn, metrics.OperationWithdraw, err)
+		if err != nil {
+			merr = multierror.Append(merr, err)
+		}
+		return true
+	})
+	return withdrawn, merr
+}
+
+func (c *VPNv4Controller) recordRoute(route vpnRoute, generated dto.Evpn5Route, neighbor string) {
+	now := time.Now()
+	c.routeInfo.Compute(route, func(info redistributionInfo, loaded bool) (redistributionInfo, xsync.ComputeOp) {
+		if !loaded {
+			info.createdAt = now
+		}
+		info.route = generated
+		info.neighbor = neighbor
+		info.generated = generatedEvpn(generated)
+		info.updatedAt = now
+		return info, xsync.UpdateOp
+	})
+	c.routeChanged(route)
+}
+
+// Updates the aggregates and the leaks once the route is redistributed, suppressed or neither anymore
+func (c *VPNv4Controller) routeChanged(route vpnRoute) {
+	if c.aggregates == nil && c.leaks == nil {
+		return
+	}
+	vrfName := c.vrfName(route.Rd)
+	var generated *dto.Evpn5Route
+	if info, ok := c.routeInfo.Load(route); ok {
+		generated = &info.route
+	} else if suppressed, ok := c.suppressed.Load(route); ok {
+		generated = &suppressed.route
+	}
+	if c.aggregates != nil {
+		var err error
+		if generated != nil {
+			err = c.aggregates.contribute(vrfName, route, *generated)
+		} else {
+			err = c.aggregates.uncontribute(vrfName, route)
+		}
+		if err != nil {
+			c.logger.Errorf("VRF %s: cannot update the aggregates of %s: %v", vrfName, route, err)
+		}
+	}
+	if c.leaks != nil {
+		var err error
+		if generated != nil {
+			err = c.leaks.contribute(vrfName, route, *generated)
+		} else {
+			err = c.leaks.uncontribute(vrfName, route)
+		}
+		if err != nil {
+			c.logger.Errorf("VRF %s: cannot leak %s: %v", vrfName, route, err)
+		}
+	}
+}
+
+func (c *VPNv4Controller) ListRedistributed() []dto.RedistributedRoute {
+	result := []dto.RedistributedRoute{}
+	c.redistributedEvpn.Range(func(route vpnRoute, evpnUuid uuid.UUID) bool {
+		info, _ := c.routeInfo.Load(route)
+		result = append(result, dto.RedistributedRoute{
+			Vrf:       c.vrfName(route.Rd),
+			Direction: metrics.DirectionToEvpn,
+			Prefix:    fmt.Sprintf("%s/%d", route.Prefix, route.Prefixlen),
+			Source:    route.String(),
+			Generated: info.generated,
+			Uuid:      evpnUuid,
+			CreatedAt: info.createdAt,
+			UpdatedAt: info.updatedAt,
+		})
+		return true
+	})
+	return result
+}
+
+func (c *VPNv4Controller) vrfName(rd string) string {
+	vrf, _ := c.rdVrfMap.Load(rd)
+	return vrf.Name
+}
+
+// Number of redistributed routes by VRF name
+func (c *VPNv4Controller) RedistributedRoutes() map[string]int {
+	result := map[string]int{}
+	c.redistributedEvpn.Range(func(route vpnRoute, _ uuid.UUID) bool {
+		result[c.vrfName(route.Rd)]++
+		return true
+	})
+	return result
 }
 
 func (c *VPNv4Controller) ReloadConfig(diff dto.VrfDiff) error {
-	deletedRd := make([]string, 0, len(diff.Deleted))
+	deletedRd := make(map[string]string, len(diff.Deleted)) // RD -> VRF name
 	for _, vrf := range diff.Deleted {
 		c.rdVrfMap.Delete(vrf.Rd)
-		deletedRd = append(deletedRd, vrf.Rd)
+		deletedRd[vrf.Rd] = vrf.Name
 	}
 	for _, vrf := range diff.Created {
-		dtoVrf := dto.Vrf{
-			Name:               vrf.Name,
-			Vni:                vrf.Id,
-			Rd:                 vrf.Rd,
-			ImportRouteTargets: vrf.ImportRtList,
-			ExportRouteTargets: vrf.ExportRtList,
-		}
+		dtoVrf := dto.NewVrf(vrf, diff.Extensions[vrf.Name])
 		c.rdVrfMap.Store(dtoVrf.Rd, dtoVrf)
 	}
-	return c.deleteStaleRoutes(deletedRd)
+	if diff.Extensions != nil {
+		c.rdVrfMap.Range(func(rd string, vrf dto.Vrf) bool {
+			vrf.VrfExtensions = diff.Extensions[vrf.Name]
+			c.rdVrfMap.Store(rd, vrf)
+			return true
+		})
+	}
+	c.withdrawHold.Discard(func(route vpnRoute) bool {
+		_, deleted := deletedRd[route.Rd]
+		return deleted
+	})
+	c.mobility.Forget(func(key prefixKey) bool {
+		_, deleted := deletedRd[key.Rd]
+		return deleted
+	})
+	c.suppressed.Range(func(route vpnRoute, _ suppressedRoute) bool {
+		if _, deleted := deletedRd[route.Rd]; deleted {
+			c.suppressed.Delete(route)
+		}
+		return true
+	})
+	c.blocked.Range(func(route vpnRoute, _ dto.BlockedRoute) bool {
+		if _, deleted := deletedRd[route.Rd]; deleted {
+			c.blocked.Delete(route)
+		}
+		return true
+	})
+	for _, vrf := range diff.Deleted {
+		c.limits.forgetVrf(vrf.Name)
+	}
+	var merr error
+	if diff.Extensions != nil {
+		merr = c.withdrawSpoofed()
+	}
+	if err := c.deleteStaleRoutes(deletedRd); err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	return merr
+}
+
+// Rejects the received path with the reason. The route redistributed from the previous best path
+// of the prefix is withdrawn, as nothing backs it anymore
+func (c *VPNv4Controller) rejectPath(vrf dto.Vrf, route vpnRoute, path *api.Path, reason string) error {
+	if _, loaded := c.suppressed.LoadAndDelete(route); loaded {
+		c.routeChanged(route)
+	}
+	evpnUuid, loaded := c.redistributedEvpn.LoadAndDelete(route)
+	if !loaded {
+		c.publish(vpnEvent(events.Rejected, vrf.Name, route, "", reason), path)
+		return nil
+	}
+	c.withdrawHold.Cancel(route.prefixKey())
+	info := c.forgetRoute(route)
+	c.publish(vpnEvent(events.Withdrawn, vrf.Name, route, info.generated, reason), path)
+	err := c.evpnInjector.DelRoute(evpnUuid)
+	observeRoute(vrf.Name, metrics.DirectionToEvpn, metrics.OperationWithdraw, err)
+	return err
 }
 
-func (c *VPNv4Controller) deleteStaleRoutes(deletedRd []string) error {
+// Withdraws the redistributed routes reject returns a reason for, e.g. once the config changes
+func (c *VPNv4Controller) withdrawRejected(
+	reject func(vrf dto.Vrf, route vpnRoute, info redistributionInfo) string,
+) (merr error) {
+	c.redistributedEvpn.Range(func(route vpnRoute, evpnUuid uuid.UUID) bool {
+		vrf, ok := c.rdVrfMap.Load(route.Rd)
+		if !ok {
+			return true
+		}
+		info, _ := c.routeInfo.Load(route)
+		reason := reject(vrf, route, info)
+		if reason == "" {
+			return true
+		}
+		if _, loaded := c.redistributedEvpn.LoadAndDelete(route); !loaded {
+			return true
+		}
+		c.withdrawHold.Cancel(route.prefixKey())
+		c.forgetRoute(route)
+		event := vpnEvent(events.Withdrawn, vrf.Name, route, info.generated, reason)
+		event.Neighbor = info.neighbor
+		c.emit(event)
+		err := c.evpnInjector.DelRoute(evpnUuid)
+		observeRoute(vrf.Name, metrics.DirectionToEvpn, metrics.OperationWithdraw, err)
+		if err != nil {
+			merr = multierror.Append(merr, err)
+		}
+		return true
+	})
+	return merr
+}
+
+// deletedRd maps RDs of the deleted VRFs to their names
+func (c *VPNv4Controller) deleteStaleRoutes(deletedRd map[string]string) error {
 	wg := sync.WaitGroup{}
-	deletedSet := mapset.NewThreadUnsafeSet(deletedRd...)
+	var mu sync.Mutex // guards merr
 	var merr error
 	c.redistributedEvpn.Range(func(key vpnRoute, value uuid.UUID) bool {
-		if deletedSet.Contains(key.Rd) {
+		if vrfName, deleted := deletedRd[key.Rd]; deleted {
 			wg.Add(1)
 			go func() {
 				err := c.evpnInjector.DelRoute(value)
 				c.redistributedEvpn.Delete(key)
+				info := c.forgetRoute(key) // safe concurrently, the maps it updates have their own locks
+				observeRoute(vrfName, metrics.DirectionToEvpn, metrics.OperationWithdraw, err)
+				c.emit(vpnEvent(events.Withdrawn, vrfName, key, info.generated, events.ReasonVrfDeleted))
 				if err != nil {
+					mu.Lock()
 					merr = multierror.Append(merr, err)
+					mu.Unlock()
 				}
 				wg.Done()
 			}()
@@ -114,28 +537,63 @@ func (c *VPNv4Controller) deleteStaleRoutes(deletedRd []string) error {
 type EvpnController struct {
 	vpnInjector          vpnInjector
 	existingRT           mapset.Set[string]
+	rtVrfMap             *xsync.Map[string, string] // import RT -> VRF name
 	redistributedStorage *redistributedEvpnStorage
 	routeGen             *vpnRouteGen
 	listEvpnRoutes       func() <-chan EvpnRouteWithPattrs
+	defaults             *DefaultRoutes                  // nil if no VRF imports the default routes only
+	suppressed           *xsync.Map[evpnRoute, []string] // by default-originate, route -> route targets
+	events               events.Publisher
+	logger               *logrus.Logger
 }
 
 func NewEvpnController(
 	injector vpnInjector, vrfCfg []oc.VrfConfig, listEvpnRoutes func() <-chan EvpnRouteWithPattrs,
 ) *EvpnController {
 	existingRt := mapset.NewSet[string]()
+	rtVrfMap := xsync.NewMap[string, string]()
 	for _, vrf := range vrfCfg {
 		existingRt.Append(vrf.ImportRtList...)
+		for _, rt := range vrf.ImportRtList {
+			rtVrfMap.Store(rt, vrf.Name)
+		}
 	}
 	return &EvpnController{
 		vpnInjector:          injector,
 		existingRT:           existingRt,
+		rtVrfMap:             rtVrfMap,
 		redistributedStorage: newRedistributedEvpnStorage(),
 		routeGen:             newVpnRouteGen(),
 		listEvpnRoutes:       listEvpnRoutes,
+		suppressed:           xsync.NewMap[evpnRoute, []string](),
+		events:               events.Discard{},
+		logger:               logging.Discard(),
 	}
 }
 
-func (c *EvpnController) HandleUpdate(path *api.Path) error {
+// Sets the receiver of the redistribution decisions
+func (c *EvpnController) SetEventPublisher(publisher events.Publisher) {
+	c.events = publisher
+}
+
+func (c *EvpnController) SetLogger(logger *logrus.Logger) {
+	c.logger = logger
+}
+
+func (c *EvpnController) publish(event events.Event, path *api.Path) {
+	event.Neighbor = path.GetNeighborIp()
+	c.emit(event)
+}
+
+func (c *EvpnController) emit(event events.Event) {
+	logEvent(c.logger, event)
+	c.events.Publish(event)
+}
+
+func (c *EvpnController) HandleUpdate(ctx context.Context, path *api.Path) (err error) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "EvpnController.HandleUpdate")
+	defer func() { tracing.End(span, err) }()
 	route, err := evpnFromApi(path.GetNlri())
 	if errors.Is(err, invalidEvpnType) { // TODO: conditionally support Type-2
 		return nil
@@ -143,38 +601,166 @@ func (c *EvpnController) HandleUpdate(path *api.Path) error {
 	if err != nil {
 		return err
 	}
+	span.SetAttributes(tracing.AttrPrefix.String(route.String()))
 	routeTargets := extractRouteTargets(path.GetPattrs())
 	if !c.existingRT.ContainsAny(routeTargets...) {
 		return nil
 	}
+	vrfName := c.vrfName(routeTargets)
+	span.SetAttributes(tracing.AttrVrf.String(vrfName))
+	defer observeHandling(vrfName, metrics.DirectionToVpn, metrics.OperationInject, start, &err)
+	if reason := c.suppression(vrfName, route); reason != "" {
+		withdrawn, err := c.suppress(vrfName, route, routeTargets)
+		if !withdrawn {
+			c.publish(evpnEvent(events.Rejected, vrfName, route, "", reason), path)
+		}
+		c.importChanged(vrfName, route, true)
+		return err
+	}
+	c.suppressed.Delete(route)
+	_, genSpan := tracing.Tracer().Start(ctx, "vpnRouteGen.GenRoute")
 	vpnRoute := c.routeGen.GenRoute(route, path.GetPattrs())
+	genSpan.End()
 	vpnRoute.RouteTargets = routeTargets
+	_, injectSpan := tracing.Tracer().Start(ctx, "VPNv4Injector.AddRoute")
 	vpnUuid, err := c.vpnInjector.AddRoute(vpnRoute)
+	tracing.End(injectSpan, err)
 	if err != nil {
+		c.publish(evpnEvent(events.Rejected, vrfName, route, generatedVpn(vpnRoute), err.Error()), path)
 		return err
 	}
-	if prevUuid := c.redistributedStorage.Get(route); prevUuid != uuid.Nil {
+	prevUuid := c.redistributedStorage.Get(route)
+	if prevUuid != uuid.Nil {
 		c.vpnInjector.DelRoute(prevUuid) // implicit withdraw
 	}
 	c.redistributedStorage.Store(route, routeTargets, vpnUuid)
+	eventType, reason := injectedEvent(prevUuid != uuid.Nil)
+	c.publish(evpnEvent(eventType, vrfName, route, generatedVpn(vpnRoute), reason), path)
+	c.importChanged(vrfName, route, true)
 	return nil
 }
 
-func (c *EvpnController) HandleWithdraw(path *api.Path) error {
+// Redistributes paths in bulk, e.g. the routes collected during startup hold-down
+func (c *EvpnController) HandleUpdates(paths []*api.Path) error {
+	var merr error
+	routes := make([]evpnRoute, 0, len(paths))
+	sources := make([]*api.Path, 0, len(paths))
+	vpnRoutes := make([]dto.VPNRoute, 0, len(paths))
+	for _, path := range paths {
+		route, err := evpnFromApi(path.GetNlri())
+		if errors.Is(err, invalidEvpnType) {
+			continue
+		}
+		if err != nil {
+			merr = multierror.Append(merr, err)
+			continue
+		}
+		routeTargets := extractRouteTargets(path.GetPattrs())
+		if !c.existingRT.ContainsAny(routeTargets...) {
+			continue
+		}
+		vrfName := c.vrfName(routeTargets)
+		if reason := c.suppression(vrfName, route); reason != "" {
+			c.suppressed.Store(route, routeTargets)
+			c.publish(evpnEvent(events.Rejected, vrfName, route, "", reason), path)
+			c.importChanged(vrfName, route, true)
+			continue
+		}
+		vpnRoute := c.routeGen.GenRoute(route, path.GetPattrs())
+		vpnRoute.RouteTargets = routeTargets
+		routes = append(routes, route)
+		sources = append(sources, path)
+		vpnRoutes = append(vpnRoutes, vpnRoute)
+	}
+	if len(vpnRoutes) == 0 {
+		return merr
+	}
+	vpnUuids, err := c.vpnInjector.AddRoutes(vpnRoutes)
+	if err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	for i, vpnUuid := range vpnUuids {
+		vrfName := c.vrfName(vpnRoutes[i].RouteTargets)
+		generated := generatedVpn(vpnRoutes[i])
+		if vpnUuid == uuid.Nil {
+			observeRoute(vrfName, metrics.DirectionToVpn, metrics.OperationInject, errNotInjected)
+			c.publish(evpnEvent(events.Rejected, vrfName, routes[i], generated, errNotInjected.Error()), sources[i])
+			continue
+		}
+		observeRoute(vrfName, metrics.DirectionToVpn, metrics.OperationInject, nil)
+		prevUuid := c.redistributedStorage.Get(routes[i])
+		if prevUuid != uuid.Nil {
+			c.vpnInjector.DelRoute(prevUuid) // implicit withdraw
+		}
+		c.redistributedStorage.Store(routes[i], vpnRoutes[i].RouteTargets, vpnUuid)
+		eventType, reason := injectedEvent(prevUuid != uuid.Nil)
+		c.publish(evpnEvent(eventType, vrfName, routes[i], generated, reason), sources[i])
+		c.importChanged(vrfName, routes[i], true)
+	}
+	return merr
+}
+
+func (c *EvpnController) HandleWithdraw(ctx context.Context, path *api.Path) (err error) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "EvpnController.HandleWithdraw")
+	defer func() { tracing.End(span, err) }()
 	route, err := evpnFromApi(path.GetNlri())
 	if err != nil {
 		return err
 	}
+	span.SetAttributes(tracing.AttrPrefix.String(route.String()))
+	routeTargets := extractRouteTargets(path.GetPattrs())
+	vrfName := c.vrfName(routeTargets)
+	c.suppressed.Delete(route)
+	defer c.importChanged(vrfName, route, false) // once the route itself is withdrawn
 	if vpnUuid := c.redistributedStorage.Get(route); vpnUuid != uuid.Nil {
-		routeTargets := extractRouteTargets(path.GetPattrs())
+		span.SetAttributes(tracing.AttrVrf.String(vrfName))
+		defer observeHandling(vrfName, metrics.DirectionToVpn, metrics.OperationWithdraw, start, &err)
 		c.redistributedStorage.Delete(route, routeTargets)
-		if err = c.vpnInjector.DelRoute(vpnUuid); err != nil {
+		generated := generatedVpnOf(route)
+		c.publish(evpnEvent(events.Withdrawn, vrfName, route, generated, events.ReasonSourceWithdrawn), path)
+		_, injectSpan := tracing.Tracer().Start(ctx, "VPNv4Injector.DelRoute")
+		err = c.vpnInjector.DelRoute(vpnUuid)
+		tracing.End(injectSpan, err)
+		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// Withdraws the routes redistributed from the source which is gone from the RIB without a withdrawal
+func (c *EvpnController) WithdrawSource(source string) (withdrawn bool, merr error) {
+	c.suppressed.Range(func(route evpnRoute, targets []string) bool {
+		if route.String() == source {
+			c.suppressed.Delete(route)
+			c.importChanged(c.vrfName(targets), route, false)
+		}
+		return true
+	})
+	stale := map[evpnRoute]uuidRT{}
+	c.redistributedStorage.Range(func(route evpnRoute, value uuidRT) bool {
+		if route.String() == source {
+			stale[route] = value
+		}
+		return true
+	})
+	for route, value := range stale {
+		withdrawn = true
+		vrfName := c.vrfName(value.targets)
+		c.redistributedStorage.Delete(route, value.targets)
+		c.importChanged(vrfName, route, false)
+		generated := generatedVpnOf(route)
+		c.emit(evpnEvent(events.Withdrawn, vrfName, route, generated, events.ReasonSourceLost))
+		err := c.vpnInjector.DelRoute(value.uuid)
+		observeRoute(vrfName, metrics.DirectionToVpn, metrics.OperationWithdraw, err)
+		if err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	return withdrawn, merr
+}
+
 func (c *EvpnController) ReloadConfig(diff dto.VrfDiff) error {
 	// modify c.existingRT
 	deleteRT := []string{}
@@ -187,37 +773,138 @@ func (c *EvpnController) ReloadConfig(diff dto.VrfDiff) error {
 	}
 	c.existingRT.RemoveAll(deleteRT...)
 	c.existingRT.Append(createRT...)
+	for _, vrf := range diff.Deleted {
+		for _, rt := range vrf.ImportRtList {
+			c.rtVrfMap.Compute(rt, func(name string, loaded bool) (string, xsync.ComputeOp) {
+				if loaded && name == vrf.Name {
+					return name, xsync.DeleteOp
+				}
+				return name, xsync.CancelOp
+			})
+		}
+	}
+	for _, vrf := range diff.Created {
+		for _, rt := range vrf.ImportRtList {
+			c.rtVrfMap.Store(rt, vrf.Name)
+		}
+	}
+	c.suppressed.Range(func(route evpnRoute, targets []string) bool {
+		if c.vrfName(targets) == "" {
+			c.suppressed.Delete(route)
+		}
+		return true
+	})
 
 	// delete old VPN routes
-	uuids := c.redistributedStorage.PopByRT(deleteRT)
 	var merr error
+	var mu sync.Mutex // guards merr
 	wg := sync.WaitGroup{}
-	for _, rid := range uuids {
-		rid := rid
-		wg.Add(1)
-		go func() {
-			err := c.vpnInjector.DelRoute(rid)
-			if err != nil {
-				merr = multierror.Append(merr, err)
-			}
-			wg.Done()
-		}()
+	for _, vrf := range diff.Deleted {
+		for route, rid := range c.redistributedStorage.PopByRT(vrf.ImportRtList) {
+			wg.Add(1)
+			go func() {
+				err := c.vpnInjector.DelRoute(rid)
+				observeRoute(vrf.Name, metrics.DirectionToVpn, metrics.OperationWithdraw, err)
+				generated := generatedVpnOf(route)
+				// the publisher and the logger are safe for concurrent use, unlike merr
+				c.emit(evpnEvent(events.Withdrawn, vrf.Name, route, generated, events.ReasonVrfDeleted))
+				if err != nil {
+					mu.Lock()
+					merr = multierror.Append(merr, err)
+					mu.Unlock()
+				}
+				wg.Done()
+			}()
+		}
 	}
 	wg.Wait()
 
 	// redistribute new vrfs
+	sources := []EvpnRouteWithPattrs{}
+	vpnRoutes := []dto.VPNRoute{}
 	ch := c.listEvpnRoutes()
 	for route := range ch {
 		if rid := c.redistributedStorage.Get(route.Nlri); rid != uuid.Nil {
 			continue
 		}
 		if route.HasAnyTarget(createRT...) {
+			targets := route.Targets.ToSlice()
+			vrfName := c.vrfName(targets)
+			if reason := c.suppression(vrfName, route.Nlri); reason != "" {
+				c.suppressed.Store(route.Nlri, targets)
+				c.emit(evpnEvent(events.Rejected, vrfName, route.Nlri, "", reason))
+				c.importChanged(vrfName, route.Nlri, true)
+				continue
+			}
 			vpnRoute := c.routeGen.GenRoute(route.Nlri, route.Pattrs)
-			vpnRoute.RouteTargets = route.Targets.ToSlice()
-			rid, err := c.vpnInjector.AddRoute(vpnRoute)
-			merr = multierror.Append(merr, err)
-			c.redistributedStorage.Store(route.Nlri, route.Targets.ToSlice(), rid)
+			vpnRoute.RouteTargets = targets
+			sources = append(sources, route)
+			vpnRoutes = append(vpnRoutes, vpnRoute)
+		}
+	}
+	if err := c.injectListed(sources, vpnRoutes, events.ReasonVrfCreated); err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	return merr
+}
+
+// Redistributes the routes listed from the RIB in bulk, vpnRoutes are generated from sources
+func (c *EvpnController) injectListed(sources []EvpnRouteWithPattrs, vpnRoutes []dto.VPNRoute, reason string) error {
+	if len(vpnRoutes) == 0 {
+		return nil
+	}
+	rids, merr := c.vpnInjector.AddRoutes(vpnRoutes)
+	for i, rid := range rids {
+		vrfName := c.vrfName(vpnRoutes[i].RouteTargets)
+		generated := generatedVpn(vpnRoutes[i])
+		if rid == uuid.Nil {
+			observeRoute(vrfName, metrics.DirectionToVpn, metrics.OperationInject, errNotInjected)
+			c.emit(evpnEvent(events.Rejected, vrfName, sources[i].Nlri, generated, errNotInjected.Error()))
+			c.importChanged(vrfName, sources[i].Nlri, false) // e.g. a restored route which is not suppressed anymore
+			continue
 		}
+		observeRoute(vrfName, metrics.DirectionToVpn, metrics.OperationInject, nil)
+		c.redistributedStorage.Store(sources[i].Nlri, vpnRoutes[i].RouteTargets, rid)
+		c.emit(evpnEvent(events.Added, vrfName, sources[i].Nlri, generated, reason))
+		c.importChanged(vrfName, sources[i].Nlri, true)
 	}
 	return merr
 }
+
+// Name of the VRF importing the route, the first matching route target wins
+func (c *EvpnController) vrfName(routeTargets []string) string {
+	for _, rt := range routeTargets {
+		if name, ok := c.rtVrfMap.Load(rt); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// Number of redistributed routes by VRF name
+func (c *EvpnController) RedistributedRoutes() map[string]int {
+	result := map[string]int{}
+	c.redistributedStorage.Range(func(_ evpnRoute, value uuidRT) bool {
+		result[c.vrfName(value.targets)]++
+		return true
+	})
+	return result
+}
+
+func (c *EvpnController) ListRedistributed() []dto.RedistributedRoute {
+	result := []dto.RedistributedRoute{}
+	c.redistributedStorage.Range(func(route evpnRoute, value uuidRT) bool {
+		result = append(result, dto.RedistributedRoute{
+			Vrf:       c.vrfName(value.targets),
+			Direction: metrics.DirectionToVpn,
+			Prefix:    fmt.Sprintf("%s/%d", route.Prefix, route.Prefixlen),
+			Source:    route.String(),
+			Generated: generatedVpnOf(route),
+			Uuid:      value.uuid,
+			CreatedAt: value.createdAt,
+			UpdatedAt: value.updatedAt,
+		})
+		return true
+	})
+	return result
+}
@@ -1,15 +1,26 @@
 package controller
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/amyasnikov/berg/internal/tracing"
 	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
 	api "github.com/osrg/gobgp/v3/api"
 	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"google.golang.org/protobuf/types/known/anypb"
 )
 
@@ -85,6 +96,11 @@ func (m *mockEvpnInjector) AddType5Route(route dto.Evpn5Route) (uuid.UUID, error
 	return args.Get(0).(uuid.UUID), args.Error(1)
 }
 
+func (m *mockEvpnInjector) AddType5Routes(routes []dto.Evpn5Route) ([]uuid.UUID, error) {
+	args := m.Called(routes)
+	return args.Get(0).([]uuid.UUID), args.Error(1)
+}
+
 func (m *mockEvpnInjector) DelRoute(routeId uuid.UUID) error {
 	args := m.Called(routeId)
 	return args.Error(0)
@@ -100,11 +116,63 @@ func (m *mockVpnInjector) AddRoute(route dto.VPNRoute) (uuid.UUID, error) {
 	return args.Get(0).(uuid.UUID), args.Error(1)
 }
 
+func (m *mockVpnInjector) AddRoutes(routes []dto.VPNRoute) ([]uuid.UUID, error) {
+	args := m.Called(routes)
+	return args.Get(0).([]uuid.UUID), args.Error(1)
+}
+
 func (m *mockVpnInjector) DelRoute(routeId uuid.UUID) error {
 	args := m.Called(routeId)
 	return args.Error(0)
 }
 
+// Controllers wired together the way the app does, all publishing to the same recorder
+type testControllers struct {
+	vpn          *VPNv4Controller
+	evpn         *EvpnController
+	orchestrated *OrchestratedRoutes
+	aggregates   *Aggregates
+	defaults     *DefaultRoutes
+	leaks        *Leaks
+	publisher    *recordingPublisher
+}
+
+// listed are the EVPN paths of the RIB the EVPN controller looks the imported routes up in
+func newTestControllers(
+	evpnInjector *mockEvpnInjector, vpnInjector *mockVpnInjector,
+	vrfs []oc.VrfConfig, ext map[string]dto.VrfExtensions, listed ...*api.Path,
+) testControllers {
+	listEvpnRoutes := func() <-chan EvpnRouteWithPattrs {
+		ch := make(chan EvpnRouteWithPattrs, len(listed))
+		for _, path := range listed {
+			route, _ := NewEvpnRouteWithPattrs(path)
+			ch <- route
+		}
+		close(ch)
+		return ch
+	}
+	c := testControllers{
+		vpn:       NewVPNv4Controller(evpnInjector, vrfs, ext),
+		evpn:      NewEvpnController(vpnInjector, vrfs, listEvpnRoutes),
+		publisher: &recordingPublisher{},
+	}
+	c.orchestrated = NewOrchestratedRoutes(evpnInjector, c.vpn, vrfs, ext)
+	c.aggregates = NewAggregates(evpnInjector, c.vpn, vrfs, ext)
+	c.leaks = NewLeaks(vpnInjector, evpnInjector, c.vpn, vrfs, ext)
+	c.defaults = NewDefaultRoutes(vpnInjector, vpnInjector, c.evpn, vrfs, ext)
+	c.vpn.SetOrchestratedRoutes(c.orchestrated)
+	c.vpn.SetAggregates(c.aggregates)
+	c.vpn.SetLeaks(c.leaks)
+	c.evpn.SetDefaultRoutes(c.defaults)
+	c.vpn.SetEventPublisher(c.publisher)
+	c.evpn.SetEventPublisher(c.publisher)
+	c.orchestrated.SetEventPublisher(c.publisher)
+	c.aggregates.SetEventPublisher(c.publisher)
+	c.leaks.SetEventPublisher(c.publisher)
+	c.defaults.SetEventPublisher(c.publisher)
+	return c
+}
+
 func TestVPNv4Controller_HandleUpdate(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -165,7 +233,7 @@ func TestVPNv4Controller_HandleUpdate(t *testing.T) {
 				})
 			}
 
-			controller := NewVPNv4Controller(mockInjector, vrfCfg)
+			controller := NewVPNv4Controller(mockInjector, vrfCfg, nil)
 
 			if tt.hasExistingRoute {
 				// Pre-populate with existing route (must match all fields from createTestVPNPath)
@@ -202,7 +270,7 @@ func TestVPNv4Controller_HandleUpdate(t *testing.T) {
 				}
 			}
 
-			err := controller.HandleUpdate(tt.path)
+			err := controller.HandleUpdate(context.Background(), tt.path)
 
 			if tt.expectedError {
 				assert.Error(t, err)
@@ -215,6 +283,33 @@ func TestVPNv4Controller_HandleUpdate(t *testing.T) {
 	}
 }
 
+func TestVPNv4Controller_HandleUpdates(t *testing.T) {
+	mockInjector := &mockEvpnInjector{}
+	controller := NewVPNv4Controller(
+		mockInjector, []oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", Id: 1000}}, nil,
+	)
+	unknownVrfPath := createTestVPNPath()
+	rd, _ := anypb.New(&api.RouteDistinguisherTwoOctetASN{Admin: 65000, Assigned: 999})
+	unknownVrfPath.Nlri, _ = anypb.New(&api.LabeledVPNIPAddressPrefix{
+		Rd: rd, Prefix: "10.9.0.0", PrefixLen: 24, Labels: []uint32{1000},
+	})
+	existingRoute := vpnRoute{Rd: "65000:100", Prefix: "10.0.0.0", Prefixlen: 24, Label: 1000}
+	existingUuid := uuid.New()
+	controller.redistributedEvpn.Store(existingRoute, existingUuid)
+	newUuid := uuid.New()
+	mockInjector.On("AddType5Routes", mock.MatchedBy(func(routes []dto.Evpn5Route) bool {
+		return len(routes) == 1 && routes[0].Prefix == "10.0.0.0" && routes[0].Gateway == "192.168.1.1"
+	})).Return([]uuid.UUID{newUuid}, nil)
+	mockInjector.On("DelRoute", existingUuid).Return(nil)
+
+	err := controller.HandleUpdates([]*api.Path{createTestVPNPath(), unknownVrfPath})
+
+	assert.NoError(t, err)
+	storedUuid, _ := controller.redistributedEvpn.Load(existingRoute)
+	assert.Equal(t, newUuid, storedUuid)
+	mockInjector.AssertExpectations(t)
+}
+
 func TestVPNv4Controller_HandleWithdraw(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -247,7 +342,7 @@ func TestVPNv4Controller_HandleWithdraw(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockInjector := &mockEvpnInjector{}
-			controller := NewVPNv4Controller(mockInjector, []oc.VrfConfig{})
+			controller := NewVPNv4Controller(mockInjector, []oc.VrfConfig{}, nil)
 
 			routeUuid := uuid.New()
 			if tt.hasRoute {
@@ -261,7 +356,7 @@ func TestVPNv4Controller_HandleWithdraw(t *testing.T) {
 				}
 			}
 
-			err := controller.HandleWithdraw(tt.path)
+			err := controller.HandleWithdraw(context.Background(), tt.path)
 
 			if tt.expectedError {
 				assert.Error(t, err)
@@ -341,7 +436,7 @@ func TestVPNv4Controller_ReloadConfig(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockInjector := &mockEvpnInjector{}
-			controller := NewVPNv4Controller(mockInjector, tt.initialVrfs)
+			controller := NewVPNv4Controller(mockInjector, tt.initialVrfs, nil)
 
 			if tt.hasRoutes {
 				// Add some routes that should be cleaned up
@@ -383,7 +478,7 @@ func TestVPNv4Controller_ReloadConfig(t *testing.T) {
 
 func TestVPNv4Controller_DeleteStaleRoutes(t *testing.T) {
 	mockInjector := &mockEvpnInjector{}
-	controller := NewVPNv4Controller(mockInjector, []oc.VrfConfig{})
+	controller := NewVPNv4Controller(mockInjector, []oc.VrfConfig{}, nil)
 
 	// Add some routes
 	route1 := vpnRoute{Rd: "65000:100", Prefix: "10.0.0.0", Prefixlen: 24, Label: 1000}
@@ -397,7 +492,7 @@ func TestVPNv4Controller_DeleteStaleRoutes(t *testing.T) {
 	// Only route1 (with RD "65000:100") should be deleted
 	mockInjector.On("DelRoute", uuid1).Return(nil)
 
-	deletedRd := []string{"65000:100"}
+	deletedRd := map[string]string{"65000:100": "test-vrf"}
 	err := controller.deleteStaleRoutes(deletedRd)
 
 	assert.NoError(t, err)
@@ -412,6 +507,24 @@ func TestVPNv4Controller_DeleteStaleRoutes(t *testing.T) {
 	mockInjector.AssertExpectations(t)
 }
 
+func TestVPNv4Controller_DeleteStaleRoutes_CollectsErrors(t *testing.T) {
+	mockInjector := &mockEvpnInjector{}
+	controller := NewVPNv4Controller(mockInjector, []oc.VrfConfig{}, nil)
+	for i := range 10 {
+		route := vpnRoute{Rd: "65000:100", Prefix: fmt.Sprintf("10.0.%d.0", i), Prefixlen: 24}
+		routeUuid := uuid.New()
+		controller.redistributedEvpn.Store(route, routeUuid)
+		mockInjector.On("DelRoute", routeUuid).Return(errors.New("delete failed"))
+	}
+
+	err := controller.deleteStaleRoutes(map[string]string{"65000:100": "test-vrf"})
+
+	var merr *multierror.Error
+	require.ErrorAs(t, err, &merr)
+	assert.Len(t, merr.Errors, 10)
+	assert.Zero(t, controller.redistributedEvpn.Size())
+}
+
 func TestEvpnController_HandleUpdate(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -519,7 +632,7 @@ func TestEvpnController_HandleUpdate(t *testing.T) {
 				}
 			}
 
-			err := controller.HandleUpdate(tt.path)
+			err := controller.HandleUpdate(context.Background(), tt.path)
 
 			if tt.expectedError {
 				assert.Error(t, err)
@@ -532,6 +645,28 @@ func TestEvpnController_HandleUpdate(t *testing.T) {
 	}
 }
 
+func TestEvpnController_HandleUpdates(t *testing.T) {
+	mockInjector := &mockVpnInjector{}
+	controller := NewEvpnController(
+		mockInjector,
+		[]oc.VrfConfig{{Name: "vrf1", Rd: "65000:100", Id: 1000, ImportRtList: []string{"65000:100"}}},
+		nil,
+	)
+	unknownRtPath := createTestEVPNPath()
+	unknownRtPath.Pattrs = nil
+	vpnUuid := uuid.New()
+	mockInjector.On("AddRoutes", mock.MatchedBy(func(routes []dto.VPNRoute) bool {
+		return len(routes) == 1 && routes[0].Prefix == "10.0.0.0"
+	})).Return([]uuid.UUID{vpnUuid}, nil)
+
+	err := controller.HandleUpdates([]*api.Path{createTestEVPNPath(), unknownRtPath})
+
+	assert.NoError(t, err)
+	route, _ := evpnFromApi(createTestEVPNPath().GetNlri())
+	assert.Equal(t, vpnUuid, controller.redistributedStorage.Get(route))
+	mockInjector.AssertExpectations(t)
+}
+
 func TestEvpnController_HandleWithdraw(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -594,7 +729,7 @@ func TestEvpnController_HandleWithdraw(t *testing.T) {
 				}
 			}
 
-			err := controller.HandleWithdraw(tt.path)
+			err := controller.HandleWithdraw(context.Background(), tt.path)
 
 			if tt.expectedError {
 				assert.Error(t, err)
@@ -679,3 +814,371 @@ func TestEvpnController_ReloadConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestEvpnController_ReloadConfig_CollectsWithdrawErrors(t *testing.T) {
+	mockInjector := &mockVpnInjector{}
+	vrf := oc.VrfConfig{Name: "vrf1", Rd: "65000:100", Id: 1000, ImportRtList: []string{"65000:100"}}
+	listEvpnRoutes := func() <-chan EvpnRouteWithPattrs {
+		ch := make(chan EvpnRouteWithPattrs)
+		close(ch)
+		return ch
+	}
+	controller := NewEvpnController(mockInjector, []oc.VrfConfig{vrf}, listEvpnRoutes)
+	publisher := &recordingPublisher{}
+	controller.SetEventPublisher(publisher)
+	for i := range 10 {
+		route := evpnRoute{Rd: "65000:100", Prefix: fmt.Sprintf("10.0.%d.0", i), Prefixlen: 24}
+		routeUuid := uuid.New()
+		controller.redistributedStorage.Store(route, vrf.ImportRtList, routeUuid)
+		mockInjector.On("DelRoute", routeUuid).Return(errors.New("delete failed"))
+	}
+
+	err := controller.ReloadConfig(dto.VrfDiff{Deleted: []oc.VrfConfig{vrf}})
+
+	var merr *multierror.Error
+	require.ErrorAs(t, err, &merr)
+	assert.Len(t, merr.Errors, 10)
+	assert.Len(t, publisher.types(), 10)
+}
+
+func TestEvpnController_ReloadConfig_RedistributesInBulk(t *testing.T) {
+	mockInjector := &mockVpnInjector{}
+	newVrfPath := createTestEVPNPath()
+	otherPath := createTestEVPNPath()
+	otherRt, _ := anypb.New(&api.TwoOctetAsSpecificExtended{SubType: 2, Asn: 65000, LocalAdmin: 300})
+	otherExtComm, _ := anypb.New(&api.ExtendedCommunitiesAttribute{Communities: []*anypb.Any{otherRt}})
+	otherPath.Pattrs = []*anypb.Any{otherExtComm}
+	listEvpnRoutes := func() <-chan EvpnRouteWithPattrs {
+		ch := make(chan EvpnRouteWithPattrs, 2)
+		for _, path := range []*api.Path{newVrfPath, otherPath} {
+			route, _ := NewEvpnRouteWithPattrs(path)
+			ch <- route
+		}
+		close(ch)
+		return ch
+	}
+	controller := NewEvpnController(mockInjector, []oc.VrfConfig{}, listEvpnRoutes)
+	routeUuid := uuid.New()
+	mockInjector.On("AddRoutes", mock.MatchedBy(func(routes []dto.VPNRoute) bool {
+		return len(routes) == 1 &&
+			routes[0].Rd == "65000:100" &&
+			routes[0].Prefix == "10.0.0.0" &&
+			assert.ObjectsAreEqual([]string{"65000:100"}, routes[0].RouteTargets)
+	})).Return([]uuid.UUID{routeUuid}, nil)
+
+	err := controller.ReloadConfig(dto.VrfDiff{
+		Created: []oc.VrfConfig{{Name: "vrf1", Rd: "65000:100", Id: 1000, ImportRtList: []string{"65000:100"}}},
+	})
+
+	assert.NoError(t, err)
+	route, _ := evpnFromApi(newVrfPath.GetNlri())
+	assert.Equal(t, routeUuid, controller.redistributedStorage.Get(route))
+	mockInjector.AssertExpectations(t)
+}
+
+func TestVPNv4Controller_HandleWithdraw_Delayed(t *testing.T) {
+	mockInjector := &mockEvpnInjector{}
+	controller := NewVPNv4Controller(
+		mockInjector,
+		[]oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", Id: 1000}},
+		map[string]dto.VrfExtensions{"test-vrf": {WithdrawHoldTime: 10 * time.Millisecond}},
+	)
+	route := vpnRoute{Rd: "65000:100", Prefix: "10.0.0.0", Prefixlen: 24, Label: 1000}
+	routeUuid := uuid.New()
+	controller.redistributedEvpn.Store(route, routeUuid)
+	deleted := make(chan struct{})
+	mockInjector.On("DelRoute", routeUuid).Run(func(mock.Arguments) { close(deleted) }).Return(nil)
+	delayed := metrics.WithdrawHold.WithLabelValues("test-vrf", "delayed")
+	withdrawn := metrics.WithdrawHold.WithLabelValues("test-vrf", "withdrawn")
+	before := []float64{testutil.ToFloat64(delayed), testutil.ToFloat64(withdrawn)}
+
+	err := controller.HandleWithdraw(context.Background(), createTestVPNPath())
+
+	assert.NoError(t, err)
+	_, exists := controller.redistributedEvpn.Load(route)
+	assert.True(t, exists, "route withdrawn before hold time expired")
+	select {
+	case <-deleted:
+	case <-time.After(time.Second):
+		t.Fatal("Route was not withdrawn after hold time")
+	}
+	_, exists = controller.redistributedEvpn.Load(route)
+	assert.False(t, exists)
+	assert.Equal(t, before[0]+1, testutil.ToFloat64(delayed))
+	assert.Equal(t, before[1]+1, testutil.ToFloat64(withdrawn))
+}
+
+func TestVPNv4Controller_HandleUpdate_CancelsDelayedWithdraw(t *testing.T) {
+	tests := []struct {
+		name    string
+		batched bool // received through HandleUpdates
+	}{
+		{name: "Single update"},
+		{name: "Batched update", batched: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockInjector := &mockEvpnInjector{}
+			controller := NewVPNv4Controller(
+				mockInjector,
+				[]oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", Id: 1000}},
+				map[string]dto.VrfExtensions{"test-vrf": {WithdrawHoldTime: 20 * time.Millisecond}},
+			)
+			// The prefix reappears with a different label, e.g. from another hypervisor
+			oldRoute := vpnRoute{Rd: "65000:100", Prefix: "10.0.0.0", Prefixlen: 24, Label: 500}
+			oldUuid := uuid.New()
+			controller.redistributedEvpn.Store(oldRoute, oldUuid)
+			oldPath := createTestVPNPath()
+			rd, _ := anypb.New(&api.RouteDistinguisherTwoOctetASN{Admin: 65000, Assigned: 100})
+			oldPath.Nlri, _ = anypb.New(&api.LabeledVPNIPAddressPrefix{
+				Rd: rd, Prefix: "10.0.0.0", PrefixLen: 24, Labels: []uint32{500},
+			})
+			newUuid := uuid.New()
+			if tt.batched {
+				mockInjector.On("AddType5Routes", mock.Anything).Return([]uuid.UUID{newUuid}, nil)
+			} else {
+				mockInjector.On("AddType5Route", mock.Anything).Return(newUuid, nil)
+			}
+			mockInjector.On("DelRoute", oldUuid).Return(nil).Once()
+			delayed := metrics.WithdrawHold.WithLabelValues("test-vrf", "delayed")
+			saved := metrics.WithdrawHold.WithLabelValues("test-vrf", "saved")
+			before := []float64{testutil.ToFloat64(delayed), testutil.ToFloat64(saved)}
+
+			assert.NoError(t, controller.HandleWithdraw(context.Background(), oldPath))
+			if tt.batched {
+				assert.NoError(t, controller.HandleUpdates([]*api.Path{createTestVPNPath()}))
+			} else {
+				assert.NoError(t, controller.HandleUpdate(context.Background(), createTestVPNPath()))
+			}
+			time.Sleep(40 * time.Millisecond)
+
+			_, exists := controller.redistributedEvpn.Load(oldRoute)
+			assert.False(t, exists)
+			storedUuid, _ := controller.redistributedEvpn.Load(
+				vpnRoute{Rd: "65000:100", Prefix: "10.0.0.0", Prefixlen: 24, Label: 1000},
+			)
+			assert.Equal(t, newUuid, storedUuid)
+			assert.Equal(t, before[0]+1, testutil.ToFloat64(delayed))
+			assert.Equal(t, before[1]+1, testutil.ToFloat64(saved))
+			mockInjector.AssertExpectations(t)
+		})
+	}
+}
+
+func TestVPNv4Controller_HandleUpdate_Mobility(t *testing.T) {
+	mockInjector := &mockEvpnInjector{}
+	controller := NewVPNv4Controller(
+		mockInjector,
+		[]oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", Id: 1000}},
+		map[string]dto.VrfExtensions{"test-vrf": {Mobility: dto.MobilityMacMobility}},
+	)
+	movedPath := createTestVPNPath()
+	movedPath.Pattrs[0], _ = anypb.New(&api.MpReachNLRIAttribute{NextHops: []string{"192.168.1.2"}})
+	var sequences []uint32
+	mockInjector.On("AddType5Route", mock.Anything).Run(func(args mock.Arguments) {
+		route := args.Get(0).(dto.Evpn5Route)
+		var seq uint32
+		for _, comm := range route.ExtCommunities {
+			var mobility api.MacMobilityExtended
+			if comm.UnmarshalTo(&mobility) == nil {
+				seq = mobility.SequenceNum
+			}
+		}
+		sequences = append(sequences, seq)
+	}).Return(uuid.New(), nil)
+	mockInjector.On("DelRoute", mock.Anything).Return(nil)
+
+	assert.NoError(t, controller.HandleUpdate(context.Background(), createTestVPNPath()))
+	assert.NoError(t, controller.HandleUpdate(context.Background(), movedPath))
+	assert.NoError(t, controller.HandleUpdate(context.Background(), createTestVPNPath()))
+
+	assert.Equal(t, []uint32{0, 1, 2}, sequences)
+}
+
+func TestVPNv4Controller_HandleWithdraw_KeepsMobility(t *testing.T) {
+	mockInjector := &mockEvpnInjector{}
+	controller := NewVPNv4Controller(
+		mockInjector,
+		[]oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", Id: 1000}},
+		map[string]dto.VrfExtensions{"test-vrf": {Mobility: dto.MobilityMacMobility}},
+	)
+	movedPath := createTestVPNPath()
+	movedPath.Pattrs[0], _ = anypb.New(&api.MpReachNLRIAttribute{NextHops: []string{"192.168.1.2"}})
+	var sequences []uint32
+	mockInjector.On("AddType5Route", mock.Anything).Run(func(args mock.Arguments) {
+		var seq uint32
+		for _, comm := range args.Get(0).(dto.Evpn5Route).ExtCommunities {
+			var mobility api.MacMobilityExtended
+			if comm.UnmarshalTo(&mobility) == nil {
+				seq = mobility.SequenceNum
+			}
+		}
+		sequences = append(sequences, seq)
+	}).Return(uuid.New(), nil)
+	mockInjector.On("DelRoute", mock.Anything).Return(nil)
+
+	// live migration: the old session withdraws before the new gateway announces the prefix
+	assert.NoError(t, controller.HandleUpdate(context.Background(), createTestVPNPath()))
+	assert.NoError(t, controller.HandleWithdraw(context.Background(), createTestVPNPath()))
+	assert.NoError(t, controller.HandleUpdate(context.Background(), movedPath))
+
+	assert.Equal(t, []uint32{0, 1}, sequences)
+}
+
+func TestVPNv4Controller_Metrics(t *testing.T) {
+	mockInjector := &mockEvpnInjector{}
+	controller := NewVPNv4Controller(
+		mockInjector, []oc.VrfConfig{{Name: "metrics-vrf", Rd: "65000:100", Id: 1000}}, nil,
+	)
+	redistributed := metrics.Redistributed.WithLabelValues("metrics-vrf", metrics.DirectionToEvpn)
+	withdrawn := metrics.Withdrawn.WithLabelValues("metrics-vrf", metrics.DirectionToEvpn)
+	failed := metrics.Errors.WithLabelValues("metrics-vrf", metrics.DirectionToEvpn, metrics.OperationInject)
+	before := []float64{testutil.ToFloat64(redistributed), testutil.ToFloat64(withdrawn), testutil.ToFloat64(failed)}
+	routeUuid := uuid.New()
+	mockInjector.On("AddType5Route", mock.Anything).Return(routeUuid, nil).Once()
+	mockInjector.On("AddType5Route", mock.Anything).Return(uuid.Nil, errors.New("injection failed")).Once()
+	mockInjector.On("DelRoute", routeUuid).Return(nil)
+
+	assert.NoError(t, controller.HandleUpdate(context.Background(), createTestVPNPath()))
+	assert.Equal(t, map[string]int{"metrics-vrf": 1}, controller.RedistributedRoutes())
+	assert.Error(t, controller.HandleUpdate(context.Background(), createTestVPNPath()))
+	assert.NoError(t, controller.HandleWithdraw(context.Background(), createTestVPNPath()))
+
+	assert.Equal(t, before[0]+1, testutil.ToFloat64(redistributed))
+	assert.Equal(t, before[1]+1, testutil.ToFloat64(withdrawn))
+	assert.Equal(t, before[2]+1, testutil.ToFloat64(failed))
+	assert.Empty(t, controller.RedistributedRoutes())
+}
+
+func TestEvpnController_RedistributedRoutes(t *testing.T) {
+	controller := NewEvpnController(
+		&mockVpnInjector{},
+		[]oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", ImportRtList: []string{"65000:100"}}},
+		nil,
+	)
+	route := evpnRoute{Rd: "65000:100", Prefix: "10.0.0.0", Prefixlen: 24}
+	controller.redistributedStorage.Store(route, []string{"65000:999", "65000:100"}, uuid.New())
+
+	assert.Equal(t, map[string]int{"test-vrf": 1}, controller.RedistributedRoutes())
+}
+
+func TestVPNv4Controller_ListRedistributed(t *testing.T) {
+	mockInjector := &mockEvpnInjector{}
+	controller := NewVPNv4Controller(
+		mockInjector, []oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", Id: 1000}}, nil,
+	)
+	firstUuid, secondUuid := uuid.New(), uuid.New()
+	mockInjector.On("AddType5Route", mock.Anything).Return(firstUuid, nil).Once()
+	mockInjector.On("AddType5Route", mock.Anything).Return(secondUuid, nil).Once()
+	mockInjector.On("DelRoute", firstUuid).Return(nil)
+
+	assert.NoError(t, controller.HandleUpdate(context.Background(), createTestVPNPath()))
+	created := controller.ListRedistributed()[0].CreatedAt
+	assert.NoError(t, controller.HandleUpdate(context.Background(), createTestVPNPath()))
+	routes := controller.ListRedistributed()
+
+	assert.Len(t, routes, 1)
+	assert.Equal(t, "test-vrf", routes[0].Vrf)
+	assert.Equal(t, metrics.DirectionToEvpn, routes[0].Direction)
+	assert.Equal(t, "10.0.0.0/24", routes[0].Prefix)
+	assert.Equal(t, "65000:100:10.0.0.0/24", routes[0].Source)
+	assert.Equal(t, "5:65000:100:10.0.0.0/24 Gw:192.168.1.1 Vni:1000", routes[0].Generated)
+	assert.Equal(t, secondUuid, routes[0].Uuid)
+	assert.Equal(t, created, routes[0].CreatedAt)
+	assert.False(t, routes[0].UpdatedAt.Before(created))
+}
+
+func TestEvpnController_ListRedistributed(t *testing.T) {
+	mockInjector := &mockVpnInjector{}
+	controller := NewEvpnController(
+		mockInjector,
+		[]oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", ImportRtList: []string{"65000:100"}}},
+		nil,
+	)
+	vpnUuid := uuid.New()
+	mockInjector.On("AddRoute", mock.Anything).Return(vpnUuid, nil)
+
+	assert.NoError(t, controller.HandleUpdate(context.Background(), createTestEVPNPath()))
+	routes := controller.ListRedistributed()
+
+	assert.Len(t, routes, 1)
+	assert.Equal(t, "test-vrf", routes[0].Vrf)
+	assert.Equal(t, metrics.DirectionToVpn, routes[0].Direction)
+	assert.Equal(t, "5:65000:100:10.0.0.0/24 Gw:192.168.1.1 Vni:1000", routes[0].Source)
+	assert.Equal(t, "65000:100:10.0.0.0/24", routes[0].Generated)
+	assert.Equal(t, vpnUuid, routes[0].Uuid)
+	assert.False(t, routes[0].CreatedAt.IsZero())
+}
+
+func TestVPNv4Controller_HandleUpdateTraced(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(prevProvider)
+	mockInjector := &mockEvpnInjector{}
+	controller := NewVPNv4Controller(
+		mockInjector, []oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", Id: 1000}}, nil,
+	)
+	mockInjector.On("AddType5Route", mock.Anything).Return(uuid.New(), nil)
+
+	assert.NoError(t, controller.HandleUpdate(context.Background(), createTestVPNPath()))
+
+	spans := recorder.Ended()
+	assert.Equal(t, []string{"evpnRouteGen.GenRoute", "EvpnInjector.AddType5Route", "VPNv4Controller.HandleUpdate"},
+		[]string{spans[0].Name(), spans[1].Name(), spans[2].Name()})
+	assert.Contains(t, spans[2].Attributes(), tracing.AttrVrf.String("test-vrf"))
+	assert.Contains(t, spans[2].Attributes(), tracing.AttrPrefix.String("65000:100:10.0.0.0/24"))
+	assert.Equal(t, spans[2].SpanContext().SpanID(), spans[1].Parent().SpanID())
+}
+
+func TestVPNv4Controller_WithdrawSource(t *testing.T) {
+	mockInjector := &mockEvpnInjector{}
+	controller := NewVPNv4Controller(
+		mockInjector,
+		[]oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", Id: 1000}},
+		map[string]dto.VrfExtensions{"test-vrf": {WithdrawHoldTime: time.Minute}},
+	)
+	route := vpnRoute{Rd: "65000:100", Prefix: "10.0.0.0", Prefixlen: 24, Label: 1000}
+	heldRoute := vpnRoute{Rd: "65000:100", Prefix: "10.1.0.0", Prefixlen: 24, Label: 1000}
+	routeUuid, heldUuid := uuid.New(), uuid.New()
+	controller.redistributedEvpn.Store(route, routeUuid)
+	controller.redistributedEvpn.Store(heldRoute, heldUuid)
+	controller.withdrawHold.Schedule(heldRoute, heldUuid, time.Minute, controller.withdrawHeld)
+	mockInjector.On("DelRoute", routeUuid).Return(nil).Once()
+
+	withdrawn, err := controller.WithdrawSource("65000:100:10.0.0.0/24")
+	assert.NoError(t, err)
+	assert.True(t, withdrawn)
+	withdrawn, err = controller.WithdrawSource("65000:100:10.1.0.0/24")
+	assert.NoError(t, err)
+	assert.False(t, withdrawn, "route on withdraw hold")
+
+	_, exists := controller.redistributedEvpn.Load(route)
+	assert.False(t, exists)
+	_, exists = controller.redistributedEvpn.Load(heldRoute)
+	assert.True(t, exists)
+	mockInjector.AssertExpectations(t)
+}
+
+func TestEvpnController_WithdrawSource(t *testing.T) {
+	mockInjector := &mockVpnInjector{}
+	controller := NewEvpnController(
+		mockInjector,
+		[]oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", ImportRtList: []string{"65000:100"}}},
+		nil,
+	)
+	vpnUuid := uuid.New()
+	mockInjector.On("AddRoute", mock.Anything).Return(vpnUuid, nil)
+	mockInjector.On("DelRoute", vpnUuid).Return(errors.New("can't find a specified path")).Once()
+	assert.NoError(t, controller.HandleUpdate(context.Background(), createTestEVPNPath()))
+
+	withdrawn, err := controller.WithdrawSource("5:65000:100:10.0.0.0/24 Gw:192.168.1.1 Vni:1000")
+
+	assert.True(t, withdrawn)
+	assert.Error(t, err)
+	assert.Empty(t, controller.ListRedistributed())
+	withdrawn, _ = controller.WithdrawSource("5:65000:100:10.0.0.0/24 Gw:192.168.1.1 Vni:1000")
+	assert.False(t, withdrawn)
+	mockInjector.AssertExpectations(t)
+}
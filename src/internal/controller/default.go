@@ -0,0 +1,452 @@
+package controller
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/logging"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/sirupsen/logrus"
+)
+
+// Source of the default routes originated into the VRFs
+const DefaultSource = "default-originate"
+
+// Everything the default route is generated from, a change of any of it means re-injection
+type defaultSpec struct {
+	IPv6         bool // ::/0 injected as a VPNv6 route rather than 0.0.0.0/0
+	Rd           string
+	RouteTargets []string
+}
+
+func (s defaultSpec) prefix() string {
+	if s.IPv6 {
+		return "::/0"
+	}
+	return "0.0.0.0/0"
+}
+
+type defaultRoute struct {
+	spec      defaultSpec
+	generated string
+	uuid      uuid.UUID
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+// Injects a VPNv4 or VPNv6 default route into every VRF with default-originate,
+// the conditional ones only while the VRF imports the condition EVPN route
+type DefaultRoutes struct {
+	lock      sync.Mutex
+	injector  vpnInjector
+	injector6 vpnInjector // of the IPv6 default routes
+	routeGen  *vpnRouteGen
+	evpn      *EvpnController
+	vrfs      map[string]dto.Vrf              // by VRF name
+	injected  map[string]defaultRoute         // by VRF name
+	conds     map[localKey]bool               // condition routes of the VRFs
+	present   map[localKey]map[evpnRoute]bool // imported routes of every condition
+	events    events.Publisher
+	logger    *logrus.Logger
+}
+
+// injector6 injects the default routes of the VRFs with an IPv6 condition. evpn supplies the condition routes
+// and suppresses the imported routes of the VRFs
+func NewDefaultRoutes(
+	injector, injector6 vpnInjector, evpn *EvpnController, vrfCfg []oc.VrfConfig, vrfExt map[string]dto.VrfExtensions,
+) *DefaultRoutes {
+	d := &DefaultRoutes{
+		injector:  injector,
+		injector6: injector6,
+		routeGen:  newVpnRouteGen(),
+		evpn:      evpn,
+		vrfs:      newVrfMap(vrfCfg, vrfExt),
+		injected:  map[string]defaultRoute{},
+		present:   map[localKey]map[evpnRoute]bool{},
+		events:    events.Discard{},
+		logger:    logging.Discard(),
+	}
+	d.conds = d.conditions()
+	return d
+}
+
+// Sets the receiver of the injection decisions
+func (d *DefaultRoutes) SetEventPublisher(publisher events.Publisher) {
+	d.events = publisher
+}
+
+func (d *DefaultRoutes) SetLogger(logger *logrus.Logger) {
+	d.logger = logger
+}
+
+// Applies the VRF changes, suppresses or restores the imported routes of the VRFs whose suppress-imported
+// has changed, then looks the condition routes up and injects or withdraws the default routes.
+// Runs before EvpnController.ReloadConfig, so the routes of the created VRFs are suppressed right away
+func (d *DefaultRoutes) ReloadConfig(diff dto.VrfDiff) error {
+	d.lock.Lock()
+	prev := maps.Clone(d.vrfs)
+	reloadVrfs(d.vrfs, diff)
+	changed := map[string]bool{}
+	for name, vrf := range d.vrfs {
+		if old, ok := prev[name]; ok && suppressesImported(old) != suppressesImported(vrf) {
+			changed[name] = suppressesImported(vrf)
+		}
+	}
+	d.lock.Unlock()
+	var merr error
+	if d.evpn != nil && len(changed) > 0 { // without the lock, as the restored routes are reported back
+		if err := d.evpn.resuppress(changed); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.conds = d.conditions()
+	d.present = map[localKey]map[evpnRoute]bool{}
+	if d.evpn != nil && len(d.conds) > 0 {
+		d.present = d.evpn.importedPrefixes(d.conds)
+	}
+	if err := d.sync(); err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	return merr
+}
+
+// Injects the default routes whose condition is met and withdraws the rest
+func (d *DefaultRoutes) Sync() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.sync()
+}
+
+// Records the EVPN route imported into the VRF or gone from it. If the route is the condition of the VRF
+// and it is the first or the last one of the prefix, the default route is injected or withdrawn
+func (d *DefaultRoutes) conditionChanged(vrfName string, route evpnRoute, imported bool) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if len(d.conds) == 0 {
+		return nil
+	}
+	key := localKey{vrf: vrfName, prefix: fmt.Sprintf("%s/%d", route.Prefix, route.Prefixlen)}
+	if !d.conds[key] {
+		return nil
+	}
+	routes := d.present[key]
+	wasPresent := len(routes) > 0
+	if imported {
+		if routes == nil {
+			routes = map[evpnRoute]bool{}
+			d.present[key] = routes
+		}
+		routes[route] = true
+	} else {
+		delete(routes, route)
+		if len(routes) == 0 {
+			delete(d.present, key)
+		}
+	}
+	if wasPresent == (len(d.present[key]) > 0) {
+		return nil
+	}
+	return d.sync()
+}
+
+// Condition routes of the VRFs, must be called with lock held
+func (d *DefaultRoutes) conditions() map[localKey]bool {
+	conditions := map[localKey]bool{}
+	for name, vrf := range d.vrfs {
+		if vrf.DefaultOriginate != nil && vrf.DefaultOriginate.Condition != "" {
+			conditions[conditionKey(name, *vrf.DefaultOriginate)] = true
+		}
+	}
+	return conditions
+}
+
+// Must be called with lock held
+func (d *DefaultRoutes) sync() error {
+	wanted := map[string]string{} // VRF name -> reason of the injection
+	for name, vrf := range d.vrfs {
+		switch {
+		case vrf.DefaultOriginate == nil:
+		case vrf.DefaultOriginate.Condition == "":
+			wanted[name] = events.ReasonDefaultOriginate
+		case len(d.present[conditionKey(name, *vrf.DefaultOriginate)]) > 0:
+			wanted[name] = events.ReasonConditionPresent
+		}
+	}
+	var merr error
+	for name, injected := range d.injected {
+		if _, ok := wanted[name]; ok {
+			continue
+		}
+		delete(d.injected, name)
+		if err := d.withdraw(name, injected, d.withdrawReason(name)); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	for name, reason := range wanted {
+		vrf := d.vrfs[name]
+		spec := defaultSpec{
+			IPv6: conditionIPv6(*vrf.DefaultOriginate), Rd: vrf.Rd, RouteTargets: vrf.ImportRouteTargets,
+		}
+		prev, loaded := d.injected[name]
+		if loaded && reflect.DeepEqual(prev.spec, spec) {
+			continue
+		}
+		injected, err := d.inject(name, spec, prev, loaded, reason)
+		if err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("VRF %s: %w", name, err))
+			continue
+		}
+		d.injected[name] = injected
+	}
+	return merr
+}
+
+// Condition route of the VRF, the prefix has its host bits cleared
+func conditionKey(vrfName string, defaultOriginate dto.DefaultOriginate) localKey {
+	key := localKey{vrf: vrfName, prefix: defaultOriginate.Condition} // validated with the config
+	if prefix, err := netip.ParsePrefix(defaultOriginate.Condition); err == nil {
+		key.prefix = prefix.Masked().String()
+	}
+	return key
+}
+
+// Whether the condition is IPv6, the default route is of the family of its condition
+func conditionIPv6(defaultOriginate dto.DefaultOriginate) bool {
+	prefix, err := netip.ParsePrefix(defaultOriginate.Condition)
+	return err == nil && prefix.Addr().Is6()
+}
+
+func (d *DefaultRoutes) injectorOf(spec defaultSpec) vpnInjector {
+	if spec.IPv6 {
+		return d.injector6
+	}
+	return d.injector
+}
+
+// Must be called with lock held
+func (d *DefaultRoutes) withdrawReason(vrfName string) string {
+	vrf, ok := d.vrfs[vrfName]
+	switch {
+	case !ok:
+		return events.ReasonVrfDeleted
+	case vrf.DefaultOriginate == nil:
+		return events.ReasonDefaultRemoved
+	}
+	return events.ReasonConditionAbsent
+}
+
+// prev is the route injected for an older version of the spec, if loaded
+func (d *DefaultRoutes) inject(
+	vrfName string, spec defaultSpec, prev defaultRoute, loaded bool, reason string,
+) (defaultRoute, error) {
+	route := d.routeGen.GenDefaultRoute(dto.Vrf{Rd: spec.Rd, ImportRouteTargets: spec.RouteTargets}, spec.IPv6)
+	generated := generatedVpn(route)
+	vpnUuid, err := d.injectorOf(spec).AddRoute(route)
+	observeRoute(vrfName, metrics.DirectionToVpn, metrics.OperationInject, err)
+	if err != nil {
+		d.emit(d.event(events.Rejected, vrfName, spec, generated, err.Error()))
+		return defaultRoute{}, err
+	}
+	now := time.Now()
+	injected := defaultRoute{spec: spec, generated: generated, uuid: vpnUuid, createdAt: now, updatedAt: now}
+	eventType := events.Added
+	if loaded {
+		eventType = events.Replaced
+		injected.createdAt = prev.createdAt
+		if prev.generated != generated { // the same NLRI is replaced in place
+			d.injectorOf(prev.spec).DelRoute(prev.uuid)
+		}
+	}
+	d.emit(d.event(eventType, vrfName, spec, generated, reason))
+	return injected, nil
+}
+
+func (d *DefaultRoutes) withdraw(vrfName string, injected defaultRoute, reason string) error {
+	d.emit(d.event(events.Withdrawn, vrfName, injected.spec, injected.generated, reason))
+	err := d.injectorOf(injected.spec).DelRoute(injected.uuid)
+	observeRoute(vrfName, metrics.DirectionToVpn, metrics.OperationWithdraw, err)
+	return err
+}
+
+func (d *DefaultRoutes) emit(event events.Event) {
+	logEvent(d.logger, event)
+	d.events.Publish(event)
+}
+
+func (d *DefaultRoutes) event(
+	eventType events.Type, vrfName string, spec defaultSpec, generated string, reason string,
+) events.Event {
+	return events.Event{
+		Time:      time.Now(),
+		Type:      eventType,
+		Vrf:       vrfName,
+		Direction: metrics.DirectionToVpn,
+		Prefix:    spec.prefix(),
+		Source:    DefaultSource,
+		Generated: generated,
+		Reason:    reason,
+	}
+}
+
+// Whether the VRF imports the default routes only
+func (d *DefaultRoutes) suppresses(vrfName string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return suppressesImported(d.vrfs[vrfName])
+}
+
+func suppressesImported(vrf dto.Vrf) bool {
+	return vrf.DefaultOriginate != nil && vrf.DefaultOriginate.SuppressImported
+}
+
+// Injected default routes sorted by VRF, Source is DefaultSource
+func (d *DefaultRoutes) ListRedistributed() []dto.RedistributedRoute {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	result := make([]dto.RedistributedRoute, 0, len(d.injected))
+	for name, injected := range d.injected {
+		result = append(result, dto.RedistributedRoute{
+			Vrf:       name,
+			Direction: metrics.DirectionToVpn,
+			Prefix:    injected.spec.prefix(),
+			Source:    DefaultSource,
+			Generated: injected.generated,
+			Uuid:      injected.uuid,
+			CreatedAt: injected.createdAt,
+			UpdatedAt: injected.updatedAt,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Vrf < result[j].Vrf })
+	return result
+}
+
+// Number of injected default routes by VRF name
+func (d *DefaultRoutes) RedistributedRoutes() map[string]int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	result := map[string]int{}
+	for name := range d.injected {
+		result[name]++
+	}
+	return result
+}
+
+// Sets the default routes whose VRFs may import them only
+func (c *EvpnController) SetDefaultRoutes(defaults *DefaultRoutes) {
+	c.defaults = defaults
+}
+
+// Reason the route is kept out of its VRF, empty unless the VRF imports the default routes only or the route
+// is IPv6. The suppressed routes still meet the default-originate conditions
+func (c *EvpnController) suppression(vrfName string, route evpnRoute) string {
+	switch {
+	case !route.isIPv4():
+		return events.ReasonNotIPv4
+	case c.defaults != nil && route.Prefixlen > 0 && c.defaults.suppresses(vrfName):
+		return events.ReasonDefaultOnly
+	}
+	return ""
+}
+
+// Keeps the route aside rather than redistributing it, withdrawing it if it is redistributed
+func (c *EvpnController) suppress(vrfName string, route evpnRoute, routeTargets []string) (withdrawn bool, err error) {
+	c.suppressed.Store(route, routeTargets)
+	value, ok := c.redistributedStorage.Load(route)
+	if !ok {
+		return false, nil
+	}
+	c.redistributedStorage.Delete(route, value.targets)
+	c.emit(evpnEvent(events.Withdrawn, vrfName, route, generatedVpnOf(route), events.ReasonDefaultOnly))
+	err = c.vpnInjector.DelRoute(value.uuid)
+	observeRoute(vrfName, metrics.DirectionToVpn, metrics.OperationWithdraw, err)
+	return true, err
+}
+
+// Suppresses the redistributed routes of the VRFs which import the default routes only from now on and
+// redistributes the suppressed routes of the VRFs which no longer do. changed maps VRF names to the former
+func (c *EvpnController) resuppress(changed map[string]bool) error {
+	var merr error
+	suppressed := map[evpnRoute]uuidRT{}
+	c.redistributedStorage.Range(func(route evpnRoute, value uuidRT) bool {
+		if changed[c.vrfName(value.targets)] && route.Prefixlen > 0 {
+			suppressed[route] = value
+		}
+		return true
+	})
+	for route, value := range suppressed {
+		if _, err := c.suppress(c.vrfName(value.targets), route, value.targets); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	restored := map[evpnRoute]bool{}
+	c.suppressed.Range(func(route evpnRoute, targets []string) bool {
+		if suppress, ok := changed[c.vrfName(targets)]; ok && !suppress && route.isIPv4() {
+			restored[route] = true
+			c.suppressed.Delete(route)
+		}
+		return true
+	})
+	if len(restored) == 0 {
+		return merr
+	}
+	sources := []EvpnRouteWithPattrs{}
+	vpnRoutes := []dto.VPNRoute{}
+	for route := range c.listEvpnRoutes() {
+		if restored[route.Nlri] {
+			vpnRoute := c.routeGen.GenRoute(route.Nlri, route.Pattrs)
+			vpnRoute.RouteTargets = route.Targets.ToSlice()
+			sources = append(sources, route)
+			vpnRoutes = append(vpnRoutes, vpnRoute)
+		}
+	}
+	if err := c.injectListed(sources, vpnRoutes, events.ReasonNotDefaultOnly); err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	return merr
+}
+
+// Reports the route imported into the VRF or gone from it to the default routes, whose condition it may be
+func (c *EvpnController) importChanged(vrfName string, route evpnRoute, imported bool) {
+	if c.defaults == nil || vrfName == "" {
+		return
+	}
+	if err := c.defaults.conditionChanged(vrfName, route, imported); err != nil {
+		c.logger.Errorf("error while originating default routes: %v", err)
+	}
+}
+
+// Redistributed and suppressed routes importing the prefixes into their VRFs
+func (c *EvpnController) importedPrefixes(keys map[localKey]bool) map[localKey]map[evpnRoute]bool {
+	result := map[localKey]map[evpnRoute]bool{}
+	check := func(route evpnRoute, targets []string) {
+		key := localKey{vrf: c.vrfName(targets), prefix: fmt.Sprintf("%s/%d", route.Prefix, route.Prefixlen)}
+		if !keys[key] {
+			return
+		}
+		if result[key] == nil {
+			result[key] = map[evpnRoute]bool{}
+		}
+		result[key][route] = true
+	}
+	c.redistributedStorage.Range(func(route evpnRoute, value uuidRT) bool {
+		check(route, value.targets)
+		return true
+	})
+	c.suppressed.Range(func(route evpnRoute, targets []string) bool {
+		check(route, targets)
+		return true
+	})
+	return result
+}
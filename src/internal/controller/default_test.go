@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Imports the route of createTestEVPNPath
+var defaultVrf = oc.VrfConfig{
+	Name: "vrf_10", Id: 10, Rd: "65000:10", ImportRtList: []string{"65000:100"}, ExportRtList: []string{"65000:10"},
+}
+
+func defaultExtensions(defaultOriginate *dto.DefaultOriginate) map[string]dto.VrfExtensions {
+	return map[string]dto.VrfExtensions{"vrf_10": {DefaultOriginate: defaultOriginate}}
+}
+
+// EVPN path of createTestEVPNPath with another prefix
+func createImportedPath(prefix string, prefixlen uint32, gateway string) *api.Path {
+	path := createTestEVPNPath()
+	rd, _ := anypb.New(&api.RouteDistinguisherTwoOctetASN{Admin: 65000, Assigned: 100})
+	path.Nlri, _ = anypb.New(&api.EVPNIPPrefixRoute{
+		Rd: rd, Esi: &api.EthernetSegmentIdentifier{}, IpPrefix: prefix, IpPrefixLen: prefixlen, GwAddress: gateway,
+	})
+	return path
+}
+
+func withVpnPrefix(prefix string) any {
+	return mock.MatchedBy(func(route dto.VPNRoute) bool { return route.Prefix == prefix })
+}
+
+func TestDefaultRoutes_Sync(t *testing.T) {
+	injector := &mockVpnInjector{}
+	defaultUuid := uuid.New()
+	injector.On("AddRoute", withVpnPrefix("0.0.0.0")).Return(defaultUuid, nil).Once()
+	c := newTestControllers(
+		&mockEvpnInjector{}, injector, []oc.VrfConfig{defaultVrf}, defaultExtensions(&dto.DefaultOriginate{}),
+	)
+
+	require.NoError(t, c.defaults.Sync())
+	require.NoError(t, c.defaults.Sync()) // nothing changed
+
+	route := injector.Calls[0].Arguments.Get(0).(dto.VPNRoute)
+	assert.Equal(t, "65000:10", route.Rd)
+	assert.Equal(t, []string{"65000:100"}, route.RouteTargets)
+	assert.Equal(t, uint32(0), route.Prefixlen)
+	listed := c.defaults.ListRedistributed()
+	require.Len(t, listed, 1)
+	assert.Equal(t, DefaultSource, listed[0].Source)
+	assert.Equal(t, "65000:10:0.0.0.0/0", listed[0].Generated)
+	assert.Equal(t, defaultUuid, listed[0].Uuid)
+	assert.Equal(t, map[string]int{"vrf_10": 1}, c.defaults.RedistributedRoutes())
+
+	injector.On("DelRoute", defaultUuid).Return(nil).Once()
+	require.NoError(t, c.defaults.ReloadConfig(dto.VrfDiff{Extensions: map[string]dto.VrfExtensions{}}))
+
+	assert.Empty(t, c.defaults.ListRedistributed())
+	assert.Equal(t, []events.Type{events.Added, events.Withdrawn}, c.publisher.types())
+	assert.Equal(t, events.ReasonDefaultRemoved, c.publisher.events[1].Reason)
+	injector.AssertExpectations(t)
+}
+
+func TestDefaultRoutes_Condition(t *testing.T) {
+	tests := []struct {
+		name              string
+		condition         string
+		path              *api.Path
+		redistributed     int    // imported routes
+		rejectedReason    string // of the imported route not redistributed
+		expectedGenerated string // empty if no default route is originated
+	}{
+		{
+			name:              "Condition met",
+			condition:         "10.0.0.1/24",
+			path:              createTestEVPNPath(),
+			redistributed:     1,
+			expectedGenerated: "65000:10:0.0.0.0/0",
+		},
+		{
+			name:          "Condition not met",
+			condition:     "10.0.1.0/24",
+			path:          createTestEVPNPath(),
+			redistributed: 1,
+		},
+		{
+			name:              "IPv6 condition met by route not redistributed",
+			condition:         "::/0",
+			path:              createImportedPath("::", 0, "2001:db8::1"),
+			rejectedReason:    events.ReasonNotIPv4,
+			expectedGenerated: "65000:10:::/0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			injector := &mockVpnInjector{}
+			injector.On("AddRoute", mock.Anything).Return(uuid.New(), nil)
+			injector.On("DelRoute", mock.Anything).Return(nil)
+			c := newTestControllers(
+				&mockEvpnInjector{}, injector, []oc.VrfConfig{defaultVrf},
+				defaultExtensions(&dto.DefaultOriginate{Condition: tt.condition}),
+			)
+			require.NoError(t, c.defaults.Sync())
+			assert.Empty(t, c.defaults.ListRedistributed()) // no condition route yet
+
+			require.NoError(t, c.evpn.HandleUpdate(context.Background(), tt.path))
+
+			assert.Len(t, c.evpn.ListRedistributed(), tt.redistributed)
+			assert.Equal(t, tt.redistributed == 1, c.evpn.Audit(tt.path).Expected)
+			if tt.rejectedReason != "" {
+				assert.Equal(t, tt.rejectedReason, c.publisher.events[0].Reason)
+			}
+			listed := c.defaults.ListRedistributed()
+			if tt.expectedGenerated == "" {
+				assert.Empty(t, listed)
+				return
+			}
+			require.Len(t, listed, 1)
+			assert.Equal(t, tt.expectedGenerated, listed[0].Generated)
+
+			require.NoError(t, c.evpn.HandleWithdraw(context.Background(), tt.path))
+			assert.Empty(t, c.defaults.ListRedistributed())
+			last := c.publisher.events[len(c.publisher.events)-1]
+			assert.Equal(t, DefaultSource, last.Source)
+			assert.Equal(t, events.ReasonConditionAbsent, last.Reason)
+		})
+	}
+}
+
+func TestDefaultRoutes_ConditionReload(t *testing.T) {
+	injector := &mockVpnInjector{}
+	routeUuid, defaultUuid := uuid.New(), uuid.New()
+	c := newTestControllers(&mockEvpnInjector{}, injector, []oc.VrfConfig{defaultVrf}, nil)
+	injector.On("AddRoute", withVpnPrefix("10.0.0.0")).Return(routeUuid, nil).Once()
+	require.NoError(t, c.evpn.HandleUpdate(context.Background(), createTestEVPNPath()))
+
+	// the condition route imported before the condition is set is looked up on reload
+	injector.On("AddRoute", withVpnPrefix("0.0.0.0")).Return(defaultUuid, nil).Once()
+	conditional := defaultExtensions(&dto.DefaultOriginate{Condition: "10.0.0.0/24"})
+	require.NoError(t, c.defaults.ReloadConfig(dto.VrfDiff{Extensions: conditional}))
+	assert.Len(t, c.defaults.ListRedistributed(), 1)
+
+	// a withdrawal of another prefix leaves the default route alone
+	other := createImportedPath("10.0.1.0", 24, "192.168.1.1")
+	require.NoError(t, c.evpn.HandleWithdraw(context.Background(), other))
+	assert.Len(t, c.defaults.ListRedistributed(), 1)
+	injector.AssertExpectations(t)
+}
+
+func TestDefaultRoutes_SuppressImported(t *testing.T) {
+	injector := &mockVpnInjector{}
+	routeUuid := uuid.New()
+	path := createTestEVPNPath()
+	defaultOriginate := &dto.DefaultOriginate{Condition: "10.0.0.0/24", SuppressImported: true}
+	c := newTestControllers(
+		&mockEvpnInjector{}, injector, []oc.VrfConfig{defaultVrf}, defaultExtensions(defaultOriginate), path,
+	)
+	injector.On("AddRoute", withVpnPrefix("0.0.0.0")).Return(uuid.New(), nil).Once()
+
+	require.NoError(t, c.evpn.HandleUpdate(context.Background(), path))
+	assert.Equal(t, []events.Type{events.Rejected, events.Added}, c.publisher.types())
+	assert.Equal(t, events.ReasonDefaultOnly, c.publisher.events[0].Reason)
+	assert.False(t, c.evpn.Audit(path).Expected)
+	assert.Empty(t, c.evpn.ListRedistributed())
+	// the suppressed route still meets the condition
+	assert.Len(t, c.defaults.ListRedistributed(), 1)
+
+	injector.On("AddRoutes", mock.MatchedBy(func(routes []dto.VPNRoute) bool {
+		return len(routes) == 1 && routes[0].Prefix == "10.0.0.0"
+	})).Return([]uuid.UUID{routeUuid}, nil).Once()
+	conditional := defaultExtensions(&dto.DefaultOriginate{Condition: "10.0.0.0/24"})
+	require.NoError(t, c.defaults.ReloadConfig(dto.VrfDiff{Extensions: conditional}))
+	require.Len(t, c.evpn.ListRedistributed(), 1)
+	assert.Equal(t, routeUuid, c.evpn.ListRedistributed()[0].Uuid)
+	assert.Equal(t, events.ReasonNotDefaultOnly, c.publisher.events[len(c.publisher.events)-1].Reason)
+	assert.Len(t, c.defaults.ListRedistributed(), 1)
+
+	injector.On("DelRoute", routeUuid).Return(nil).Once()
+	require.NoError(t, c.defaults.ReloadConfig(dto.VrfDiff{Extensions: defaultExtensions(defaultOriginate)}))
+	assert.Empty(t, c.evpn.ListRedistributed())
+	last := c.publisher.events[len(c.publisher.events)-1]
+	assert.Equal(t, events.Withdrawn, last.Type)
+	assert.Equal(t, events.ReasonDefaultOnly, last.Reason)
+	injector.AssertExpectations(t)
+}
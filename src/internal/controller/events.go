@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+func vpnEvent(eventType events.Type, vrf string, route vpnRoute, generated string, reason string) events.Event {
+	return events.Event{
+		Time:      time.Now(),
+		Type:      eventType,
+		Vrf:       vrf,
+		Direction: metrics.DirectionToEvpn,
+		Prefix:    fmt.Sprintf("%s/%d", route.Prefix, route.Prefixlen),
+		Source:    route.String(),
+		Generated: generated,
+		Reason:    reason,
+	}
+}
+
+func evpnEvent(eventType events.Type, vrf string, route evpnRoute, generated string, reason string) events.Event {
+	return events.Event{
+		Time:      time.Now(),
+		Type:      eventType,
+		Vrf:       vrf,
+		Direction: metrics.DirectionToVpn,
+		Prefix:    fmt.Sprintf("%s/%d", route.Prefix, route.Prefixlen),
+		Source:    route.String(),
+		Generated: generated,
+		Reason:    reason,
+	}
+}
+
+// Rejections are logged at debug level, the rest of the decisions at trace level
+func logEvent(logger *logrus.Logger, event events.Event) {
+	level := logrus.TraceLevel
+	switch event.Type {
+	case events.Rejected:
+		level = logrus.DebugLevel
+	case events.Warning:
+		level = logrus.WarnLevel
+	}
+	if !logger.IsLevelEnabled(level) {
+		return
+	}
+	logger.WithFields(logrus.Fields{
+		"type":      event.Type,
+		"vrf":       event.Vrf,
+		"direction": event.Direction,
+		"source":    event.Source,
+		"neighbor":  event.Neighbor,
+		"generated": event.Generated,
+	}).Log(level, event.Reason)
+}
+
+// Added if the route was not redistributed before, replaced otherwise
+func injectedEvent(replaced bool) (events.Type, string) {
+	if replaced {
+		return events.Replaced, events.ReasonSourceUpdated
+	}
+	return events.Added, events.ReasonSourceAdvertised
+}
+
+func generatedEvpn(route dto.Evpn5Route) string {
+	return evpnRoute{
+		Rd:        route.Rd,
+		Prefix:    route.Prefix,
+		Prefixlen: route.Prefixlen,
+		Gateway:   route.Gateway,
+		Label:     route.Vni,
+	}.String()
+}
+
+func generatedVpn(route dto.VPNRoute) string {
+	return vpnRoute{Rd: route.Rd, Prefix: route.Prefix, Prefixlen: route.Prefixlen}.String()
+}
+
+// Generated VPNv4 route of the redistributed EVPN route
+func generatedVpnOf(route evpnRoute) string {
+	return vpnRoute{Rd: route.Rd, Prefix: route.Prefix, Prefixlen: route.Prefixlen}.String()
+}
@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/google/uuid"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type recordingPublisher struct {
+	events []events.Event
+	lock   sync.Mutex
+}
+
+func (p *recordingPublisher) Publish(event events.Event) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.events = append(p.events, event)
+}
+
+func (p *recordingPublisher) types() []events.Type {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	result := []events.Type{}
+	for _, e := range p.events {
+		result = append(result, e.Type)
+	}
+	return result
+}
+
+func (p *recordingPublisher) reasons() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	result := []string{}
+	for _, e := range p.events {
+		result = append(result, e.Reason)
+	}
+	return result
+}
+
+func TestVPNv4Controller_Events(t *testing.T) {
+	mockInjector := &mockEvpnInjector{}
+	controller := NewVPNv4Controller(
+		mockInjector, []oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", Id: 1000}}, nil,
+	)
+	publisher := &recordingPublisher{}
+	controller.SetEventPublisher(publisher)
+	firstUuid, secondUuid := uuid.New(), uuid.New()
+	mockInjector.On("AddType5Route", mock.Anything).Return(firstUuid, nil).Once()
+	mockInjector.On("AddType5Route", mock.Anything).Return(secondUuid, nil).Once()
+	mockInjector.On("AddType5Route", mock.Anything).Return(uuid.Nil, errors.New("injection failed")).Once()
+	mockInjector.On("DelRoute", mock.Anything).Return(nil)
+	path := createTestVPNPath()
+	path.NeighborIp = "192.168.1.1"
+
+	assert.NoError(t, controller.HandleUpdate(context.Background(), path))
+	assert.NoError(t, controller.HandleUpdate(context.Background(), path))
+	assert.Error(t, controller.HandleUpdate(context.Background(), path))
+	assert.NoError(t, controller.HandleWithdraw(context.Background(), path))
+
+	assert.Equal(t,
+		[]events.Type{events.Added, events.Replaced, events.Rejected, events.Withdrawn}, publisher.types(),
+	)
+	added := publisher.events[0]
+	assert.Equal(t, "test-vrf", added.Vrf)
+	assert.Equal(t, metrics.DirectionToEvpn, added.Direction)
+	assert.Equal(t, "10.0.0.0/24", added.Prefix)
+	assert.Equal(t, "65000:100:10.0.0.0/24", added.Source)
+	assert.Equal(t, "5:65000:100:10.0.0.0/24 Gw:192.168.1.1 Vni:1000", added.Generated)
+	assert.Equal(t, "192.168.1.1", added.Neighbor)
+	assert.Equal(t, events.ReasonSourceAdvertised, added.Reason)
+	assert.Equal(t, "injection failed", publisher.events[2].Reason)
+	assert.Equal(t, added.Generated, publisher.events[3].Generated)
+	assert.Equal(t, events.ReasonSourceWithdrawn, publisher.events[3].Reason)
+}
+
+func TestVPNv4Controller_EventsRejectedWithoutNexthop(t *testing.T) {
+	controller := NewVPNv4Controller(
+		&mockEvpnInjector{}, []oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", Id: 1000}}, nil,
+	)
+	publisher := &recordingPublisher{}
+	controller.SetEventPublisher(publisher)
+	path := createTestVPNPath()
+	path.Pattrs = nil
+
+	assert.Error(t, controller.HandleUpdate(context.Background(), path))
+
+	assert.Equal(t, []events.Type{events.Rejected}, publisher.types())
+	assert.NotEmpty(t, publisher.events[0].Reason)
+}
+
+func TestEvpnController_Events(t *testing.T) {
+	mockInjector := &mockVpnInjector{}
+	controller := NewEvpnController(
+		mockInjector,
+		[]oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", ImportRtList: []string{"65000:100"}}},
+		func() <-chan EvpnRouteWithPattrs { return nil },
+	)
+	publisher := &recordingPublisher{}
+	controller.SetEventPublisher(publisher)
+	mockInjector.On("AddRoute", mock.Anything).Return(uuid.New(), nil)
+	mockInjector.On("DelRoute", mock.Anything).Return(nil)
+	path := createTestEVPNPath()
+
+	assert.NoError(t, controller.HandleUpdate(context.Background(), path))
+	assert.NoError(t, controller.HandleUpdate(context.Background(), path))
+	withdraw := createTestEVPNPath()
+	withdraw.IsWithdraw = true
+	assert.NoError(t, controller.HandleWithdraw(context.Background(), withdraw))
+
+	assert.Equal(t, []events.Type{events.Added, events.Replaced, events.Withdrawn}, publisher.types())
+	assert.Equal(t, "test-vrf", publisher.events[0].Vrf)
+	assert.Equal(t, metrics.DirectionToVpn, publisher.events[0].Direction)
+	assert.Equal(t, "65000:100:10.0.0.0/24", publisher.events[0].Generated)
+}
+
+func TestEvpnController_EventsOnVrfDeletion(t *testing.T) {
+	mockInjector := &mockVpnInjector{}
+	vrf := oc.VrfConfig{Name: "test-vrf", Rd: "65000:100", ImportRtList: []string{"65000:100"}}
+	controller := NewEvpnController(
+		mockInjector, []oc.VrfConfig{vrf}, func() <-chan EvpnRouteWithPattrs {
+			ch := make(chan EvpnRouteWithPattrs)
+			close(ch)
+			return ch
+		},
+	)
+	publisher := &recordingPublisher{}
+	controller.SetEventPublisher(publisher)
+	routeUuid := uuid.New()
+	route, _ := evpnFromApi(createTestEVPNPath().GetNlri())
+	controller.redistributedStorage.Store(route, []string{"65000:100"}, routeUuid)
+	mockInjector.On("DelRoute", routeUuid).Return(nil)
+
+	assert.NoError(t, controller.ReloadConfig(dto.VrfDiff{Deleted: []oc.VrfConfig{vrf}}))
+
+	assert.Equal(t, []events.Type{events.Withdrawn}, publisher.types())
+	assert.Equal(t, events.ReasonVrfDeleted, publisher.events[0].Reason)
+}
+
+func TestLogEvent(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	event := vpnEvent(events.Added, "vrf_10", vpnRoute{Rd: "100:10", Prefix: "10.0.0.0", Prefixlen: 24}, "", "added")
+
+	logEvent(logger, event)
+	assert.Empty(t, hook.AllEntries())
+
+	event.Type = events.Rejected
+	logEvent(logger, event)
+	assert.Equal(t, logrus.DebugLevel, hook.LastEntry().Level)
+	assert.Equal(t, "vrf_10", hook.LastEntry().Data["vrf"])
+
+	logger.SetLevel(logrus.TraceLevel)
+	event.Type = events.Added
+	logEvent(logger, event)
+	assert.Equal(t, logrus.TraceLevel, hook.LastEntry().Level)
+}
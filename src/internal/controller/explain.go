@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/metrics"
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+const (
+	stepNlri         = "nlri"
+	stepVrf          = "vrf"
+	stepRouteTargets = "route-targets"
+	stepPrecedence   = "precedence"
+	stepAllowlist    = "allowlist"
+	stepGateway      = "gateway"
+	stepGenerate     = "generate"
+	stepAggregate    = "aggregate"
+	stepMaxPrefix    = "max-prefix"
+	stepDefaultOnly  = "default-originate"
+	stepInject       = "inject"
+)
+
+const notInjectedReason = "route is not injected, it is either queued or was rejected by GoBGP"
+
+// Walks the HandleUpdate pipeline against the path of the VRF without changing any state
+func (c *VPNv4Controller) Explain(path *api.Path, vrf dto.Vrf) dto.PathExplanation {
+	result := dto.PathExplanation{Direction: metrics.DirectionToEvpn, Neighbor: path.GetNeighborIp()}
+	route, err := vpnFromApi(path.GetNlri())
+	if err != nil {
+		result.Reject(stepNlri, fmt.Sprintf("cannot parse VPNv4 NLRI: %v", err))
+		return result
+	}
+	result.Source = route.String()
+	result.Pass(stepNlri, "VPNv4 route "+route.String())
+	known, ok := c.rdVrfMap.Load(route.Rd)
+	if !ok || known.Name != vrf.Name {
+		result.Reject(stepVrf, fmt.Sprintf("RD %s does not belong to VRF %s", route.Rd, vrf.Name))
+		return result
+	}
+	result.Pass(stepVrf, fmt.Sprintf("RD %s belongs to VRF %s", route.Rd, vrf.Name))
+	if c.overridden(known, route) {
+		result.Reject(stepPrecedence, "prefix is leased by the orchestrator, which takes precedence in VRF "+vrf.Name)
+		return result
+	}
+	if reason := c.unauthorized(known, route, path.GetNeighborIp()); reason != "" {
+		result.Reject(stepAllowlist, reason)
+		return result
+	}
+	if c.allowlist.Load() != nil && path.GetNeighborIp() != "" {
+		result.Pass(stepAllowlist, "prefix is allowed for neighbor "+path.GetNeighborIp())
+	}
+	if reason := pathSpoofed(known, route, path); reason != "" {
+		result.Reject(stepGateway, reason)
+		return result
+	}
+	if known.GatewayCheck != nil {
+		result.Pass(stepGateway, "gateway is allowed for neighbor "+path.GetNeighborIp())
+	}
+	generated, err := c.routeGen.GenRoute(route, known, path.GetPattrs())
+	if err != nil {
+		result.Reject(stepGenerate, err.Error())
+		return result
+	}
+	result.Generated = generatedEvpn(generated)
+	result.Pass(stepGenerate, "EVPN route "+result.Generated)
+	if c.summarized(known, route) {
+		result.Reject(stepAggregate, "suppressed by a summary-only aggregate of VRF "+vrf.Name)
+		return result
+	}
+	if blocking := c.limits.blocks(known, path.GetNeighborIp(), route); blocking != nil {
+		result.Reject(stepMaxPrefix, blocking.reason(events.ReasonMaxPrefix)+", clear it to redistribute the route")
+		return result
+	}
+	evpnUuid, _ := c.redistributedEvpn.Load(route)
+	if evpnUuid == uuid.Nil {
+		result.Reject(stepInject, notInjectedReason)
+		return result
+	}
+	if info, ok := c.routeInfo.Load(route); ok && info.generated != "" {
+		result.Generated = info.generated
+	}
+	result.Redistributed = true
+	detail := "injected as " + evpnUuid.String()
+	if c.withdrawHold.Pending(route.prefixKey()) {
+		detail += ", withdrawal is on hold"
+	}
+	result.Pass(stepInject, detail)
+	return result
+}
+
+// Walks the HandleUpdate pipeline against the path of the VRF without changing any state
+func (c *EvpnController) Explain(path *api.Path, vrf dto.Vrf) dto.PathExplanation {
+	result := dto.PathExplanation{Direction: metrics.DirectionToVpn, Neighbor: path.GetNeighborIp()}
+	route, err := evpnFromApi(path.GetNlri())
+	if errors.Is(err, invalidEvpnType) {
+		result.Reject(stepNlri, "only EVPN Type-5 routes are redistributed")
+		return result
+	}
+	if err != nil {
+		result.Reject(stepNlri, fmt.Sprintf("cannot parse EVPN NLRI: %v", err))
+		return result
+	}
+	result.Source = route.String()
+	if !route.isIPv4() {
+		result.Reject(stepNlri, "only IPv4 EVPN routes are redistributed, IPv6 ones meet default-originate conditions only")
+		return result
+	}
+	result.Pass(stepNlri, "EVPN route "+route.String())
+	routeTargets := extractRouteTargets(path.GetPattrs())
+	imported := mapset.NewThreadUnsafeSet(routeTargets...).Intersect(mapset.NewThreadUnsafeSet(vrf.ImportRouteTargets...))
+	if imported.Cardinality() == 0 || !c.existingRT.ContainsAny(routeTargets...) {
+		reason := "route has no route targets"
+		if len(routeTargets) > 0 {
+			reason = fmt.Sprintf("route targets %s are not imported by VRF %s", strings.Join(routeTargets, ", "), vrf.Name)
+		}
+		result.Reject(stepRouteTargets, reason)
+		return result
+	}
+	detail := fmt.Sprintf("VRF %s imports %s", vrf.Name, strings.Join(mapset.Sorted(imported), ", "))
+	if owner := c.vrfName(routeTargets); owner != vrf.Name {
+		detail += fmt.Sprintf(", the route is accounted to VRF %s", owner)
+	}
+	result.Pass(stepRouteTargets, detail)
+	generated := c.routeGen.GenRoute(route, path.GetPattrs())
+	result.Generated = generatedVpn(generated)
+	result.Pass(stepGenerate, "VPNv4 route "+result.Generated)
+	if owner := c.vrfName(routeTargets); c.suppression(owner, route) != "" {
+		result.Reject(stepDefaultOnly, "suppressed by default-originate of VRF "+owner)
+		return result
+	}
+	vpnUuid := c.redistributedStorage.Get(route)
+	if vpnUuid == uuid.Nil {
+		result.Reject(stepInject, notInjectedReason)
+		return result
+	}
+	result.Redistributed = true
+	result.Pass(stepInject, "injected as "+vpnUuid.String())
+	return result
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func stepNames(explanation dto.PathExplanation) []string {
+	names := []string{}
+	for _, step := range explanation.Steps {
+		names = append(names, step.Name)
+	}
+	return names
+}
+
+func TestVPNv4Controller_Explain(t *testing.T) {
+	vrf := dto.Vrf{Name: "test-vrf", Rd: "65000:100", Vni: 1000}
+	mockInjector := &mockEvpnInjector{}
+	controller := NewVPNv4Controller(mockInjector, []oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", Id: 1000}}, nil)
+
+	explanation := controller.Explain(createTestVPNPath(), vrf)
+	assert.Equal(t, metrics.DirectionToEvpn, explanation.Direction)
+	assert.Equal(t, "65000:100:10.0.0.0/24", explanation.Source)
+	assert.Equal(t, []string{stepNlri, stepVrf, stepGenerate, stepInject}, stepNames(explanation))
+	assert.False(t, explanation.Redistributed)
+	assert.Equal(t, notInjectedReason, explanation.Reason)
+	assert.Equal(t, "5:65000:100:10.0.0.0/24 Gw:192.168.1.1 Vni:1000", explanation.Generated)
+
+	evpnUuid := uuid.New()
+	mockInjector.On("AddType5Route", mock.Anything).Return(evpnUuid, nil)
+	assert.NoError(t, controller.HandleUpdate(context.Background(), createTestVPNPath()))
+	explanation = controller.Explain(createTestVPNPath(), vrf)
+	assert.True(t, explanation.Redistributed)
+	assert.Empty(t, explanation.Reason)
+	assert.Equal(t, "injected as "+evpnUuid.String(), explanation.Steps[3].Detail)
+}
+
+func TestVPNv4Controller_Explain_Rejected(t *testing.T) {
+	controller := NewVPNv4Controller(
+		&mockEvpnInjector{}, []oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", Id: 1000}}, nil,
+	)
+	noNexthop := createTestVPNPath()
+	noNexthop.Pattrs = []*anypb.Any{}
+
+	explanation := controller.Explain(noNexthop, dto.Vrf{Name: "test-vrf"})
+	assert.Equal(t, []string{stepNlri, stepVrf, stepGenerate}, stepNames(explanation))
+	assert.False(t, explanation.Steps[2].Passed)
+	assert.Contains(t, explanation.Reason, "nexthop")
+	assert.Empty(t, explanation.Generated)
+
+	explanation = controller.Explain(createTestVPNPath(), dto.Vrf{Name: "other-vrf"})
+	assert.Equal(t, []string{stepNlri, stepVrf}, stepNames(explanation))
+	assert.Equal(t, "RD 65000:100 does not belong to VRF other-vrf", explanation.Reason)
+}
+
+func TestEvpnController_Explain(t *testing.T) {
+	vrf := dto.Vrf{Name: "test-vrf", Rd: "65000:100", ImportRouteTargets: []string{"65000:100"}}
+	mockInjector := &mockVpnInjector{}
+	controller := NewEvpnController(
+		mockInjector,
+		[]oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", ImportRtList: []string{"65000:100"}}},
+		nil,
+	)
+
+	explanation := controller.Explain(createTestEVPNPath(), vrf)
+	assert.Equal(t, metrics.DirectionToVpn, explanation.Direction)
+	assert.Equal(t, []string{stepNlri, stepRouteTargets, stepGenerate, stepInject}, stepNames(explanation))
+	assert.Equal(t, "VRF test-vrf imports 65000:100", explanation.Steps[1].Detail)
+	assert.Equal(t, "65000:100:10.0.0.0/24", explanation.Generated)
+	assert.False(t, explanation.Redistributed)
+
+	mockInjector.On("AddRoute", mock.Anything).Return(uuid.New(), nil)
+	assert.NoError(t, controller.HandleUpdate(context.Background(), createTestEVPNPath()))
+	assert.True(t, controller.Explain(createTestEVPNPath(), vrf).Redistributed)
+}
+
+func TestEvpnController_Explain_Rejected(t *testing.T) {
+	controller := NewEvpnController(
+		&mockVpnInjector{},
+		[]oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", ImportRtList: []string{"65000:100"}}},
+		nil,
+	)
+	other := dto.Vrf{Name: "other-vrf", ImportRouteTargets: []string{"65000:200"}}
+
+	explanation := controller.Explain(createTestEVPNPath(), other)
+	assert.Equal(t, []string{stepNlri, stepRouteTargets}, stepNames(explanation))
+	assert.Equal(t, "route targets 65000:100 are not imported by VRF other-vrf", explanation.Reason)
+
+	rd, _ := anypb.New(&api.RouteDistinguisherTwoOctetASN{Admin: 65000, Assigned: 100})
+	macIp := createTestEVPNPath()
+	macIp.Nlri, _ = anypb.New(&api.EVPNMACIPAdvertisementRoute{Rd: rd, IpAddress: "10.0.0.1"})
+	explanation = controller.Explain(macIp, other)
+	assert.Equal(t, []string{stepNlri}, stepNames(explanation))
+	assert.Equal(t, "only EVPN Type-5 routes are redistributed", explanation.Reason)
+}
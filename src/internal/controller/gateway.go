@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/amyasnikov/berg/internal/utils"
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+// Reason to reject the route of the neighbor whose gateway is neither the neighbor itself
+// nor within the subnets allowed for it, empty if the VRF does not check gateways or the gateway is allowed.
+// Locally originated routes have no neighbor and are never rejected
+func spoofedGateway(vrf dto.Vrf, neighbor, gateway string) string {
+	if vrf.GatewayCheck == nil || neighbor == "" || neighbor == gateway {
+		return ""
+	}
+	reason := fmt.Sprintf("%s: gateway %s, neighbor %s", events.ReasonSpoofedGateway, gateway, neighbor)
+	neighborAddr, err := netip.ParseAddr(neighbor)
+	if err != nil {
+		return reason
+	}
+	gatewayAddr, err := netip.ParseAddr(gateway)
+	if err != nil {
+		return reason
+	}
+	for _, allowed := range vrf.GatewayCheck.Allowed {
+		if neighbors, err := utils.NeighborPrefix(allowed.Neighbor); err != nil || !neighbors.Contains(neighborAddr) {
+			continue
+		}
+		for _, subnet := range allowed.Subnets {
+			if prefix, err := utils.ParsePrefix(subnet); err == nil &&
+				prefix.Contains(gatewayAddr) {
+				return ""
+			}
+		}
+	}
+	return reason
+}
+
+// Gateway check of the received path, the paths without a next hop are left to route generation
+func pathSpoofed(vrf dto.Vrf, route vpnRoute, path *api.Path) string {
+	gateway, err := findNextHop(route, path.GetPattrs())
+	if err != nil {
+		return ""
+	}
+	return spoofedGateway(vrf, path.GetNeighborIp(), gateway)
+}
+
+// Rejects the path with a spoofed gateway
+func (c *VPNv4Controller) rejectSpoofed(vrf dto.Vrf, route vpnRoute, path *api.Path, reason string) error {
+	metrics.SpoofedGateways.WithLabelValues(vrf.Name).Inc()
+	c.logger.Warnf("VRF %s: route %s rejected, %s", vrf.Name, route, reason)
+	return c.rejectPath(vrf, route, path, reason)
+}
+
+// Withdraws the redistributed routes whose gateways the reloaded config does not allow anymore
+func (c *VPNv4Controller) withdrawSpoofed() error {
+	return c.withdrawRejected(func(vrf dto.Vrf, _ vpnRoute, info redistributionInfo) string {
+		reason := spoofedGateway(vrf, info.neighbor, info.route.Gateway)
+		if reason != "" {
+			metrics.SpoofedGateways.WithLabelValues(vrf.Name).Inc()
+		}
+		return reason
+	})
+}
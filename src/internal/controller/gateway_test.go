@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// The gateway of createNeighborPath is 192.168.1.1
+var testGatewayCheck = dto.GatewayCheck{Allowed: []dto.AllowedGateways{
+	{Neighbor: "192.168.0.0/24", Subnets: []string{"192.168.1.0/30"}},
+}}
+
+func gatewayExtensions(check *dto.GatewayCheck) map[string]dto.VrfExtensions {
+	return map[string]dto.VrfExtensions{"vrf_10": {GatewayCheck: check}}
+}
+
+func TestSpoofedGateway(t *testing.T) {
+	tests := []struct {
+		name     string
+		check    *dto.GatewayCheck
+		neighbor string
+		gateway  string
+		expected string
+	}{
+		{
+			name:     "No gateway check",
+			neighbor: "192.168.2.10",
+			gateway:  "10.0.0.1",
+		},
+		{
+			name:     "Gateway is the neighbor",
+			check:    &testGatewayCheck,
+			neighbor: "192.168.2.10",
+			gateway:  "192.168.2.10",
+		},
+		{
+			name:     "Gateway in the subnet of the neighbor",
+			check:    &testGatewayCheck,
+			neighbor: "192.168.0.10",
+			gateway:  "192.168.1.3",
+		},
+		{
+			name:    "Locally originated",
+			check:   &testGatewayCheck,
+			gateway: "10.0.0.1",
+		},
+		{
+			name:     "Gateway outside the subnet of the neighbor",
+			check:    &testGatewayCheck,
+			neighbor: "192.168.0.10",
+			gateway:  "192.168.1.4",
+			expected: "gateway does not belong to the neighbor: gateway 192.168.1.4, neighbor 192.168.0.10",
+		},
+		{
+			name:     "Neighbor without subnets",
+			check:    &testGatewayCheck,
+			neighbor: "192.168.2.10",
+			gateway:  "192.168.1.1",
+			expected: "gateway does not belong to the neighbor: gateway 192.168.1.1, neighbor 192.168.2.10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vrf := dto.NewVrf(orchestratedVrf, dto.VrfExtensions{GatewayCheck: tt.check})
+
+			assert.Equal(t, tt.expected, spoofedGateway(vrf, tt.neighbor, tt.gateway))
+		})
+	}
+}
+
+func TestGatewayCheck_HandleUpdate(t *testing.T) {
+	tests := []struct {
+		name           string
+		check          *dto.GatewayCheck
+		neighbor       string
+		batched        bool // received through HandleUpdates
+		expectedEvent  events.Type
+		expectedReason string
+		redistributed  int
+	}{
+		{
+			name:           "Gateway allowed",
+			check:          &testGatewayCheck,
+			neighbor:       "192.168.0.10",
+			expectedEvent:  events.Added,
+			expectedReason: events.ReasonSourceAdvertised,
+			redistributed:  1,
+		},
+		{
+			name:           "Gateway is the neighbor",
+			check:          &testGatewayCheck,
+			neighbor:       "192.168.1.1",
+			expectedEvent:  events.Added,
+			expectedReason: events.ReasonSourceAdvertised,
+			redistributed:  1,
+		},
+		{
+			name:           "Spoofed gateway",
+			check:          &testGatewayCheck,
+			neighbor:       "192.168.2.10",
+			expectedEvent:  events.Rejected,
+			expectedReason: "gateway does not belong to the neighbor: gateway 192.168.1.1, neighbor 192.168.2.10",
+		},
+		{
+			name:           "Spoofed gateway in batch",
+			check:          &testGatewayCheck,
+			neighbor:       "192.168.2.10",
+			batched:        true,
+			expectedEvent:  events.Rejected,
+			expectedReason: "gateway does not belong to the neighbor: gateway 192.168.1.1, neighbor 192.168.2.10",
+		},
+		{
+			name:           "No gateway check",
+			neighbor:       "192.168.2.10",
+			expectedEvent:  events.Added,
+			expectedReason: events.ReasonSourceAdvertised,
+			redistributed:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			injector := &mockEvpnInjector{}
+			injector.On("AddType5Route", mock.Anything).Return(uuid.New(), nil)
+			injector.On("AddType5Routes", mock.Anything).Return([]uuid.UUID{uuid.New()}, nil)
+			c := newTestControllers(
+				injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf}, gatewayExtensions(tt.check),
+			)
+			path := createNeighborPath("10.0.1.0", tt.neighbor)
+
+			if tt.batched {
+				require.NoError(t, c.vpn.HandleUpdates([]*api.Path{path}))
+			} else {
+				require.NoError(t, c.vpn.HandleUpdate(context.Background(), path))
+			}
+
+			assert.Equal(t, []events.Type{tt.expectedEvent}, c.publisher.types())
+			assert.Equal(t, tt.expectedReason, c.publisher.events[0].Reason)
+			assert.Equal(t, tt.neighbor, c.publisher.events[0].Neighbor)
+			assert.Len(t, c.vpn.ListRedistributed(), tt.redistributed)
+			assert.Equal(t, tt.redistributed == 1, c.vpn.Audit(path).Expected)
+			explanation := c.vpn.Explain(path, dto.NewVrf(orchestratedVrf, dto.VrfExtensions{GatewayCheck: tt.check}))
+			assert.Equal(t, tt.redistributed == 1, explanation.Redistributed)
+			if tt.redistributed == 0 {
+				assert.Equal(t, stepGateway, explanation.Steps[len(explanation.Steps)-1].Name)
+			}
+		})
+	}
+}
+
+func TestGatewayCheck_WithdrawsPreviousBestPath(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	evpnUuid := uuid.New()
+	injector.On("AddType5Route", mock.Anything).Return(evpnUuid, nil).Once()
+	injector.On("DelRoute", evpnUuid).Return(nil).Once()
+	c := newTestControllers(
+		injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf}, gatewayExtensions(&testGatewayCheck),
+	)
+	ctx := context.Background()
+
+	require.NoError(t, c.vpn.HandleUpdate(ctx, createNeighborPath("10.0.1.0", "192.168.0.10")))
+	// the best path is now learned from a neighbor the gateway does not belong to
+	require.NoError(t, c.vpn.HandleUpdate(ctx, createNeighborPath("10.0.1.0", "192.168.2.10")))
+
+	assert.Empty(t, c.vpn.ListRedistributed())
+	assert.Equal(t, []events.Type{events.Added, events.Withdrawn}, c.publisher.types())
+	assert.Equal(t, "192.168.2.10", c.publisher.events[1].Neighbor)
+	injector.AssertExpectations(t)
+}
+
+func TestGatewayCheck_ReloadConfig(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	evpnUuid := uuid.New()
+	injector.On("AddType5Route", withPrefix("10.0.1.0")).Return(evpnUuid, nil).Once()
+	injector.On("AddType5Route", withPrefix("10.0.2.0")).Return(uuid.New(), nil).Once()
+	injector.On("DelRoute", evpnUuid).Return(nil).Once()
+	c := newTestControllers(injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf}, gatewayExtensions(nil))
+	ctx := context.Background()
+
+	require.NoError(t, c.vpn.HandleUpdate(ctx, createNeighborPath("10.0.1.0", "192.168.2.10")))
+	require.NoError(t, c.vpn.HandleUpdate(ctx, createNeighborPath("10.0.2.0", "192.168.0.10")))
+	require.NoError(t, c.vpn.ReloadConfig(dto.VrfDiff{Extensions: gatewayExtensions(&testGatewayCheck)}))
+
+	listed := c.vpn.ListRedistributed()
+	require.Len(t, listed, 1)
+	assert.Equal(t, "65000:100:10.0.2.0/24", listed[0].Source)
+	last := c.publisher.events[len(c.publisher.events)-1]
+	assert.Equal(t, events.Withdrawn, last.Type)
+	assert.Equal(t, "192.168.2.10", last.Neighbor)
+	injector.AssertExpectations(t)
+}
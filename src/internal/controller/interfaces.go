@@ -7,10 +7,12 @@ import (
 
 type vpnInjector interface {
 	AddRoute(route dto.VPNRoute) (uuid.UUID, error)
+	AddRoutes(routes []dto.VPNRoute) ([]uuid.UUID, error)
 	DelRoute(uuid uuid.UUID) error
 }
 
 type evpnInjector interface {
 	AddType5Route(route dto.Evpn5Route) (uuid.UUID, error)
+	AddType5Routes(routes []dto.Evpn5Route) ([]uuid.UUID, error)
 	DelRoute(uuid uuid.UUID) error
 }
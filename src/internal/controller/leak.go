@@ -0,0 +1,505 @@
+package controller
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/logging"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+// Source of the routes leaked between the VRFs
+const LeakSource = "leak"
+
+// Route of the destination VRF leaked from another VRF
+type leakKey struct {
+	dst    string // VRF name
+	prefix netip.Prefix
+}
+
+// Leak rule from the source VRF to the destination one
+type leak struct {
+	src      string
+	dst      string
+	prefixes []netip.Prefix // empty means all the routes
+	evpn     bool
+}
+
+func (l leak) matches(prefix netip.Prefix) bool {
+	if len(l.prefixes) == 0 {
+		return true
+	}
+	for _, p := range l.prefixes {
+		if p.Bits() <= prefix.Bits() && p.Contains(prefix.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Routes injected for the leaked route, evpn is nil unless the rule exports it to EVPN
+type leakedRoute struct {
+	src           string
+	vpn           dto.VPNRoute
+	vpnUuid       uuid.UUID
+	evpn          *dto.Evpn5Route
+	evpnUuid      uuid.UUID
+	createdAt     time.Time
+	evpnCreatedAt time.Time
+	updatedAt     time.Time
+}
+
+// Re-originates the received routes of the VRFs in the other VRFs according to the leak rules:
+// as VPNv4 routes imported into the destination VRF and, if requested, as its Type-5 routes.
+// A route is not leaked into a VRF which has a route of the prefix of its own, and the leaked routes
+// are never leaked further, so they cannot loop back to their source VRF
+type Leaks struct {
+	lock         sync.Mutex
+	vpnInjector  vpnInjector
+	evpnInjector evpnInjector
+	vpn          *VPNv4Controller
+	vrfs         map[string]dto.Vrf         // by VRF name
+	rules        map[string][]leak          // by source VRF name
+	involved     map[string]bool            // VRFs either leaking or receiving routes, the others are not tracked
+	own          map[leakKey]dto.Evpn5Route // received routes of the involved VRFs, kept up to date by the updates
+	injected     map[leakKey]leakedRoute
+	events       events.Publisher
+	logger       *logrus.Logger
+}
+
+// vpn supplies the received routes of the VRFs
+func NewLeaks(
+	vpnInj vpnInjector, evpnInj evpnInjector, vpn *VPNv4Controller,
+	vrfCfg []oc.VrfConfig, vrfExt map[string]dto.VrfExtensions,
+) *Leaks {
+	l := &Leaks{
+		vpnInjector:  vpnInj,
+		evpnInjector: evpnInj,
+		vpn:          vpn,
+		vrfs:         newVrfMap(vrfCfg, vrfExt),
+		own:          map[leakKey]dto.Evpn5Route{},
+		injected:     map[leakKey]leakedRoute{},
+		events:       events.Discard{},
+		logger:       logging.Discard(),
+	}
+	l.buildRules()
+	return l
+}
+
+// Sets the receiver of the injection decisions
+func (l *Leaks) SetEventPublisher(publisher events.Publisher) {
+	l.events = publisher
+}
+
+func (l *Leaks) SetLogger(logger *logrus.Logger) {
+	l.logger = logger
+}
+
+// Applies the VRF changes, then leaks the routes according to the new rules
+func (l *Leaks) ReloadConfig(diff dto.VrfDiff) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	reloadVrfs(l.vrfs, diff)
+	l.buildRules()
+	return l.sync()
+}
+
+// Must be called with lock held
+func (l *Leaks) buildRules() {
+	l.rules = l.leakRules()
+	l.involved = map[string]bool{}
+	for src, rules := range l.rules {
+		l.involved[src] = true
+		for _, rule := range rules {
+			l.involved[rule.dst] = true
+		}
+	}
+}
+
+// Leak rules of the VRFs by source VRF name, rules of unknown VRFs are skipped.
+// Must be called with lock held
+func (l *Leaks) leakRules() map[string][]leak {
+	result := map[string][]leak{}
+	for name, vrf := range l.vrfs {
+		for _, rule := range vrf.Leaks {
+			if _, ok := l.vrfs[rule.Vrf]; !ok || rule.Vrf == name {
+				continue
+			}
+			prefixes := make([]netip.Prefix, 0, len(rule.Prefixes))
+			for _, prefix := range rule.Prefixes {
+				if parsed, err := netip.ParsePrefix(prefix); err == nil { // validated with the config
+					prefixes = append(prefixes, parsed.Masked())
+				}
+			}
+			pairs := [][2]string{}
+			if rule.Direction == dto.LeakImport || rule.Direction == dto.LeakBoth {
+				pairs = append(pairs, [2]string{rule.Vrf, name})
+			}
+			if rule.Direction == dto.LeakExport || rule.Direction == dto.LeakBoth {
+				pairs = append(pairs, [2]string{name, rule.Vrf})
+			}
+			for _, pair := range pairs {
+				rule := leak{src: pair[0], dst: pair[1], prefixes: prefixes, evpn: rule.Evpn}
+				result[rule.src] = append(result[rule.src], rule)
+			}
+		}
+	}
+	return result
+}
+
+// Recollects the received routes, leaks the ones matching the rules
+// and withdraws the leaked routes which no longer match. Must be called with lock held
+func (l *Leaks) sync() error {
+	l.own = map[leakKey]dto.Evpn5Route{}
+	if len(l.rules) == 0 && len(l.injected) == 0 {
+		return nil
+	}
+	if l.vpn != nil {
+		l.vpn.contributors(func(vrfName string, received vpnRoute, route dto.Evpn5Route) {
+			prefix, err := received.netipPrefix()
+			if err != nil || !l.involved[vrfName] {
+				return
+			}
+			key := leakKey{dst: vrfName, prefix: prefix}
+			if _, leaked := l.injected[key]; leaked {
+				return // the leaked route came back, it is not a route of the VRF
+			}
+			if prev, ok := l.own[key]; !ok || generatedEvpn(route) < generatedEvpn(prev) {
+				l.own[key] = route
+			}
+		})
+	}
+	wanted := map[leakKey]leakedRoute{}
+	prefixes := map[netip.Prefix]bool{}
+	for key := range l.own {
+		if !prefixes[key.prefix] {
+			prefixes[key.prefix] = true
+			l.collect(key.prefix, wanted)
+		}
+	}
+	var merr error
+	for key := range l.injected {
+		if _, ok := wanted[key]; !ok {
+			if err := l.settle(key, wanted); err != nil {
+				merr = multierror.Append(merr, err)
+			}
+		}
+	}
+	for key := range wanted {
+		if err := l.settle(key, wanted); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	return merr
+}
+
+// Leaks the redistributed or suppressed route of the VRF into the other VRFs, if the rules say so
+func (l *Leaks) contribute(vrfName string, route vpnRoute, generated dto.Evpn5Route) error {
+	prefix, err := route.netipPrefix()
+	if err != nil {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.involved[vrfName] {
+		return nil
+	}
+	key := leakKey{dst: vrfName, prefix: prefix}
+	if _, leaked := l.injected[key]; leaked {
+		// the leaked route came back, a route of the VRF arriving once the prefix is leaked is taken for it
+		return nil
+	}
+	l.own[key] = generated
+	return l.leakPrefix(prefix)
+}
+
+// Withdraws the routes leaked from the route of the VRF which is neither redistributed nor suppressed anymore
+func (l *Leaks) uncontribute(vrfName string, route vpnRoute) error {
+	prefix, err := route.netipPrefix()
+	if err != nil {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	key := leakKey{dst: vrfName, prefix: prefix}
+	if _, ok := l.own[key]; !ok {
+		return nil
+	}
+	delete(l.own, key)
+	return l.leakPrefix(prefix)
+}
+
+// Settles the leaked routes of the prefix in every destination VRF. Must be called with lock held
+func (l *Leaks) leakPrefix(prefix netip.Prefix) error {
+	wanted := map[leakKey]leakedRoute{}
+	l.collect(prefix, wanted)
+	var merr error
+	for vrfName := range l.involved {
+		if err := l.settle(leakKey{dst: vrfName, prefix: prefix}, wanted); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	return merr
+}
+
+// Adds the routes of the prefix to leak to wanted. Must be called with lock held
+func (l *Leaks) collect(prefix netip.Prefix, wanted map[leakKey]leakedRoute) {
+	for src, rules := range l.rules {
+		route, ok := l.own[leakKey{dst: src, prefix: prefix}]
+		if !ok {
+			continue
+		}
+		for _, rule := range rules {
+			dstKey := leakKey{dst: rule.dst, prefix: prefix}
+			if _, ok := l.own[dstKey]; ok || !rule.matches(prefix) {
+				continue
+			}
+			// leaked from several VRFs the first one by name wins, of the duplicate rules the one exporting to EVPN
+			if prev, ok := wanted[dstKey]; ok && (prev.src < rule.src || prev.src == rule.src && prev.evpn != nil) {
+				continue
+			}
+			wanted[dstKey] = l.leakedRoute(rule, route)
+		}
+	}
+}
+
+// Injects or replaces the leaked route if it is wanted, withdraws it otherwise. Must be called with lock held
+func (l *Leaks) settle(key leakKey, wanted map[leakKey]leakedRoute) error {
+	prev, loaded := l.injected[key]
+	route, ok := wanted[key]
+	if !ok {
+		if !loaded {
+			return nil
+		}
+		delete(l.injected, key)
+		return l.withdraw(key, prev, l.withdrawReason(key, prev))
+	}
+	injected, err := l.inject(key, route, prev, loaded)
+	if injected.vpnUuid != uuid.Nil {
+		l.injected[key] = injected
+	}
+	if err != nil {
+		return fmt.Errorf("VRF %s: %w", key.dst, err)
+	}
+	return nil
+}
+
+// Routes of the destination VRF of the rule for the received route of its source VRF
+func (l *Leaks) leakedRoute(rule leak, route dto.Evpn5Route) leakedRoute {
+	dst := l.vrfs[rule.dst]
+	leaked := leakedRoute{
+		src: rule.src,
+		vpn: dto.VPNRoute{
+			Rd:           dst.Rd,
+			RouteTargets: dst.ImportRouteTargets,
+			Prefix:       route.Prefix,
+			Prefixlen:    route.Prefixlen,
+			PathAttrs:    route.PathAttrs,
+		},
+	}
+	if rule.evpn {
+		evpnRoute := route
+		evpnRoute.Rd = dst.Rd
+		evpnRoute.RouteTargets = dst.ExportRouteTargets
+		evpnRoute.Vni = dst.Vni
+		evpnRoute.ExtCommunities = nil // mobility of the source VRF
+		leaked.evpn = &evpnRoute
+	}
+	return leaked
+}
+
+// Must be called with lock held
+func (l *Leaks) withdrawReason(key leakKey, injected leakedRoute) string {
+	if _, ok := l.vrfs[key.dst]; !ok {
+		return events.ReasonVrfDeleted
+	}
+	if _, ok := l.vrfs[injected.src]; !ok {
+		return events.ReasonVrfDeleted
+	}
+	for _, rule := range l.rules[injected.src] {
+		if rule.dst == key.dst && rule.matches(key.prefix) {
+			return events.ReasonLeakSourceGone
+		}
+	}
+	return events.ReasonLeakRemoved
+}
+
+// Injects the parts of the leaked route which differ from the ones injected before, if loaded.
+// The VPNv4 UUID of the result is zero unless it is injected
+func (l *Leaks) inject(key leakKey, route leakedRoute, prev leakedRoute, loaded bool) (leakedRoute, error) {
+	reason := "leaked from VRF " + route.src
+	now := time.Now()
+	result := route
+	result.createdAt, result.updatedAt, result.evpnCreatedAt = now, now, now
+	if loaded {
+		result.createdAt, result.evpnCreatedAt = prev.createdAt, prev.evpnCreatedAt
+		result.vpnUuid, result.evpnUuid = prev.vpnUuid, prev.evpnUuid
+		result.updatedAt = prev.updatedAt
+	}
+	var merr error
+	if !loaded || !sameVpnRoute(prev.vpn, route.vpn) {
+		vpnUuid, err := l.vpnInjector.AddRoute(route.vpn)
+		observeRoute(key.dst, metrics.DirectionToVpn, metrics.OperationInject, err)
+		generated := generatedVpn(route.vpn)
+		if err != nil {
+			l.emit(l.event(events.Rejected, metrics.DirectionToVpn, key, generated, err.Error()))
+			return prev, err
+		}
+		eventType := events.Added
+		if loaded {
+			eventType = events.Replaced
+			if generatedVpn(prev.vpn) != generated { // the same NLRI is replaced in place
+				l.vpnInjector.DelRoute(prev.vpnUuid)
+			}
+		}
+		result.vpnUuid, result.updatedAt = vpnUuid, now
+		l.emit(l.event(eventType, metrics.DirectionToVpn, key, generated, reason))
+	}
+	evpnLoaded := loaded && prev.evpn != nil
+	switch {
+	case route.evpn == nil && evpnLoaded:
+		result.evpnUuid = uuid.Nil
+		if err := l.withdrawEvpn(key, prev, events.ReasonLeakRemoved); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	case route.evpn != nil && (!evpnLoaded || !sameEvpnRoute(*prev.evpn, *route.evpn)):
+		evpnUuid, err := l.evpnInjector.AddType5Route(*route.evpn)
+		observeRoute(key.dst, metrics.DirectionToEvpn, metrics.OperationInject, err)
+		generated := generatedEvpn(*route.evpn)
+		if err != nil {
+			l.emit(l.event(events.Rejected, metrics.DirectionToEvpn, key, generated, err.Error()))
+			result.evpn, result.evpnUuid = prev.evpn, prev.evpnUuid
+			merr = multierror.Append(merr, err)
+			break
+		}
+		eventType := events.Added
+		if evpnLoaded {
+			eventType = events.Replaced
+			if generatedEvpn(*prev.evpn) != generated { // the same NLRI is replaced in place
+				l.evpnInjector.DelRoute(prev.evpnUuid)
+			}
+		} else {
+			result.evpnCreatedAt = now
+		}
+		result.evpnUuid, result.updatedAt = evpnUuid, now
+		l.emit(l.event(eventType, metrics.DirectionToEvpn, key, generated, reason))
+	}
+	return result, merr
+}
+
+func (l *Leaks) withdraw(key leakKey, injected leakedRoute, reason string) error {
+	var merr error
+	if injected.evpn != nil {
+		if err := l.withdrawEvpn(key, injected, reason); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	l.emit(l.event(events.Withdrawn, metrics.DirectionToVpn, key, generatedVpn(injected.vpn), reason))
+	err := l.vpnInjector.DelRoute(injected.vpnUuid)
+	observeRoute(key.dst, metrics.DirectionToVpn, metrics.OperationWithdraw, err)
+	if err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	return merr
+}
+
+func (l *Leaks) withdrawEvpn(key leakKey, injected leakedRoute, reason string) error {
+	l.emit(l.event(events.Withdrawn, metrics.DirectionToEvpn, key, generatedEvpn(*injected.evpn), reason))
+	err := l.evpnInjector.DelRoute(injected.evpnUuid)
+	observeRoute(key.dst, metrics.DirectionToEvpn, metrics.OperationWithdraw, err)
+	return err
+}
+
+func (l *Leaks) emit(event events.Event) {
+	logEvent(l.logger, event)
+	l.events.Publish(event)
+}
+
+func (l *Leaks) event(eventType events.Type, direction string, key leakKey, generated, reason string) events.Event {
+	return events.Event{
+		Time:      time.Now(),
+		Type:      eventType,
+		Vrf:       key.dst,
+		Direction: direction,
+		Prefix:    key.prefix.String(),
+		Source:    LeakSource,
+		Generated: generated,
+		Reason:    reason,
+	}
+}
+
+// Injected routes of the leaks sorted by VRF and prefix, Source is LeakSource
+func (l *Leaks) ListRedistributed() []dto.RedistributedRoute {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	result := []dto.RedistributedRoute{}
+	for key, injected := range l.injected {
+		result = append(result, dto.RedistributedRoute{
+			Vrf:       key.dst,
+			Direction: metrics.DirectionToVpn,
+			Prefix:    key.prefix.String(),
+			Source:    LeakSource,
+			Generated: generatedVpn(injected.vpn),
+			Uuid:      injected.vpnUuid,
+			CreatedAt: injected.createdAt,
+			UpdatedAt: injected.updatedAt,
+		})
+		if injected.evpn != nil {
+			result = append(result, dto.RedistributedRoute{
+				Vrf:       key.dst,
+				Direction: metrics.DirectionToEvpn,
+				Prefix:    key.prefix.String(),
+				Source:    LeakSource,
+				Generated: generatedEvpn(*injected.evpn),
+				Uuid:      injected.evpnUuid,
+				CreatedAt: injected.evpnCreatedAt,
+				UpdatedAt: injected.updatedAt,
+			})
+		}
+	}
+	sortRedistributed(result)
+	return result
+}
+
+// Number of leaked routes by direction and VRF name
+func (l *Leaks) RedistributedRoutes() map[string]map[string]int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	result := map[string]map[string]int{metrics.DirectionToVpn: {}, metrics.DirectionToEvpn: {}}
+	for key, injected := range l.injected {
+		result[metrics.DirectionToVpn][key.dst]++
+		if injected.evpn != nil {
+			result[metrics.DirectionToEvpn][key.dst]++
+		}
+	}
+	return result
+}
+
+func sameVpnRoute(a, b dto.VPNRoute) bool {
+	return a.Rd == b.Rd && a.Prefix == b.Prefix && a.Prefixlen == b.Prefixlen &&
+		slices.Equal(a.RouteTargets, b.RouteTargets) && sameAttrs(a.PathAttrs, b.PathAttrs)
+}
+
+func sameEvpnRoute(a, b dto.Evpn5Route) bool {
+	return a.Rd == b.Rd && a.Prefix == b.Prefix && a.Prefixlen == b.Prefixlen && a.Gateway == b.Gateway &&
+		a.Vni == b.Vni && slices.Equal(a.RouteTargets, b.RouteTargets) && sameAttrs(a.PathAttrs, b.PathAttrs)
+}
+
+func sameAttrs[T proto.Message](a, b []T) bool {
+	return slices.EqualFunc(a, b, func(x, y T) bool { return proto.Equal(x, y) })
+}
+
+// Sets the leaks of the received routes into the other VRFs
+func (c *VPNv4Controller) SetLeaks(leaks *Leaks) {
+	c.leaks = leaks
+}
@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Routes are leaked between orchestratedVrf and this one
+var leakVrf = oc.VrfConfig{
+	Name: "vrf_20", Id: 20, Rd: "65000:200", ImportRtList: []string{"65000:201"}, ExportRtList: []string{"65000:202"},
+}
+
+// VPNv4 path of the VRF of the RD 65000:<assigned>
+func createLeakPath(prefix string, assigned uint32) *api.Path {
+	path := createAggregatedPath(prefix, 65001)
+	rd, _ := anypb.New(&api.RouteDistinguisherTwoOctetASN{Admin: 65000, Assigned: assigned})
+	path.Nlri, _ = anypb.New(&api.LabeledVPNIPAddressPrefix{
+		Rd: rd, Prefix: prefix, PrefixLen: 24, Labels: []uint32{1000},
+	})
+	return path
+}
+
+func leakExtensions(rules ...dto.LeakRule) map[string]dto.VrfExtensions {
+	return map[string]dto.VrfExtensions{"vrf_20": {Leaks: rules}}
+}
+
+// Reasons of the events of the leaked routes
+func leakReasons(publisher *recordingPublisher) []string {
+	result := []string{}
+	for _, event := range publisher.events {
+		if event.Source == LeakSource {
+			result = append(result, event.Reason)
+		}
+	}
+	return result
+}
+
+func TestLeaks_HandleUpdate(t *testing.T) {
+	tests := []struct {
+		name               string
+		rules              []dto.LeakRule
+		path               *api.Path
+		expectedGenerated  []string
+		expectedDirections []string
+	}{
+		{
+			name:               "Leaked to VPN",
+			rules:              []dto.LeakRule{{Vrf: "vrf_10"}},
+			path:               createLeakPath("10.0.1.0", 100),
+			expectedGenerated:  []string{"65000:200:10.0.1.0/24"},
+			expectedDirections: []string{metrics.DirectionToVpn},
+		},
+		{
+			name:               "Leaked to VPN and EVPN",
+			rules:              []dto.LeakRule{{Vrf: "vrf_10", Prefixes: []string{"10.0.0.0/16"}, Evpn: true}},
+			path:               createLeakPath("10.0.1.0", 100),
+			expectedGenerated:  []string{"65000:200:10.0.1.0/24", "5:65000:200:10.0.1.0/24 Gw:192.168.1.1 Vni:20"},
+			expectedDirections: []string{metrics.DirectionToVpn, metrics.DirectionToEvpn},
+		},
+		{
+			name:  "Prefix not matched",
+			rules: []dto.LeakRule{{Vrf: "vrf_10", Prefixes: []string{"10.0.0.0/16"}, Evpn: true}},
+			path:  createLeakPath("10.1.0.0", 100),
+		},
+		{
+			name:  "Rule of another VRF",
+			rules: []dto.LeakRule{{Vrf: "vrf_30"}},
+			path:  createLeakPath("10.0.1.0", 100),
+		},
+		{
+			name: "No rules",
+			path: createLeakPath("10.0.1.0", 100),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vpnInjector, evpnInjector := &mockVpnInjector{}, &mockEvpnInjector{}
+			vpnInjector.On("AddRoute", mock.Anything).Return(uuid.New(), nil)
+			vpnInjector.On("DelRoute", mock.Anything).Return(nil)
+			evpnInjector.On("AddType5Route", mock.Anything).Return(uuid.New(), nil)
+			evpnInjector.On("DelRoute", mock.Anything).Return(nil)
+			c := newTestControllers(
+				evpnInjector, vpnInjector, []oc.VrfConfig{orchestratedVrf, leakVrf}, leakExtensions(tt.rules...),
+			)
+
+			require.NoError(t, c.vpn.HandleUpdate(context.Background(), tt.path))
+			require.NoError(t, c.leaks.ReloadConfig(dto.VrfDiff{})) // nothing changed
+
+			listed := c.leaks.ListRedistributed()
+			require.Len(t, listed, len(tt.expectedGenerated))
+			for i, route := range listed {
+				assert.Equal(t, LeakSource, route.Source)
+				assert.Equal(t, "vrf_20", route.Vrf)
+				assert.Equal(t, tt.expectedGenerated[i], route.Generated)
+				assert.Equal(t, tt.expectedDirections[i], route.Direction)
+			}
+			if tt.rules == nil {
+				assert.Empty(t, c.leaks.own) // the routes of VRFs without rules are not tracked
+			}
+			if len(listed) == 0 {
+				vpnInjector.AssertNotCalled(t, "AddRoute", mock.Anything)
+				return
+			}
+			reasons := leakReasons(c.publisher)
+			require.Len(t, reasons, len(listed))
+			for _, reason := range reasons {
+				assert.Equal(t, "leaked from VRF vrf_10", reason)
+			}
+
+			// the leaked routes never outlive their source
+			c.publisher.events = nil
+			require.NoError(t, c.vpn.HandleWithdraw(context.Background(), tt.path))
+			assert.Empty(t, c.leaks.ListRedistributed())
+			reasons = leakReasons(c.publisher)
+			require.Len(t, reasons, len(listed))
+			for _, reason := range reasons {
+				assert.Equal(t, events.ReasonLeakSourceGone, reason)
+			}
+		})
+	}
+}
+
+func TestLeaks_ReloadConfig(t *testing.T) {
+	vpnInjector, evpnInjector := &mockVpnInjector{}, &mockEvpnInjector{}
+	leakedUuid, leakedEvpnUuid := uuid.New(), uuid.New()
+	vpnInjector.On("AddRoute", withVpnPrefix("10.0.1.0")).Return(leakedUuid, nil).Once()
+	withRd := func(rd string) any {
+		return mock.MatchedBy(func(route dto.Evpn5Route) bool { return route.Rd == rd })
+	}
+	evpnInjector.On("AddType5Route", withRd("65000:100")).Return(uuid.New(), nil).Once()
+	evpnInjector.On("AddType5Route", withRd("65000:200")).Return(leakedEvpnUuid, nil).Once()
+	c := newTestControllers(
+		evpnInjector, vpnInjector, []oc.VrfConfig{orchestratedVrf, leakVrf},
+		leakExtensions(dto.LeakRule{Vrf: "vrf_10", Evpn: true}),
+	)
+	require.NoError(t, c.vpn.HandleUpdate(context.Background(), createLeakPath("10.0.1.0", 100)))
+
+	route := vpnInjector.Calls[0].Arguments.Get(0).(dto.VPNRoute)
+	assert.Equal(t, "65000:200", route.Rd)
+	assert.Equal(t, []string{"65000:201"}, route.RouteTargets)
+	assert.Equal(t, uint32(24), route.Prefixlen)
+	leaked := evpnInjector.Calls[1].Arguments.Get(0).(dto.Evpn5Route)
+	assert.Equal(t, "10.0.1.0", leaked.Prefix)
+	assert.Equal(t, uint32(20), leaked.Vni)
+	assert.Equal(t, []string{"65000:202"}, leaked.RouteTargets)
+	assert.Equal(t, "192.168.1.1", leaked.Gateway)
+	assert.Equal(t, map[string]map[string]int{
+		metrics.DirectionToVpn:  {"vrf_20": 1},
+		metrics.DirectionToEvpn: {"vrf_20": 1},
+	}, c.leaks.RedistributedRoutes())
+
+	// the rule is gone, so are the leaked routes
+	vpnInjector.On("DelRoute", leakedUuid).Return(nil).Once()
+	evpnInjector.On("DelRoute", leakedEvpnUuid).Return(nil).Once()
+	c.publisher.events = nil
+	require.NoError(t, c.leaks.ReloadConfig(dto.VrfDiff{Extensions: map[string]dto.VrfExtensions{}}))
+
+	assert.Empty(t, c.leaks.ListRedistributed())
+	assert.Equal(t, []events.Type{events.Withdrawn, events.Withdrawn}, c.publisher.types())
+	assert.Equal(t, []string{events.ReasonLeakRemoved, events.ReasonLeakRemoved}, c.publisher.reasons())
+	vpnInjector.AssertExpectations(t)
+	evpnInjector.AssertExpectations(t)
+}
+
+func TestLeaks_OwnRoutes(t *testing.T) {
+	vpnInjector, evpnInjector := &mockVpnInjector{}, &mockEvpnInjector{}
+	vpnInjector.On("AddRoute", withVpnPrefix("10.0.2.0")).Return(uuid.New(), nil).Once()
+	evpnInjector.On("AddType5Route", mock.Anything).Return(uuid.New(), nil)
+	c := newTestControllers(evpnInjector, vpnInjector, []oc.VrfConfig{orchestratedVrf, leakVrf}, leakExtensions())
+
+	require.NoError(t, c.vpn.HandleUpdate(context.Background(), createLeakPath("10.0.1.0", 100)))
+	require.NoError(t, c.vpn.HandleUpdate(context.Background(), createLeakPath("10.0.1.0", 200)))
+	require.NoError(t, c.vpn.HandleUpdate(context.Background(), createLeakPath("10.0.2.0", 100)))
+	require.NoError(t, c.leaks.ReloadConfig(dto.VrfDiff{
+		Extensions: leakExtensions(dto.LeakRule{Vrf: "vrf_10", Direction: dto.LeakBoth}),
+	}))
+	// the leaked route reflected back to berg is not leaked back to its source VRF
+	require.NoError(t, c.vpn.HandleUpdate(context.Background(), createLeakPath("10.0.2.0", 200)))
+
+	listed := c.leaks.ListRedistributed()
+	require.Len(t, listed, 1)
+	assert.Equal(t, "vrf_20", listed[0].Vrf)
+	assert.Equal(t, "10.0.2.0/24", listed[0].Prefix)
+	vpnInjector.AssertExpectations(t)
+}
+
+func TestLeaks_WithdrawDuringReload(t *testing.T) {
+	vpnInjector, evpnInjector := &mockVpnInjector{}, &mockEvpnInjector{}
+	vpnInjector.On("AddRoute", withVpnPrefix("10.0.1.0")).Return(uuid.New(), nil)
+	vpnInjector.On("DelRoute", mock.Anything).Return(nil)
+	evpnInjector.On("DelRoute", mock.Anything).Return(nil)
+	evpnInjector.On("AddType5Route", mock.Anything).Return(uuid.New(), nil)
+	rule := dto.LeakRule{Vrf: "vrf_10"}
+	c := newTestControllers(evpnInjector, vpnInjector, []oc.VrfConfig{orchestratedVrf, leakVrf}, leakExtensions(rule))
+	diff := dto.VrfDiff{Extensions: leakExtensions(rule)}
+	path := createLeakPath("10.0.1.0", 100)
+
+	for range 50 {
+		require.NoError(t, c.vpn.HandleUpdate(context.Background(), path))
+		require.Len(t, c.leaks.ListRedistributed(), 1)
+		withdrawn := make(chan error)
+		go func() { withdrawn <- c.vpn.HandleWithdraw(context.Background(), path) }()
+		require.NoError(t, c.leaks.ReloadConfig(diff))
+		require.NoError(t, <-withdrawn)
+		// the leaked route never outlives its source, whichever comes first
+		require.Empty(t, c.leaks.ListRedistributed())
+	}
+}
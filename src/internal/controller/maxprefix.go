@@ -0,0 +1,316 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/hashicorp/go-multierror"
+)
+
+// Limit of the VRF with empty neighbor, of the neighbor in the VRF otherwise
+type limitKey = dto.MaxPrefixBlock
+
+type limitState struct {
+	warned   bool        // warning threshold reached
+	exceeded *limitCheck // limit exceeded, new routes are blocked unless the action is warn
+}
+
+// Limit checked against a route along with its configured value
+type limitCheck struct {
+	key   limitKey
+	limit uint32
+}
+
+func (l limitCheck) reason(base string) string {
+	if l.key.Neighbor == "" {
+		return fmt.Sprintf("%s: %d routes of VRF %s", base, l.limit, l.key.Vrf)
+	}
+	return fmt.Sprintf("%s: %d routes of neighbor %s", base, l.limit, l.key.Neighbor)
+}
+
+func (l limitCheck) label() string {
+	if l.key.Neighbor == "" {
+		return metrics.LimitVrf
+	}
+	return metrics.LimitNeighbor
+}
+
+// Outcome of the max-prefix check of a new route
+type admission struct {
+	admitted bool
+	warned   []limitCheck // limits whose warning threshold the route reached
+	exceeded *limitCheck  // limit exceeded by the route, or the one blocking it
+	blocked  bool         // exceeded before the route, nothing has changed
+	withdraw bool         // routes of the neighbor are to be withdrawn
+}
+
+// Counts the redistributed routes by VRF and neighbor against the max-prefix limits of the VRFs
+type prefixLimits struct {
+	lock    sync.Mutex
+	routes  map[vpnRoute]limitKey // counted route -> its neighbor limit
+	counts  map[limitKey]int
+	states  map[limitKey]limitState
+	cleared []limitKey // unblocked since the last takeCleared
+}
+
+func newPrefixLimits() *prefixLimits {
+	return &prefixLimits{
+		routes: map[vpnRoute]limitKey{},
+		counts: map[limitKey]int{},
+		states: map[limitKey]limitState{},
+	}
+}
+
+// Limits of the VRF applying to the routes of the neighbor, zero limits are skipped
+func limitChecks(vrf dto.Vrf, neighbor string) []limitCheck {
+	if vrf.MaxPrefix == nil {
+		return nil
+	}
+	checks := []limitCheck{}
+	if vrf.MaxPrefix.Vrf > 0 {
+		checks = append(checks, limitCheck{key: limitKey{Vrf: vrf.Name}, limit: vrf.MaxPrefix.Vrf})
+	}
+	if vrf.MaxPrefix.Neighbor > 0 {
+		checks = append(checks, limitCheck{key: limitKey{Vrf: vrf.Name, Neighbor: neighbor}, limit: vrf.MaxPrefix.Neighbor})
+	}
+	return checks
+}
+
+// Counts the route unless one of the limits blocks it. Routes counted before are always admitted
+func (p *prefixLimits) admit(vrf dto.Vrf, neighbor string, route vpnRoute) (result admission) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if key, ok := p.routes[route]; ok {
+		if key.Neighbor != neighbor { // the best path is learned from another neighbor now
+			p.counts[key]--
+			key.Neighbor = neighbor
+			p.routes[route] = key
+			p.counts[key]++
+		}
+		result.admitted = true
+		return result
+	}
+	checks := limitChecks(vrf, neighbor)
+	if blocking := p.blocking(vrf, neighbor, checks); blocking != nil {
+		result.exceeded, result.blocked = blocking, true
+		return result
+	}
+	for _, check := range checks {
+		count := uint32(p.counts[check.key]) + 1
+		state := p.states[check.key]
+		if count > check.limit {
+			if state.exceeded == nil {
+				state.exceeded = &check
+				result.exceeded = &check
+			}
+			p.states[check.key] = state
+			break
+		}
+		state.exceeded = nil // the action is warn, otherwise the limit would block the route
+		threshold := vrf.MaxPrefix.Warning
+		switch {
+		case threshold == 0:
+		case uint64(count)*100 < uint64(check.limit)*uint64(threshold):
+			state.warned = false
+		case !state.warned:
+			state.warned = true
+			result.warned = append(result.warned, check)
+		}
+		p.states[check.key] = state
+	}
+	switch {
+	case result.exceeded == nil || vrf.MaxPrefix.Action == dto.MaxPrefixWarn:
+		key := limitKey{Vrf: vrf.Name, Neighbor: neighbor}
+		p.routes[route] = key
+		p.counts[key]++
+		p.counts[limitKey{Vrf: vrf.Name}]++
+		result.admitted = true
+	case vrf.MaxPrefix.Action == dto.MaxPrefixWithdraw:
+		// the neighbor exceeding either limit is blocked, so the other neighbors of the VRF are not
+		delete(p.states, result.exceeded.key)
+		p.states[limitKey{Vrf: vrf.Name, Neighbor: neighbor}] = limitState{exceeded: result.exceeded}
+		result.withdraw = true
+	}
+	return result
+}
+
+// Exceeded limit blocking the new routes of the neighbor, nil if none. Must be called with lock held
+func (p *prefixLimits) blocking(vrf dto.Vrf, neighbor string, checks []limitCheck) *limitCheck {
+	if vrf.MaxPrefix == nil || vrf.MaxPrefix.Action == dto.MaxPrefixWarn {
+		return nil
+	}
+	for _, check := range checks {
+		if exceeded := p.states[check.key].exceeded; exceeded != nil {
+			return exceeded
+		}
+	}
+	// the neighbor exceeding the VRF limit is blocked with the withdraw action
+	return p.states[limitKey{Vrf: vrf.Name, Neighbor: neighbor}].exceeded
+}
+
+// Limit blocking the new route of the neighbor, nil if the route would be admitted or is counted already
+func (p *prefixLimits) blocks(vrf dto.Vrf, neighbor string, route vpnRoute) *limitCheck {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.routes[route]; ok {
+		return nil
+	}
+	return p.blocking(vrf, neighbor, limitChecks(vrf, neighbor))
+}
+
+func (p *prefixLimits) remove(route vpnRoute) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	key, ok := p.routes[route]
+	if !ok {
+		return
+	}
+	delete(p.routes, route)
+	p.counts[key]--
+	p.counts[limitKey{Vrf: key.Vrf}]--
+}
+
+// Counted routes of the neighbor in the VRF
+func (p *prefixLimits) neighborRoutes(key limitKey) []vpnRoute {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	result := []vpnRoute{}
+	for route, routeKey := range p.routes {
+		if routeKey == key {
+			result = append(result, route)
+		}
+	}
+	return result
+}
+
+// Unblocks the exceeded limits of the VRF, only the one of the neighbor unless it is empty.
+// Returns the unblocked limits sorted by neighbor
+func (p *prefixLimits) clear(vrf, neighbor string) []limitKey {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	cleared := []limitKey{}
+	for key, state := range p.states {
+		if key.Vrf != vrf || neighbor != "" && key.Neighbor != neighbor {
+			continue
+		}
+		delete(p.states, key)
+		if state.exceeded != nil {
+			cleared = append(cleared, key)
+		}
+	}
+	sort.Slice(cleared, func(i, j int) bool { return cleared[i].Neighbor < cleared[j].Neighbor })
+	p.cleared = append(p.cleared, cleared...)
+	return cleared
+}
+
+// Limits unblocked since the last call
+func (p *prefixLimits) takeCleared() []limitKey {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	cleared := p.cleared
+	p.cleared = nil
+	return cleared
+}
+
+// Forgets the limits of the deleted VRF, its routes are removed one by one
+func (p *prefixLimits) forgetVrf(vrf string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for key := range p.states {
+		if key.Vrf == vrf {
+			delete(p.states, key)
+		}
+	}
+}
+
+// Checks the max-prefix limits of the VRF before the new route of the neighbor is redistributed,
+// publishing the warnings and the rejection. Withdraws the routes of the neighbor if the action says so
+func (c *VPNv4Controller) admit(vrf dto.Vrf, route vpnRoute, neighbor string) bool {
+	result := c.limits.admit(vrf, neighbor, route)
+	for _, check := range result.warned {
+		metrics.MaxPrefix.WithLabelValues(vrf.Name, check.label(), "warning").Inc()
+		event := vpnEvent(events.Warning, vrf.Name, route, "", check.reason(events.ReasonMaxPrefixWarning))
+		event.Neighbor = neighbor
+		c.emit(event)
+	}
+	if result.exceeded == nil {
+		return result.admitted
+	}
+	reason := result.exceeded.reason(events.ReasonMaxPrefix)
+	if !result.blocked {
+		metrics.MaxPrefix.WithLabelValues(vrf.Name, result.exceeded.label(), "exceeded").Inc()
+		c.logger.Warnf("VRF %s: %s, action %q", vrf.Name, reason, vrf.MaxPrefix.Action)
+	}
+	eventType := events.Rejected
+	if result.admitted {
+		eventType = events.Warning
+	}
+	event := vpnEvent(eventType, vrf.Name, route, "", reason)
+	event.Neighbor = neighbor
+	c.emit(event)
+	if result.withdraw {
+		if err := c.withdrawNeighbor(limitKey{Vrf: vrf.Name, Neighbor: neighbor}, reason); err != nil {
+			c.logger.Errorf("VRF %s: cannot withdraw the routes of neighbor %s: %v", vrf.Name, neighbor, err)
+		}
+	}
+	return result.admitted
+}
+
+// Withdraws the redistributed routes of the neighbor in the VRF, including the ones on withdraw hold
+func (c *VPNv4Controller) withdrawNeighbor(key limitKey, reason string) (merr error) {
+	for _, route := range c.limits.neighborRoutes(key) {
+		evpnUuid, loaded := c.redistributedEvpn.LoadAndDelete(route)
+		if !loaded {
+			continue
+		}
+		c.withdrawHold.Cancel(route.prefixKey())
+		info := c.forgetRoute(route)
+		event := vpnEvent(events.Withdrawn, key.Vrf, route, info.generated, reason)
+		event.Neighbor = key.Neighbor
+		c.emit(event)
+		err := c.evpnInjector.DelRoute(evpnUuid)
+		observeRoute(key.Vrf, metrics.DirectionToEvpn, metrics.OperationWithdraw, err)
+		if err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	return merr
+}
+
+// Unblocks the exceeded max-prefix limits of the VRF, only the one of the neighbor unless it is empty.
+// The received routes the limits blocked are to be redistributed again, see ClearedLimits
+func (c *VPNv4Controller) ClearMaxPrefix(vrf, neighbor string) ([]dto.MaxPrefixBlock, error) {
+	found := false
+	c.rdVrfMap.Range(func(_ string, known dto.Vrf) bool {
+		found = known.Name == vrf
+		return !found
+	})
+	if !found {
+		return nil, fmt.Errorf("%w: %s", dto.ErrVrfNotFound, vrf)
+	}
+	return c.limits.clear(vrf, neighbor), nil
+}
+
+// Limits unblocked since the last call, whose received routes are not redistributed yet
+func (c *VPNv4Controller) ClearedLimits() []dto.MaxPrefixBlock {
+	return c.limits.takeCleared()
+}
+
+// Uncounts the route admitted by the limits which failed to be injected, unless it is redistributed before
+func (c *VPNv4Controller) uncount(route vpnRoute) {
+	if _, tracked := c.redistributedEvpn.Load(route); !tracked {
+		c.limits.remove(route)
+	}
+}
+
+// Forgets the redistributed route, returning what was recorded about it
+func (c *VPNv4Controller) forgetRoute(route vpnRoute) redistributionInfo {
+	info, _ := c.routeInfo.LoadAndDelete(route)
+	c.limits.remove(route)
+	c.routeChanged(route)
+	return info
+}
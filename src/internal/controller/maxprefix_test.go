@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// VPNv4 path of the VRF of createTestVPNPath received from the neighbor
+func createNeighborPath(prefix, neighbor string) *api.Path {
+	path := createAggregatedPath(prefix, 65001)
+	path.NeighborIp = neighbor
+	return path
+}
+
+func maxPrefixExtensions(maxPrefix dto.MaxPrefix) map[string]dto.VrfExtensions {
+	return map[string]dto.VrfExtensions{"vrf_10": {MaxPrefix: &maxPrefix}}
+}
+
+func TestPrefixLimits_HandleUpdate(t *testing.T) {
+	tests := []struct {
+		name            string
+		maxPrefix       dto.MaxPrefix
+		paths           []*api.Path
+		expectedEvents  []events.Type
+		expectedReasons map[int]string // by event index
+		neighbor        string         // of the last event
+		redistributed   int
+	}{
+		{
+			name:      "Neighbor limit stops the neighbor only",
+			maxPrefix: dto.MaxPrefix{Neighbor: 2, Warning: 50, Action: dto.MaxPrefixStop},
+			paths: []*api.Path{
+				createNeighborPath("10.0.1.0", "192.168.0.10"),
+				createNeighborPath("10.0.2.0", "192.168.0.10"),
+				createNeighborPath("10.0.3.0", "192.168.0.10"),
+				createNeighborPath("10.0.4.0", "192.168.0.10"),
+				createNeighborPath("10.0.5.0", "192.168.0.20"),
+			},
+			expectedEvents: []events.Type{
+				events.Warning, events.Added, events.Added, events.Rejected, events.Rejected,
+				events.Warning, events.Added,
+			},
+			expectedReasons: map[int]string{
+				0: "max-prefix warning threshold reached: 2 routes of neighbor 192.168.0.10",
+				3: "max-prefix limit exceeded: 2 routes of neighbor 192.168.0.10",
+			},
+			neighbor:      "192.168.0.20",
+			redistributed: 3,
+		},
+		{
+			name:      "VRF limit withdraws the routes of the neighbor exceeding it",
+			maxPrefix: dto.MaxPrefix{Vrf: 2, Action: dto.MaxPrefixWithdraw},
+			paths: []*api.Path{
+				createNeighborPath("10.0.1.0", "192.168.0.10"),
+				createNeighborPath("10.0.2.0", "192.168.0.20"),
+				createNeighborPath("10.0.3.0", "192.168.0.20"),
+			},
+			expectedEvents: []events.Type{
+				events.Added, events.Added, events.Rejected, events.Withdrawn,
+			},
+			expectedReasons: map[int]string{3: "max-prefix limit exceeded: 2 routes of VRF vrf_10"},
+			neighbor:        "192.168.0.20",
+			redistributed:   1,
+		},
+		{
+			name:      "VRF limit warns by default",
+			maxPrefix: dto.MaxPrefix{Vrf: 1},
+			paths: []*api.Path{
+				createNeighborPath("10.0.1.0", "192.168.0.10"),
+				createNeighborPath("10.0.2.0", "192.168.0.10"),
+				createNeighborPath("10.0.2.0", "192.168.0.10"), // counted already
+				createNeighborPath("10.0.3.0", "192.168.0.10"),
+			},
+			expectedEvents: []events.Type{
+				events.Added, events.Warning, events.Added, events.Replaced, events.Added,
+			},
+			expectedReasons: map[int]string{1: "max-prefix limit exceeded: 1 routes of VRF vrf_10"},
+			neighbor:        "192.168.0.10",
+			redistributed:   3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			injector := &mockEvpnInjector{}
+			injector.On("AddType5Route", mock.Anything).Return(uuid.New(), nil)
+			injector.On("DelRoute", mock.Anything).Return(nil)
+			c := newTestControllers(
+				injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf}, maxPrefixExtensions(tt.maxPrefix),
+			)
+
+			for _, path := range tt.paths {
+				require.NoError(t, c.vpn.HandleUpdate(context.Background(), path))
+			}
+
+			assert.Len(t, c.vpn.ListRedistributed(), tt.redistributed)
+			assert.Equal(t, tt.expectedEvents, c.publisher.types())
+			for i, reason := range tt.expectedReasons {
+				assert.Equal(t, reason, c.publisher.events[i].Reason)
+			}
+			assert.Equal(t, tt.neighbor, c.publisher.events[len(c.publisher.events)-1].Neighbor)
+		})
+	}
+}
+
+func TestPrefixLimits_ClearMaxPrefix(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	injector.On("AddType5Route", mock.Anything).Return(uuid.New(), nil)
+	c := newTestControllers(
+		injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf},
+		maxPrefixExtensions(dto.MaxPrefix{Neighbor: 1, Action: dto.MaxPrefixStop}),
+	)
+	ctx := context.Background()
+	blocked := createNeighborPath("10.0.2.0", "192.168.0.10")
+	require.NoError(t, c.vpn.HandleUpdate(ctx, createNeighborPath("10.0.1.0", "192.168.0.10")))
+	require.NoError(t, c.vpn.HandleUpdate(ctx, blocked))
+	require.NoError(t, c.vpn.HandleUpdate(ctx, createNeighborPath("10.0.3.0", "192.168.0.20")))
+
+	assert.False(t, c.vpn.Audit(blocked).Expected)
+	explanation := c.vpn.Explain(blocked, dto.NewVrf(orchestratedVrf, dto.VrfExtensions{
+		MaxPrefix: &dto.MaxPrefix{Neighbor: 1, Action: dto.MaxPrefixStop},
+	}))
+	assert.Equal(t, stepMaxPrefix, explanation.Steps[len(explanation.Steps)-1].Name)
+
+	// the routes of the other neighbor are not cleared
+	cleared, err := c.vpn.ClearMaxPrefix("vrf_10", "192.168.0.20")
+	require.NoError(t, err)
+	assert.Empty(t, cleared)
+	cleared, err = c.vpn.ClearMaxPrefix("vrf_10", "")
+	require.NoError(t, err)
+	assert.Equal(t, []dto.MaxPrefixBlock{{Vrf: "vrf_10", Neighbor: "192.168.0.10"}}, cleared)
+	assert.Equal(t, cleared, c.vpn.ClearedLimits())
+	assert.Empty(t, c.vpn.ClearedLimits())
+	assert.True(t, c.vpn.Audit(blocked).Expected)
+	_, err = c.vpn.ClearMaxPrefix("vrf_20", "")
+	assert.ErrorIs(t, err, dto.ErrVrfNotFound)
+}
+
+func TestPrefixLimits_Withdraw(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	injector.On("AddType5Route", mock.Anything).Return(uuid.New(), nil)
+	injector.On("DelRoute", mock.Anything).Return(nil)
+	c := newTestControllers(
+		injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf},
+		maxPrefixExtensions(dto.MaxPrefix{Vrf: 2, Action: dto.MaxPrefixWithdraw}),
+	)
+	ctx := context.Background()
+	require.NoError(t, c.vpn.HandleUpdate(ctx, createNeighborPath("10.0.1.0", "192.168.0.10")))
+	require.NoError(t, c.vpn.HandleUpdate(ctx, createNeighborPath("10.0.2.0", "192.168.0.20")))
+	require.NoError(t, c.vpn.HandleUpdate(ctx, createNeighborPath("10.0.3.0", "192.168.0.20")))
+	listed := c.vpn.ListRedistributed()
+	require.Len(t, listed, 1)
+	assert.Equal(t, "65000:100:10.0.1.0/24", listed[0].Source)
+
+	// the neighbor stays blocked, while the others are below the limit again
+	require.NoError(t, c.vpn.HandleUpdate(ctx, createNeighborPath("10.0.4.0", "192.168.0.20")))
+	require.NoError(t, c.vpn.HandleUpdate(ctx, createNeighborPath("10.0.5.0", "192.168.0.10")))
+	assert.Len(t, c.vpn.ListRedistributed(), 2)
+	assert.Equal(t, events.Rejected, c.publisher.events[len(c.publisher.events)-2].Type)
+
+	// withdrawn routes count no more
+	require.NoError(t, c.vpn.HandleWithdraw(ctx, createNeighborPath("10.0.5.0", "192.168.0.10")))
+	require.NoError(t, c.vpn.HandleUpdate(ctx, createNeighborPath("10.0.6.0", "192.168.0.10")))
+	assert.Len(t, c.vpn.ListRedistributed(), 2)
+}
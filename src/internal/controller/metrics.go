@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"errors"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/metrics"
+)
+
+var errNotInjected = errors.New("route was not injected")
+
+// Records the outcome of redistributing or withdrawing a single route
+func observeRoute(vrf string, direction string, operation string, err error) {
+	switch {
+	case err != nil:
+		metrics.Errors.WithLabelValues(vrf, direction, operation).Inc()
+	case operation == metrics.OperationInject:
+		metrics.Redistributed.WithLabelValues(vrf, direction).Inc()
+	default:
+		metrics.Withdrawn.WithLabelValues(vrf, direction).Inc()
+	}
+}
+
+// Deferred by the path handlers once the VRF of the path is known
+func observeHandling(vrf string, direction string, operation string, start time.Time, err *error) {
+	observeRoute(vrf, direction, operation, *err)
+	metrics.ObservePath(vrf, direction, start)
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	api "github.com/osrg/gobgp/v3/api"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	defaultMobilityResetTime = 5 * time.Minute
+	defaultLocalPref         = 100
+)
+
+type mobilityState struct {
+	gateway   string
+	seq       uint32
+	movedAt   time.Time
+	resetTime time.Duration // the prefix is forgotten once it stays on the same gateway for it
+}
+
+func (s *mobilityState) expired(now time.Time) bool {
+	return now.Sub(s.movedAt) >= s.resetTime
+}
+
+// Counts gateway changes of every prefix, the way MAC mobility sequence numbers do for Type-2 routes.
+// The count survives withdrawals, so a prefix announced again via another gateway after a live migration
+// gets the next sequence number
+type mobilityTracker struct {
+	prefixes map[prefixKey]*mobilityState
+	lock     sync.Mutex
+	now      func() time.Time
+}
+
+func newMobilityTracker() *mobilityTracker {
+	return &mobilityTracker{prefixes: map[prefixKey]*mobilityState{}, now: time.Now}
+}
+
+// Returns the sequence number of the prefix announced via gateway.
+// The counter restarts once the prefix stays on the same gateway for resetTime
+func (t *mobilityTracker) Observe(key prefixKey, gateway string, resetTime time.Duration) uint32 {
+	if resetTime <= 0 {
+		resetTime = defaultMobilityResetTime
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := t.now()
+	state, ok := t.prefixes[key]
+	if !ok || state.expired(now) {
+		t.prefixes[key] = &mobilityState{gateway: gateway, movedAt: now, resetTime: resetTime}
+		return 0
+	}
+	state.resetTime = resetTime
+	if state.gateway != gateway {
+		state.gateway = gateway
+		state.seq++
+		state.movedAt = now
+	}
+	return state.seq
+}
+
+// Forgets the prefixes which stayed on the same gateway for their reset time
+func (t *mobilityTracker) Expire() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := t.now()
+	for key, state := range t.prefixes {
+		if state.expired(now) {
+			delete(t.prefixes, key)
+		}
+	}
+}
+
+func (t *mobilityTracker) Forget(match func(prefixKey) bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for key := range t.prefixes {
+		if match(key) {
+			delete(t.prefixes, key)
+		}
+	}
+}
+
+// Forgets the gateway changes of the prefixes which stayed on the same gateway for the mobility reset time
+func (c *VPNv4Controller) ExpireMobility() {
+	c.mobility.Expire()
+}
+
+// Makes the route win over the ones advertised with lower sequence numbers
+func applyMobility(route *dto.Evpn5Route, mode dto.MobilityMode, seq uint32) {
+	if seq == 0 {
+		return
+	}
+	switch mode {
+	case dto.MobilityLocalPref:
+		localPref := uint32(defaultLocalPref)
+		attrs := make([]*anypb.Any, 0, len(route.PathAttrs)+1)
+		for _, attr := range route.PathAttrs {
+			var lp api.LocalPrefAttribute
+			if attr.MessageIs(&lp) && attr.UnmarshalTo(&lp) == nil {
+				localPref = lp.LocalPref
+				continue
+			}
+			attrs = append(attrs, attr)
+		}
+		lpAttr, _ := anypb.New(&api.LocalPrefAttribute{LocalPref: localPref + seq})
+		route.PathAttrs = append(attrs, lpAttr)
+	case dto.MobilityMacMobility:
+		mobility, _ := anypb.New(&api.MacMobilityExtended{SequenceNum: seq})
+		route.ExtCommunities = append(route.ExtCommunities, mobility)
+	}
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestMobilityTracker_Observe(t *testing.T) {
+	now := time.Now()
+	tracker := newMobilityTracker()
+	tracker.now = func() time.Time { return now }
+	key := prefixKey{Rd: "65000:100", Prefix: "10.0.0.0", Prefixlen: 24}
+
+	assert.Equal(t, uint32(0), tracker.Observe(key, "192.168.1.1", time.Minute))
+	assert.Equal(t, uint32(0), tracker.Observe(key, "192.168.1.1", time.Minute))
+	assert.Equal(t, uint32(1), tracker.Observe(key, "192.168.1.2", time.Minute))
+	assert.Equal(t, uint32(2), tracker.Observe(key, "192.168.1.1", time.Minute))
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, uint32(2), tracker.Observe(key, "192.168.1.1", time.Minute))
+	assert.Equal(t, uint32(3), tracker.Observe(key, "192.168.1.3", time.Minute))
+
+	// Stable for the reset time
+	now = now.Add(time.Minute)
+	assert.Equal(t, uint32(0), tracker.Observe(key, "192.168.1.3", time.Minute))
+	assert.Equal(t, uint32(1), tracker.Observe(key, "192.168.1.1", time.Minute))
+
+	// Moved after the reset time, not swept yet
+	now = now.Add(time.Minute)
+	assert.Equal(t, uint32(0), tracker.Observe(key, "192.168.1.3", time.Minute))
+}
+
+func TestMobilityTracker_Forget(t *testing.T) {
+	tracker := newMobilityTracker()
+	key := prefixKey{Rd: "65000:100", Prefix: "10.0.0.0", Prefixlen: 24}
+	tracker.Observe(key, "192.168.1.1", time.Minute)
+
+	tracker.Forget(func(k prefixKey) bool { return k == key })
+
+	assert.Equal(t, uint32(0), tracker.Observe(key, "192.168.1.2", time.Minute))
+}
+
+func TestMobilityTracker_Expire(t *testing.T) {
+	now := time.Now()
+	tracker := newMobilityTracker()
+	tracker.now = func() time.Time { return now }
+	moved := prefixKey{Rd: "65000:100", Prefix: "10.0.0.0", Prefixlen: 24}
+	stable := prefixKey{Rd: "65000:100", Prefix: "10.0.1.0", Prefixlen: 24}
+	tracker.Observe(stable, "192.168.1.1", time.Minute)
+	tracker.Observe(moved, "192.168.1.1", time.Minute)
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, uint32(1), tracker.Observe(moved, "192.168.1.2", time.Minute))
+
+	now = now.Add(30 * time.Second)
+	tracker.Expire()
+
+	assert.Len(t, tracker.prefixes, 1)
+	assert.Contains(t, tracker.prefixes, moved)
+	now = now.Add(30 * time.Second)
+	tracker.Expire()
+	assert.Empty(t, tracker.prefixes)
+	assert.Equal(t, uint32(0), tracker.Observe(moved, "192.168.1.1", time.Minute))
+}
+
+func TestApplyMobility_LocalPref(t *testing.T) {
+	origin, _ := anypb.New(&api.OriginAttribute{Origin: 0})
+	localPref, _ := anypb.New(&api.LocalPrefAttribute{LocalPref: 200})
+	route := dto.Evpn5Route{PathAttrs: []*anypb.Any{origin, localPref}}
+
+	applyMobility(&route, dto.MobilityLocalPref, 3)
+
+	assert.Len(t, route.PathAttrs, 2)
+	var lp api.LocalPrefAttribute
+	assert.NoError(t, route.PathAttrs[1].UnmarshalTo(&lp))
+	assert.Equal(t, uint32(203), lp.LocalPref)
+}
+
+func TestApplyMobility_LocalPrefDefault(t *testing.T) {
+	route := dto.Evpn5Route{}
+
+	applyMobility(&route, dto.MobilityLocalPref, 1)
+
+	var lp api.LocalPrefAttribute
+	assert.NoError(t, route.PathAttrs[0].UnmarshalTo(&lp))
+	assert.Equal(t, uint32(101), lp.LocalPref)
+}
+
+func TestApplyMobility_MacMobility(t *testing.T) {
+	route := dto.Evpn5Route{}
+
+	applyMobility(&route, dto.MobilityMacMobility, 2)
+
+	assert.Len(t, route.ExtCommunities, 1)
+	var mobility api.MacMobilityExtended
+	assert.NoError(t, route.ExtCommunities[0].UnmarshalTo(&mobility))
+	assert.Equal(t, uint32(2), mobility.SequenceNum)
+}
+
+func TestApplyMobility_NoMoves(t *testing.T) {
+	route := dto.Evpn5Route{}
+
+	applyMobility(&route, dto.MobilityLocalPref, 0)
+	applyMobility(&route, dto.MobilityMacMobility, 0)
+
+	assert.Empty(t, route.PathAttrs)
+	assert.Empty(t, route.ExtCommunities)
+}
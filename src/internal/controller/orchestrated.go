@@ -0,0 +1,324 @@
+package controller
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/amyasnikov/berg/internal/utils"
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/sirupsen/logrus"
+)
+
+// Source of the routes injected for orchestrator leases
+const OrchestratorSource = "orchestrator"
+
+type lease struct {
+	gateway   string
+	expiresAt time.Time
+	injected  localRoute // zero UUID while not injected
+}
+
+// Prefixes leased by an orchestrator, injected as Type-5 routes until the lease expires.
+// A prefix learned over BGP as well is redistributed either from BGP or from the lease, see dto.Precedence
+type OrchestratedRoutes struct {
+	lock     sync.Mutex
+	local    localInjector
+	vpn      *VPNv4Controller
+	vrfs     map[string]dto.Vrf // by VRF name
+	leases   map[localKey]*lease
+	released []localKey // ended leases which overrode the received routes of their prefixes
+	now      func() time.Time
+}
+
+// vpn redistributes the received routes the leases compete with
+func NewOrchestratedRoutes(
+	injector evpnInjector, vpn *VPNv4Controller, vrfCfg []oc.VrfConfig, vrfExt map[string]dto.VrfExtensions,
+) *OrchestratedRoutes {
+	return &OrchestratedRoutes{
+		local:  newLocalInjector(injector, OrchestratorSource),
+		vpn:    vpn,
+		vrfs:   newVrfMap(vrfCfg, vrfExt),
+		leases: map[localKey]*lease{},
+		now:    time.Now,
+	}
+}
+
+// Sets the receiver of the injection decisions
+func (o *OrchestratedRoutes) SetEventPublisher(publisher events.Publisher) {
+	o.local.events = publisher
+}
+
+func (o *OrchestratedRoutes) SetLogger(logger *logrus.Logger) {
+	o.local.logger = logger
+}
+
+// Adds or renews the lease of the prefix for ttl
+func (o *OrchestratedRoutes) Lease(vrfName, prefix, gateway string, ttl time.Duration) error {
+	route := dto.StaticRoute{Prefix: prefix, Gateway: gateway}
+	if err := utils.ValidateStaticRoute(route); err != nil {
+		return fmt.Errorf("%w: %w", dto.ErrInvalidRoute, err)
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("%w: TTL must be positive", dto.ErrInvalidRoute)
+	}
+	masked, _ := utils.StaticRoutePrefix(route)
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if _, ok := o.vrfs[vrfName]; !ok {
+		return fmt.Errorf("%w: %s", dto.ErrVrfNotFound, vrfName)
+	}
+	key := localKey{vrf: vrfName, prefix: masked.String()}
+	l, ok := o.leases[key]
+	if !ok {
+		l = &lease{}
+		o.leases[key] = l
+	}
+	l.gateway = gateway
+	l.expiresAt = o.now().Add(ttl)
+	return o.arbitrate(map[localKey]*lease{key: l})
+}
+
+// Ends the lease of the prefix before it expires
+func (o *OrchestratedRoutes) Release(vrfName, prefix string) error {
+	parsed, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return fmt.Errorf("%w: invalid prefix %q", dto.ErrInvalidRoute, prefix)
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	key := localKey{vrf: vrfName, prefix: parsed.Masked().String()}
+	l, ok := o.leases[key]
+	if !ok {
+		return fmt.Errorf("%w: %s in VRF %s is not leased", dto.ErrRouteNotFound, key.prefix, vrfName)
+	}
+	return o.end(key, l, events.ReasonLeaseReleased)
+}
+
+// Must be called with lock held
+func (o *OrchestratedRoutes) end(key localKey, l *lease, reason string) error {
+	delete(o.leases, key)
+	if o.vrfs[key.vrf].OrchestratedPrecedence == dto.PrecedenceOrchestrator {
+		o.released = append(o.released, key)
+	}
+	if l.injected.uuid == uuid.Nil {
+		return nil
+	}
+	return o.local.withdraw(key, l.injected, reason)
+}
+
+// Withdraws the expired leases and settles which of BGP and the leases redistributes each leased prefix.
+// Returns the prefixes whose received routes are no longer overridden and should be redistributed again
+func (o *OrchestratedRoutes) Maintain() ([]dto.OrchestratedRoute, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	var merr error
+	now := o.now()
+	for key, l := range o.leases {
+		if now.Before(l.expiresAt) {
+			continue
+		}
+		if err := o.end(key, l, events.ReasonLeaseExpired); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	ended := make([]dto.OrchestratedRoute, 0, len(o.released))
+	for _, key := range o.released {
+		ended = append(ended, dto.OrchestratedRoute{Vrf: key.vrf, Prefix: key.prefix})
+	}
+	o.released = nil
+	if err := o.arbitrate(o.leases); err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	return ended, merr
+}
+
+// Applies the VRF changes. Leases of the deleted VRFs end, the others are re-injected if their VRF has changed
+func (o *OrchestratedRoutes) ReloadConfig(diff dto.VrfDiff) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	prev := maps.Clone(o.vrfs)
+	reloadVrfs(o.vrfs, diff)
+	var merr error
+	for key, l := range o.leases {
+		vrf, ok := o.vrfs[key.vrf]
+		if !ok {
+			if err := o.end(key, l, events.ReasonVrfDeleted); err != nil {
+				merr = multierror.Append(merr, err)
+			}
+			continue
+		}
+		if prev[key.vrf].OrchestratedPrecedence == dto.PrecedenceOrchestrator &&
+			vrf.OrchestratedPrecedence != dto.PrecedenceOrchestrator {
+			o.released = append(o.released, key)
+		}
+	}
+	if err := o.arbitrate(o.leases); err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	return merr
+}
+
+// Injects or withdraws the routes of the leases depending on the precedence. Must be called with lock held
+func (o *OrchestratedRoutes) arbitrate(leases map[localKey]*lease) error {
+	keys := make(map[localKey]bool, len(leases))
+	for key := range leases {
+		keys[key] = true
+	}
+	learned := map[localKey]bool{}
+	if o.vpn != nil && len(keys) > 0 {
+		learned = o.vpn.learnedPrefixes(keys)
+	}
+	var merr error
+	for key, l := range leases {
+		vrf := o.vrfs[key.vrf]
+		wanted := vrf.OrchestratedPrecedence == dto.PrecedenceOrchestrator || !learned[key]
+		if vrf.OrchestratedPrecedence == dto.PrecedenceOrchestrator && learned[key] {
+			if err := o.vpn.withdrawOverridden(key); err != nil {
+				merr = multierror.Append(merr, err)
+			}
+		}
+		injected := l.injected.uuid != uuid.Nil
+		if !wanted {
+			if injected {
+				if err := o.local.withdraw(key, l.injected, events.ReasonBgpPrecedence); err != nil {
+					merr = multierror.Append(merr, err)
+				}
+				l.injected = localRoute{}
+			}
+			continue
+		}
+		spec := newLocalSpec(vrf, dto.StaticRoute{Prefix: key.prefix, Gateway: l.gateway})
+		if injected && reflect.DeepEqual(l.injected.spec, spec) {
+			continue
+		}
+		route, err := o.local.inject(key, spec, l.injected, injected, events.ReasonLeased)
+		if err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("VRF %s: %w", key.vrf, err))
+			continue
+		}
+		l.injected = route
+	}
+	return merr
+}
+
+// Whether the prefix has a lease taking precedence over the received routes
+func (o *OrchestratedRoutes) overrides(vrf dto.Vrf, key localKey) bool {
+	if vrf.OrchestratedPrecedence != dto.PrecedenceOrchestrator {
+		return false
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	_, ok := o.leases[key]
+	return ok
+}
+
+// Leases sorted by VRF and prefix, empty vrf means all the VRFs
+func (o *OrchestratedRoutes) List(vrf string) []dto.OrchestratedRoute {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	result := []dto.OrchestratedRoute{}
+	for key, l := range o.leases {
+		if vrf != "" && key.vrf != vrf {
+			continue
+		}
+		result = append(result, dto.OrchestratedRoute{
+			Vrf:       key.vrf,
+			Prefix:    key.prefix,
+			Gateway:   l.gateway,
+			ExpiresAt: l.expiresAt,
+			Injected:  l.injected.uuid != uuid.Nil,
+			Generated: l.injected.generated,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Vrf != result[j].Vrf {
+			return result[i].Vrf < result[j].Vrf
+		}
+		return result[i].Prefix < result[j].Prefix
+	})
+	return result
+}
+
+// Injected routes of the leases sorted by VRF and prefix, Source is OrchestratorSource
+func (o *OrchestratedRoutes) ListRedistributed() []dto.RedistributedRoute {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	result := []dto.RedistributedRoute{}
+	for key, l := range o.leases {
+		if l.injected.uuid != uuid.Nil {
+			result = append(result, o.local.redistributedRoute(key, l.injected))
+		}
+	}
+	sortRedistributed(result)
+	return result
+}
+
+// Number of injected routes of the leases by VRF name
+func (o *OrchestratedRoutes) RedistributedRoutes() map[string]int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	result := map[string]int{}
+	for key, l := range o.leases {
+		if l.injected.uuid != uuid.Nil {
+			result[key.vrf]++
+		}
+	}
+	return result
+}
+
+// Sets the leases which may take precedence over the received routes
+func (c *VPNv4Controller) SetOrchestratedRoutes(orchestrated *OrchestratedRoutes) {
+	c.orchestrated = orchestrated
+}
+
+func (c *VPNv4Controller) overridden(vrf dto.Vrf, route vpnRoute) bool {
+	return c.orchestrated != nil && c.orchestrated.overrides(vrf, c.localKey(vrf.Name, route))
+}
+
+func (c *VPNv4Controller) localKey(vrfName string, route vpnRoute) localKey {
+	return localKey{vrf: vrfName, prefix: fmt.Sprintf("%s/%d", route.Prefix, route.Prefixlen)}
+}
+
+// Which of the prefixes have redistributed received routes
+func (c *VPNv4Controller) learnedPrefixes(keys map[localKey]bool) map[localKey]bool {
+	result := map[localKey]bool{}
+	c.redistributedEvpn.Range(func(route vpnRoute, _ uuid.UUID) bool {
+		if key := c.localKey(c.vrfName(route.Rd), route); keys[key] {
+			result[key] = true
+		}
+		return true
+	})
+	return result
+}
+
+// Withdraws the redistributed routes of the prefix, which has a lease taking precedence over them
+func (c *VPNv4Controller) withdrawOverridden(key localKey) (merr error) {
+	c.redistributedEvpn.Range(func(route vpnRoute, evpnUuid uuid.UUID) bool {
+		if c.localKey(c.vrfName(route.Rd), route) != key {
+			return true
+		}
+		if _, loaded := c.redistributedEvpn.LoadAndDelete(route); !loaded {
+			return true
+		}
+		c.withdrawHold.Cancel(route.prefixKey())
+		info := c.forgetRoute(route)
+		c.emit(vpnEvent(events.Withdrawn, key.vrf, route, info.generated, events.ReasonOrchestrated))
+		err := c.evpnInjector.DelRoute(evpnUuid)
+		observeRoute(key.vrf, metrics.DirectionToEvpn, metrics.OperationWithdraw, err)
+		if err != nil {
+			merr = multierror.Append(merr, err)
+		}
+		return true
+	})
+	return merr
+}
@@ -0,0 +1,264 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/google/uuid"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// The VRF of createTestVPNPath
+var orchestratedVrf = oc.VrfConfig{Name: "vrf_10", Id: 10, Rd: "65000:100", BothRtList: []string{"65000:100"}}
+
+func orchestratedExtensions(precedence dto.Precedence) map[string]dto.VrfExtensions {
+	return map[string]dto.VrfExtensions{"vrf_10": {OrchestratedPrecedence: precedence}}
+}
+
+func TestOrchestratedRoutes_Lease(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	routeUuid := uuid.New()
+	injector.On("AddType5Route", withGateway("192.168.0.7")).Return(routeUuid, nil).Once()
+	c := newTestControllers(
+		injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf}, orchestratedExtensions(dto.PrecedenceBgp),
+	)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.orchestrated.now = func() time.Time { return now }
+
+	require.NoError(t, c.orchestrated.Lease("vrf_10", "10.0.7.1/24", "192.168.0.7", time.Minute))
+	now = now.Add(30 * time.Second)
+	require.NoError(t, c.orchestrated.Lease("vrf_10", "10.0.7.0/24", "192.168.0.7", time.Minute)) // renewed
+
+	assert.Equal(t, []dto.OrchestratedRoute{{
+		Vrf:       "vrf_10",
+		Prefix:    "10.0.7.0/24",
+		Gateway:   "192.168.0.7",
+		ExpiresAt: now.Add(time.Minute),
+		Injected:  true,
+		Generated: "5:65000:100:10.0.7.0/24 Gw:192.168.0.7 Vni:10",
+	}}, c.orchestrated.List(""))
+	assert.Empty(t, c.orchestrated.List("vrf_20"))
+	listed := c.orchestrated.ListRedistributed()
+	require.Len(t, listed, 1)
+	assert.Equal(t, routeUuid, listed[0].Uuid)
+	assert.Equal(t, OrchestratorSource, listed[0].Source)
+	assert.Equal(t, map[string]int{"vrf_10": 1}, c.orchestrated.RedistributedRoutes())
+
+	now = now.Add(59 * time.Second)
+	ended, err := c.orchestrated.Maintain()
+	require.NoError(t, err)
+	assert.Empty(t, ended)
+
+	injector.On("DelRoute", routeUuid).Return(nil).Once()
+	now = now.Add(time.Second)
+	ended, err = c.orchestrated.Maintain()
+	require.NoError(t, err)
+	assert.Empty(t, ended) // received routes have precedence anyway
+	assert.Empty(t, c.orchestrated.List(""))
+	injector.AssertExpectations(t)
+	assert.Equal(t, []events.Type{events.Added, events.Withdrawn}, c.publisher.types())
+	assert.Equal(t, events.ReasonLeased, c.publisher.events[0].Reason)
+	assert.Equal(t, events.ReasonLeaseExpired, c.publisher.events[1].Reason)
+}
+
+func TestOrchestratedRoutes_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		call     func(o *OrchestratedRoutes) error
+		expected error
+	}{
+		{
+			name: "Lease without prefix length",
+			call: func(o *OrchestratedRoutes) error {
+				return o.Lease("vrf_10", "10.0.7.0", "192.168.0.7", time.Minute)
+			},
+			expected: dto.ErrInvalidRoute,
+		},
+		{
+			name:     "Lease without gateway",
+			call:     func(o *OrchestratedRoutes) error { return o.Lease("vrf_10", "10.0.7.0/24", "", time.Minute) },
+			expected: dto.ErrInvalidRoute,
+		},
+		{
+			name:     "Lease without TTL",
+			call:     func(o *OrchestratedRoutes) error { return o.Lease("vrf_10", "10.0.7.0/24", "192.168.0.7", 0) },
+			expected: dto.ErrInvalidRoute,
+		},
+		{
+			name: "Lease in unknown VRF",
+			call: func(o *OrchestratedRoutes) error {
+				return o.Lease("vrf_20", "10.0.7.0/24", "192.168.0.7", time.Minute)
+			},
+			expected: dto.ErrVrfNotFound,
+		},
+		{
+			name:     "Release of prefix not leased",
+			call:     func(o *OrchestratedRoutes) error { return o.Release("vrf_10", "10.0.7.0/24") },
+			expected: dto.ErrRouteNotFound,
+		},
+		{
+			name:     "Release without prefix length",
+			call:     func(o *OrchestratedRoutes) error { return o.Release("vrf_10", "10.0.7.0") },
+			expected: dto.ErrInvalidRoute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestControllers(
+				&mockEvpnInjector{}, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf},
+				orchestratedExtensions(dto.PrecedenceBgp),
+			)
+
+			assert.ErrorIs(t, tt.call(c.orchestrated), tt.expected)
+		})
+	}
+}
+
+func TestOrchestratedRoutes_Precedence(t *testing.T) {
+	tests := []struct {
+		name           string
+		precedence     dto.Precedence
+		leaseFirst     bool
+		expectedEvents []events.Type
+		expectedReason string // of the last event
+		leaseInjected  bool
+		redistributed  int // received routes
+	}{
+		{
+			name:           "BGP precedence - learned prefix replaces the lease",
+			precedence:     dto.PrecedenceBgp,
+			leaseFirst:     true,
+			expectedEvents: []events.Type{events.Added, events.Added, events.Withdrawn},
+			expectedReason: events.ReasonBgpPrecedence,
+			redistributed:  1,
+		},
+		{
+			name:           "BGP precedence - lease of learned prefix is not injected",
+			precedence:     dto.PrecedenceBgp,
+			expectedEvents: []events.Type{events.Added},
+			redistributed:  1,
+		},
+		{
+			name:           "Orchestrator precedence - received route is rejected",
+			precedence:     dto.PrecedenceOrchestrator,
+			leaseFirst:     true,
+			expectedEvents: []events.Type{events.Added, events.Rejected},
+			expectedReason: events.ReasonOrchestrated,
+			leaseInjected:  true,
+		},
+		{
+			name:           "Orchestrator precedence - lease overrides received route",
+			precedence:     dto.PrecedenceOrchestrator,
+			expectedEvents: []events.Type{events.Added, events.Withdrawn, events.Added},
+			expectedReason: events.ReasonLeased,
+			leaseInjected:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			injector := &mockEvpnInjector{}
+			injector.On("AddType5Route", mock.Anything).Return(uuid.New(), nil)
+			injector.On("DelRoute", mock.Anything).Return(nil)
+			c := newTestControllers(
+				injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf}, orchestratedExtensions(tt.precedence),
+			)
+			lease := func() {
+				require.NoError(t, c.orchestrated.Lease("vrf_10", "10.0.0.0/24", "192.168.0.7", time.Minute))
+			}
+
+			if tt.leaseFirst {
+				lease()
+			}
+			require.NoError(t, c.vpn.HandleUpdate(context.Background(), createTestVPNPath()))
+			if !tt.leaseFirst {
+				lease()
+			}
+			_, err := c.orchestrated.Maintain()
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedEvents, c.publisher.types())
+			if tt.expectedReason != "" {
+				assert.Equal(t, tt.expectedReason, c.publisher.events[len(c.publisher.events)-1].Reason)
+			}
+			leases := c.orchestrated.List("vrf_10")
+			require.Len(t, leases, 1)
+			assert.Equal(t, tt.leaseInjected, leases[0].Injected)
+			assert.Len(t, c.vpn.ListRedistributed(), tt.redistributed)
+			assert.Equal(t, tt.redistributed == 1, c.vpn.Audit(createTestVPNPath()).Expected)
+		})
+	}
+}
+
+func TestOrchestratedRoutes_BgpWithdrawn(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	vpnUuid, reinjectedUuid := uuid.New(), uuid.New()
+	injector.On("AddType5Route", withGateway("192.168.1.1")).Return(vpnUuid, nil).Once()
+	c := newTestControllers(
+		injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf}, orchestratedExtensions(dto.PrecedenceBgp),
+	)
+	require.NoError(t, c.vpn.HandleUpdate(context.Background(), createTestVPNPath()))
+	require.NoError(t, c.orchestrated.Lease("vrf_10", "10.0.0.0/24", "192.168.0.7", time.Minute))
+
+	// the prefix is not learned anymore, the lease takes over
+	injector.On("DelRoute", vpnUuid).Return(nil).Once()
+	injector.On("AddType5Route", withGateway("192.168.0.7")).Return(reinjectedUuid, nil).Once()
+	require.NoError(t, c.vpn.HandleWithdraw(context.Background(), createTestVPNPath()))
+	_, err := c.orchestrated.Maintain()
+	require.NoError(t, err)
+
+	assert.True(t, c.orchestrated.List("vrf_10")[0].Injected)
+	assert.Equal(t, reinjectedUuid, c.orchestrated.ListRedistributed()[0].Uuid)
+	injector.AssertExpectations(t)
+}
+
+func TestOrchestratedRoutes_Release(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	leaseUuid := uuid.New()
+	injector.On("AddType5Route", withGateway("192.168.0.7")).Return(leaseUuid, nil).Once()
+	c := newTestControllers(
+		injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf},
+		orchestratedExtensions(dto.PrecedenceOrchestrator),
+	)
+	require.NoError(t, c.orchestrated.Lease("vrf_10", "10.0.0.0/24", "192.168.0.7", time.Minute))
+	require.NoError(t, c.vpn.HandleUpdate(context.Background(), createTestVPNPath()))
+
+	// once released, the received route should be redistributed again
+	injector.On("DelRoute", leaseUuid).Return(nil).Once()
+	require.NoError(t, c.orchestrated.Release("vrf_10", "10.0.0.0/24"))
+	ended, err := c.orchestrated.Maintain()
+	require.NoError(t, err)
+
+	assert.Equal(t, []dto.OrchestratedRoute{{Vrf: "vrf_10", Prefix: "10.0.0.0/24"}}, ended)
+	assert.Equal(t, events.ReasonLeaseReleased, c.publisher.events[len(c.publisher.events)-1].Reason)
+	audit := c.vpn.Audit(createTestVPNPath())
+	assert.True(t, audit.Expected)
+	assert.False(t, audit.Tracked)
+	injector.AssertExpectations(t)
+}
+
+func TestOrchestratedRoutes_ReloadConfig(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	routeUuid := uuid.New()
+	injector.On("AddType5Route", mock.Anything).Return(routeUuid, nil).Once()
+	c := newTestControllers(
+		injector, &mockVpnInjector{}, []oc.VrfConfig{orchestratedVrf},
+		orchestratedExtensions(dto.PrecedenceOrchestrator),
+	)
+	require.NoError(t, c.orchestrated.Lease("vrf_10", "10.0.7.0/24", "192.168.0.7", time.Minute))
+
+	// the VRF is gone, so is the lease
+	injector.On("DelRoute", routeUuid).Return(nil).Once()
+	require.NoError(t, c.orchestrated.ReloadConfig(dto.VrfDiff{Deleted: []oc.VrfConfig{orchestratedVrf}}))
+
+	assert.Empty(t, c.orchestrated.List(""))
+	assert.Equal(t, events.ReasonVrfDeleted, c.publisher.events[len(c.publisher.events)-1].Reason)
+	injector.AssertExpectations(t)
+}
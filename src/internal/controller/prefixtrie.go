@@ -0,0 +1,70 @@
+package controller
+
+import "net/netip"
+
+// Binary trie of IPv4 prefixes, one bit of the address per level
+type prefixTrie[V any] struct {
+	root trieNode[V]
+}
+
+type trieNode[V any] struct {
+	children [2]*trieNode[V]
+	value    V
+	set      bool
+}
+
+// Host bits of the prefix are ignored
+func (t *prefixTrie[V]) Insert(prefix netip.Prefix, value V) {
+	node := &t.root
+	addr := prefix.Addr().As4()
+	for i := range prefix.Bits() {
+		bit := addrBit(addr, i)
+		if node.children[bit] == nil {
+			node.children[bit] = &trieNode[V]{}
+		}
+		node = node.children[bit]
+	}
+	node.value, node.set = value, true
+}
+
+// Values of the prefixes strictly less specific than the prefix and covering it, the shortest first
+func (t *prefixTrie[V]) Supernets(prefix netip.Prefix) []V {
+	var result []V
+	node := &t.root
+	addr := prefix.Addr().As4()
+	for i := range prefix.Bits() {
+		if node.set {
+			result = append(result, node.value)
+		}
+		node = node.children[addrBit(addr, i)]
+		if node == nil {
+			break
+		}
+	}
+	return result
+}
+
+// Values of all the prefixes, the shortest first
+func (t *prefixTrie[V]) Values() []V {
+	var result []V
+	level := []*trieNode[V]{&t.root}
+	for len(level) > 0 {
+		next := []*trieNode[V]{}
+		for _, node := range level {
+			if node.set {
+				result = append(result, node.value)
+			}
+			for _, child := range node.children {
+				if child != nil {
+					next = append(next, child)
+				}
+			}
+		}
+		level = next
+	}
+	return result
+}
+
+func addrBit(addr [4]byte, i int) int {
+	return int(addr[i/8]>>(7-i%8)) & 1
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixTrie_Supernets(t *testing.T) {
+	var trie prefixTrie[string]
+	for _, prefix := range []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "10.2.0.0/16"} {
+		trie.Insert(netip.MustParsePrefix(prefix), prefix)
+	}
+
+	assert.Equal(t, []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24"},
+		trie.Supernets(netip.MustParsePrefix("10.1.2.3/32")))
+	assert.Equal(t, []string{"0.0.0.0/0", "10.0.0.0/8"}, trie.Supernets(netip.MustParsePrefix("10.1.0.0/16")))
+	assert.Equal(t, []string{"0.0.0.0/0"}, trie.Supernets(netip.MustParsePrefix("192.168.0.0/24")))
+	assert.Empty(t, trie.Supernets(netip.MustParsePrefix("0.0.0.0/0")))
+}
+
+func TestPrefixTrie_Values(t *testing.T) {
+	var trie prefixTrie[string]
+	assert.Empty(t, trie.Values())
+	for _, prefix := range []string{"10.1.2.0/24", "10.0.0.0/8", "10.2.0.0/16"} {
+		trie.Insert(netip.MustParsePrefix(prefix), prefix)
+	}
+
+	assert.Equal(t, []string{"10.0.0.0/8", "10.2.0.0/16", "10.1.2.0/24"}, trie.Values())
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/utils"
 	api "github.com/osrg/gobgp/v3/api"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
@@ -49,6 +50,56 @@ func (g *evpnRouteGen) GenRoute(route vpnRoute, vrf dto.Vrf, pattrs []*anypb.Any
 	return
 }
 
+// Route of the VRF for its static route, the attributes come from the config rather than a received path
+func (g *evpnRouteGen) GenStaticRoute(route dto.StaticRoute, vrf dto.Vrf) (er dto.Evpn5Route, err error) {
+	if err = utils.ValidateStaticRoute(route); err != nil {
+		return dto.Evpn5Route{}, err
+	}
+	prefix, _ := utils.StaticRoutePrefix(route)
+	er.Rd = vrf.Rd
+	er.RouteTargets = vrf.ExportRouteTargets
+	er.Prefix = prefix.Addr().String()
+	er.Prefixlen = uint32(prefix.Bits())
+	er.Gateway = route.Gateway
+	er.Vni = vrf.Vni
+	origin, _ := anypb.New(&api.OriginAttribute{Origin: 0}) // IGP
+	er.PathAttrs = []*anypb.Any{origin}
+	if route.LocalPref != 0 {
+		localPref, _ := anypb.New(&api.LocalPrefAttribute{LocalPref: route.LocalPref})
+		er.PathAttrs = append(er.PathAttrs, localPref)
+	}
+	if route.Med != 0 {
+		med, _ := anypb.New(&api.MultiExitDiscAttribute{Med: route.Med})
+		er.PathAttrs = append(er.PathAttrs, med)
+	}
+	if len(route.Communities) > 0 {
+		communities := make([]uint32, 0, len(route.Communities))
+		for _, community := range route.Communities {
+			parsed, _ := utils.ParseCommunity(community) // validated above
+			communities = append(communities, parsed)
+		}
+		attr, _ := anypb.New(&api.CommunitiesAttribute{Communities: communities})
+		er.PathAttrs = append(er.PathAttrs, attr)
+	}
+	return
+}
+
+// Route of the VRF for its aggregate. asns are the AS_SET of the contributing routes, nil means ATOMIC_AGGREGATE
+func (g *evpnRouteGen) GenAggregateRoute(route dto.StaticRoute, asns []uint32, vrf dto.Vrf) (dto.Evpn5Route, error) {
+	er, err := g.GenStaticRoute(route, vrf)
+	if err != nil {
+		return dto.Evpn5Route{}, err
+	}
+	var attr *anypb.Any
+	if asns != nil {
+		attr, _ = anypb.New(&api.AsPathAttribute{Segments: []*api.AsSegment{{Type: asSet, Numbers: asns}}})
+	} else {
+		attr, _ = anypb.New(&api.AtomicAggregateAttribute{})
+	}
+	er.PathAttrs = append(er.PathAttrs, attr)
+	return er, nil
+}
+
 type vpnRouteGen struct {
 	attrFilter *AttrFilter
 }
@@ -83,3 +134,16 @@ func (g *vpnRouteGen) GenRoute(route evpnRoute, pattrs []*anypb.Any) (r dto.VPNR
 	r.PathAttrs = g.attrFilter.Filter(pattrs)
 	return
 }
+
+// Default route imported into the VRF by its import route targets, ::/0 if ipv6
+func (g *vpnRouteGen) GenDefaultRoute(vrf dto.Vrf, ipv6 bool) (r dto.VPNRoute) {
+	r.Rd = vrf.Rd
+	r.RouteTargets = vrf.ImportRouteTargets
+	r.Prefix = "0.0.0.0"
+	if ipv6 {
+		r.Prefix = "::"
+	}
+	origin, _ := anypb.New(&api.OriginAttribute{Origin: 0}) // IGP
+	r.PathAttrs = []*anypb.Any{origin}
+	return
+}
@@ -130,3 +130,35 @@ func TestEvpnRouteGen_AttributeFiltering(t *testing.T) {
 	}
 	assert.True(t, found, "LocalPrefAttribute should be present in filtered attributes")
 }
+
+func TestEvpnRouteGen_GenStaticRoute(t *testing.T) {
+	vrf := dto.Vrf{Rd: "65000:100", ExportRouteTargets: []string{"65000:100"}, Vni: 1000}
+	route := dto.StaticRoute{
+		Prefix: "10.0.5.1/24", Gateway: "192.168.0.5", LocalPref: 200, Med: 10, Communities: []string{"65000:1"},
+	}
+
+	er, err := newEvpnRouteGen().GenStaticRoute(route, vrf)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "65000:100", er.Rd)
+	assert.Equal(t, []string{"65000:100"}, er.RouteTargets)
+	assert.Equal(t, "10.0.5.0", er.Prefix)
+	assert.Equal(t, uint32(24), er.Prefixlen)
+	assert.Equal(t, "192.168.0.5", er.Gateway)
+	assert.Equal(t, uint32(1000), er.Vni)
+	var origin api.OriginAttribute
+	var localPref api.LocalPrefAttribute
+	var med api.MultiExitDiscAttribute
+	var communities api.CommunitiesAttribute
+	assert.Len(t, er.PathAttrs, 4)
+	assert.NoError(t, er.PathAttrs[0].UnmarshalTo(&origin))
+	assert.NoError(t, er.PathAttrs[1].UnmarshalTo(&localPref))
+	assert.Equal(t, uint32(200), localPref.LocalPref)
+	assert.NoError(t, er.PathAttrs[2].UnmarshalTo(&med))
+	assert.Equal(t, uint32(10), med.Med)
+	assert.NoError(t, er.PathAttrs[3].UnmarshalTo(&communities))
+	assert.Equal(t, []uint32{65000<<16 | 1}, communities.Communities)
+
+	_, err = newEvpnRouteGen().GenStaticRoute(dto.StaticRoute{Prefix: "10.0.5.0/24", Gateway: "gw"}, vrf)
+	assert.ErrorContains(t, err, "invalid IPv4 gateway")
+}
@@ -3,7 +3,10 @@ package controller
 import (
 	"errors"
 	"fmt"
+	"net/netip"
+	"time"
 
+	"github.com/amyasnikov/berg/internal/dto"
 	"github.com/amyasnikov/berg/internal/utils"
 	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/google/uuid"
@@ -39,6 +42,12 @@ func (r evpnRoute) String() string {
 	return fmt.Sprintf("5:%s:%s/%d Gw:%s Vni:%d", r.Rd, r.Prefix, r.Prefixlen, r.Gateway, r.Label)
 }
 
+// Whether the prefix is IPv4, BERG does not redistribute the IPv6 ones
+func (r evpnRoute) isIPv4() bool {
+	addr, err := netip.ParseAddr(r.Prefix)
+	return err == nil && addr.Is4()
+}
+
 func evpnFromApi(apiRoute *anypb.Any) (evpnRoute, error) {
 	var route api.EVPNIPPrefixRoute
 	err := anypb.UnmarshalTo(apiRoute, &route, proto.UnmarshalOptions{})
@@ -93,6 +102,10 @@ func (r vpnRoute) String() string {
 	return fmt.Sprintf("%s:%s/%d", r.Rd, r.Prefix, r.Prefixlen)
 }
 
+func (r vpnRoute) netipPrefix() (netip.Prefix, error) {
+	return netip.ParsePrefix(fmt.Sprintf("%s/%d", r.Prefix, r.Prefixlen))
+}
+
 func vpnFromApi(apiRoute *anypb.Any) (vpnRoute, error) {
 	var route api.LabeledVPNIPAddressPrefix
 	err := anypb.UnmarshalTo(apiRoute, &route, proto.UnmarshalOptions{})
@@ -100,7 +113,9 @@ func vpnFromApi(apiRoute *anypb.Any) (vpnRoute, error) {
 		return vpnRoute{}, invalidEvpnType
 	}
 	var result vpnRoute
-	result.Label = route.Labels[0]
+	if len(route.Labels) > 0 {
+		result.Label = route.Labels[0]
+	}
 	result.Prefix = route.Prefix
 	result.Prefixlen = route.PrefixLen
 	result.Rd, err = utils.RdToString(route.Rd)
@@ -109,3 +124,29 @@ func vpnFromApi(apiRoute *anypb.Any) (vpnRoute, error) {
 	}
 	return result, nil
 }
+
+// NLRI of a VPNv4 or EVPN Type-5 path in the format of RedistributedRoute Source and Generated
+func FormatNlri(nlri *anypb.Any) (string, bool) {
+	if route, err := vpnFromApi(nlri); err == nil {
+		return route.String(), true
+	}
+	if route, err := evpnFromApi(nlri); err == nil {
+		return route.String(), true
+	}
+	return "", false
+}
+
+// Received route kept aside rather than redistributed
+type suppressedRoute struct {
+	route    dto.Evpn5Route
+	neighbor string // of the source path
+}
+
+// Details of a redistributed route kept for the Berg API
+type redistributionInfo struct {
+	route     dto.Evpn5Route // kept to restore the route suppressed by an aggregate
+	neighbor  string         // of the source path
+	generated string
+	createdAt time.Time
+	updatedAt time.Time
+}
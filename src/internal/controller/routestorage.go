@@ -1,14 +1,18 @@
 package controller
 
 import (
+	"time"
+
 	"github.com/amyasnikov/berg/internal/utils"
 	"github.com/google/uuid"
 	"github.com/puzpuzpuz/xsync/v4"
 )
 
 type uuidRT struct {
-	uuid    uuid.UUID
-	targets []string
+	uuid      uuid.UUID
+	targets   []string
+	createdAt time.Time
+	updatedAt time.Time
 }
 
 type redistributedEvpnStorage struct {
@@ -24,7 +28,17 @@ func newRedistributedEvpnStorage() *redistributedEvpnStorage {
 }
 
 func (s *redistributedEvpnStorage) Store(route evpnRoute, targets []string, vpnUuid uuid.UUID) {
-	oldUuidRt, loaded := s.routeMap.LoadAndStore(route, uuidRT{uuid: vpnUuid, targets: targets})
+	now := time.Now()
+	var oldUuidRt uuidRT
+	var loaded bool
+	s.routeMap.Compute(route, func(prev uuidRT, ok bool) (uuidRT, xsync.ComputeOp) {
+		oldUuidRt, loaded = prev, ok
+		value := uuidRT{uuid: vpnUuid, targets: targets, createdAt: now, updatedAt: now}
+		if ok {
+			value.createdAt = prev.createdAt
+		}
+		return value, xsync.UpdateOp
+	})
 	if loaded {
 		for _, rt := range oldUuidRt.targets {
 			s.rtMap.DeleteVal(rt, route)
@@ -40,6 +54,10 @@ func (s *redistributedEvpnStorage) Get(route evpnRoute) uuid.UUID {
 	return u.uuid
 }
 
+func (s *redistributedEvpnStorage) Load(route evpnRoute) (uuidRT, bool) {
+	return s.routeMap.Load(route)
+}
+
 func (s *redistributedEvpnStorage) Delete(route evpnRoute, targets []string) {
 	s.routeMap.Delete(route)
 	for _, rt := range targets {
@@ -47,9 +65,13 @@ func (s *redistributedEvpnStorage) Delete(route evpnRoute, targets []string) {
 	}
 }
 
-// get uuids and delete
-func (s *redistributedEvpnStorage) PopByRT(targets []string) []uuid.UUID {
-	uuids := []uuid.UUID{}
+func (s *redistributedEvpnStorage) Range(f func(route evpnRoute, value uuidRT) bool) {
+	s.routeMap.Range(f)
+}
+
+// get uuids by route and delete
+func (s *redistributedEvpnStorage) PopByRT(targets []string) map[evpnRoute]uuid.UUID {
+	uuids := map[evpnRoute]uuid.UUID{}
 	for _, rt := range targets {
 		routes, ok := s.rtMap.Load(rt)
 		if !ok {
@@ -58,10 +80,14 @@ func (s *redistributedEvpnStorage) PopByRT(targets []string) []uuid.UUID {
 		for route := range routes.Iter() {
 			urt, loaded := s.routeMap.LoadAndDelete(route)
 			if loaded {
-				uuids = append(uuids, urt.uuid)
+				uuids[route] = urt.uuid
 			}
 		}
 		s.rtMap.Delete(rt)
 	}
 	return uuids
 }
+
+func (s *redistributedEvpnStorage) RangeRT(f func(rt string, routes []evpnRoute) bool) {
+	s.rtMap.Range(f)
+}
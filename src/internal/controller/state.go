@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+// Dumps the internal maps and cross-checks them against each other
+func (c *VPNv4Controller) DumpState() dto.ControllerState {
+	state := dto.ControllerState{RdVrfMap: map[string]string{}, RedistributedEvpn: []dto.TrackedRoute{}}
+	c.rdVrfMap.Range(func(rd string, vrf dto.Vrf) bool {
+		state.RdVrfMap[rd] = vrf.Name
+		return true
+	})
+	c.redistributedEvpn.Range(func(route vpnRoute, evpnUuid uuid.UUID) bool {
+		info, ok := c.routeInfo.Load(route)
+		if !ok {
+			state.Problems = append(state.Problems, fmt.Sprintf("no generated route is recorded for %s", route))
+		}
+		if _, ok := state.RdVrfMap[route.Rd]; !ok {
+			state.Problems = append(state.Problems,
+				fmt.Sprintf("%s is redistributed although RD %s belongs to no VRF", route, route.Rd))
+		}
+		state.RedistributedEvpn = append(state.RedistributedEvpn,
+			dto.TrackedRoute{Source: route.String(), Generated: info.generated, Uuid: evpnUuid})
+		return true
+	})
+	c.routeInfo.Range(func(route vpnRoute, _ redistributionInfo) bool {
+		if _, ok := c.redistributedEvpn.Load(route); !ok {
+			state.Problems = append(state.Problems, fmt.Sprintf("route info of %s outlives the route", route))
+		}
+		return true
+	})
+	sortTracked(state.RedistributedEvpn)
+	sort.Strings(state.Problems)
+	return state
+}
+
+// Dumps the internal maps and cross-checks them against each other
+func (c *EvpnController) DumpState() dto.ControllerState {
+	state := dto.ControllerState{
+		ExistingRT: mapset.Sorted(c.existingRT),
+		RtVrfMap:   map[string]string{},
+		RouteMap:   []dto.TrackedRoute{},
+		RtMap:      map[string][]string{},
+	}
+	c.rtVrfMap.Range(func(rt string, vrfName string) bool {
+		state.RtVrfMap[rt] = vrfName
+		return true
+	})
+	tracked := map[evpnRoute]uuidRT{}
+	c.redistributedStorage.Range(func(route evpnRoute, value uuidRT) bool {
+		tracked[route] = value
+		state.RouteMap = append(state.RouteMap, dto.TrackedRoute{
+			Source:    route.String(),
+			Generated: generatedVpnOf(route),
+			Uuid:      value.uuid,
+			Targets:   value.targets,
+		})
+		return true
+	})
+	indexed := map[string]mapset.Set[evpnRoute]{}
+	c.redistributedStorage.RangeRT(func(rt string, routes []evpnRoute) bool {
+		indexed[rt] = mapset.NewThreadUnsafeSet(routes...)
+		sources := make([]string, 0, len(routes))
+		for _, route := range routes {
+			sources = append(sources, route.String())
+			if _, ok := tracked[route]; !ok {
+				state.Problems = append(state.Problems,
+					fmt.Sprintf("route target %s refers to untracked route %s", rt, route))
+			}
+		}
+		sort.Strings(sources)
+		state.RtMap[rt] = sources
+		return true
+	})
+	for route, value := range tracked {
+		if !c.existingRT.ContainsAny(value.targets...) {
+			state.Problems = append(state.Problems,
+				fmt.Sprintf("%s is redistributed although no VRF imports its route targets %v", route, value.targets))
+		}
+		for _, rt := range value.targets {
+			if routes, ok := indexed[rt]; !ok || !routes.Contains(route) {
+				state.Problems = append(state.Problems,
+					fmt.Sprintf("route target %s does not refer to tracked route %s", rt, route))
+			}
+		}
+	}
+	sortTracked(state.RouteMap)
+	sort.Strings(state.Problems)
+	return state
+}
+
+func sortTracked(routes []dto.TrackedRoute) {
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Source != routes[j].Source {
+			return routes[i].Source < routes[j].Source
+		}
+		return routes[i].Uuid.String() < routes[j].Uuid.String()
+	})
+}
+
+// Whether the received path should be redistributed and whether it is
+func (c *VPNv4Controller) Audit(path *api.Path) dto.PathAudit {
+	route, err := vpnFromApi(path.GetNlri())
+	if err != nil {
+		return dto.PathAudit{}
+	}
+	vrf, ok := c.rdVrfMap.Load(route.Rd)
+	if !ok {
+		return dto.PathAudit{}
+	}
+	_, err = c.routeGen.GenRoute(route, vrf, path.GetPattrs())
+	expected := err == nil && !c.overridden(vrf, route) && c.unauthorized(vrf, route, path.GetNeighborIp()) == "" &&
+		pathSpoofed(vrf, route, path) == "" && !c.summarized(vrf, route) &&
+		c.limits.blocks(vrf, path.GetNeighborIp(), route) == nil
+	audit := dto.PathAudit{Vrf: vrf.Name, Source: route.String(), Expected: expected}
+	if _, tracked := c.redistributedEvpn.Load(route); tracked {
+		info, _ := c.routeInfo.Load(route)
+		audit.Tracked, audit.Generated = true, info.generated
+	}
+	return audit
+}
+
+// Whether the received path should be redistributed and whether it is
+func (c *EvpnController) Audit(path *api.Path) dto.PathAudit {
+	route, err := evpnFromApi(path.GetNlri())
+	if err != nil {
+		return dto.PathAudit{}
+	}
+	routeTargets := extractRouteTargets(path.GetPattrs())
+	if !c.existingRT.ContainsAny(routeTargets...) {
+		return dto.PathAudit{}
+	}
+	vrfName := c.vrfName(routeTargets)
+	audit := dto.PathAudit{Vrf: vrfName, Source: route.String(), Expected: c.suppression(vrfName, route) == ""}
+	if c.redistributedStorage.Get(route) != uuid.Nil {
+		audit.Tracked, audit.Generated = true, generatedVpnOf(route)
+	}
+	return audit
+}
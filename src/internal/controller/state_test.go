@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/google/uuid"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestVPNv4Controller_DumpState(t *testing.T) {
+	mockInjector := &mockEvpnInjector{}
+	controller := NewVPNv4Controller(mockInjector, []oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", Id: 1000}}, nil)
+	evpnUuid := uuid.New()
+	mockInjector.On("AddType5Route", mock.Anything).Return(evpnUuid, nil)
+	require.NoError(t, controller.HandleUpdate(context.Background(), createTestVPNPath()))
+
+	state := controller.DumpState()
+
+	assert.Equal(t, map[string]string{"65000:100": "test-vrf"}, state.RdVrfMap)
+	assert.Equal(t, []dto.TrackedRoute{{
+		Source:    "65000:100:10.0.0.0/24",
+		Generated: "5:65000:100:10.0.0.0/24 Gw:192.168.1.1 Vni:1000",
+		Uuid:      evpnUuid,
+	}}, state.RedistributedEvpn)
+	assert.Empty(t, state.Problems)
+
+	controller.redistributedEvpn.Store(vpnRoute{Rd: "65000:999", Prefix: "10.9.0.0", Prefixlen: 24}, uuid.New())
+	assert.Equal(t, []string{
+		"65000:999:10.9.0.0/24 is redistributed although RD 65000:999 belongs to no VRF",
+		"no generated route is recorded for 65000:999:10.9.0.0/24",
+	}, controller.DumpState().Problems)
+}
+
+func TestEvpnController_DumpState(t *testing.T) {
+	mockInjector := &mockVpnInjector{}
+	controller := NewEvpnController(
+		mockInjector,
+		[]oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", ImportRtList: []string{"65000:100"}}},
+		nil,
+	)
+	mockInjector.On("AddRoute", mock.Anything).Return(uuid.New(), nil)
+	require.NoError(t, controller.HandleUpdate(context.Background(), createTestEVPNPath()))
+	source := "5:65000:100:10.0.0.0/24 Gw:192.168.1.1 Vni:1000"
+
+	state := controller.DumpState()
+
+	assert.Equal(t, []string{"65000:100"}, state.ExistingRT)
+	assert.Equal(t, map[string]string{"65000:100": "test-vrf"}, state.RtVrfMap)
+	require.Len(t, state.RouteMap, 1)
+	assert.Equal(t, source, state.RouteMap[0].Source)
+	assert.Equal(t, "65000:100:10.0.0.0/24", state.RouteMap[0].Generated)
+	assert.Equal(t, map[string][]string{"65000:100": {source}}, state.RtMap)
+	assert.Empty(t, state.Problems)
+
+	route, err := evpnFromApi(createTestEVPNPath().Nlri)
+	require.NoError(t, err)
+	controller.redistributedStorage.rtMap.DeleteVal("65000:100", route)
+	controller.existingRT.Remove("65000:100")
+	assert.Equal(t, []string{
+		source + " is redistributed although no VRF imports its route targets [65000:100]",
+		"route target 65000:100 does not refer to tracked route " + source,
+	}, controller.DumpState().Problems)
+
+	controller.redistributedStorage.rtMap.Store("65000:200", route)
+	controller.redistributedStorage.routeMap.Delete(route)
+	assert.Equal(t, []string{"route target 65000:200 refers to untracked route " + source},
+		controller.DumpState().Problems)
+}
+
+func TestVPNv4Controller_Audit(t *testing.T) {
+	mockInjector := &mockEvpnInjector{}
+	controller := NewVPNv4Controller(mockInjector, []oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", Id: 1000}}, nil)
+
+	audit := controller.Audit(createTestVPNPath())
+	assert.Equal(t, dto.PathAudit{Vrf: "test-vrf", Source: "65000:100:10.0.0.0/24", Expected: true}, audit)
+
+	noNexthop := createTestVPNPath()
+	noNexthop.Pattrs = []*anypb.Any{}
+	assert.False(t, controller.Audit(noNexthop).Expected)
+
+	mockInjector.On("AddType5Route", mock.Anything).Return(uuid.New(), nil)
+	require.NoError(t, controller.HandleUpdate(context.Background(), createTestVPNPath()))
+	assert.True(t, controller.Audit(createTestVPNPath()).Tracked)
+}
+
+func TestEvpnController_Audit(t *testing.T) {
+	controller := NewEvpnController(&mockVpnInjector{}, []oc.VrfConfig{}, nil)
+	assert.Equal(t, dto.PathAudit{}, controller.Audit(createTestEVPNPath()))
+
+	controller = NewEvpnController(
+		&mockVpnInjector{},
+		[]oc.VrfConfig{{Name: "test-vrf", Rd: "65000:100", ImportRtList: []string{"65000:100"}}},
+		nil,
+	)
+	audit := controller.Audit(createTestEVPNPath())
+	assert.Equal(t, dto.PathAudit{
+		Vrf: "test-vrf", Source: "5:65000:100:10.0.0.0/24 Gw:192.168.1.1 Vni:1000", Expected: true,
+	}, audit)
+}
+
+func TestFormatNlri(t *testing.T) {
+	nlri, ok := FormatNlri(createTestVPNPath().Nlri)
+	assert.True(t, ok)
+	assert.Equal(t, "65000:100:10.0.0.0/24", nlri)
+
+	nlri, ok = FormatNlri(createTestEVPNPath().Nlri)
+	assert.True(t, ok)
+	assert.Equal(t, "5:65000:100:10.0.0.0/24 Gw:192.168.1.1 Vni:1000", nlri)
+
+	_, ok = FormatNlri(createTestEVPNPath().Pattrs[0])
+	assert.False(t, ok)
+}
@@ -0,0 +1,284 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/amyasnikov/berg/internal/logging"
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/amyasnikov/berg/internal/utils"
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/sirupsen/logrus"
+)
+
+// Source of the routes injected for static routes, they have no received path behind them
+const StaticSource = "static"
+
+// Prefix of a VRF, the prefix has its host bits cleared
+type localKey struct {
+	vrf    string
+	prefix string
+}
+
+// Everything the injected route is generated from, a change of any of it means re-injection
+type localSpec struct {
+	Rd           string
+	RouteTargets []string
+	Vni          uint32
+	Route        dto.StaticRoute
+	Aggregate    bool
+	Asns         []uint32 // AS_SET of the aggregate
+}
+
+func newLocalSpec(vrf dto.Vrf, route dto.StaticRoute) localSpec {
+	return localSpec{Rd: vrf.Rd, RouteTargets: vrf.ExportRouteTargets, Vni: vrf.Vni, Route: route}
+}
+
+type localRoute struct {
+	spec      localSpec
+	generated string
+	uuid      uuid.UUID
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+// Injects the routes configured rather than received, e.g. static or orchestrated ones
+type localInjector struct {
+	injector evpnInjector
+	routeGen *evpnRouteGen
+	source   string
+	events   events.Publisher
+	logger   *logrus.Logger
+}
+
+func newLocalInjector(injector evpnInjector, source string) localInjector {
+	return localInjector{
+		injector: injector,
+		routeGen: newEvpnRouteGen(),
+		source:   source,
+		events:   events.Discard{},
+		logger:   logging.Discard(),
+	}
+}
+
+// prev is the route injected for an older version of the spec, if loaded
+func (l *localInjector) inject(
+	key localKey, spec localSpec, prev localRoute, loaded bool, reason string,
+) (localRoute, error) {
+	vrf := dto.Vrf{Rd: spec.Rd, ExportRouteTargets: spec.RouteTargets, Vni: spec.Vni}
+	var evpnRoute dto.Evpn5Route
+	var err error
+	if spec.Aggregate {
+		evpnRoute, err = l.routeGen.GenAggregateRoute(spec.Route, spec.Asns, vrf)
+	} else {
+		evpnRoute, err = l.routeGen.GenStaticRoute(spec.Route, vrf)
+	}
+	if err != nil {
+		observeRoute(key.vrf, metrics.DirectionToEvpn, metrics.OperationInject, err)
+		l.emit(l.event(events.Rejected, key, "", err.Error()))
+		return localRoute{}, err
+	}
+	generated := generatedEvpn(evpnRoute)
+	evpnUuid, err := l.injector.AddType5Route(evpnRoute)
+	observeRoute(key.vrf, metrics.DirectionToEvpn, metrics.OperationInject, err)
+	if err != nil {
+		l.emit(l.event(events.Rejected, key, generated, err.Error()))
+		return localRoute{}, err
+	}
+	now := time.Now()
+	injected := localRoute{spec: spec, generated: generated, uuid: evpnUuid, createdAt: now, updatedAt: now}
+	eventType := events.Added
+	if loaded {
+		eventType = events.Replaced
+		injected.createdAt = prev.createdAt
+		if prev.generated != generated { // the same NLRI is replaced in place
+			l.injector.DelRoute(prev.uuid)
+		}
+	}
+	l.emit(l.event(eventType, key, generated, reason))
+	return injected, nil
+}
+
+func (l *localInjector) withdraw(key localKey, injected localRoute, reason string) error {
+	l.emit(l.event(events.Withdrawn, key, injected.generated, reason))
+	err := l.injector.DelRoute(injected.uuid)
+	observeRoute(key.vrf, metrics.DirectionToEvpn, metrics.OperationWithdraw, err)
+	return err
+}
+
+func (l *localInjector) emit(event events.Event) {
+	logEvent(l.logger, event)
+	l.events.Publish(event)
+}
+
+func (l *localInjector) event(eventType events.Type, key localKey, generated string, reason string) events.Event {
+	return events.Event{
+		Time:      time.Now(),
+		Type:      eventType,
+		Vrf:       key.vrf,
+		Direction: metrics.DirectionToEvpn,
+		Prefix:    key.prefix,
+		Source:    l.source,
+		Generated: generated,
+		Reason:    reason,
+	}
+}
+
+func (l *localInjector) redistributedRoute(key localKey, injected localRoute) dto.RedistributedRoute {
+	return dto.RedistributedRoute{
+		Vrf:       key.vrf,
+		Direction: metrics.DirectionToEvpn,
+		Prefix:    key.prefix,
+		Source:    l.source,
+		Generated: injected.generated,
+		Uuid:      injected.uuid,
+		CreatedAt: injected.createdAt,
+		UpdatedAt: injected.updatedAt,
+	}
+}
+
+func sortRedistributed(routes []dto.RedistributedRoute) {
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Vrf != routes[j].Vrf {
+			return routes[i].Vrf < routes[j].Vrf
+		}
+		return routes[i].Prefix < routes[j].Prefix
+	})
+}
+
+// Applies the VRF changes to the VRFs by name
+func reloadVrfs(vrfs map[string]dto.Vrf, diff dto.VrfDiff) {
+	for _, vrf := range diff.Deleted {
+		delete(vrfs, vrf.Name)
+	}
+	for _, vrf := range diff.Created {
+		vrfs[vrf.Name] = dto.NewVrf(vrf, diff.Extensions[vrf.Name])
+	}
+	if diff.Extensions != nil {
+		for name, vrf := range vrfs {
+			vrf.VrfExtensions = diff.Extensions[name]
+			vrfs[name] = vrf
+		}
+	}
+}
+
+func newVrfMap(vrfCfg []oc.VrfConfig, vrfExt map[string]dto.VrfExtensions) map[string]dto.Vrf {
+	vrfs := make(map[string]dto.Vrf, len(vrfCfg))
+	for _, vrf := range vrfCfg {
+		vrfs[vrf.Name] = dto.NewVrf(vrf, vrfExt[vrf.Name])
+	}
+	return vrfs
+}
+
+// Injects the static routes of the VRFs as Type-5 routes and keeps them in line with the config
+type StaticRoutes struct {
+	lock     sync.Mutex
+	local    localInjector
+	vrfs     map[string]dto.Vrf // by VRF name
+	injected map[localKey]localRoute
+}
+
+func NewStaticRoutes(
+	injector evpnInjector, vrfCfg []oc.VrfConfig, vrfExt map[string]dto.VrfExtensions,
+) *StaticRoutes {
+	return &StaticRoutes{
+		local:    newLocalInjector(injector, StaticSource),
+		vrfs:     newVrfMap(vrfCfg, vrfExt),
+		injected: map[localKey]localRoute{},
+	}
+}
+
+// Sets the receiver of the injection decisions
+func (s *StaticRoutes) SetEventPublisher(publisher events.Publisher) {
+	s.local.events = publisher
+}
+
+func (s *StaticRoutes) SetLogger(logger *logrus.Logger) {
+	s.local.logger = logger
+}
+
+// Injects the configured static routes which are not injected yet
+func (s *StaticRoutes) Sync() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sync()
+}
+
+// Applies the VRF changes, then injects the added or changed static routes and withdraws the removed ones
+func (s *StaticRoutes) ReloadConfig(diff dto.VrfDiff) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	reloadVrfs(s.vrfs, diff)
+	return s.sync()
+}
+
+// Must be called with lock held
+func (s *StaticRoutes) sync() error {
+	wanted := map[localKey]localSpec{}
+	for name, vrf := range s.vrfs {
+		for _, route := range vrf.StaticRoutes {
+			key := localKey{vrf: name, prefix: route.Prefix} // invalid prefixes are rejected on injection
+			if prefix, err := utils.StaticRoutePrefix(route); err == nil {
+				key.prefix = prefix.String()
+			}
+			wanted[key] = newLocalSpec(vrf, route)
+		}
+	}
+	var merr error
+	for key, injected := range s.injected {
+		if _, ok := wanted[key]; ok {
+			continue
+		}
+		delete(s.injected, key)
+		reason := events.ReasonStaticRemoved
+		if _, ok := s.vrfs[key.vrf]; !ok {
+			reason = events.ReasonVrfDeleted
+		}
+		if err := s.local.withdraw(key, injected, reason); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	for key, spec := range wanted {
+		prev, loaded := s.injected[key]
+		if loaded && reflect.DeepEqual(prev.spec, spec) {
+			continue
+		}
+		injected, err := s.local.inject(key, spec, prev, loaded, events.ReasonStaticConfigured)
+		if err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("VRF %s: %w", key.vrf, err))
+			continue
+		}
+		s.injected[key] = injected
+	}
+	return merr
+}
+
+// Injected static routes sorted by VRF and prefix, Source is StaticSource
+func (s *StaticRoutes) ListRedistributed() []dto.RedistributedRoute {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	result := make([]dto.RedistributedRoute, 0, len(s.injected))
+	for key, injected := range s.injected {
+		result = append(result, s.local.redistributedRoute(key, injected))
+	}
+	sortRedistributed(result)
+	return result
+}
+
+// Number of injected static routes by VRF name
+func (s *StaticRoutes) RedistributedRoutes() map[string]int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	result := map[string]int{}
+	for key := range s.injected {
+		result[key.vrf]++
+	}
+	return result
+}
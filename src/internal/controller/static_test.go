@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/events"
+	"github.com/google/uuid"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var staticVrf = oc.VrfConfig{Name: "vrf_10", Id: 10, Rd: "65000:10", BothRtList: []string{"65000:10"}}
+
+func staticExtensions(routes ...dto.StaticRoute) map[string]dto.VrfExtensions {
+	return map[string]dto.VrfExtensions{"vrf_10": {StaticRoutes: routes}}
+}
+
+func withGateway(gateway string) any {
+	return mock.MatchedBy(func(route dto.Evpn5Route) bool { return route.Gateway == gateway })
+}
+
+func TestStaticRoutes_Sync(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	routeUuid := uuid.New()
+	injector.On("AddType5Route", mock.Anything).Return(routeUuid, nil).Once()
+	publisher := &recordingPublisher{}
+	static := NewStaticRoutes(injector, []oc.VrfConfig{staticVrf}, staticExtensions(
+		dto.StaticRoute{Prefix: "10.0.5.0/24", Gateway: "192.168.0.5", Communities: []string{"65000:1"}},
+	))
+	static.SetEventPublisher(publisher)
+
+	require.NoError(t, static.Sync())
+	require.NoError(t, static.Sync()) // nothing changed
+
+	injector.AssertExpectations(t)
+	route := injector.Calls[0].Arguments.Get(0).(dto.Evpn5Route)
+	assert.Equal(t, "65000:10", route.Rd)
+	assert.Equal(t, []string{"65000:10"}, route.RouteTargets)
+	assert.Equal(t, "10.0.5.0", route.Prefix)
+	assert.Equal(t, uint32(24), route.Prefixlen)
+	assert.Equal(t, "192.168.0.5", route.Gateway)
+	assert.Equal(t, uint32(10), route.Vni)
+	assert.Len(t, route.PathAttrs, 2) // origin and communities
+	require.Len(t, publisher.events, 1)
+	assert.Equal(t, events.Added, publisher.events[0].Type)
+	assert.Equal(t, StaticSource, publisher.events[0].Source)
+	assert.Equal(t, events.ReasonStaticConfigured, publisher.events[0].Reason)
+	assert.Equal(t, "5:65000:10:10.0.5.0/24 Gw:192.168.0.5 Vni:10", publisher.events[0].Generated)
+	listed := static.ListRedistributed()
+	require.Len(t, listed, 1)
+	assert.Equal(t, routeUuid, listed[0].Uuid)
+	assert.Equal(t, "vrf_10", listed[0].Vrf)
+	assert.Equal(t, map[string]int{"vrf_10": 1}, static.RedistributedRoutes())
+}
+
+func TestStaticRoutes_ReloadConfig(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+	injector.On("AddType5Route", withGateway("192.168.0.5")).Return(first, nil).Once()
+	publisher := &recordingPublisher{}
+	static := NewStaticRoutes(injector, []oc.VrfConfig{staticVrf}, staticExtensions(
+		dto.StaticRoute{Prefix: "10.0.5.0/24", Gateway: "192.168.0.5"},
+	))
+	static.SetEventPublisher(publisher)
+	require.NoError(t, static.Sync())
+
+	// attributes changed, the same NLRI is replaced in place
+	injector.On("AddType5Route", withGateway("192.168.0.5")).Return(second, nil).Once()
+	require.NoError(t, static.ReloadConfig(dto.VrfDiff{Extensions: staticExtensions(
+		dto.StaticRoute{Prefix: "10.0.5.0/24", Gateway: "192.168.0.5", LocalPref: 200},
+	)}))
+	injector.AssertNotCalled(t, "DelRoute", first)
+
+	// gateway changed, the old NLRI is withdrawn
+	injector.On("AddType5Route", withGateway("192.168.0.6")).Return(third, nil).Once()
+	injector.On("DelRoute", second).Return(nil).Once()
+	require.NoError(t, static.ReloadConfig(dto.VrfDiff{Extensions: staticExtensions(
+		dto.StaticRoute{Prefix: "10.0.5.0/24", Gateway: "192.168.0.6", LocalPref: 200},
+	)}))
+
+	// removed
+	injector.On("DelRoute", third).Return(nil).Once()
+	require.NoError(t, static.ReloadConfig(dto.VrfDiff{Extensions: staticExtensions()}))
+
+	injector.AssertExpectations(t)
+	assert.Equal(t, []events.Type{events.Added, events.Replaced, events.Replaced, events.Withdrawn}, publisher.types())
+	assert.Equal(t, events.ReasonStaticRemoved, publisher.events[3].Reason)
+	assert.Empty(t, static.ListRedistributed())
+}
+
+func TestStaticRoutes_VrfChanges(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	routeUuid := uuid.New()
+	injector.On("AddType5Route", mock.Anything).Return(routeUuid, nil).Once()
+	injector.On("DelRoute", routeUuid).Return(nil).Once()
+	publisher := &recordingPublisher{}
+	static := NewStaticRoutes(injector, nil, nil)
+	static.SetEventPublisher(publisher)
+	extensions := staticExtensions(dto.StaticRoute{Prefix: "10.0.5.0/24", Gateway: "192.168.0.5"})
+
+	require.NoError(t, static.ReloadConfig(dto.VrfDiff{Created: []oc.VrfConfig{staticVrf}, Extensions: extensions}))
+	require.NoError(t, static.ReloadConfig(dto.VrfDiff{Deleted: []oc.VrfConfig{staticVrf}, Extensions: extensions}))
+
+	injector.AssertExpectations(t)
+	assert.Equal(t, []events.Type{events.Added, events.Withdrawn}, publisher.types())
+	assert.Equal(t, events.ReasonVrfDeleted, publisher.events[1].Reason)
+}
+
+func TestStaticRoutes_InjectionFailed(t *testing.T) {
+	injector := &mockEvpnInjector{}
+	injector.On("AddType5Route", mock.Anything).Return(uuid.Nil, errors.New("AddPath failed")).Once()
+	publisher := &recordingPublisher{}
+	static := NewStaticRoutes(injector, []oc.VrfConfig{staticVrf}, staticExtensions(
+		dto.StaticRoute{Prefix: "10.0.5.0/24", Gateway: "192.168.0.5"},
+	))
+	static.SetEventPublisher(publisher)
+
+	err := static.Sync()
+
+	assert.ErrorContains(t, err, "VRF vrf_10: AddPath failed")
+	assert.Equal(t, []events.Type{events.Rejected}, publisher.types())
+	assert.Empty(t, static.ListRedistributed())
+
+	// retried by the next sync
+	injector.On("AddType5Route", mock.Anything).Return(uuid.New(), nil).Once()
+	assert.NoError(t, static.Sync())
+	assert.Len(t, static.ListRedistributed(), 1)
+}
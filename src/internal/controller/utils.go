@@ -52,22 +52,10 @@ func findNextHop(route fmt.Stringer, pattrs []*anypb.Any) (string, error) {
 	return "", fmt.Errorf("no nexthop was found for route %s", route.String())
 }
 
-func makeRdVrfMap(vrfCfg []oc.VrfConfig) *xsync.Map[string, dto.Vrf] {
+func makeRdVrfMap(vrfCfg []oc.VrfConfig, vrfExt map[string]dto.VrfExtensions) *xsync.Map[string, dto.Vrf] {
 	rdVrfMap := xsync.NewMap[string, dto.Vrf]()
 	for _, vrf := range vrfCfg {
-		vrfDto := dto.Vrf{
-			Name:               vrf.Name,
-			Rd:                 vrf.Rd,
-			ImportRouteTargets: vrf.BothRtList,
-			ExportRouteTargets: vrf.BothRtList,
-			Vni:                vrf.Id,
-		}
-		if len(vrf.ImportRtList) > 0 {
-			vrfDto.ImportRouteTargets = vrf.ImportRtList
-		}
-		if len(vrf.ExportRtList) > 0 {
-			vrfDto.ExportRouteTargets = vrf.ExportRtList
-		}
+		vrfDto := dto.NewVrf(vrf, vrfExt[vrf.Name])
 		rdVrfMap.Store(vrfDto.Rd, vrfDto)
 	}
 	return rdVrfMap
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Identifies a prefix within a VRF regardless of its label
+type prefixKey struct {
+	Rd        string
+	Prefix    string
+	Prefixlen uint32
+}
+
+func (r vpnRoute) prefixKey() prefixKey {
+	return prefixKey{Rd: r.Rd, Prefix: r.Prefix, Prefixlen: r.Prefixlen}
+}
+
+type delayedWithdraw struct {
+	route vpnRoute
+	uuid  uuid.UUID
+	timer *time.Timer
+}
+
+// Keeps redistributed routes alive for a while after their source is withdrawn,
+// e.g. while a VM re-establishes its BGP session from another hypervisor after live migration
+type withdrawHold struct {
+	pending map[prefixKey]*delayedWithdraw
+	lock    sync.Mutex
+}
+
+func newWithdrawHold() *withdrawHold {
+	return &withdrawHold{pending: map[prefixKey]*delayedWithdraw{}}
+}
+
+// Calls withdraw after delay unless the prefix reappears earlier
+func (h *withdrawHold) Schedule(
+	route vpnRoute, routeUuid uuid.UUID, delay time.Duration, withdraw func(vpnRoute, uuid.UUID),
+) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	key := route.prefixKey()
+	if prev, ok := h.pending[key]; ok {
+		prev.timer.Stop()
+	}
+	entry := &delayedWithdraw{route: route, uuid: routeUuid}
+	entry.timer = time.AfterFunc(delay, func() {
+		h.lock.Lock()
+		if h.pending[key] != entry {
+			h.lock.Unlock()
+			return
+		}
+		delete(h.pending, key)
+		h.lock.Unlock()
+		withdraw(entry.route, entry.uuid)
+	})
+	h.pending[key] = entry
+}
+
+// Cancels the pending withdrawal of the prefix, returns the route it was scheduled for
+func (h *withdrawHold) Cancel(key prefixKey) (vpnRoute, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	entry, ok := h.pending[key]
+	if !ok {
+		return vpnRoute{}, false
+	}
+	entry.timer.Stop()
+	delete(h.pending, key)
+	return entry.route, true
+}
+
+func (h *withdrawHold) Pending(key prefixKey) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	_, ok := h.pending[key]
+	return ok
+}
+
+// Drops pending withdrawals without executing them
+func (h *withdrawHold) Discard(match func(vpnRoute) bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for key, entry := range h.pending {
+		if match(entry.route) {
+			entry.timer.Stop()
+			delete(h.pending, key)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithdrawHold_ExecutesAfterDelay(t *testing.T) {
+	hold := newWithdrawHold()
+	route := vpnRoute{Rd: "65000:100", Prefix: "10.0.0.0", Prefixlen: 24, Label: 1000}
+	routeUuid := uuid.New()
+	withdrawn := make(chan uuid.UUID, 1)
+
+	hold.Schedule(route, routeUuid, 10*time.Millisecond, func(r vpnRoute, id uuid.UUID) {
+		assert.Equal(t, route, r)
+		withdrawn <- id
+	})
+
+	select {
+	case id := <-withdrawn:
+		assert.Equal(t, routeUuid, id)
+	case <-time.After(time.Second):
+		t.Fatal("Withdrawal was not executed")
+	}
+}
+
+func TestWithdrawHold_Cancel(t *testing.T) {
+	hold := newWithdrawHold()
+	route := vpnRoute{Rd: "65000:100", Prefix: "10.0.0.0", Prefixlen: 24, Label: 1000}
+	hold.Schedule(route, uuid.New(), 20*time.Millisecond, func(vpnRoute, uuid.UUID) {
+		t.Error("Cancelled withdrawal was executed")
+	})
+
+	relabeled := route
+	relabeled.Label = 2000
+	heldRoute, held := hold.Cancel(relabeled.prefixKey())
+	time.Sleep(40 * time.Millisecond)
+
+	assert.True(t, held)
+	assert.Equal(t, route, heldRoute)
+	_, held = hold.Cancel(route.prefixKey())
+	assert.False(t, held)
+}
+
+func TestWithdrawHold_Discard(t *testing.T) {
+	hold := newWithdrawHold()
+	discarded := vpnRoute{Rd: "65000:100", Prefix: "10.0.0.0", Prefixlen: 24}
+	kept := vpnRoute{Rd: "65000:200", Prefix: "10.0.0.0", Prefixlen: 24}
+	withdrawn := make(chan vpnRoute, 2)
+	withdraw := func(r vpnRoute, _ uuid.UUID) { withdrawn <- r }
+	hold.Schedule(discarded, uuid.New(), 10*time.Millisecond, withdraw)
+	hold.Schedule(kept, uuid.New(), 10*time.Millisecond, withdraw)
+
+	hold.Discard(func(r vpnRoute) bool { return r.Rd == "65000:100" })
+
+	select {
+	case r := <-withdrawn:
+		assert.Equal(t, kept, r)
+	case <-time.After(time.Second):
+		t.Fatal("Withdrawal was not executed")
+	}
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, withdrawn)
+}
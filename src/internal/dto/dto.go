@@ -1,6 +1,10 @@
 package dto
 
 import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
 	"github.com/osrg/gobgp/v3/pkg/config/oc"
 	"google.golang.org/protobuf/types/known/anypb"
 )
@@ -13,6 +17,8 @@ type Evpn5Route struct {
 	Gateway      string
 	Vni          uint32
 	PathAttrs    []*anypb.Any
+	// Added to the route targets and the encapsulation community
+	ExtCommunities []*anypb.Any
 }
 
 type VPNRoute struct {
@@ -29,9 +35,305 @@ type Vrf struct {
 	ExportRouteTargets []string
 	ImportRouteTargets []string
 	Vni                uint32
+	VrfExtensions
+}
+
+func NewVrf(vrf oc.VrfConfig, ext VrfExtensions) Vrf {
+	vrfDto := Vrf{
+		Name:               vrf.Name,
+		Rd:                 vrf.Rd,
+		ImportRouteTargets: vrf.BothRtList,
+		ExportRouteTargets: vrf.BothRtList,
+		Vni:                vrf.Id,
+		VrfExtensions:      ext,
+	}
+	if len(vrf.ImportRtList) > 0 {
+		vrfDto.ImportRouteTargets = vrf.ImportRtList
+	}
+	if len(vrf.ExportRtList) > 0 {
+		vrfDto.ExportRouteTargets = vrf.ExportRtList
+	}
+	return vrfDto
+}
+
+// Berg-specific VRF settings which are not a part of GoBGP configuration
+type VrfExtensions struct {
+	// How long a redistributed route outlives the withdrawal of its source, 0 means withdraw immediately
+	WithdrawHoldTime time.Duration
+	// Attribute favoring the newest gateway of a moving prefix, empty means no mobility tracking
+	Mobility MobilityMode
+	// Moves counter restarts after the prefix stays on the same gateway for this long
+	MobilityResetTime time.Duration
+	// Routes injected as Type-5 without a BGP session behind them
+	StaticRoutes []StaticRoute
+	// Which route is redistributed when an orchestrated prefix is learned over BGP as well
+	OrchestratedPrecedence Precedence
+	// Prefixes exported as a single Type-5 route while any more specific route of the VRF is redistributed
+	Aggregates []Aggregate
+	// Default route imported into the VRF in place of the EVPN routes, nil means none
+	DefaultOriginate *DefaultOriginate
+	// Routes leaked between this VRF and the others
+	Leaks []LeakRule
+	// Limits of the received routes redistributed to EVPN, nil means no limits
+	MaxPrefix *MaxPrefix
+	// Gateways the neighbors of the VRF may announce, nil means any gateway is redistributed
+	GatewayCheck *GatewayCheck
 }
 
+// Anti-spoofing: the gateway of a received route is either the address of the announcing neighbor
+// or belongs to a subnet allowed for the neighbor
+type GatewayCheck struct {
+	Allowed []AllowedGateways
+}
+
+type AllowedGateways struct {
+	Neighbor string   // neighbor address or dynamic-neighbor range, e.g. 192.168.0.0/24
+	Subnets  []string // gateway subnets allowed for the matching neighbors
+}
+
+// Zero limit means no limit
+type MaxPrefix struct {
+	Vrf      uint32 // routes of the VRF
+	Neighbor uint32 // routes of the VRF received from a single neighbor
+	Warning  uint32 // percentage of a limit raising a warning once reached, 0 means no warning
+	Action   MaxPrefixAction
+}
+
+// What happens once a limit is exceeded
+type MaxPrefixAction string
+
+const (
+	MaxPrefixWarn     MaxPrefixAction = ""         // the routes are redistributed anyway
+	MaxPrefixStop     MaxPrefixAction = "stop"     // new routes are not redistributed until the limit is cleared
+	MaxPrefixWithdraw MaxPrefixAction = "withdraw" // besides, the routes of the neighbor exceeding it are withdrawn
+)
+
+// Exceeded max-prefix limit blocking the new routes
+type MaxPrefixBlock struct {
+	Vrf      string
+	Neighbor string // empty for the limit of the VRF
+}
+
+// Routes received in one VRF re-originated in another one
+type LeakRule struct {
+	Vrf       string        // the other VRF
+	Prefixes  []string      // routes within any of the prefixes are leaked, empty means all the routes
+	Direction LeakDirection // which VRF the routes are leaked from
+	Evpn      bool          // the leaked routes are exported to EVPN under the destination VRF as well
+}
+
+type LeakDirection string
+
+const (
+	LeakImport LeakDirection = "" // from the other VRF into this one
+	LeakExport LeakDirection = "export"
+	LeakBoth   LeakDirection = "both"
+)
+
+// Default route originated into the VRF, ::/0 if the condition is IPv6 and 0.0.0.0/0 otherwise
+type DefaultOriginate struct {
+	Condition        string // prefix of the EVPN route the VRF must import for the default route to exist, e.g. 0.0.0.0/0
+	SuppressImported bool   // EVPN routes other than default ones are not imported into the VRF
+}
+
+type Aggregate struct {
+	Prefix      string // e.g. 10.0.0.0/16
+	Gateway     string // empty means the gateway of the lowest contributing route
+	SummaryOnly bool   // the contributing routes are suppressed rather than exported along with the aggregate
+	AsSet       bool   // AS_PATH is the AS_SET of the contributing routes rather than empty with ATOMIC_AGGREGATE
+}
+
+type Precedence string
+
+const (
+	PrecedenceBgp          Precedence = "" // orchestrated route is withdrawn while the prefix is learned over BGP
+	PrecedenceOrchestrator Precedence = "orchestrator"
+)
+
+// Prefix of an appliance which cannot speak BGP, advertised with the appliance address as the gateway
+type StaticRoute struct {
+	Prefix  string // e.g. 10.0.0.0/24
+	Gateway string
+	// Optional attributes, zero means not set
+	LocalPref   uint32
+	Med         uint32
+	Communities []string // e.g. 65000:100
+}
+
+type MobilityMode string
+
+const (
+	MobilityNone        MobilityMode = ""
+	MobilityLocalPref   MobilityMode = "local-pref"
+	MobilityMacMobility MobilityMode = "mac-mobility"
+)
+
 type VrfDiff struct {
 	Created []oc.VrfConfig
 	Deleted []oc.VrfConfig
+	// Extensions of all the configured VRFs by VRF name, nil means no changes
+	Extensions map[string]VrfExtensions
+}
+
+// Route injected by berg along with the path it was generated from
+type RedistributedRoute struct {
+	Vrf       string
+	Direction string
+	Prefix    string // e.g. 10.0.0.0/24
+	Source    string // NLRI of the source path
+	Generated string // NLRI of the injected path
+	Uuid      uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Prefix of a VRF leased by an orchestrator, e.g. the address of a VM whose BGP session is not up yet
+type OrchestratedRoute struct {
+	Vrf       string
+	Prefix    string // e.g. 10.0.0.5/32
+	Gateway   string
+	ExpiresAt time.Time
+	Injected  bool   // false while the prefix is learned over BGP and BGP takes precedence
+	Generated string // NLRI of the injected path
+}
+
+// Prefixes the neighbors may announce, as exported by the IPAM
+type AllowlistEntry struct {
+	Neighbor string   // neighbor address or subnet, e.g. 192.168.0.0/24
+	Vrf      string   // empty means any VRF
+	Prefixes []string // the prefixes and their more specific routes are allowed
+}
+
+// Received route the prefix allowlist keeps from being redistributed
+type BlockedRoute struct {
+	Vrf      string
+	Prefix   string // e.g. 10.0.0.0/24
+	Source   string // NLRI of the received path
+	Neighbor string
+	Reason   string
+	Since    time.Time
+}
+
+type AllowlistState struct {
+	Enabled   bool
+	Source    string    // file path or URL
+	LoadedAt  time.Time // zero until the allowlist is loaded
+	CheckedAt time.Time // last time the source was read
+	Entries   int
+	Error     string // of the last read, the previous allowlist stays in effect
+	Blocked   []BlockedRoute
+}
+
+type ReloadStatus struct {
+	Time    time.Time
+	Success bool
+	Error   string
+}
+
+type Status struct {
+	StartedAt       time.Time
+	Converged       bool
+	Workers         int
+	EventQueueDepth int
+	Redistributed   map[string]int // routes count by direction
+	LastReload      *ReloadStatus  // nil if config was never reloaded
+}
+
+var ErrVrfNotFound = errors.New("VRF not found")
+
+var ErrRouteNotFound = errors.New("route not found")
+
+// Wrapped by the errors of route validation
+var ErrInvalidRoute = errors.New("invalid route")
+
+var ErrVrfExists = errors.New("VRF already exists")
+
+// Wrapped by the errors of VRF settings validation
+var ErrInvalidVrf = errors.New("invalid VRF")
+
+// Outcome of a single step of the redistribution pipeline
+type ExplainStep struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+// Redistribution decisions taken for a path of the RIB
+type PathExplanation struct {
+	Direction     string
+	Source        string // NLRI of the path
+	Neighbor      string
+	Steps         []ExplainStep
+	Generated     string // NLRI of the generated path, empty if the pipeline stopped earlier
+	Redistributed bool
+	Reason        string // why the path is not redistributed
+}
+
+func (e *PathExplanation) Pass(step, detail string) {
+	e.Steps = append(e.Steps, ExplainStep{Name: step, Passed: true, Detail: detail})
+}
+
+// Records the failed step which stops the pipeline
+func (e *PathExplanation) Reject(step, reason string) {
+	e.Steps = append(e.Steps, ExplainStep{Name: step, Detail: reason})
+	e.Reason = reason
+}
+
+type Explanation struct {
+	Vrf    string
+	Prefix string
+	Paths  []PathExplanation
+}
+
+// Route tracked by a controller along with the path injected for it
+type TrackedRoute struct {
+	Source    string    `json:"source"`
+	Generated string    `json:"generated"`
+	Uuid      uuid.UUID `json:"uuid"`
+	Targets   []string  `json:"targets,omitempty"`
+}
+
+// Internal maps of a controller, Problems lists the disagreements between them
+type ControllerState struct {
+	RdVrfMap          map[string]string   `json:"rd_vrf_map,omitempty"` // RD -> VRF name
+	RedistributedEvpn []TrackedRoute      `json:"redistributed_evpn,omitempty"`
+	ExistingRT        []string            `json:"existing_rt,omitempty"`
+	RtVrfMap          map[string]string   `json:"rt_vrf_map,omitempty"` // import RT -> VRF name
+	RouteMap          []TrackedRoute      `json:"route_map,omitempty"`
+	RtMap             map[string][]string `json:"rt_map,omitempty"` // RT -> source NLRIs
+	Problems          []string            `json:"problems,omitempty"`
+}
+
+type StateDump struct {
+	Vpnv4 ControllerState `json:"vpnv4"`
+	Evpn  ControllerState `json:"evpn"`
+}
+
+// Whether a received path should be redistributed and whether it is.
+// Empty Vrf means no VRF is interested in the path
+type PathAudit struct {
+	Vrf       string
+	Source    string
+	Expected  bool
+	Tracked   bool
+	Generated string // NLRI of the path injected for the tracked route
+}
+
+type InconsistentRoute struct {
+	Direction string `json:"direction"`
+	Vrf       string `json:"vrf,omitempty"`
+	Source    string `json:"source,omitempty"`
+	Generated string `json:"generated,omitempty"`
+	Uuid      string `json:"uuid,omitempty"`
+}
+
+// Disagreements between the controllers and the GoBGP RIB
+type ConsistencyReport struct {
+	Consistent bool                `json:"consistent"`
+	Converged  bool                `json:"converged"`
+	Orphans    []InconsistentRoute `json:"orphans"`  // injected paths in the RIB which are not tracked
+	Dangling   []InconsistentRoute `json:"dangling"` // tracked routes without the injected path in the RIB
+	Stale      []InconsistentRoute `json:"stale"`    // tracked routes without the source path in the RIB
+	Missing    []InconsistentRoute `json:"missing"`  // received paths which should be redistributed but are not
+	Internal   []string            `json:"internal"` // disagreements between the controller maps
 }
@@ -0,0 +1,176 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/amyasnikov/berg/internal/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+type Type string
+
+// Redistribution decisions
+const (
+	Added     Type = "added"
+	Replaced  Type = "replaced"
+	Withdrawn Type = "withdrawn"
+	Rejected  Type = "rejected"
+	// Made by the reconciliation loop to fix a disagreement with the GoBGP RIB
+	Corrected Type = "corrected"
+	// Max-prefix warning threshold reached, nothing is changed
+	Warning Type = "warning"
+)
+
+// Reasons of the redistribution decisions
+const (
+	ReasonSourceAdvertised = "source advertised"
+	ReasonSourceUpdated    = "source updated"
+	ReasonSourceWithdrawn  = "source withdrawn"
+	ReasonHoldExpired      = "withdraw hold time expired"
+	ReasonVrfCreated       = "VRF created"
+	ReasonVrfDeleted       = "VRF deleted"
+	ReasonNotRedistributed = "source not redistributed"
+	ReasonInjectedPathLost = "injected path missing from RIB"
+	ReasonSourceLost       = "source missing from RIB"
+	ReasonUntrackedPath    = "injected path not tracked"
+	ReasonStaticConfigured = "static route configured"
+	ReasonStaticRemoved    = "static route removed"
+	ReasonLeased           = "prefix leased by orchestrator"
+	ReasonLeaseExpired     = "lease expired"
+	ReasonLeaseReleased    = "lease released"
+	ReasonBgpPrecedence    = "prefix learned over BGP takes precedence"
+	ReasonOrchestrated     = "orchestrated route takes precedence"
+	ReasonSummarized       = "suppressed by summary-only aggregate"
+	ReasonUnsummarized     = "no longer suppressed by aggregate"
+	ReasonContributing     = "contributing route redistributed"
+	ReasonNoContributors   = "last contributing route gone"
+	ReasonAggregateRemoved = "aggregate removed"
+	ReasonDefaultOriginate = "default-originate configured"
+	ReasonConditionPresent = "default-originate condition route present"
+	ReasonConditionAbsent  = "default-originate condition route gone"
+	ReasonDefaultRemoved   = "default-originate removed"
+	ReasonDefaultOnly      = "suppressed by default-originate"
+	ReasonNotDefaultOnly   = "no longer suppressed by default-originate"
+	ReasonNotIPv4          = "IPv6 routes are not redistributed"
+	ReasonLeakRemoved      = "leak rule removed"
+	ReasonLeakSourceGone   = "leaked route gone"
+	ReasonMaxPrefix        = "max-prefix limit exceeded"
+	ReasonMaxPrefixWarning = "max-prefix warning threshold reached"
+	ReasonSpoofedGateway   = "gateway does not belong to the neighbor"
+	ReasonNotAllowlisted   = "prefix not allowed by the allowlist"
+)
+
+// A single redistribution decision made by a controller
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      Type      `json:"type"`
+	Vrf       string    `json:"vrf"`
+	Direction string    `json:"direction"`
+	Prefix    string    `json:"prefix"`
+	Source    string    `json:"source"`
+	Neighbor  string    `json:"neighbor,omitempty"`
+	Generated string    `json:"generated,omitempty"`
+	Reason    string    `json:"reason"`
+}
+
+// Persists or forwards events. Write is called from a single goroutine,
+// it should give up once ctx is done
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, event Event) error
+	Close() error
+}
+
+// Receives the redistribution decisions, Publish may be called concurrently
+type Publisher interface {
+	Publish(Event)
+}
+
+// Publisher dropping all the events
+type Discard struct{}
+
+func (Discard) Publish(Event) {}
+
+type sinkWorker struct {
+	sink  Sink
+	queue chan Event
+}
+
+// Fans events out to the sinks. Every sink has its own queue and goroutine,
+// so neither a slow sink nor a full queue blocks the publisher: overflowing events are dropped
+type Dispatcher struct {
+	workers []sinkWorker
+	logger  *logrus.Logger
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	lock    sync.RWMutex // guards closed, Publish may race with Close at shutdown
+	closed  bool
+}
+
+func NewDispatcher(logger *logrus.Logger, queueSize int, sinks ...Sink) *Dispatcher {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{logger: logger, ctx: ctx, cancel: cancel}
+	for _, sink := range sinks {
+		w := sinkWorker{sink: sink, queue: make(chan Event, queueSize)}
+		d.workers = append(d.workers, w)
+		d.wg.Add(1)
+		go d.work(w)
+	}
+	return d
+}
+
+func (d *Dispatcher) work(w sinkWorker) {
+	defer d.wg.Done()
+	for event := range w.queue {
+		if err := w.sink.Write(d.ctx, event); err != nil {
+			metrics.EventSinkErrors.WithLabelValues(w.sink.Name()).Inc()
+			d.logger.Errorf("event sink %s: %v", w.sink.Name(), err)
+		}
+	}
+}
+
+func (d *Dispatcher) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if d.closed {
+		return
+	}
+	for _, w := range d.workers {
+		select {
+		case w.queue <- event:
+		default:
+			metrics.EventsDropped.WithLabelValues(w.sink.Name()).Inc()
+		}
+	}
+}
+
+// Flushes the queued events and closes the sinks, later events are dropped.
+// Writes still in progress after timeout are aborted
+func (d *Dispatcher) Close(timeout time.Duration) error {
+	d.lock.Lock()
+	d.closed = true
+	for _, w := range d.workers {
+		close(w.queue)
+	}
+	d.lock.Unlock()
+	timer := time.AfterFunc(timeout, d.cancel)
+	d.wg.Wait()
+	timer.Stop()
+	d.cancel()
+	var firstErr error
+	for _, w := range d.workers {
+		if err := w.sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,98 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type memorySink struct {
+	events  []Event
+	lock    sync.Mutex
+	block   chan struct{}
+	closed  bool
+	written chan struct{}
+}
+
+func newMemorySink() *memorySink {
+	return &memorySink{written: make(chan struct{}, 100)}
+}
+
+func (s *memorySink) Name() string {
+	return "memory"
+}
+
+func (s *memorySink) Write(ctx context.Context, event Event) error {
+	if s.block != nil {
+		select {
+		case <-s.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.lock.Lock()
+	s.events = append(s.events, event)
+	s.lock.Unlock()
+	s.written <- struct{}{}
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestDispatcher_FansOut(t *testing.T) {
+	first, second := newMemorySink(), newMemorySink()
+	d := NewDispatcher(logrus.New(), 10, first, second)
+
+	d.Publish(Event{Type: Added, Prefix: "10.0.0.0/24"})
+	assert.NoError(t, d.Close(time.Second))
+
+	for _, sink := range []*memorySink{first, second} {
+		assert.Len(t, sink.events, 1)
+		assert.Equal(t, Added, sink.events[0].Type)
+		assert.False(t, sink.events[0].Time.IsZero())
+		assert.True(t, sink.closed)
+	}
+}
+
+func TestDispatcher_DoesNotBlock(t *testing.T) {
+	slow := newMemorySink()
+	slow.block = make(chan struct{})
+	d := NewDispatcher(logrus.New(), 1, slow)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			d.Publish(Event{Type: Added})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow sink")
+	}
+	close(slow.block)
+	assert.NoError(t, d.Close(time.Second))
+	assert.LessOrEqual(t, len(slow.events), 2)
+}
+
+func TestDispatcher_CloseAbortsStuckWrites(t *testing.T) {
+	stuck := newMemorySink()
+	stuck.block = make(chan struct{})
+	d := NewDispatcher(logrus.New(), 10, stuck)
+	d.Publish(Event{Type: Added})
+
+	start := time.Now()
+	assert.NoError(t, d.Close(10*time.Millisecond))
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Empty(t, stuck.events)
+	d.Publish(Event{Type: Added}) // dropped after Close
+}
@@ -0,0 +1,72 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readEvents(t *testing.T, path string) []Event {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	result := []Event{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		result = append(result, event)
+	}
+	return result
+}
+
+func TestFileSink_AppendsJsonLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := NewFileSink(path, 0, 0)
+	assert.NoError(t, err)
+
+	assert.NoError(t, sink.Write(context.Background(), Event{Type: Added, Prefix: "10.0.0.0/24"}))
+	assert.NoError(t, sink.Write(context.Background(), Event{Type: Withdrawn, Prefix: "10.0.0.0/24"}))
+	assert.NoError(t, sink.Close())
+
+	written := readEvents(t, path)
+	assert.Len(t, written, 2)
+	assert.Equal(t, Withdrawn, written[1].Type)
+}
+
+func TestFileSink_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	line, _ := json.Marshal(Event{Type: Added})
+	sink, err := NewFileSink(path, int64(len(line)+1)*2, 2)
+	assert.NoError(t, err)
+
+	for i := 0; i < 7; i++ {
+		assert.NoError(t, sink.Write(context.Background(), Event{Type: Added}))
+	}
+	assert.NoError(t, sink.Close())
+
+	assert.Len(t, readEvents(t, path), 1)
+	assert.Len(t, readEvents(t, path+".1"), 2)
+	assert.Len(t, readEvents(t, path+".2"), 2)
+	assert.NoFileExists(t, path+".3")
+}
+
+func TestFileSink_RotatesWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := NewFileSink(path, 1, 0)
+	assert.NoError(t, err)
+
+	assert.NoError(t, sink.Write(context.Background(), Event{Type: Added}))
+	assert.NoError(t, sink.Write(context.Background(), Event{Type: Withdrawn}))
+	assert.NoError(t, sink.Close())
+
+	written := readEvents(t, path)
+	assert.Len(t, written, 1)
+	assert.Equal(t, Withdrawn, written[0].Type)
+	assert.NoFileExists(t, path+".1")
+}
@@ -0,0 +1,108 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	severityWarning = 4
+	severityNotice  = 5
+)
+
+// Syslog facility codes by name
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "daemon": 3, "auth": 4, "syslog": 5,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+const rfc5424Time = "2006-01-02T15:04:05.000000Z07:00"
+
+// Sends events as RFC 5424 messages over udp, tcp or unixgram.
+// The message carries the event in JSON, the route identity is duplicated in structured data
+type SyslogSink struct {
+	network  string
+	address  string
+	facility int
+	hostname string
+	conn     net.Conn
+}
+
+func NewSyslogSink(network, address, facility string) (*SyslogSink, error) {
+	code, ok := facilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", facility)
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &SyslogSink{network: network, address: address, facility: code, hostname: hostname}, nil
+}
+
+func (s *SyslogSink) Name() string {
+	return "syslog"
+}
+
+func (s *SyslogSink) Write(_ context.Context, event Event) error {
+	msg, err := s.format(event)
+	if err != nil {
+		return err
+	}
+	if s.network == "tcp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg) // octet counting, RFC 6587
+	}
+	// reconnect once, e.g. after the collector restarts
+	for attempt := 0; ; attempt++ {
+		if s.conn == nil {
+			if s.conn, err = net.DialTimeout(s.network, s.address, 5*time.Second); err != nil {
+				return err
+			}
+		}
+		if _, err = s.conn.Write([]byte(msg)); err == nil || attempt > 0 {
+			return err
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func (s *SyslogSink) format(event Event) (string, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	severity := severityNotice
+	if event.Type == Rejected {
+		severity = severityWarning
+	}
+	return fmt.Sprintf(`<%d>1 %s %s berg %d %s [route@32473 vrf="%s" direction="%s" prefix="%s"] %s`,
+		s.facility*8+severity,
+		event.Time.Format(rfc5424Time),
+		s.hostname,
+		os.Getpid(),
+		event.Type,
+		escapeParam(event.Vrf),
+		escapeParam(event.Direction),
+		escapeParam(event.Prefix),
+		body,
+	), nil
+}
+
+// RFC 5424 section 6.3.3
+func escapeParam(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+func (s *SyslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
@@ -0,0 +1,72 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyslogSink_Udp(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+	sink, err := NewSyslogSink("udp", conn.LocalAddr().String(), "local1")
+	assert.NoError(t, err)
+	defer sink.Close()
+
+	err = sink.Write(context.Background(), Event{
+		Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Type: Rejected, Vrf: `vrf"1`, Prefix: "10.0.0.0/24",
+	})
+	assert.NoError(t, err)
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	pattern := fmt.Sprintf(
+		`^<140>1 2024-01-02T03:04:05.000000Z \S+ berg %d rejected \[route@32473 vrf="vrf\\"1" direction="" `+
+			`prefix="10.0.0.0/24"\] \{.*"type":"rejected".*\}$`,
+		os.Getpid(),
+	)
+	assert.Regexp(t, regexp.MustCompile(pattern), string(buf[:n]))
+}
+
+func TestSyslogSink_TcpOctetCounting(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	sink, err := NewSyslogSink("tcp", listener.Addr().String(), "local0")
+	assert.NoError(t, err)
+	defer sink.Close()
+
+	assert.NoError(t, sink.Write(context.Background(), Event{Type: Added}))
+
+	conn, err := listener.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	prefix, err := reader.ReadString(' ')
+	assert.NoError(t, err)
+	length, err := strconv.Atoi(strings.TrimSpace(prefix))
+	assert.NoError(t, err)
+	msg := make([]byte, length)
+	_, err = io.ReadFull(reader, msg)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^<133>1 `, string(msg))
+}
+
+func TestNewSyslogSink_UnknownFacility(t *testing.T) {
+	_, err := NewSyslogSink("udp", "127.0.0.1:514", "mail2")
+
+	assert.ErrorContains(t, err, "mail2")
+}
@@ -0,0 +1,73 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// POSTs every event as a JSON object, failed requests are retried with exponential backoff
+type WebhookSink struct {
+	url           string
+	client        *http.Client
+	retries       int
+	retryInterval time.Duration
+}
+
+func NewWebhookSink(url string, timeout time.Duration, retries int, retryInterval time.Duration) *WebhookSink {
+	return &WebhookSink{
+		url:           url,
+		client:        &http.Client{Timeout: timeout},
+		retries:       retries,
+		retryInterval: retryInterval,
+	}
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *WebhookSink) Write(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	delay := s.retryInterval
+	for attempt := 0; ; attempt++ {
+		err = s.post(ctx, body)
+		if err == nil || attempt >= s.retries {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+}
+
+func (s *WebhookSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded with %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,61 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookSink_Retries(t *testing.T) {
+	var calls atomic.Int32
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+	sink := NewWebhookSink(server.URL, time.Second, 3, time.Millisecond)
+
+	err := sink.Write(context.Background(), Event{Type: Rejected, Reason: "no nexthop"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, "no nexthop", received.Reason)
+}
+
+func TestWebhookSink_GivesUp(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	sink := NewWebhookSink(server.URL, time.Second, 2, time.Millisecond)
+
+	err := sink.Write(context.Background(), Event{Type: Added})
+
+	assert.ErrorContains(t, err, "500")
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestWebhookSink_StopsOnCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	sink := NewWebhookSink(server.URL, time.Second, 10, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.Error(t, sink.Write(ctx, Event{Type: Added}))
+}
@@ -0,0 +1,59 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const checkTimeout = 5 * time.Second
+
+const (
+	StatusOk   = "ok"
+	StatusFail = "fail"
+)
+
+// Named probe, nil error means healthy
+type Check struct {
+	Name string
+	Run  func(context.Context) error
+}
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Runs every check, the report fails if any of them does
+func Run(ctx context.Context, checks ...Check) Report {
+	report := Report{Status: StatusOk, Checks: make(map[string]CheckResult, len(checks))}
+	for _, check := range checks {
+		result := CheckResult{Status: StatusOk}
+		if err := check.Run(ctx); err != nil {
+			result = CheckResult{Status: StatusFail, Error: err.Error()}
+			report.Status = StatusFail
+		}
+		report.Checks[check.Name] = result
+	}
+	return report
+}
+
+// Serves the JSON report, 503 if any check fails
+func Handler(checks ...Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+		report := Run(ctx, checks...)
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != StatusOk {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,42 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func okCheck(context.Context) error {
+	return nil
+}
+
+func TestHandler_Ok(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	Handler(Check{"event_loop", okCheck}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"status":"ok","checks":{"event_loop":{"status":"ok"}}}`, recorder.Body.String())
+}
+
+func TestHandler_Fail(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	failing := func(context.Context) error { return errors.New("peer 10.0.0.1 is ACTIVE") }
+
+	Handler(
+		Check{"converged", okCheck}, Check{"evpn_sessions", failing},
+	).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	var report Report
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, CheckResult{Status: StatusOk}, report.Checks["converged"])
+	assert.Equal(t, CheckResult{Status: StatusFail, Error: "peer 10.0.0.1 is ACTIVE"}, report.Checks["evpn_sessions"])
+}
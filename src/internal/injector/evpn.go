@@ -4,25 +4,36 @@ import (
 	"context"
 
 	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/logging"
+	"github.com/amyasnikov/berg/internal/metrics"
 	"github.com/amyasnikov/berg/internal/utils"
 	"github.com/google/uuid"
 	"github.com/hashicorp/go-multierror"
 	api "github.com/osrg/gobgp/v3/api"
+	"github.com/sirupsen/logrus"
 	"google.golang.org/protobuf/types/known/anypb"
 )
 
 type EvpnInjector struct {
-	s bgpServer
+	s        bgpServer
+	streamer pathStreamer
+	streamed *streamedPaths
+	logger   *logrus.Logger
 }
 
-func NewEvpnInjector(s bgpServer) *EvpnInjector {
-	return &EvpnInjector{s: s}
+// streamer is optional, without it AddType5Routes falls back to AddPath calls
+func NewEvpnInjector(s bgpServer, streamer pathStreamer) *EvpnInjector {
+	return &EvpnInjector{s: s, streamer: streamer, streamed: newStreamedPaths(), logger: logging.Discard()}
 }
 
-func (c *EvpnInjector) AddType5Route(route dto.Evpn5Route) (uuid.UUID, error) {
+func (c *EvpnInjector) SetLogger(logger *logrus.Logger) {
+	c.logger = logger
+}
+
+func (c *EvpnInjector) buildType5Path(route dto.Evpn5Route) (*api.Path, error) {
 	rd, err := utils.RdToApi(route.Rd)
 	if err != nil {
-		return uuid.Nil, err
+		return nil, err
 	}
 
 	nlri, _ := anypb.New(&api.EVPNIPPrefixRoute{
@@ -34,7 +45,7 @@ func (c *EvpnInjector) AddType5Route(route dto.Evpn5Route) (uuid.UUID, error) {
 		GwAddress:   route.Gateway,
 		Label:       route.Vni,
 	})
-	extcomms := make([]*anypb.Any, 0, len(route.RouteTargets)+1)
+	extcomms := make([]*anypb.Any, 0, len(route.RouteTargets)+len(route.ExtCommunities)+1)
 	var merr error
 	for _, rtString := range route.RouteTargets {
 		rt, err := utils.RtToApi(rtString)
@@ -44,32 +55,66 @@ func (c *EvpnInjector) AddType5Route(route dto.Evpn5Route) (uuid.UUID, error) {
 		extcomms = append(extcomms, rt)
 	}
 	if merr != nil {
-		return uuid.Nil, merr
+		return nil, merr
 	}
+	extcomms = append(extcomms, route.ExtCommunities...)
 	encap, _ := anypb.New(&api.EncapExtended{TunnelType: 8}) // VXLAN encap
 	extcommAttr, _ := anypb.New(&api.ExtendedCommunitiesAttribute{
 		Communities: append(extcomms, encap),
 	})
 	nh, _ := anypb.New(&api.NextHopAttribute{NextHop: "0.0.0.0"})
 	pattrs := append(route.PathAttrs, extcommAttr, nh)
-	req := &api.AddPathRequest{
-		Path: &api.Path{
-			Family: &api.Family{
-				Afi:  api.Family_AFI_L2VPN,
-				Safi: api.Family_SAFI_EVPN,
-			},
-			Nlri:   nlri,
-			Pattrs: pattrs,
+	return &api.Path{
+		Family: &api.Family{
+			Afi:  api.Family_AFI_L2VPN,
+			Safi: api.Family_SAFI_EVPN,
 		},
+		Nlri:   nlri,
+		Pattrs: pattrs,
+	}, nil
+}
+
+func (c *EvpnInjector) AddType5Route(route dto.Evpn5Route) (_ uuid.UUID, err error) {
+	defer func() { observe(c.logger, metrics.DirectionToEvpn, metrics.OperationInject, 1, err) }()
+	path, err := c.buildType5Path(route)
+	if err != nil {
+		return uuid.Nil, err
 	}
-	resp, err := c.s.AddPath(context.TODO(), req)
+	resp, err := c.s.AddPath(context.TODO(), &api.AddPathRequest{Path: path})
 	if err != nil {
 		return uuid.Nil, err
 	}
+	c.streamed.Forget(path) // replaced in place
 	return uuid.FromBytes(resp.Uuid)
 }
 
-func (c *EvpnInjector) DelRoute(uuid uuid.UUID) error {
+// Injects routes in bulk. Returned UUIDs are aligned with routes, uuid.Nil means the route was not injected
+func (c *EvpnInjector) AddType5Routes(routes []dto.Evpn5Route) (_ []uuid.UUID, merr error) {
+	defer func() { observe(c.logger, metrics.DirectionToEvpn, metrics.OperationInject, len(routes), merr) }()
+	paths := make([]*api.Path, len(routes))
+	for i, route := range routes {
+		path, err := c.buildType5Path(route)
+		if err != nil {
+			merr = multierror.Append(merr, err)
+			continue
+		}
+		paths[i] = path
+	}
+	uuids, err := injectPaths(c.s, c.streamer, c.streamed, paths)
+	if err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	return uuids, merr
+}
+
+func (c *EvpnInjector) DelRoute(uuid uuid.UUID) (err error) {
+	defer func() { observe(c.logger, metrics.DirectionToEvpn, metrics.OperationWithdraw, 1, err) }()
+	if path, found := c.streamed.Release(uuid); found {
+		if path == nil {
+			return nil // still injected on behalf of another route or replaced in place
+		}
+		return delPath(c.s, path)
+	}
 	family := &api.Family{
 		Afi:  api.Family_AFI_L2VPN,
 		Safi: api.Family_SAFI_EVPN,
@@ -16,7 +16,7 @@ import (
 
 func TestEvpnInjector_AddType5Route_Ok(t *testing.T) {
 	m := new(mockBgpServer)
-	injector := NewEvpnInjector(m)
+	injector := NewEvpnInjector(m, nil)
 
 	// Create path attribute (e.g., LOCAL_PREF)
 	localPref := &api.LocalPrefAttribute{LocalPref: 100}
@@ -84,9 +84,45 @@ func TestEvpnInjector_AddType5Route_Ok(t *testing.T) {
 	m.AssertExpectations(t)
 }
 
+func TestEvpnInjector_AddType5Route_ExtCommunities(t *testing.T) {
+	m := new(mockBgpServer)
+	injector := NewEvpnInjector(m, nil)
+
+	mobility, err := anypb.New(&api.MacMobilityExtended{SequenceNum: 3})
+	require.NoError(t, err)
+	route := dto.Evpn5Route{
+		Rd:             "65000:1",
+		RouteTargets:   []string{"65000:100"},
+		Prefix:         "10.0.0.0",
+		Prefixlen:      24,
+		Gateway:        "10.0.0.1",
+		Vni:            1000,
+		ExtCommunities: []*anypb.Any{mobility},
+	}
+	respUuid := uuid.New()
+
+	m.On("AddPath", mock.Anything, mock.MatchedBy(func(req *api.AddPathRequest) bool {
+		extCommAttr := &api.ExtendedCommunitiesAttribute{}
+		if err := req.Path.Pattrs[0].UnmarshalTo(extCommAttr); err != nil {
+			return false
+		}
+		// route target + MAC mobility + encap (VXLAN)
+		if len(extCommAttr.Communities) != 3 {
+			return false
+		}
+		seq := &api.MacMobilityExtended{}
+		return extCommAttr.Communities[1].UnmarshalTo(seq) == nil && seq.SequenceNum == 3
+	})).Return(&api.AddPathResponse{Uuid: respUuid[:]}, nil)
+
+	id, err := injector.AddType5Route(route)
+	require.NoError(t, err)
+	require.Equal(t, respUuid, id)
+	m.AssertExpectations(t)
+}
+
 func TestEvpnInjector_AddType5Route_Error(t *testing.T) {
 	m := new(mockBgpServer)
-	injector := NewEvpnInjector(m)
+	injector := NewEvpnInjector(m, nil)
 
 	// Create path attribute (e.g., LOCAL_PREF)
 	localPref := &api.LocalPrefAttribute{LocalPref: 100}
@@ -116,7 +152,7 @@ func TestEvpnInjector_AddType5Route_Error(t *testing.T) {
 
 func TestEvpnInjector_DelRoute_Ok(t *testing.T) {
 	m := new(mockBgpServer)
-	injector := NewEvpnInjector(m)
+	injector := NewEvpnInjector(m, nil)
 
 	id := uuid.New()
 	binUuid, _ := id.MarshalBinary()
@@ -172,7 +208,7 @@ func TestEvpnInjector_DelRoute_Ok(t *testing.T) {
 
 func TestEvpnInjector_DelRoute_Error(t *testing.T) {
 	m := new(mockBgpServer)
-	injector := NewEvpnInjector(m)
+	injector := NewEvpnInjector(m, nil)
 
 	id := uuid.New()
 	m.On("DeletePath", mock.Anything, mock.Anything).Return(errors.New("fail"))
@@ -4,9 +4,14 @@ import (
 	"context"
 
 	api "github.com/osrg/gobgp/v3/api"
+	"google.golang.org/grpc"
 )
 
 type bgpServer interface {
 	AddPath(context.Context, *api.AddPathRequest) (*api.AddPathResponse, error)
 	DeletePath(context.Context, *api.DeletePathRequest) error
 }
+
+type pathStreamer interface {
+	AddPathStream(ctx context.Context, opts ...grpc.CallOption) (api.GobgpApi_AddPathStreamClient, error)
+}
@@ -5,6 +5,8 @@ import (
 
 	api "github.com/osrg/gobgp/v3/api"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 // Mock implementation of bgpServer for tests
@@ -21,3 +23,25 @@ func (m *mockBgpServer) DeletePath(ctx context.Context, req *api.DeletePathReque
 	args := m.Called(ctx, req)
 	return args.Error(0)
 }
+
+// Mock implementation of pathStreamer, records every sent request
+type mockPathStreamer struct {
+	api.GobgpApi_AddPathStreamClient
+	requests []*api.AddPathStreamRequest
+	err      error
+}
+
+func (m *mockPathStreamer) AddPathStream(
+	ctx context.Context, opts ...grpc.CallOption,
+) (api.GobgpApi_AddPathStreamClient, error) {
+	return m, nil
+}
+
+func (m *mockPathStreamer) Send(req *api.AddPathStreamRequest) error {
+	m.requests = append(m.requests, req)
+	return nil
+}
+
+func (m *mockPathStreamer) CloseAndRecv() (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, m.err
+}
@@ -0,0 +1,133 @@
+package injector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+// Max number of paths sent in a single AddPathStream message
+const streamBatchSize = 1000
+
+var streamedNamespace = uuid.MustParse("5f0f6f1e-8a8e-4c55-9a43-3d1f2a7b9c01")
+
+type streamedPath struct {
+	path *api.Path // nil once the path is replaced by a path with GoBGP-assigned UUID
+	refs int
+}
+
+// GoBGP does not assign UUIDs to paths injected via AddPathStream.
+// Such paths are identified by UUIDs derived from their NLRI and withdrawn by NLRI
+type streamedPaths struct {
+	paths map[uuid.UUID]*streamedPath
+	lock  sync.Mutex
+}
+
+func newStreamedPaths() *streamedPaths {
+	return &streamedPaths{paths: map[uuid.UUID]*streamedPath{}}
+}
+
+func streamedUuid(path *api.Path) uuid.UUID {
+	key := append([]byte(path.GetFamily().String()), path.GetNlri().GetValue()...)
+	return uuid.NewSHA1(streamedNamespace, key)
+}
+
+func (s *streamedPaths) Add(path *api.Path) uuid.UUID {
+	id := streamedUuid(path)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if sp, ok := s.paths[id]; ok {
+		sp.refs++
+		sp.path = path
+	} else {
+		s.paths[id] = &streamedPath{path: path, refs: 1}
+	}
+	return id
+}
+
+// Used when the path gets replaced by a path with GoBGP-assigned UUID.
+// The streamed UUIDs are still released, but nothing is withdrawn on their behalf
+func (s *streamedPaths) Forget(path *api.Path) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if sp, ok := s.paths[streamedUuid(path)]; ok {
+		sp.path = nil
+	}
+}
+
+// Returns the path to withdraw once the last reference is released, nil if there is nothing to withdraw.
+// found=false means the UUID was assigned by GoBGP
+func (s *streamedPaths) Release(id uuid.UUID) (path *api.Path, found bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sp, ok := s.paths[id]
+	if !ok {
+		return nil, false
+	}
+	sp.refs--
+	if sp.refs > 0 {
+		return nil, true
+	}
+	delete(s.paths, id)
+	return sp.path, true
+}
+
+func addPathStream(streamer pathStreamer, paths []*api.Path) error {
+	stream, err := streamer.AddPathStream(context.TODO())
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(paths); start += streamBatchSize {
+		end := min(start+streamBatchSize, len(paths))
+		req := &api.AddPathStreamRequest{TableType: api.TableType_GLOBAL, Paths: paths[start:end]}
+		if err = stream.Send(req); err != nil {
+			return err
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+// Injects paths in bulk. Nil paths are skipped and get uuid.Nil.
+// Without a streamer paths are injected one by one via AddPath
+func injectPaths(s bgpServer, streamer pathStreamer, streamed *streamedPaths, paths []*api.Path) ([]uuid.UUID, error) {
+	uuids := make([]uuid.UUID, len(paths))
+	var merr error
+	if streamer == nil {
+		for i, path := range paths {
+			if path == nil {
+				continue
+			}
+			resp, err := s.AddPath(context.TODO(), &api.AddPathRequest{Path: path})
+			if err != nil {
+				merr = multierror.Append(merr, err)
+				continue
+			}
+			uuids[i], err = uuid.FromBytes(resp.Uuid)
+			if err != nil {
+				merr = multierror.Append(merr, err)
+			}
+		}
+		return uuids, merr
+	}
+	toSend := make([]*api.Path, 0, len(paths))
+	for i, path := range paths {
+		if path == nil {
+			continue
+		}
+		toSend = append(toSend, path)
+		uuids[i] = streamed.Add(path)
+	}
+	if err := addPathStream(streamer, toSend); err != nil {
+		for _, id := range uuids {
+			if id != uuid.Nil {
+				streamed.Release(id)
+			}
+		}
+		return make([]uuid.UUID, len(paths)), err
+	}
+	return uuids, nil
+}
@@ -0,0 +1,158 @@
+package injector
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/google/uuid"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func testVpnRoutes(count int) []dto.VPNRoute {
+	routes := make([]dto.VPNRoute, 0, count)
+	for i := 0; i < count; i++ {
+		routes = append(routes, dto.VPNRoute{
+			Rd:           "65000:1",
+			RouteTargets: []string{"65000:100"},
+			Prefix:       fmt.Sprintf("10.%d.%d.0", i/256, i%256),
+			Prefixlen:    24,
+		})
+	}
+	return routes
+}
+
+func TestVpnInjector_AddRoutes_Stream(t *testing.T) {
+	m := new(mockBgpServer)
+	streamer := &mockPathStreamer{}
+	injector := NewVPNv4Injector(m, streamer)
+
+	routes := testVpnRoutes(streamBatchSize + 1)
+	uuids, err := injector.AddRoutes(routes)
+
+	require.NoError(t, err)
+	require.Len(t, uuids, len(routes))
+	require.Len(t, streamer.requests, 2)
+	require.Len(t, streamer.requests[0].Paths, streamBatchSize)
+	require.Len(t, streamer.requests[1].Paths, 1)
+	require.Equal(t, api.TableType_GLOBAL, streamer.requests[0].TableType)
+	// identity is deterministic
+	again, err := NewVPNv4Injector(m, &mockPathStreamer{}).AddRoutes(routes[:1])
+	require.NoError(t, err)
+	require.Equal(t, uuids[0], again[0])
+	require.NotEqual(t, uuids[0], uuids[1])
+	m.AssertNotCalled(t, "AddPath", mock.Anything, mock.Anything)
+}
+
+func TestVpnInjector_AddRoutes_InvalidRoute(t *testing.T) {
+	m := new(mockBgpServer)
+	streamer := &mockPathStreamer{}
+	injector := NewVPNv4Injector(m, streamer)
+
+	routes := testVpnRoutes(2)
+	routes[0].Rd = "invalid"
+	uuids, err := injector.AddRoutes(routes)
+
+	require.Error(t, err)
+	require.Equal(t, uuid.Nil, uuids[0])
+	require.NotEqual(t, uuid.Nil, uuids[1])
+	require.Len(t, streamer.requests[0].Paths, 1)
+}
+
+func TestVpnInjector_AddRoutes_StreamError(t *testing.T) {
+	m := new(mockBgpServer)
+	streamer := &mockPathStreamer{err: errors.New("stream failed")}
+	injector := NewVPNv4Injector(m, streamer)
+
+	uuids, err := injector.AddRoutes(testVpnRoutes(2))
+
+	require.ErrorContains(t, err, "stream failed")
+	require.Equal(t, []uuid.UUID{uuid.Nil, uuid.Nil}, uuids)
+	require.Empty(t, injector.streamed.paths)
+}
+
+func TestVpnInjector_AddRoutes_WithoutStreamer(t *testing.T) {
+	m := new(mockBgpServer)
+	injector := NewVPNv4Injector(m, nil)
+	respUuid := uuid.New()
+	m.On("AddPath", mock.Anything, mock.Anything).Return(&api.AddPathResponse{Uuid: respUuid[:]}, nil).Twice()
+
+	uuids, err := injector.AddRoutes(testVpnRoutes(2))
+
+	require.NoError(t, err)
+	require.Equal(t, []uuid.UUID{respUuid, respUuid}, uuids)
+	m.AssertExpectations(t)
+}
+
+func TestVpnInjector_DelRoute_Streamed(t *testing.T) {
+	m := new(mockBgpServer)
+	injector := NewVPNv4Injector(m, &mockPathStreamer{})
+	route := testVpnRoutes(1)[0]
+	// the same NLRI injected on behalf of two routes
+	uuids, err := injector.AddRoutes([]dto.VPNRoute{route, route})
+	require.NoError(t, err)
+	require.Equal(t, uuids[0], uuids[1])
+
+	m.On("DeletePath", mock.Anything, mock.MatchedBy(func(req *api.DeletePathRequest) bool {
+		nlri := &api.LabeledVPNIPAddressPrefix{}
+		if err := req.Path.Nlri.UnmarshalTo(nlri); err != nil {
+			return false
+		}
+		return len(req.Uuid) == 0 && nlri.Prefix == route.Prefix && nlri.PrefixLen == route.Prefixlen
+	})).Return(nil).Once()
+
+	require.NoError(t, injector.DelRoute(uuids[0]))
+	m.AssertNotCalled(t, "DeletePath", mock.Anything, mock.Anything)
+	require.NoError(t, injector.DelRoute(uuids[1]))
+	m.AssertExpectations(t)
+}
+
+func TestVpnInjector_AddRoute_ReplacesStreamed(t *testing.T) {
+	m := new(mockBgpServer)
+	injector := NewVPNv4Injector(m, &mockPathStreamer{})
+	route := testVpnRoutes(1)[0]
+	uuids, err := injector.AddRoutes([]dto.VPNRoute{route})
+	require.NoError(t, err)
+	respUuid := uuid.New()
+	m.On("AddPath", mock.Anything, mock.Anything).Return(&api.AddPathResponse{Uuid: respUuid[:]}, nil)
+
+	_, err = injector.AddRoute(route)
+	require.NoError(t, err)
+
+	// implicit withdraw of the streamed route must not remove the replacement
+	require.NoError(t, injector.DelRoute(uuids[0]))
+	m.AssertNotCalled(t, "DeletePath", mock.Anything, mock.Anything)
+}
+
+func TestEvpnInjector_AddType5Routes_Stream(t *testing.T) {
+	m := new(mockBgpServer)
+	streamer := &mockPathStreamer{}
+	injector := NewEvpnInjector(m, streamer)
+	route := dto.Evpn5Route{
+		Rd:           "65000:1",
+		RouteTargets: []string{"65000:100"},
+		Prefix:       "10.0.0.0",
+		Prefixlen:    24,
+		Gateway:      "10.0.0.1",
+		Vni:          1000,
+	}
+
+	uuids, err := injector.AddType5Routes([]dto.Evpn5Route{route})
+
+	require.NoError(t, err)
+	require.Len(t, streamer.requests, 1)
+	path := streamer.requests[0].Paths[0]
+	require.Equal(t, api.Family_SAFI_EVPN, path.Family.Safi)
+	nlri := &api.EVPNIPPrefixRoute{}
+	require.NoError(t, path.Nlri.UnmarshalTo(nlri))
+	require.Equal(t, "10.0.0.1", nlri.GwAddress)
+
+	m.On("DeletePath", mock.Anything, mock.MatchedBy(func(req *api.DeletePathRequest) bool {
+		return len(req.Uuid) == 0 && req.Family.Safi == api.Family_SAFI_EVPN
+	})).Return(nil)
+	require.NoError(t, injector.DelRoute(uuids[0]))
+	m.AssertExpectations(t)
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/amyasnikov/berg/internal/metrics"
 	"github.com/google/uuid"
 	api "github.com/osrg/gobgp/v3/api"
+	"github.com/sirupsen/logrus"
 	"google.golang.org/protobuf/types/known/anypb"
 )
 
@@ -19,7 +21,7 @@ func delRoute(server bgpServer, uuid uuid.UUID, family *api.Family) error {
 	} else {
 		return fmt.Errorf("Unknown family %s", family.String())
 	}
-	nh, _ := anypb.New(&api.NextHopAttribute{NextHop: "0.0.0.0"})
+	nh, _ := anypb.New(&api.NextHopAttribute{NextHop: localNextHop(family.Afi)})
 	binUuid, _ := uuid.MarshalBinary()
 	delReq := &api.DeletePathRequest{
 		Uuid:   binUuid,
@@ -37,3 +39,37 @@ func delRoute(server bgpServer, uuid uuid.UUID, family *api.Family) error {
 	}
 	return nil
 }
+
+// Unspecified next hop of the locally originated paths of the family
+func localNextHop(afi api.Family_Afi) string {
+	if afi == api.Family_AFI_IP6 {
+		return "::"
+	}
+	return "0.0.0.0"
+}
+
+// Withdraws a path by its NLRI
+func delPath(server bgpServer, path *api.Path) error {
+	nh, _ := anypb.New(&api.NextHopAttribute{NextHop: localNextHop(path.Family.GetAfi())})
+	delReq := &api.DeletePathRequest{
+		Family: path.Family,
+		Path: &api.Path{
+			Family: path.Family,
+			Nlri:   path.Nlri,
+			Pattrs: []*anypb.Any{nh},
+		},
+	}
+	return server.DeletePath(context.TODO(), delReq)
+}
+
+// Failures are logged at debug level, since the callers decide whether they matter
+func observe(logger *logrus.Logger, direction string, operation string, paths int, err error) {
+	metrics.InjectorPaths.WithLabelValues(direction, operation).Add(float64(paths))
+	fields := logrus.Fields{"direction": direction, "operation": operation, "paths": paths}
+	if err != nil {
+		metrics.InjectorErrors.WithLabelValues(direction, operation).Inc()
+		logger.WithFields(fields).WithError(err).Debug("injector call failed")
+	} else if logger.IsLevelEnabled(logrus.TraceLevel) {
+		logger.WithFields(fields).Trace("injector call succeeded")
+	}
+}
@@ -4,26 +4,46 @@ import (
 	"context"
 
 	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/amyasnikov/berg/internal/logging"
+	"github.com/amyasnikov/berg/internal/metrics"
 	"github.com/amyasnikov/berg/internal/utils"
 	"github.com/google/uuid"
 	"github.com/hashicorp/go-multierror"
 	api "github.com/osrg/gobgp/v3/api"
+	"github.com/sirupsen/logrus"
 	"google.golang.org/protobuf/types/known/anypb"
 )
 
 type VPNInjector struct {
-	s   bgpServer
-	afi api.Family_Afi
+	s        bgpServer
+	streamer pathStreamer
+	streamed *streamedPaths
+	logger   *logrus.Logger
+	afi      api.Family_Afi
 }
 
-func NewVPNv4Injector(s bgpServer) *VPNInjector {
-	return &VPNInjector{s: s, afi: api.Family_AFI_IP}
+// streamer is optional, without it AddRoutes falls back to AddPath calls
+func NewVPNv4Injector(s bgpServer, streamer pathStreamer) *VPNInjector {
+	return &VPNInjector{
+		s: s, streamer: streamer, streamed: newStreamedPaths(), afi: api.Family_AFI_IP, logger: logging.Discard(),
+	}
+}
+
+// Injects the VPNv6 routes, e.g. the IPv6 default routes
+func NewVPNv6Injector(s bgpServer, streamer pathStreamer) *VPNInjector {
+	return &VPNInjector{
+		s: s, streamer: streamer, streamed: newStreamedPaths(), afi: api.Family_AFI_IP6, logger: logging.Discard(),
+	}
+}
+
+func (c *VPNInjector) SetLogger(logger *logrus.Logger) {
+	c.logger = logger
 }
 
-func (c *VPNInjector) AddRoute(route dto.VPNRoute) (uuid.UUID, error) {
+func (c *VPNInjector) buildPath(route dto.VPNRoute) (*api.Path, error) {
 	rd, err := utils.RdToApi(route.Rd)
 	if err != nil {
-		return uuid.Nil, err
+		return nil, err
 	}
 
 	nlri, _ := anypb.New(&api.LabeledVPNIPAddressPrefix{
@@ -42,31 +62,64 @@ func (c *VPNInjector) AddRoute(route dto.VPNRoute) (uuid.UUID, error) {
 		extcomms = append(extcomms, rt)
 	}
 	if merr != nil {
-		return uuid.Nil, merr
+		return nil, merr
 	}
 	extcommAttr, _ := anypb.New(&api.ExtendedCommunitiesAttribute{
 		Communities: extcomms,
 	})
-	nh, _ := anypb.New(&api.NextHopAttribute{NextHop: "0.0.0.0"})
+	nh, _ := anypb.New(&api.NextHopAttribute{NextHop: localNextHop(c.afi)})
 	pattrs := append(route.PathAttrs, extcommAttr, nh)
-	req := &api.AddPathRequest{
-		Path: &api.Path{
-			Family: &api.Family{
-				Afi:  c.afi,
-				Safi: api.Family_SAFI_MPLS_VPN,
-			},
-			Nlri:   nlri,
-			Pattrs: pattrs,
+	return &api.Path{
+		Family: &api.Family{
+			Afi:  c.afi,
+			Safi: api.Family_SAFI_MPLS_VPN,
 		},
+		Nlri:   nlri,
+		Pattrs: pattrs,
+	}, nil
+}
+
+func (c *VPNInjector) AddRoute(route dto.VPNRoute) (_ uuid.UUID, err error) {
+	defer func() { observe(c.logger, metrics.DirectionToVpn, metrics.OperationInject, 1, err) }()
+	path, err := c.buildPath(route)
+	if err != nil {
+		return uuid.Nil, err
 	}
-	resp, err := c.s.AddPath(context.TODO(), req)
+	resp, err := c.s.AddPath(context.TODO(), &api.AddPathRequest{Path: path})
 	if err != nil {
 		return uuid.Nil, err
 	}
+	c.streamed.Forget(path) // replaced in place
 	return uuid.FromBytes(resp.Uuid)
 }
 
-func (c *VPNInjector) DelRoute(uuid uuid.UUID) error {
+// Injects routes in bulk. Returned UUIDs are aligned with routes, uuid.Nil means the route was not injected
+func (c *VPNInjector) AddRoutes(routes []dto.VPNRoute) (_ []uuid.UUID, merr error) {
+	defer func() { observe(c.logger, metrics.DirectionToVpn, metrics.OperationInject, len(routes), merr) }()
+	paths := make([]*api.Path, len(routes))
+	for i, route := range routes {
+		path, err := c.buildPath(route)
+		if err != nil {
+			merr = multierror.Append(merr, err)
+			continue
+		}
+		paths[i] = path
+	}
+	uuids, err := injectPaths(c.s, c.streamer, c.streamed, paths)
+	if err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	return uuids, merr
+}
+
+func (c *VPNInjector) DelRoute(uuid uuid.UUID) (err error) {
+	defer func() { observe(c.logger, metrics.DirectionToVpn, metrics.OperationWithdraw, 1, err) }()
+	if path, found := c.streamed.Release(uuid); found {
+		if path == nil {
+			return nil // still injected on behalf of another route or replaced in place
+		}
+		return delPath(c.s, path)
+	}
 	family := &api.Family{
 		Afi:  c.afi,
 		Safi: api.Family_SAFI_MPLS_VPN,
@@ -16,7 +16,7 @@ import (
 
 func TestVpnInjector_AddRoute_Ok(t *testing.T) {
 	m := new(mockBgpServer)
-	injector := NewVPNv4Injector(m)
+	injector := NewVPNv4Injector(m, nil)
 
 	// Create path attribute (e.g., LOCAL_PREF)
 	localPref := &api.LocalPrefAttribute{LocalPref: 100}
@@ -97,7 +97,7 @@ func TestVpnInjector_AddRoute_Ok(t *testing.T) {
 
 func TestVpnInjector_AddRoute_InvalidRd(t *testing.T) {
 	m := new(mockBgpServer)
-	injector := NewVPNv4Injector(m)
+	injector := NewVPNv4Injector(m, nil)
 
 	// Test data with invalid RD
 	route := dto.VPNRoute{
@@ -116,7 +116,7 @@ func TestVpnInjector_AddRoute_InvalidRd(t *testing.T) {
 
 func TestVpnInjector_AddRoute_InvalidRouteTarget(t *testing.T) {
 	m := new(mockBgpServer)
-	injector := NewVPNv4Injector(m)
+	injector := NewVPNv4Injector(m, nil)
 
 	// Test data with invalid route target
 	route := dto.VPNRoute{
@@ -134,7 +134,7 @@ func TestVpnInjector_AddRoute_InvalidRouteTarget(t *testing.T) {
 
 func TestVpnInjector_AddRoute_BgpServerError(t *testing.T) {
 	m := new(mockBgpServer)
-	injector := NewVPNv4Injector(m)
+	injector := NewVPNv4Injector(m, nil)
 
 	// Test data
 	route := dto.VPNRoute{
@@ -157,7 +157,7 @@ func TestVpnInjector_AddRoute_BgpServerError(t *testing.T) {
 
 func TestVpnInjector_DelRoute_Ok(t *testing.T) {
 	m := new(mockBgpServer)
-	injector := NewVPNv4Injector(m)
+	injector := NewVPNv4Injector(m, nil)
 
 	id := uuid.New()
 	binUuid, _ := id.MarshalBinary()
@@ -213,7 +213,7 @@ func TestVpnInjector_DelRoute_Ok(t *testing.T) {
 
 func TestVpnInjector_DelRoute_Error(t *testing.T) {
 	m := new(mockBgpServer)
-	injector := NewVPNv4Injector(m)
+	injector := NewVPNv4Injector(m, nil)
 
 	id := uuid.New()
 	m.On("DeletePath", mock.Anything, mock.Anything).Return(errors.New("delete failed"))
@@ -226,8 +226,30 @@ func TestVpnInjector_DelRoute_Error(t *testing.T) {
 
 func TestNewVPNv4Injector(t *testing.T) {
 	m := new(mockBgpServer)
-	injector := NewVPNv4Injector(m)
+	injector := NewVPNv4Injector(m, nil)
 
 	require.NotNil(t, injector)
 	require.Equal(t, api.Family_AFI_IP, injector.afi)
 }
+
+func TestNewVPNv6Injector(t *testing.T) {
+	m := new(mockBgpServer)
+	injector := NewVPNv6Injector(m, nil)
+	respUuid := uuid.New()
+	m.On("AddPath", mock.Anything, mock.MatchedBy(func(req *api.AddPathRequest) bool {
+		nhAttr := &api.NextHopAttribute{}
+		if err := req.Path.Pattrs[len(req.Path.Pattrs)-1].UnmarshalTo(nhAttr); err != nil {
+			return false
+		}
+		return req.Path.Family.Afi == api.Family_AFI_IP6 && nhAttr.NextHop == "::"
+	})).Return(&api.AddPathResponse{Uuid: respUuid[:]}, nil)
+	m.On("DeletePath", mock.Anything, mock.MatchedBy(func(req *api.DeletePathRequest) bool {
+		return req.Family.Afi == api.Family_AFI_IP6
+	})).Return(nil)
+
+	id, err := injector.AddRoute(dto.VPNRoute{Rd: "65000:1", RouteTargets: []string{"65000:100"}, Prefix: "::"})
+	require.NoError(t, err)
+	require.Equal(t, respUuid, id)
+	require.NoError(t, injector.DelRoute(id))
+	m.AssertExpectations(t)
+}
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"strings"
+
+	"github.com/osrg/gobgp/v3/pkg/log"
+	"github.com/sirupsen/logrus"
+)
+
+// Routes GoBGP logs to a logrus logger. GoBGP field names, e.g. Topic or Key, are lowercased to match berg ones
+type GobgpLogger struct {
+	logger *logrus.Logger
+}
+
+func NewGobgpLogger(logger *logrus.Logger) *GobgpLogger {
+	return &GobgpLogger{logger: logger}
+}
+
+func (l *GobgpLogger) entry(fields log.Fields) *logrus.Entry {
+	converted := make(logrus.Fields, len(fields))
+	for key, value := range fields {
+		converted[strings.ToLower(strings.TrimPrefix(key, "_"))] = value
+	}
+	return l.logger.WithFields(converted)
+}
+
+func (l *GobgpLogger) Panic(msg string, fields log.Fields) {
+	l.entry(fields).Panic(msg)
+}
+
+func (l *GobgpLogger) Fatal(msg string, fields log.Fields) {
+	l.entry(fields).Fatal(msg)
+}
+
+func (l *GobgpLogger) Error(msg string, fields log.Fields) {
+	l.entry(fields).Error(msg)
+}
+
+func (l *GobgpLogger) Warn(msg string, fields log.Fields) {
+	l.entry(fields).Warn(msg)
+}
+
+func (l *GobgpLogger) Info(msg string, fields log.Fields) {
+	l.entry(fields).Info(msg)
+}
+
+func (l *GobgpLogger) Debug(msg string, fields log.Fields) {
+	l.entry(fields).Debug(msg)
+}
+
+// GoBGP and logrus levels share the values
+func (l *GobgpLogger) SetLevel(level log.LogLevel) {
+	l.logger.SetLevel(logrus.Level(level))
+}
+
+func (l *GobgpLogger) GetLevel() log.LogLevel {
+	return log.LogLevel(l.logger.GetLevel())
+}
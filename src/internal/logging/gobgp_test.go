@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/osrg/gobgp/v3/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGobgpLogger(t *testing.T) {
+	var out bytes.Buffer
+	logs := New(&out)
+	logger := NewGobgpLogger(logs.Logger(Gobgp))
+
+	logger.Debug("filtered out", log.Fields{"Topic": "Peer"})
+	assert.Empty(t, out.String())
+
+	logger.SetLevel(log.DebugLevel)
+	assert.Equal(t, log.DebugLevel, logger.GetLevel())
+	assert.Equal(t, "debug", logs.Levels()[Gobgp])
+	logger.Warn("peer down", log.Fields{"Topic": "Peer", "Key": "192.168.1.1", log.FieldFacility: "config"})
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, map[string]any{
+		"level":     "warning",
+		"msg":       "peer down",
+		"subsystem": "gobgp",
+		"topic":     "Peer",
+		"key":       "192.168.1.1",
+		"facility":  "config",
+		"time":      entry["time"],
+	}, entry)
+}
@@ -0,0 +1,167 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Subsystems with their own log level
+const (
+	App        = "app"
+	Controller = "controller"
+	Injector   = "injector"
+	Gobgp      = "gobgp"
+)
+
+var Subsystems = []string{App, Controller, Injector, Gobgp}
+
+// Formats
+const (
+	FormatJson = "json"
+	FormatText = "text"
+)
+
+// Field naming the subsystem of every entry
+const FieldSubsystem = "subsystem"
+
+// Loggers of all the subsystems, writing to the same output in the same format
+type Loggers struct {
+	lock    sync.Mutex
+	loggers map[string]*logrus.Logger
+	saved   map[string]logrus.Level // levels to restore when debug is toggled off, nil while it is off
+}
+
+// JSON format and info level until changed
+func New(out io.Writer) *Loggers {
+	l := &Loggers{loggers: make(map[string]*logrus.Logger, len(Subsystems))}
+	for _, subsystem := range Subsystems {
+		logger := logrus.New()
+		logger.SetOutput(out)
+		logger.SetFormatter(&logrus.JSONFormatter{})
+		logger.AddHook(subsystemHook(subsystem))
+		l.loggers[subsystem] = logger
+	}
+	return l
+}
+
+// Returns nil for an unknown subsystem
+func (l *Loggers) Logger(subsystem string) *logrus.Logger {
+	return l.loggers[subsystem]
+}
+
+// Not safe for concurrent use with logging, meant to be called at startup
+func (l *Loggers) SetFormat(format string) error {
+	var formatter logrus.Formatter
+	switch format {
+	case FormatJson:
+		formatter = &logrus.JSONFormatter{}
+	case FormatText:
+		formatter = &logrus.TextFormatter{FullTimestamp: true}
+	default:
+		return fmt.Errorf("unknown log format %q, expected %s or %s", format, FormatJson, FormatText)
+	}
+	for _, logger := range l.loggers {
+		logger.SetFormatter(formatter)
+	}
+	return nil
+}
+
+// Empty subsystem means all of them
+func (l *Loggers) SetLevel(subsystem, level string) error {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	if subsystem != "" && l.loggers[subsystem] == nil {
+		return fmt.Errorf("unknown log subsystem %q, expected one of %v", subsystem, Subsystems)
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for name, logger := range l.loggers {
+		if subsystem == "" || subsystem == name {
+			logger.SetLevel(parsed)
+			if l.saved != nil {
+				l.saved[name] = parsed // explicitly set level survives the debug toggle
+			}
+		}
+	}
+	return nil
+}
+
+// Applies a comma-separated list of levels, where a bare level applies to all the subsystems,
+// e.g. "info,controller=debug,gobgp=warn"
+func (l *Loggers) SetLevels(spec string) error {
+	for _, item := range strings.Split(spec, ",") {
+		subsystem, level, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found {
+			subsystem, level = "", subsystem
+		}
+		if err := l.SetLevel(subsystem, level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Current level by subsystem
+func (l *Loggers) Levels() map[string]string {
+	levels := make(map[string]string, len(l.loggers))
+	for name, logger := range l.loggers {
+		levels[name] = logger.GetLevel().String()
+	}
+	return levels
+}
+
+// Switches all the subsystems to debug level, or back to their previous levels. Returns whether debug is on
+func (l *Loggers) ToggleDebug() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.saved != nil {
+		for name, level := range l.saved {
+			l.loggers[name].SetLevel(level)
+		}
+		l.saved = nil
+		return false
+	}
+	l.saved = make(map[string]logrus.Level, len(l.loggers))
+	for name, logger := range l.loggers {
+		l.saved[name] = logger.GetLevel()
+		if logger.GetLevel() < logrus.DebugLevel {
+			logger.SetLevel(logrus.DebugLevel)
+		}
+	}
+	return true
+}
+
+// Formats levels as "subsystem=level" pairs sorted by subsystem
+func FormatLevels(levels map[string]string) string {
+	pairs := make([]string, 0, len(levels))
+	for name, level := range levels {
+		pairs = append(pairs, name+"="+level)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Drops everything, for the components created without a logger
+func Discard() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+type subsystemHook string
+
+func (h subsystemHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h subsystemHook) Fire(entry *logrus.Entry) error {
+	entry.Data[FieldSubsystem] = string(h)
+	return nil
+}
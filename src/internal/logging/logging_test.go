@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggers_SubsystemField(t *testing.T) {
+	var out bytes.Buffer
+	logs := New(&out)
+	logs.Logger(Controller).WithField("vrf", "vrf_10").Info("route injected")
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "controller", entry["subsystem"])
+	assert.Equal(t, "vrf_10", entry["vrf"])
+	assert.Equal(t, "route injected", entry["msg"])
+	assert.Nil(t, logs.Logger("bgp"))
+}
+
+func TestLoggers_SetFormat(t *testing.T) {
+	var out bytes.Buffer
+	logs := New(&out)
+	assert.NoError(t, logs.SetFormat(FormatText))
+	logs.Logger(App).Info("berg started")
+	assert.Contains(t, out.String(), `msg="berg started" subsystem=app`)
+
+	assert.ErrorContains(t, logs.SetFormat("xml"), "xml")
+}
+
+func TestLoggers_SetLevels(t *testing.T) {
+	logs := New(&bytes.Buffer{})
+	assert.NoError(t, logs.SetLevels("warn, controller=trace,gobgp=error"))
+	assert.Equal(t, map[string]string{
+		"app": "warning", "controller": "trace", "injector": "warning", "gobgp": "error",
+	}, logs.Levels())
+
+	assert.NoError(t, logs.SetLevel(Injector, "debug"))
+	assert.Equal(t, "debug", logs.Levels()[Injector])
+	assert.NoError(t, logs.SetLevel("", "info"))
+	assert.Equal(t, "app=info,controller=info,gobgp=info,injector=info", FormatLevels(logs.Levels()))
+
+	assert.ErrorContains(t, logs.SetLevel("bgp", "info"), "bgp")
+	assert.Error(t, logs.SetLevel(App, "verbose"))
+	assert.Error(t, logs.SetLevels("info,controller"))
+}
+
+func TestLoggers_ToggleDebug(t *testing.T) {
+	logs := New(&bytes.Buffer{})
+	require.NoError(t, logs.SetLevels("info,controller=trace"))
+
+	assert.True(t, logs.ToggleDebug())
+	assert.Equal(t, "app=debug,controller=trace,gobgp=debug,injector=debug", FormatLevels(logs.Levels()))
+	require.NoError(t, logs.SetLevel(Gobgp, "error"))
+
+	assert.False(t, logs.ToggleDebug())
+	assert.Equal(t, "app=info,controller=trace,gobgp=error,injector=info", FormatLevels(logs.Levels()))
+}
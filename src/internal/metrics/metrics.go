@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "berg"
+
+// Direction label values
+const (
+	DirectionToEvpn = "vpnv4_to_evpn"
+	DirectionToVpn  = "evpn_to_vpnv4"
+)
+
+// Operation label values
+const (
+	OperationInject   = "inject"
+	OperationWithdraw = "withdraw"
+)
+
+// Max-prefix limit label values
+const (
+	LimitVrf      = "vrf"
+	LimitNeighbor = "neighbor"
+)
+
+// Kinds of the reconciliation corrections
+const (
+	CorrectionMissing = "missing" // source path is not redistributed
+	CorrectionLost    = "lost"    // injected path is missing from the RIB
+	CorrectionStale   = "stale"   // source path is missing from the RIB
+	CorrectionOrphan  = "orphan"  // injected path is not tracked
+)
+
+// Registry holds all the berg metrics, it is served by Handler
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	Redistributed = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redistributed_routes_total",
+		Help:      "Routes injected by the controllers",
+	}, []string{"vrf", "direction"})
+	Withdrawn = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "withdrawn_routes_total",
+		Help:      "Redistributed routes withdrawn by the controllers",
+	}, []string{"vrf", "direction"})
+	Errors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redistribution_errors_total",
+		Help:      "Errors while redistributing or withdrawing routes",
+	}, []string{"vrf", "direction", "operation"})
+	PathLatency = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "path_handling_seconds",
+		Help:      "Time spent handling a single path update or withdrawal",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 9),
+	}, []string{"vrf", "direction"})
+	WithdrawHold = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "withdraw_hold_total",
+		Help:      "Delayed withdrawals by outcome: delayed, saved or withdrawn",
+	}, []string{"vrf", "outcome"})
+	InjectorPaths = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "injector_paths_total",
+		Help:      "Paths passed to GoBGP by the injectors",
+	}, []string{"direction", "operation"})
+	InjectorErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "injector_errors_total",
+		Help:      "Failed GoBGP calls of the injectors",
+	}, []string{"direction", "operation"})
+	ReceivedPaths = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "received_paths_total",
+		Help:      "Best path updates and withdrawals received from GoBGP",
+	}, []string{"direction"})
+	ReloadDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "config_reload_seconds",
+		Help:      "Duration of configuration reloads by outcome: success or failure",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 9),
+	}, []string{"outcome"})
+	EventsDropped = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_dropped_total",
+		Help:      "Redistribution events dropped because the sink queue was full",
+	}, []string{"sink"})
+	ReconcileRuns = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_runs_total",
+		Help:      "Reconciliation rounds by outcome: success or failure",
+	}, []string{"outcome"})
+	ReconcileCorrections = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_corrections_total",
+		Help:      "Disagreements with the GoBGP RIB fixed by the reconciliation loop",
+	}, []string{"direction", "kind"})
+	ReconcileDeferred = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_deferred_total",
+		Help:      "Corrections postponed to the next reconciliation round by the rate limit",
+	})
+	MaxPrefix = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "max_prefix_total",
+		Help:      "Max-prefix limits reached by limit: vrf or neighbor, and kind: warning or exceeded",
+	}, []string{"vrf", "limit", "kind"})
+	SpoofedGateways = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "spoofed_gateway_total",
+		Help:      "Received routes rejected because their gateway does not belong to the announcing neighbor",
+	}, []string{"vrf"})
+	AllowlistReloads = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "allowlist_reloads_total",
+		Help:      "Changed prefix allowlists loaded (success) and failed checks of the allowlist source (failure)",
+	}, []string{"outcome"})
+	EventSinkErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "event_sink_errors_total",
+		Help:      "Redistribution events the sink failed to write",
+	}, []string{"sink"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+func ObservePath(vrf string, direction string, start time.Time) {
+	PathLatency.WithLabelValues(vrf, direction).Observe(time.Since(start).Seconds())
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type StateSource interface {
+	// Number of redistributed routes by direction and VRF name
+	RedistributedRoutes() map[string]map[string]int
+	// Number of GoBGP events waiting to be handled
+	EventQueueDepth() int
+}
+
+var (
+	redistributedDesc = prometheus.NewDesc(
+		namespace+"_redistributed_routes", "Routes currently redistributed", []string{"vrf", "direction"}, nil,
+	)
+	queueDepthDesc = prometheus.NewDesc(
+		namespace+"_event_queue_depth", "GoBGP events waiting to be handled", nil, nil,
+	)
+)
+
+// Reports gauges computed from the application state on every scrape
+type stateCollector struct {
+	source StateSource
+}
+
+func NewStateCollector(source StateSource) prometheus.Collector {
+	return &stateCollector{source: source}
+}
+
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- redistributedDesc
+	ch <- queueDepthDesc
+}
+
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	for direction, vrfs := range c.source.RedistributedRoutes() {
+		for vrf, count := range vrfs {
+			ch <- prometheus.MustNewConstMetric(
+				redistributedDesc, prometheus.GaugeValue, float64(count), vrf, direction,
+			)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(c.source.EventQueueDepth()))
+}
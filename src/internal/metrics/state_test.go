@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubState struct{}
+
+func (stubState) RedistributedRoutes() map[string]map[string]int {
+	return map[string]map[string]int{
+		DirectionToEvpn: {"vrf_10": 3},
+		DirectionToVpn:  {"vrf_10": 1, "vrf_20": 2},
+	}
+}
+
+func (stubState) EventQueueDepth() int {
+	return 7
+}
+
+func TestStateCollector(t *testing.T) {
+	expected := `
+# HELP berg_event_queue_depth GoBGP events waiting to be handled
+# TYPE berg_event_queue_depth gauge
+berg_event_queue_depth 7
+# HELP berg_redistributed_routes Routes currently redistributed
+# TYPE berg_redistributed_routes gauge
+berg_redistributed_routes{direction="evpn_to_vpnv4",vrf="vrf_10"} 1
+berg_redistributed_routes{direction="evpn_to_vpnv4",vrf="vrf_20"} 2
+berg_redistributed_routes{direction="vpnv4_to_evpn",vrf="vrf_10"} 3
+`
+	err := testutil.CollectAndCompare(NewStateCollector(stubState{}), strings.NewReader(expected))
+
+	assert.NoError(t, err)
+}
@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/amyasnikov/berg"
+
+// Exporters
+const (
+	ExporterNone   = ""
+	ExporterOtlp   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Span attributes
+const (
+	AttrVrf       = attribute.Key("berg.vrf")
+	AttrPrefix    = attribute.Key("berg.prefix")
+	AttrDirection = attribute.Key("berg.direction")
+	AttrNeighbor  = attribute.Key("berg.neighbor")
+	AttrWithdraw  = attribute.Key("berg.withdraw")
+	AttrHeld      = attribute.Key("berg.withdraw_held")
+)
+
+type Config struct {
+	Exporter string
+	// OTLP gRPC collector address:port
+	Endpoint string
+	// Fraction of the paths traced, from 0 to 1
+	SampleRatio float64
+}
+
+// Spans go to the global tracer provider, which drops them until Setup is called
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Installs the global tracer provider. The returned function flushes the pending spans
+func Setup(ctx context.Context, cfg Config) (shutdown func(context.Context) error, err error) {
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOtlp:
+		exporter, err = otlptracegrpc.New(ctx,
+			otlptracegrpc.WithEndpoint(cfg.Endpoint),
+			otlptracegrpc.WithInsecure(),
+		)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "berg"))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Ends the span marking it failed if err is not nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
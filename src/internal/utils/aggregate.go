@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/amyasnikov/berg/internal/dto"
+)
+
+func ValidateAggregate(aggregate dto.Aggregate) error {
+	if _, err := ParsePrefix(aggregate.Prefix); err != nil {
+		return err
+	}
+	if aggregate.Gateway == "" {
+		return nil
+	}
+	if gateway, err := netip.ParseAddr(aggregate.Gateway); err != nil || !gateway.Is4() {
+		return fmt.Errorf("aggregate %s: invalid IPv4 gateway %q", aggregate.Prefix, aggregate.Gateway)
+	}
+	return nil
+}
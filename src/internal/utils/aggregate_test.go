@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAggregate(t *testing.T) {
+	assert.NoError(t, ValidateAggregate(dto.Aggregate{Prefix: "10.0.0.0/16", SummaryOnly: true}))
+	assert.NoError(t, ValidateAggregate(dto.Aggregate{Prefix: "10.0.0.0/16", Gateway: "192.168.0.1"}))
+	assert.ErrorContains(t, ValidateAggregate(dto.Aggregate{Prefix: "10.0.0.0"}), "invalid IPv4 prefix")
+	assert.ErrorContains(t, ValidateAggregate(dto.Aggregate{Prefix: "10.0.0.0/16", Gateway: "::1"}), "invalid IPv4 gateway")
+}
@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/amyasnikov/berg/internal/dto"
+)
+
+func ValidateDefaultOriginate(defaultOriginate dto.DefaultOriginate) error {
+	if defaultOriginate.Condition == "" {
+		return nil
+	}
+	if parsed, err := netip.ParsePrefix(defaultOriginate.Condition); err == nil && parsed.Addr().Is6() {
+		return nil // the IPv6 default route is originated
+	}
+	if _, err := ParsePrefix(defaultOriginate.Condition); err != nil {
+		return fmt.Errorf("default-originate condition: %w", err)
+	}
+	return nil
+}
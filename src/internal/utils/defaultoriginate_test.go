@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDefaultOriginate(t *testing.T) {
+	assert.NoError(t, ValidateDefaultOriginate(dto.DefaultOriginate{}))
+	assert.NoError(t, ValidateDefaultOriginate(dto.DefaultOriginate{Condition: "192.168.0.0/16"}))
+	assert.NoError(t, ValidateDefaultOriginate(dto.DefaultOriginate{Condition: "::/0"}))
+	assert.ErrorContains(t, ValidateDefaultOriginate(dto.DefaultOriginate{Condition: "192.168.0.1"}),
+		"default-originate condition: invalid IPv4 prefix")
+}
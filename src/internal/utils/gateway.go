@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/amyasnikov/berg/internal/dto"
+)
+
+// Parses the neighbor address or the dynamic-neighbor range, an address is a /32 prefix
+func NeighborPrefix(neighbor string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(neighbor); err == nil && addr.Is4() {
+		return netip.PrefixFrom(addr, 32), nil
+	}
+	prefix, err := netip.ParsePrefix(neighbor)
+	if err != nil || !prefix.Addr().Is4() {
+		return netip.Prefix{}, fmt.Errorf("invalid IPv4 neighbor address or range %q", neighbor)
+	}
+	return prefix.Masked(), nil
+}
+
+func ValidateGatewayCheck(check dto.GatewayCheck) error {
+	for _, allowed := range check.Allowed {
+		if _, err := NeighborPrefix(allowed.Neighbor); err != nil {
+			return fmt.Errorf("allowed gateways: %w", err)
+		}
+		if len(allowed.Subnets) == 0 {
+			return fmt.Errorf("allowed gateways of %s: no subnets are set", allowed.Neighbor)
+		}
+		for _, subnet := range allowed.Subnets {
+			if _, err := ParsePrefix(subnet); err != nil {
+				return fmt.Errorf("allowed gateways of %s: %w", allowed.Neighbor, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateGatewayCheck(t *testing.T) {
+	assert.NoError(t, ValidateGatewayCheck(dto.GatewayCheck{}))
+	assert.NoError(t, ValidateGatewayCheck(dto.GatewayCheck{Allowed: []dto.AllowedGateways{
+		{Neighbor: "192.168.0.10", Subnets: []string{"10.0.0.0/24"}},
+		{Neighbor: "192.168.1.0/24", Subnets: []string{"10.1.0.0/16", "10.2.0.1/32"}},
+	}}))
+	assert.ErrorContains(t, ValidateGatewayCheck(dto.GatewayCheck{Allowed: []dto.AllowedGateways{
+		{Neighbor: "vm1", Subnets: []string{"10.0.0.0/24"}},
+	}}), "invalid IPv4 neighbor")
+	assert.ErrorContains(t, ValidateGatewayCheck(dto.GatewayCheck{Allowed: []dto.AllowedGateways{
+		{Neighbor: "192.168.0.10"},
+	}}), "no subnets are set")
+	assert.ErrorContains(t, ValidateGatewayCheck(dto.GatewayCheck{Allowed: []dto.AllowedGateways{
+		{Neighbor: "192.168.0.10", Subnets: []string{"10.0.0.1"}},
+	}}), "invalid IPv4 prefix")
+}
+
+func TestNeighborPrefix(t *testing.T) {
+	prefix, err := NeighborPrefix("192.168.0.10")
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.0.10/32", prefix.String())
+	prefix, err = NeighborPrefix("192.168.0.10/24")
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.0.0/24", prefix.String())
+	_, err = NeighborPrefix("2001:db8::1")
+	assert.Error(t, err)
+}
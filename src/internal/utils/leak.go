@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/amyasnikov/berg/internal/dto"
+)
+
+func ValidateLeakRule(rule dto.LeakRule) error {
+	if rule.Vrf == "" {
+		return errors.New("leak: VRF is required")
+	}
+	switch rule.Direction {
+	case dto.LeakImport, dto.LeakExport, dto.LeakBoth:
+	default:
+		return fmt.Errorf("leak %s: invalid direction %q", rule.Vrf, rule.Direction)
+	}
+	for _, prefix := range rule.Prefixes {
+		if _, err := ParsePrefix(prefix); err != nil {
+			return fmt.Errorf("leak %s: %w", rule.Vrf, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateLeakRule(t *testing.T) {
+	assert.NoError(t, ValidateLeakRule(dto.LeakRule{Vrf: "vrf_20", Prefixes: []string{"10.0.0.0/8"}}))
+	assert.NoError(t, ValidateLeakRule(dto.LeakRule{Vrf: "vrf_20", Direction: dto.LeakBoth, Evpn: true}))
+	assert.ErrorContains(t, ValidateLeakRule(dto.LeakRule{}), "VRF is required")
+	assert.ErrorContains(t, ValidateLeakRule(dto.LeakRule{Vrf: "vrf_20", Direction: "in"}), "invalid direction")
+	assert.ErrorContains(t, ValidateLeakRule(dto.LeakRule{Vrf: "vrf_20", Prefixes: []string{"10.0.0.0"}}), "invalid IPv4 prefix")
+}
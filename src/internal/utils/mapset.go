@@ -76,3 +76,14 @@ func (ms *MapSet[K, V]) ContainsVal(key K, value V) bool {
 	}
 	return curval.Contains(value)
 }
+
+// Calls f with a copy of the values of every key until f returns false. f must not modify the MapSet
+func (ms *MapSet[K, V]) Range(f func(key K, values []V) bool) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	for key, values := range ms.ms {
+		if !f(key, values.ToSlice()) {
+			return
+		}
+	}
+}
@@ -146,3 +146,17 @@ func TestMapSetContainsVal(t *testing.T) {
 	// Test non-existent value
 	assert.False(t, ms.ContainsVal("key1", 99), "Expected ContainsVal to return false for non-existent value")
 }
+
+func TestMapSetRange(t *testing.T) {
+	ms := NewMapSet[string, int]()
+	ms.StoreMany("key1", []int{1, 2})
+	ms.Store("key2", 3)
+
+	got := map[string]int{}
+	ms.Range(func(key string, values []int) bool {
+		got[key] = len(values)
+		return true
+	})
+
+	assert.Equal(t, map[string]int{"key1": 2, "key2": 1}, got)
+}
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/amyasnikov/berg/internal/dto"
+)
+
+func ValidateMaxPrefix(maxPrefix dto.MaxPrefix) error {
+	if maxPrefix.Vrf == 0 && maxPrefix.Neighbor == 0 {
+		return errors.New("max-prefix: no limit is set")
+	}
+	if maxPrefix.Warning > 100 {
+		return fmt.Errorf("max-prefix: warning threshold %d%% is over 100%%", maxPrefix.Warning)
+	}
+	switch maxPrefix.Action {
+	case dto.MaxPrefixWarn, dto.MaxPrefixStop, dto.MaxPrefixWithdraw:
+		return nil
+	}
+	return fmt.Errorf("max-prefix: invalid action %q", maxPrefix.Action)
+}
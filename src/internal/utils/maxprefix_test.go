@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMaxPrefix(t *testing.T) {
+	assert.NoError(t, ValidateMaxPrefix(dto.MaxPrefix{Vrf: 100, Warning: 80}))
+	assert.NoError(t, ValidateMaxPrefix(dto.MaxPrefix{Neighbor: 10, Action: dto.MaxPrefixWithdraw}))
+	assert.ErrorContains(t, ValidateMaxPrefix(dto.MaxPrefix{Warning: 80}), "no limit is set")
+	assert.ErrorContains(t, ValidateMaxPrefix(dto.MaxPrefix{Vrf: 100, Warning: 120}), "is over 100%")
+	assert.ErrorContains(t, ValidateMaxPrefix(dto.MaxPrefix{Vrf: 100, Action: "drop"}), "invalid action")
+}
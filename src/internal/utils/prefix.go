@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Parses the IPv4 prefix, host bits are cleared
+func ParsePrefix(prefix string) (netip.Prefix, error) {
+	parsed, err := netip.ParsePrefix(prefix)
+	if err != nil || !parsed.Addr().Is4() {
+		return netip.Prefix{}, fmt.Errorf("invalid IPv4 prefix %q", prefix)
+	}
+	return parsed.Masked(), nil
+}
+
+// Matches prefixes like 10.0.0.0/24 against the filter, which is either a prefix or an address covered by them.
+// Empty filter matches everything
+func PrefixMatcher(filter string) (func(string) bool, error) {
+	if filter == "" {
+		return func(string) bool { return true }, nil
+	}
+	if strings.Contains(filter, "/") {
+		want, err := netip.ParsePrefix(filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix %s", filter)
+		}
+		return func(prefix string) bool {
+			got, err := netip.ParsePrefix(prefix)
+			return err == nil && got.Masked() == want.Masked()
+		}, nil
+	}
+	addr, err := netip.ParseAddr(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %s", filter)
+	}
+	return func(prefix string) bool {
+		got, err := netip.ParsePrefix(prefix)
+		return err == nil && got.Contains(addr)
+	}, nil
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixMatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		prefix  string
+		matches bool
+		wantErr bool
+	}{
+		{name: "empty filter", filter: "", prefix: "10.0.0.0/24", matches: true},
+		{name: "exact prefix", filter: "10.0.0.0/24", prefix: "10.0.0.0/24", matches: true},
+		{name: "unmasked prefix", filter: "10.0.0.1/24", prefix: "10.0.0.0/24", matches: true},
+		{name: "other prefix length", filter: "10.0.0.0/16", prefix: "10.0.0.0/24", matches: false},
+		{name: "covered address", filter: "10.0.0.5", prefix: "10.0.0.0/24", matches: true},
+		{name: "uncovered address", filter: "10.0.1.5", prefix: "10.0.0.0/24", matches: false},
+		{name: "invalid prefix", filter: "10.0.0.0/33", wantErr: true},
+		{name: "invalid address", filter: "foo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := PrefixMatcher(tt.filter)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.matches, match(tt.prefix))
+		})
+	}
+}
+
+func TestParsePrefix(t *testing.T) {
+	prefix, err := ParsePrefix("10.0.1.5/24")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.1.0/24", prefix.String())
+	_, err = ParsePrefix("10.0.1.5")
+	assert.ErrorContains(t, err, `invalid IPv4 prefix "10.0.1.5"`)
+	_, err = ParsePrefix("2001:db8::/32")
+	assert.Error(t, err)
+}
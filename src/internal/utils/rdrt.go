@@ -12,6 +12,8 @@ import (
 
 var InvalidRD = errors.New("invalid RD")
 
+var InvalidRT = errors.New("invalid route-target")
+
 func RdToString(rd *anypb.Any) (string, error) {
 	rd1 := api.RouteDistinguisherTwoOctetASN{}
 	rd2 := api.RouteDistinguisherFourOctetASN{}
@@ -91,3 +93,18 @@ func RtToApi(rtStr string) (*anypb.Any, error) {
 	}
 	return anyRT, nil
 }
+
+// Formats a route-target the same way as the route-targets of the received paths
+func RtToString(rt *anypb.Any) (string, error) {
+	rt1 := api.TwoOctetAsSpecificExtended{}
+	rt2 := api.IPv4AddressSpecificExtended{}
+	rt3 := api.FourOctetAsSpecificExtended{}
+	if err := rt.UnmarshalTo(&rt1); err == nil {
+		return fmt.Sprintf("%d:%d", rt1.Asn, rt1.LocalAdmin), nil
+	} else if err = rt.UnmarshalTo(&rt2); err == nil {
+		return fmt.Sprintf("%s:%d", rt2.Address, rt2.LocalAdmin), nil
+	} else if err = rt.UnmarshalTo(&rt3); err == nil {
+		return fmt.Sprintf("%d:%d", rt3.Asn, rt3.LocalAdmin), nil
+	}
+	return "", InvalidRT
+}
@@ -76,3 +76,21 @@ func TestRdToString(t *testing.T) {
 		})
 	}
 }
+
+func TestRtToString(t *testing.T) {
+	for _, rt := range []string{"65000:10", "192.168.1.1:20"} {
+		apiRt, err := RtToApi(rt)
+		assert.NoError(t, err)
+		result, err := RtToString(apiRt)
+		assert.NoError(t, err)
+		assert.Equal(t, rt, result)
+	}
+	fourOctet, _ := anypb.New(&api.FourOctetAsSpecificExtended{SubType: 2, Asn: 4200000000, LocalAdmin: 30})
+	result, err := RtToString(fourOctet)
+	assert.NoError(t, err)
+	assert.Equal(t, "4200000000:30", result)
+
+	invalid, _ := anypb.New(&api.Family{})
+	_, err = RtToString(invalid)
+	assert.Equal(t, InvalidRT, err)
+}
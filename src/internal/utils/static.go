@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/amyasnikov/berg/internal/dto"
+)
+
+// Parses a standard community like 65000:100
+func ParseCommunity(community string) (uint32, error) {
+	asn, value, found := strings.Cut(community, ":")
+	if !found {
+		return 0, fmt.Errorf("invalid community %q, expected <asn>:<value>", community)
+	}
+	high, err := strconv.ParseUint(asn, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid community %q: %w", community, err)
+	}
+	low, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid community %q: %w", community, err)
+	}
+	return uint32(high<<16 | low), nil
+}
+
+// Parses the IPv4 prefix of the static route, host bits are cleared
+func StaticRoutePrefix(route dto.StaticRoute) (netip.Prefix, error) {
+	return ParsePrefix(route.Prefix)
+}
+
+func ValidateStaticRoute(route dto.StaticRoute) error {
+	if _, err := StaticRoutePrefix(route); err != nil {
+		return err
+	}
+	if gateway, err := netip.ParseAddr(route.Gateway); err != nil || !gateway.Is4() {
+		return fmt.Errorf("static route %s: invalid IPv4 gateway %q", route.Prefix, route.Gateway)
+	}
+	for _, community := range route.Communities {
+		if _, err := ParseCommunity(community); err != nil {
+			return fmt.Errorf("static route %s: %w", route.Prefix, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/amyasnikov/berg/internal/dto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommunity(t *testing.T) {
+	community, err := ParseCommunity("65000:100")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(65000<<16|100), community)
+
+	for _, invalid := range []string{"65000", "70000:1", "1:70000", "a:1", ""} {
+		_, err = ParseCommunity(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestValidateStaticRoute(t *testing.T) {
+	tests := []struct {
+		name  string
+		route dto.StaticRoute
+		err   string
+	}{
+		{
+			name:  "Valid",
+			route: dto.StaticRoute{Prefix: "10.0.5.0/24", Gateway: "192.168.0.5", Communities: []string{"65000:1"}},
+		},
+		{
+			name:  "Host bits",
+			route: dto.StaticRoute{Prefix: "10.0.5.1/24", Gateway: "192.168.0.5"},
+		},
+		{
+			name:  "Invalid prefix",
+			route: dto.StaticRoute{Prefix: "10.0.5.0", Gateway: "192.168.0.5"},
+			err:   `invalid IPv4 prefix "10.0.5.0"`,
+		},
+		{
+			name:  "IPv6 prefix",
+			route: dto.StaticRoute{Prefix: "2001:db8::/64", Gateway: "192.168.0.5"},
+			err:   "invalid IPv4 prefix",
+		},
+		{
+			name:  "Invalid gateway",
+			route: dto.StaticRoute{Prefix: "10.0.5.0/24"},
+			err:   `static route 10.0.5.0/24: invalid IPv4 gateway ""`,
+		},
+		{
+			name:  "Invalid community",
+			route: dto.StaticRoute{Prefix: "10.0.5.0/24", Gateway: "192.168.0.5", Communities: []string{"no-export"}},
+			err:   `static route 10.0.5.0/24: invalid community "no-export"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateStaticRoute(tt.route)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
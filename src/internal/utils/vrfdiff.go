@@ -4,7 +4,9 @@ import (
 	"reflect"
 
 	"github.com/amyasnikov/berg/internal/dto"
+	api "github.com/osrg/gobgp/v3/api"
 	"github.com/osrg/gobgp/v3/pkg/config/oc"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
 func GetVrfDiff(old, new []oc.VrfConfig) dto.VrfDiff {
@@ -37,3 +39,63 @@ func GetVrfDiff(old, new []oc.VrfConfig) dto.VrfDiff {
 		Deleted: deleted,
 	}
 }
+
+// Resolves BothRtList into import and export route-targets, the way GoBGP does,
+// so that the configs of the same VRF compare equal no matter where they come from
+func NormalizeVrf(vrf oc.VrfConfig) oc.VrfConfig {
+	normalized := oc.VrfConfig{
+		Name:         vrf.Name,
+		Id:           vrf.Id,
+		Rd:           vrf.Rd,
+		ImportRtList: vrf.ImportRtList,
+		ExportRtList: vrf.ExportRtList,
+	}
+	if len(normalized.ImportRtList) == 0 {
+		normalized.ImportRtList = vrf.BothRtList
+	}
+	if len(normalized.ExportRtList) == 0 {
+		normalized.ExportRtList = vrf.BothRtList
+	}
+	if len(normalized.ImportRtList) == 0 {
+		normalized.ImportRtList = nil
+	}
+	if len(normalized.ExportRtList) == 0 {
+		normalized.ExportRtList = nil
+	}
+	return normalized
+}
+
+// Normalized config of a VRF listed by GoBGP
+func VrfFromApi(vrf *api.Vrf) (oc.VrfConfig, error) {
+	rd, err := RdToString(vrf.GetRd())
+	if err != nil {
+		return oc.VrfConfig{}, err
+	}
+	importRts, err := rtsToString(vrf.GetImportRt())
+	if err != nil {
+		return oc.VrfConfig{}, err
+	}
+	exportRts, err := rtsToString(vrf.GetExportRt())
+	if err != nil {
+		return oc.VrfConfig{}, err
+	}
+	return NormalizeVrf(oc.VrfConfig{
+		Name:         vrf.GetName(),
+		Id:           vrf.GetId(),
+		Rd:           rd,
+		ImportRtList: importRts,
+		ExportRtList: exportRts,
+	}), nil
+}
+
+func rtsToString(rts []*anypb.Any) ([]string, error) {
+	result := make([]string, 0, len(rts))
+	for _, rt := range rts {
+		rtString, err := RtToString(rt)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, rtString)
+	}
+	return result, nil
+}
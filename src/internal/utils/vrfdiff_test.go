@@ -3,8 +3,10 @@ package utils
 import (
 	"testing"
 
+	api "github.com/osrg/gobgp/v3/api"
 	"github.com/osrg/gobgp/v3/pkg/config/oc"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
 func TestGetVrfDiff_EmptyInputs(t *testing.T) {
@@ -176,3 +178,37 @@ func TestGetVrfDiff_MixedScenario(t *testing.T) {
 	assert.Contains(t, deletedIds, uint32(3)) // deleted vrf3
 	assert.Contains(t, deletedIds, uint32(4)) // deleted vrf4
 }
+
+func TestNormalizeVrf(t *testing.T) {
+	both := oc.VrfConfig{Name: "vrf1", Id: 1, Rd: "65000:1", BothRtList: []string{"65000:1"}}
+	split := oc.VrfConfig{
+		Name: "vrf1", Id: 1, Rd: "65000:1", ImportRtList: []string{"65000:1"}, ExportRtList: []string{"65000:1"},
+	}
+
+	assert.Equal(t, split, NormalizeVrf(both))
+	assert.Equal(t, split, NormalizeVrf(split))
+
+	withImport := both
+	withImport.ImportRtList = []string{"65000:100"}
+	assert.Equal(t, []string{"65000:100"}, NormalizeVrf(withImport).ImportRtList)
+	assert.Equal(t, []string{"65000:1"}, NormalizeVrf(withImport).ExportRtList)
+	assert.Equal(t, NormalizeVrf(oc.VrfConfig{Id: 1}), NormalizeVrf(oc.VrfConfig{Id: 1, ImportRtList: []string{}}))
+}
+
+func TestVrfFromApi(t *testing.T) {
+	rd, _ := RdToApi("65000:1")
+	importRt, _ := RtToApi("65000:1")
+	exportRt, _ := RtToApi("65000:2")
+
+	vrf, err := VrfFromApi(&api.Vrf{
+		Name: "vrf1", Id: 1, Rd: rd, ImportRt: []*anypb.Any{importRt}, ExportRt: []*anypb.Any{exportRt},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, oc.VrfConfig{
+		Name: "vrf1", Id: 1, Rd: "65000:1", ImportRtList: []string{"65000:1"}, ExportRtList: []string{"65000:2"},
+	}, vrf)
+
+	_, err = VrfFromApi(&api.Vrf{Name: "vrf1", Id: 1})
+	assert.Error(t, err)
+}